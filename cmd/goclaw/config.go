@@ -2,36 +2,188 @@ package main
 
 import (
 	"fmt"
+	"net"
 	"os"
+	"strings"
 	"time"
+
+	"github.com/rvald/goclaw/internal/netutil"
+	"github.com/rvald/goclaw/internal/pairing"
 )
 
 const version = "0.1.0"
 
+// Set at build time via -ldflags "-X main.commit=... -X main.buildDate=...".
+var (
+	commit    = "unknown"
+	buildDate = "unknown"
+)
+
 // Config holds runtime configuration (used by server command)
 type Config struct {
-	Port         int
-	Bind         string
-	AuthToken    string
-	DiscordToken string
-	GuildID      string
-	TickInterval time.Duration
-	StateDir     string
+	Port            int
+	Bind            string
+	BindAddr        string   // exact listen IP; overrides Bind
+	AuthTokens      []string // any one authenticates; several allow rotation
+	TokenFile       string   // file holding AuthTokens; exclusive with them
+	AdminTokens     []string // also grant operators the scopes they claim
+	DiscordToken    string
+	GuildID         string
+	DiscordAdmins   []string      // Discord user/role IDs allowed to run privileged commands
+	DiscordNotify   string        // channel ID for pending-request notifications
+	DiscordCooldown time.Duration // per-user wait between device commands; 0 disables
+	DiscordCleanup  bool          // delete registered slash commands on shutdown
+	DiscordEvents   string        // channel ID for batched gateway events
+	PairingWebhook  string        // optional URL POSTed on each new pending request
+	MDNSName        string        // mDNS instance name; empty means OS hostname
+	MDNSDisplayName string        // TXT displayName; empty means MDNSName
+	LogLevel        string        // debug, info, warn or error
+	LogFormat       string        // console log format: text, json or empty for auto
+	LogMaxSize      int           // MB before the log file rotates; 0 = lumberjack default (100)
+	LogMaxBackups   int           // rotated log files kept; 0 = all
+	LogMaxAge       int           // days rotated log files are kept; 0 = forever
+	LogCompress     bool          // gzip rotated log files
+	AllowedOrigins  []string
+	AllowCIDRs      []string
+	DenyCIDRs       []string
+	Compression     bool          // negotiate permessage-deflate with clients
+	IdleTimeout     time.Duration // close connections silent this long; 0 disables
+	MaxInvokes      int           // per-node concurrent invokes; 0 = unlimited
+	MaxDeviceConns  int           // per-device concurrent connections; 0 = unlimited
+	ReconnectGrace  time.Duration // keep a dropped node's invokes for its reconnect; 0 disables
+	StaticMapURL    string        // /locate map image URL template; empty disables
+	StaticMapKey    string        // substituted for {key} in StaticMapURL
+	InvokeTimeout   time.Duration // Discord device command timeout; 0 = built-in defaults
+	InvokeTimeouts  []string      // per-command overrides as command=duration
+	ServerKey       string        // path to the challenge-signing key; empty disables
+	NodeScopes      []string      // granted to nodes that request no scopes
+	AutoApprove     string        // pairing auto-approve policy; see pairing.ParseAutoApprovePolicy
+	AllowTokenless  bool          // admit paired devices whose device token could not be issued
+	TickInterval    time.Duration
+	TickStats       bool // include connected node count in tick events
+	StateDir        string
+	StrictPerms     bool // refuse loose state permissions instead of fixing them
 }
 
-func validateConfig(cfg Config) error {
+// validateConfig checks cfg and fills cfg.AuthTokens from cfg.TokenFile.
+func validateConfig(cfg *Config) error {
+	if cfg.TokenFile != "" {
+		if len(cfg.AuthTokens) > 0 {
+			return fmt.Errorf("--token and --token-file are mutually exclusive")
+		}
+		tokens, err := readTokenFile(cfg.TokenFile)
+		if err != nil {
+			return err
+		}
+		cfg.AuthTokens = tokens
+	}
 	if cfg.Port <= 0 || cfg.Port > 65535 {
 		return fmt.Errorf("invalid port: %d (must be 1-65535)", cfg.Port)
 	}
 	if cfg.Bind != "loopback" && cfg.Bind != "lan" {
 		return fmt.Errorf("invalid bind mode: %q (must be \"loopback\" or \"lan\")", cfg.Bind)
 	}
-	if cfg.Bind == "lan" && cfg.AuthToken == "" {
-		return fmt.Errorf("refusing to start: --bind lan requires --token to prevent unauthenticated access")
+	if cfg.Bind == "lan" && len(cfg.AuthTokens) == 0 {
+		return fmt.Errorf("refusing to start: --bind lan requires --token or --token-file to prevent unauthenticated access")
+	}
+	if cfg.BindAddr != "" {
+		ip := net.ParseIP(cfg.BindAddr)
+		if ip == nil {
+			return fmt.Errorf("invalid --bind-addr: %q (must be an IP address)", cfg.BindAddr)
+		}
+		if !ip.IsLoopback() && len(cfg.AuthTokens) == 0 {
+			return fmt.Errorf("refusing to start: --bind-addr %s is not loopback and requires --token or --token-file to prevent unauthenticated access", cfg.BindAddr)
+		}
+	}
+	if cfg.DiscordCooldown < 0 {
+		return fmt.Errorf("invalid --discord-cooldown: %s (must be >= 0)", cfg.DiscordCooldown)
+	}
+	if cfg.TickInterval < 0 {
+		return fmt.Errorf("invalid --tick-interval: %s (must be >= 0)", cfg.TickInterval)
+	}
+	if cfg.IdleTimeout < 0 {
+		return fmt.Errorf("invalid --idle-timeout: %s (must be >= 0)", cfg.IdleTimeout)
+	}
+	if cfg.LogMaxSize < 0 {
+		return fmt.Errorf("invalid --log-max-size: %d (must be >= 0)", cfg.LogMaxSize)
+	}
+	if cfg.LogMaxBackups < 0 {
+		return fmt.Errorf("invalid --log-max-backups: %d (must be >= 0)", cfg.LogMaxBackups)
+	}
+	if cfg.LogMaxAge < 0 {
+		return fmt.Errorf("invalid --log-max-age: %d (must be >= 0)", cfg.LogMaxAge)
+	}
+	if cfg.MaxInvokes < 0 {
+		return fmt.Errorf("invalid --max-invokes-per-node: %d (must be >= 0)", cfg.MaxInvokes)
+	}
+	if cfg.MaxDeviceConns < 0 {
+		return fmt.Errorf("invalid --max-conns-per-device: %d (must be >= 0)", cfg.MaxDeviceConns)
+	}
+	if cfg.ReconnectGrace < 0 {
+		return fmt.Errorf("invalid --reconnect-grace: %s (must be >= 0)", cfg.ReconnectGrace)
+	}
+	if cfg.InvokeTimeout < 0 {
+		return fmt.Errorf("invalid --invoke-timeout: %s (must be >= 0)", cfg.InvokeTimeout)
+	}
+	if _, err := parseInvokeTimeouts(cfg.InvokeTimeouts); err != nil {
+		return fmt.Errorf("--invoke-timeouts: %w", err)
+	}
+	if _, err := netutil.ParseCIDRs(cfg.AllowCIDRs); err != nil {
+		return fmt.Errorf("--allow-cidr: %w", err)
+	}
+	if _, err := netutil.ParseCIDRs(cfg.DenyCIDRs); err != nil {
+		return fmt.Errorf("--deny-cidr: %w", err)
+	}
+	if _, err := pairing.ParseAutoApprovePolicy(cfg.AutoApprove); err != nil {
+		return fmt.Errorf("--auto-approve: %w", err)
 	}
 	return nil
 }
 
+// parseInvokeTimeouts parses command=duration pairs, such as
+// "camera.snap=1m", into timeouts in milliseconds keyed by command.
+func parseInvokeTimeouts(specs []string) (map[string]int, error) {
+	timeouts := make(map[string]int, len(specs))
+	for _, spec := range specs {
+		command, value, ok := strings.Cut(spec, "=")
+		if !ok || command == "" {
+			return nil, fmt.Errorf("%q is not command=duration", spec)
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("%q: invalid duration %q", spec, value)
+		}
+		timeouts[command] = int(d.Milliseconds())
+	}
+	return timeouts, nil
+}
+
+// readTokenFile returns the auth tokens stored one per line at path, which
+// must not be accessible to group or others.
+func readTokenFile(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("--token-file: %w", err)
+	}
+	if perm := info.Mode().Perm(); perm&0077 != 0 {
+		return nil, fmt.Errorf("--token-file %s has mode %04o; restrict it with chmod 600", path, perm)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("--token-file: %w", err)
+	}
+	var tokens []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			tokens = append(tokens, line)
+		}
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("--token-file %s is empty", path)
+	}
+	return tokens, nil
+}
+
 // Env helpers
 func envStr(key, fallback string) string {
 	if v := os.Getenv(key); v != "" {
@@ -40,6 +192,45 @@ func envStr(key, fallback string) string {
 	return fallback
 }
 
+// envSecret returns a secret-valued environment variable as a list of at
+// most one, without splitting it on commas the secret may contain.
+func envSecret(key string) []string {
+	if v := os.Getenv(key); v != "" {
+		return []string{v}
+	}
+	return nil
+}
+
+// envTokens returns the gateway auth tokens from the environment:
+// GOCLAW_TOKEN, taken whole, then the comma-separated GOCLAW_TOKENS used
+// to accept several during rotation.
+func envTokens() []string {
+	return append(envSecret("GOCLAW_TOKEN"), envList("GOCLAW_TOKENS")...)
+}
+
+// envList splits a comma-separated environment variable.
+func envList(key string) []string {
+	v := os.Getenv(key)
+	if v == "" {
+		return nil
+	}
+	var out []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	d, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return d
+}
+
 func envInt(key string, fallback int) int {
 	v := os.Getenv(key)
 	if v == "" {
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateConfig_CIDRs(t *testing.T) {
+	base := Config{Port: 18789, Bind: "loopback"}
+
+	tests := []struct {
+		name    string
+		allow   []string
+		deny    []string
+		wantErr string
+	}{
+		{name: "valid", allow: []string{"192.168.1.0/24"}, deny: []string{"192.168.1.66"}},
+		{name: "malformed allow", allow: []string{"192.168.1.0/40"}, wantErr: "--allow-cidr"},
+		{name: "malformed deny", deny: []string{"lan"}, wantErr: "--deny-cidr"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := base
+			cfg.AllowCIDRs, cfg.DenyCIDRs = tt.allow, tt.deny
+			err := validateConfig(&cfg)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want mention of %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateConfig_BindAddr(t *testing.T) {
+	tests := []struct {
+		name    string
+		addr    string
+		tokens  []string
+		wantErr string
+	}{
+		{name: "loopback alias", addr: "127.0.0.2"},
+		{name: "ipv6 loopback", addr: "::1"},
+		{name: "lan with token", addr: "192.168.1.10", tokens: []string{"s3cret"}},
+		{name: "lan without token", addr: "192.168.1.10", wantErr: "requires --token"},
+		{name: "not an ip", addr: "eth0", wantErr: "--bind-addr"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Config{Port: 18789, Bind: "loopback", BindAddr: tt.addr, AuthTokens: tt.tokens}
+			err := validateConfig(&cfg)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want mention of %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateConfig_LogRotation(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutate  func(*Config)
+		wantErr string
+	}{
+		{name: "defaults", mutate: func(*Config) {}},
+		{name: "zeros keep everything", mutate: func(c *Config) { c.LogMaxSize, c.LogMaxBackups, c.LogMaxAge = 0, 0, 0 }},
+		{name: "negative size", mutate: func(c *Config) { c.LogMaxSize = -1 }, wantErr: "--log-max-size"},
+		{name: "negative backups", mutate: func(c *Config) { c.LogMaxBackups = -1 }, wantErr: "--log-max-backups"},
+		{name: "negative age", mutate: func(c *Config) { c.LogMaxAge = -1 }, wantErr: "--log-max-age"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Config{Port: 18789, Bind: "loopback", LogMaxSize: 10, LogMaxBackups: 3, LogMaxAge: 28}
+			tt.mutate(&cfg)
+			err := validateConfig(&cfg)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want mention of %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateConfig_TokenFile(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string, mode os.FileMode) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), mode); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(path, mode); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	t.Run("reads and trims", func(t *testing.T) {
+		cfg := Config{Port: 18789, Bind: "lan", TokenFile: write("ok", "  s3cret\n", 0600)}
+		if err := validateConfig(&cfg); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(cfg.AuthTokens) != 1 || cfg.AuthTokens[0] != "s3cret" {
+			t.Fatalf("AuthTokens = %q, want [s3cret]", cfg.AuthTokens)
+		}
+	})
+
+	t.Run("one token per line", func(t *testing.T) {
+		cfg := Config{Port: 18789, Bind: "loopback", TokenFile: write("multi", "old\n\nnew\n", 0600)}
+		if err := validateConfig(&cfg); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(cfg.AuthTokens) != 2 || cfg.AuthTokens[0] != "old" || cfg.AuthTokens[1] != "new" {
+			t.Fatalf("AuthTokens = %q, want [old new]", cfg.AuthTokens)
+		}
+	})
+
+	t.Run("both set", func(t *testing.T) {
+		cfg := Config{Port: 18789, Bind: "loopback", AuthTokens: []string{"x"}, TokenFile: write("both", "y", 0600)}
+		err := validateConfig(&cfg)
+		if err == nil || !strings.Contains(err.Error(), "mutually exclusive") {
+			t.Fatalf("err = %v, want mutually exclusive", err)
+		}
+	})
+
+	t.Run("world readable", func(t *testing.T) {
+		cfg := Config{Port: 18789, Bind: "loopback", TokenFile: write("loose", "y", 0644)}
+		err := validateConfig(&cfg)
+		if err == nil || !strings.Contains(err.Error(), "chmod 600") {
+			t.Fatalf("err = %v, want permission error", err)
+		}
+	})
+}
+
+func TestEnvTokens(t *testing.T) {
+	t.Setenv("GOCLAW_TOKEN", "s3cret,with,commas")
+	t.Setenv("GOCLAW_TOKENS", "old, new")
+
+	got := envTokens()
+	if len(got) != 3 || got[0] != "s3cret,with,commas" || got[1] != "old" || got[2] != "new" {
+		t.Fatalf("envTokens() = %q, want [s3cret,with,commas old new]", got)
+	}
+}
+
+func TestParseInvokeTimeouts(t *testing.T) {
+	got, err := parseInvokeTimeouts([]string{"camera.snap=1m", "location.get=2500ms"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got["camera.snap"] != 60000 || got["location.get"] != 2500 || len(got) != 2 {
+		t.Fatalf("timeouts = %v", got)
+	}
+
+	for _, bad := range []string{"camera.snap", "=1s", "camera.snap=soon", "camera.snap=-1s"} {
+		if _, err := parseInvokeTimeouts([]string{bad}); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+}
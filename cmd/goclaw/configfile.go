@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// flagEnv maps each flag a config file may set to the environment
+// variables, comma-separated, that override it ("" for none), since the
+// flag defaults already include them.
+var flagEnv = map[string]string{
+	"state-dir":               "",
+	"strict-perms":            "GOCLAW_STRICT_PERMS",
+	"port":                    "GOCLAW_PORT",
+	"bind":                    "GOCLAW_BIND",
+	"bind-addr":               "GOCLAW_BIND_ADDR",
+	"token":                   "GOCLAW_TOKEN,GOCLAW_TOKENS",
+	"token-file":              "GOCLAW_TOKEN_FILE",
+	"admin-token":             "GOCLAW_ADMIN_TOKEN",
+	"discord-token":           "DISCORD_BOT_TOKEN",
+	"guild-id":                "DISCORD_GUILD_ID",
+	"discord-admins":          "GOCLAW_DISCORD_ADMINS",
+	"discord-notify-channel":  "GOCLAW_DISCORD_NOTIFY_CHANNEL",
+	"discord-cooldown":        "GOCLAW_DISCORD_COOLDOWN",
+	"discord-cleanup":         "GOCLAW_DISCORD_CLEANUP",
+	"discord-events-channel":  "GOCLAW_DISCORD_EVENTS_CHANNEL",
+	"pairing-webhook":         "GOCLAW_PAIRING_WEBHOOK",
+	"mdns-name":               "GOCLAW_MDNS_NAME",
+	"mdns-display-name":       "GOCLAW_MDNS_DISPLAY_NAME",
+	"log-level":               "GOCLAW_LOG_LEVEL",
+	"log-format":              "GOCLAW_LOG_FORMAT",
+	"log-max-size":            "GOCLAW_LOG_MAX_SIZE",
+	"log-max-backups":         "GOCLAW_LOG_MAX_BACKUPS",
+	"log-max-age":             "GOCLAW_LOG_MAX_AGE",
+	"log-compress":            "GOCLAW_LOG_COMPRESS",
+	"allowed-origins":         "GOCLAW_ALLOWED_ORIGINS",
+	"allow-cidr":              "GOCLAW_ALLOW_CIDR",
+	"deny-cidr":               "GOCLAW_DENY_CIDR",
+	"compression":             "GOCLAW_COMPRESSION",
+	"idle-timeout":            "GOCLAW_IDLE_TIMEOUT",
+	"tick-interval":           "GOCLAW_TICK_INTERVAL",
+	"tick-stats":              "GOCLAW_TICK_STATS",
+	"static-map-url":          "GOCLAW_STATIC_MAP_URL",
+	"static-map-key":          "GOCLAW_STATIC_MAP_KEY",
+	"invoke-timeout":          "GOCLAW_INVOKE_TIMEOUT",
+	"invoke-timeouts":         "GOCLAW_INVOKE_TIMEOUTS",
+	"max-invokes-per-node":    "GOCLAW_MAX_INVOKES_PER_NODE",
+	"max-conns-per-device":    "GOCLAW_MAX_CONNS_PER_DEVICE",
+	"reconnect-grace":         "GOCLAW_RECONNECT_GRACE",
+	"node-default-scopes":     "GOCLAW_NODE_DEFAULT_SCOPES",
+	"auto-approve":            "GOCLAW_AUTO_APPROVE",
+	"allow-tokenless-devices": "GOCLAW_ALLOW_TOKENLESS_DEVICES",
+	"server-key":              "GOCLAW_SERVER_KEY",
+}
+
+// loadConfigFile applies the YAML file at path to flags. Keys are flag
+// names; a key is ignored when its flag was given on the command line or
+// its environment variable is set, so flags > env > file > defaults.
+// Unknown keys are an error.
+func loadConfigFile(path string, flags *pflag.FlagSet) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("--config: %w", err)
+	}
+	var values map[string]any
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("--config %s: %w", path, err)
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		env, known := flagEnv[key]
+		f := flags.Lookup(key)
+		if !known || f == nil {
+			return fmt.Errorf("--config %s: unknown key %q", path, key)
+		}
+		if f.Changed || envSet(env) {
+			continue
+		}
+		if err := setConfigValue(f, values[key]); err != nil {
+			return fmt.Errorf("--config %s: %s: %w", path, key, err)
+		}
+	}
+	return nil
+}
+
+// setConfigValue applies a YAML value to f. String array flags do not
+// split on commas, so each list item is set on its own.
+func setConfigValue(f *pflag.Flag, v any) error {
+	list, ok := v.([]any)
+	if !ok || f.Value.Type() != "stringArray" {
+		return f.Value.Set(configValue(v))
+	}
+	for _, item := range list {
+		if err := f.Value.Set(fmt.Sprint(item)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// envSet reports whether any of the comma-separated environment
+// variables in envs is set.
+func envSet(envs string) bool {
+	for _, env := range strings.Split(envs, ",") {
+		if env != "" && os.Getenv(env) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// configValue renders a YAML value as flag text; lists become the
+// comma-separated form slice flags accept.
+func configValue(v any) string {
+	list, ok := v.([]any)
+	if !ok {
+		return fmt.Sprint(v)
+	}
+	items := make([]string, len(list))
+	for i, item := range list {
+		items[i] = fmt.Sprint(item)
+	}
+	return strings.Join(items, ",")
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+func TestLoadConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "goclaw.yaml")
+	content := `port: 19000
+bind: lan
+token: [old, new]
+tick-interval: 30s
+mdns-name: from-file
+`
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GOCLAW_MDNS_NAME", "from-env")
+
+	var (
+		port         int
+		bind, mdns   string
+		tokens       []string
+		tickInterval time.Duration
+	)
+	flags := pflag.NewFlagSet("server", pflag.ContinueOnError)
+	flags.IntVar(&port, "port", 18789, "")
+	flags.StringVar(&bind, "bind", "loopback", "")
+	flags.StringSliceVar(&tokens, "token", nil, "")
+	flags.DurationVar(&tickInterval, "tick-interval", 15*time.Second, "")
+	flags.StringVar(&mdns, "mdns-name", "from-env", "")
+	if err := flags.Parse([]string{"--bind", "loopback"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := loadConfigFile(path, flags); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if port != 19000 {
+		t.Errorf("port = %d, want 19000 from the file", port)
+	}
+	if bind != "loopback" {
+		t.Errorf("bind = %q, want the flag's loopback", bind)
+	}
+	if len(tokens) != 2 || tokens[0] != "old" || tokens[1] != "new" {
+		t.Errorf("tokens = %q, want [old new]", tokens)
+	}
+	if tickInterval != 30*time.Second {
+		t.Errorf("tick-interval = %s, want 30s", tickInterval)
+	}
+	if mdns != "from-env" {
+		t.Errorf("mdns-name = %q, want the environment's value", mdns)
+	}
+}
+
+func TestLoadConfigFile_TokensFromEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "goclaw.yaml")
+	if err := os.WriteFile(path, []byte("token: from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GOCLAW_TOKENS", "old,new")
+
+	var tokens []string
+	flags := pflag.NewFlagSet("server", pflag.ContinueOnError)
+	flags.StringSliceVar(&tokens, "token", envTokens(), "")
+
+	if err := loadConfigFile(path, flags); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(tokens) != 2 || tokens[0] != "old" || tokens[1] != "new" {
+		t.Errorf("tokens = %q, want the environment's [old new]", tokens)
+	}
+}
+
+func TestLoadConfigFile_AdminTokenList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "goclaw.yaml")
+	if err := os.WriteFile(path, []byte("admin-token: [aaa, bbb]\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var tokens []string
+	flags := pflag.NewFlagSet("server", pflag.ContinueOnError)
+	flags.StringArrayVar(&tokens, "admin-token", nil, "")
+
+	if err := loadConfigFile(path, flags); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(tokens) != 2 || tokens[0] != "aaa" || tokens[1] != "bbb" {
+		t.Errorf("admin tokens = %q, want [aaa bbb]", tokens)
+	}
+}
+
+func TestLoadConfigFile_UnknownKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "goclaw.yaml")
+	if err := os.WriteFile(path, []byte("prot: 19000\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	flags := pflag.NewFlagSet("server", pflag.ContinueOnError)
+	flags.Int("port", 18789, "")
+
+	err := loadConfigFile(path, flags)
+	if err == nil || !strings.Contains(err.Error(), `unknown key "prot"`) {
+		t.Fatalf("err = %v, want unknown key", err)
+	}
+}
+
+// TestFlagEnv_CoversServerFlags keeps flagEnv in step with the server
+// flags, so every flag can be set from a config file.
+func TestFlagEnv_CoversServerFlags(t *testing.T) {
+	serverCmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if f.Name == "config" {
+			return
+		}
+		if _, ok := flagEnv[f.Name]; !ok {
+			t.Errorf("flag --%s is missing from flagEnv", f.Name)
+		}
+	})
+}
@@ -1,11 +1,20 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"net"
+	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/hashicorp/mdns"
+	"github.com/rvald/goclaw/internal/discovery"
+	"github.com/rvald/goclaw/internal/gateway"
 	"github.com/spf13/cobra"
 )
 
@@ -28,6 +37,10 @@ var debugDiscoveryCmd = &cobra.Command{
 		}
 		fmt.Println()
 
+		if debugBrowse {
+			return browseGateways(cmd.Context(), debugBrowseTimeout)
+		}
+
 		// 2. Start advertising
 		fmt.Println("Starting mDNS advertisement on port 18789...")
 		fmt.Println("Service: _openclaw-gw._tcp")
@@ -61,9 +74,108 @@ var debugDiscoveryCmd = &cobra.Command{
 	},
 }
 
+var (
+	debugBrowse        bool
+	debugBrowseTimeout time.Duration
+
+	recentAddr   string
+	recentToken  string
+	recentOutput string
+)
+
+var debugRecentCmd = &cobra.Command{
+	Use:   "recent",
+	Short: "Show a running gateway's recent activity",
+	Long:  "Fetch /recent from a running gateway: the last connects, disconnects, invokes and pairing requests, oldest first.",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if recentOutput != "text" && recentOutput != "json" {
+			return fmt.Errorf("invalid --output: %q (must be \"text\" or \"json\")", recentOutput)
+		}
+		cmd.SilenceUsage = true
+		return runRecent(cmd.OutOrStdout(), recentAddr, recentToken, recentOutput == "json")
+	},
+}
+
 func init() {
 	rootCmd.AddCommand(debugCmd)
 	debugCmd.AddCommand(debugDiscoveryCmd)
+	debugCmd.AddCommand(debugRecentCmd)
+
+	debugRecentCmd.Flags().StringVar(&recentAddr, "addr", envStr("GOCLAW_HEALTH_ADDR", "http://127.0.0.1:18789"), "Gateway base URL")
+	debugRecentCmd.Flags().StringVar(&recentToken, "token", envStr("GOCLAW_ADMIN_TOKEN", envStr("GOCLAW_TOKEN", "")), "Gateway admin token, or the auth token when the gateway has no admin tokens (not needed on loopback when it has neither)")
+	debugRecentCmd.Flags().StringVarP(&recentOutput, "output", "o", "text", "Output format: text or json (the raw /recent body)")
+
+	debugDiscoveryCmd.Flags().BoolVar(&debugBrowse, "browse", false, "List gateways on the LAN instead of advertising")
+	debugDiscoveryCmd.Flags().DurationVar(&debugBrowseTimeout, "timeout", 3*time.Second, "How long to wait for answers in --browse mode")
+}
+
+// runRecent fetches addr's /recent and writes one line per event, or the
+// raw body when raw is set.
+func runRecent(w io.Writer, addr, token string, raw bool) error {
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(addr, "/")+"/recent", nil)
+	if err != nil {
+		return fmt.Errorf("recent: %w", err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("recent: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("recent: read body: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("recent: HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	if raw {
+		_, err := w.Write(body)
+		return err
+	}
+	var recent struct {
+		Events []gateway.RecentEvent `json:"events"`
+	}
+	if err := json.Unmarshal(body, &recent); err != nil {
+		return fmt.Errorf("recent: unparseable body: %w", err)
+	}
+	if len(recent.Events) == 0 {
+		fmt.Fprintln(w, "No recent events.")
+		return nil
+	}
+	for _, ev := range recent.Events {
+		fmt.Fprintf(w, "%s  %-10s  %-20s  %s\n", time.UnixMilli(ev.TimeMs).Format(time.TimeOnly), ev.Kind, ev.NodeID, ev.Detail)
+	}
+	return nil
+}
+
+// browseGateways prints the gateways that answer an mDNS query.
+func browseGateways(ctx context.Context, timeout time.Duration) error {
+	fmt.Printf("Browsing for %s (%s)...\n", discovery.ServiceType, timeout)
+	found, err := discovery.Browse(ctx, timeout)
+	if err != nil {
+		return err
+	}
+	if len(found) == 0 {
+		fmt.Println("No gateways found.")
+		return nil
+	}
+
+	fmt.Printf("%-24s  %-21s  %-8s  %-8s  %s\n", "NAME", "ADDRESS", "ROLE", "VERSION", "PROTOCOL")
+	for _, gw := range found {
+		host := gw.Host
+		if gw.Addr != nil {
+			host = gw.Addr.String()
+		}
+		addr := net.JoinHostPort(host, strconv.Itoa(gw.Port))
+		fmt.Printf("%-24s  %-21s  %-8s  %-8s  %d\n", gw.Name, addr, gw.Role, gw.Version, gw.Protocol)
+	}
+	return nil
 }
 
 var debugCmd = &cobra.Command{
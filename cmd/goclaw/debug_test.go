@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRunRecent(t *testing.T) {
+	body := `{"events":[{"ts":1700000000000,"kind":"connect","connId":"c1","nodeId":"iphone-1","detail":"node via token auth"}]}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/recent" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	var buf bytes.Buffer
+	if err := runRecent(&buf, srv.URL, "secret", false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, want := range []string{"connect", "iphone-1", "node via token auth"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, buf.String())
+		}
+	}
+
+	buf.Reset()
+	if err := runRecent(&buf, srv.URL+"/", "secret", true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if buf.String() != body {
+		t.Errorf("raw output = %q, want %q", buf.String(), body)
+	}
+
+	err := runRecent(&buf, srv.URL, "wrong", false)
+	if err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("wrong token: err = %v, want HTTP 401", err)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rvald/goclaw/internal/gateway"
+	"github.com/spf13/cobra"
+)
+
+var (
+	healthAddr   string
+	healthOutput string
+)
+
+var healthCmd = &cobra.Command{
+	Use:   "health",
+	Short: "Check a running gateway's health",
+	Long:  "Fetch /health from a running gateway and summarize it. Exits non-zero unless the status is ok.",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if healthOutput != "text" && healthOutput != "json" {
+			return fmt.Errorf("invalid --output: %q (must be \"text\" or \"json\")", healthOutput)
+		}
+		cmd.SilenceUsage = true
+		return runHealth(cmd.OutOrStdout(), healthAddr, healthOutput == "json")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(healthCmd)
+
+	healthCmd.Flags().StringVar(&healthAddr, "addr", envStr("GOCLAW_HEALTH_ADDR", "http://127.0.0.1:18789"), "Gateway base URL")
+	healthCmd.Flags().StringVarP(&healthOutput, "output", "o", "text", "Output format: text or json (the raw /health body)")
+}
+
+// runHealth fetches addr's /health and writes a summary, or the raw body
+// when raw is set. It fails when the gateway is unreachable or its status
+// is not ok.
+func runHealth(w io.Writer, addr string, raw bool) error {
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(strings.TrimSuffix(addr, "/") + "/health")
+	if err != nil {
+		return fmt.Errorf("health check: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("health check: read body: %w", err)
+	}
+
+	var health gateway.HealthResponse
+	if err := json.Unmarshal(body, &health); err != nil {
+		return fmt.Errorf("health check: HTTP %d with unparseable body: %w", resp.StatusCode, err)
+	}
+
+	if raw {
+		w.Write(body)
+	} else {
+		printHealth(w, health)
+	}
+	if health.Status != "ok" {
+		return fmt.Errorf("gateway status: %s", health.Status)
+	}
+	return nil
+}
+
+func printHealth(w io.Writer, h gateway.HealthResponse) {
+	fmt.Fprintf(w, "status:     %s\n", h.Status)
+	if h.Version != "" {
+		fmt.Fprintf(w, "version:    %s\n", h.Version)
+	}
+	if h.Nodes != nil {
+		fmt.Fprintf(w, "nodes:      %d\n", *h.Nodes)
+	}
+	names := make([]string, 0, len(h.Components))
+	for name := range h.Components {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		state := "inactive"
+		if h.Components[name] {
+			state = "active"
+		}
+		fmt.Fprintf(w, "%-11s %s\n", name+":", state)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRunHealth(t *testing.T) {
+	body := `{"status":"ok","version":"1.2.3","goVersion":"go1.24","nodes":2,"components":{"discord":true,"mdns":false}}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	var buf bytes.Buffer
+	if err := runHealth(&buf, srv.URL, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{"status:     ok", "version:    1.2.3", "nodes:      2", "discord:    active", "mdns:       inactive"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+
+	buf.Reset()
+	if err := runHealth(&buf, srv.URL+"/", true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if buf.String() != body {
+		t.Errorf("raw output = %q, want %q", buf.String(), body)
+	}
+}
+
+func TestRunHealth_NotOK(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"status":"draining","goVersion":"go1.24"}`))
+	}))
+	defer srv.Close()
+
+	var buf bytes.Buffer
+	err := runHealth(&buf, srv.URL, false)
+	if err == nil || !strings.Contains(err.Error(), "draining") {
+		t.Fatalf("err = %v, want draining status error", err)
+	}
+	if !strings.Contains(buf.String(), "status:     draining") {
+		t.Errorf("summary not printed:\n%s", buf.String())
+	}
+}
+
+func TestRunHealth_Unreachable(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+	if err := runHealth(&bytes.Buffer{}, srv.URL, false); err == nil {
+		t.Fatal("expected an error for an unreachable gateway")
+	}
+}
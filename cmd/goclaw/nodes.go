@@ -1,8 +1,14 @@
 package main
 
 import (
+	"bufio"
 	"fmt"
+	"io"
+	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
 	"time"
 
 	"github.com/rvald/goclaw/internal/pairing"
@@ -34,7 +40,7 @@ var nodesPendingCmd = &cobra.Command{
 		now := time.Now().UnixMilli()
 		for _, req := range pending {
 			age := time.Duration((now - req.Timestamp) * int64(time.Millisecond)).Round(time.Second)
-			fmt.Printf("%-36s  %-20s  %-15s  %s\n", req.RequestID, req.DisplayName, req.RemoteIP, age)
+			fmt.Printf("%-36s  %-20s  %-15s  %s\n", req.RequestID, termSafe(req.DisplayName), req.RemoteIP, age)
 		}
 		return nil
 	},
@@ -61,11 +67,85 @@ var nodesApproveCmd = &cobra.Command{
 		}
 
 		fmt.Printf("Approved request %s\n", reqID)
-		fmt.Printf("Device paired: %s (%s)\n", device.DisplayName, device.DeviceID)
+		fmt.Printf("Device paired: %s (%s)\n", termSafe(device.DisplayName), device.DeviceID)
 		return nil
 	},
 }
 
+var (
+	approveAllPlatform string
+	approveAllSince    time.Duration
+	approveAllYes      bool
+)
+
+var nodesApproveAllCmd = &cobra.Command{
+	Use:   "approve-all",
+	Short: "Approve every pending pairing request matching the filters",
+	Long: `Approve every pending pairing request matching --platform and --since, for
+enrolling a fleet at once. Each approved device gets full access, so the matching
+requests are listed and confirmed first unless --yes is given; only the listed
+requests are approved. Repair requests (a known device ID with a new key) and
+requests for a role other than node or for operator scopes are never
+bulk-approved; approve them one by one.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := openPairingStore()
+		if err != nil {
+			return err
+		}
+		filter := pairing.PendingFilter{Platform: approveAllPlatform, Since: approveAllSince}
+		return approveAll(cmd.InOrStdin(), cmd.OutOrStdout(), pairing.NewService(store), store, filter, approveAllYes, time.Now())
+	},
+}
+
+// approveAll approves the pending requests in store matching filter,
+// asking on in for confirmation unless yes is set.
+func approveAll(in io.Reader, w io.Writer, svc *pairing.Service, store *pairing.Store, filter pairing.PendingFilter, yes bool, now time.Time) error {
+	matched := filter.Select(store.ListPending(), now)
+	if len(matched) == 0 {
+		fmt.Fprintln(w, "No matching pending requests.")
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "REQUEST ID\tDEVICE NAME\tPLATFORM\tIP\tAGE")
+	for _, req := range matched {
+		age := now.Sub(time.UnixMilli(req.Timestamp)).Round(time.Second)
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", req.RequestID, termSafe(req.DisplayName), termSafe(req.Platform), req.RemoteIP, age)
+	}
+	tw.Flush()
+
+	if !yes {
+		fmt.Fprintf(w, "Approve %d request(s)? [y/N] ", len(matched))
+		answer, _ := bufio.NewReader(in).ReadString('\n')
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "y", "yes":
+		default:
+			fmt.Fprintln(w, "Aborted.")
+			return nil
+		}
+	}
+
+	failed := 0
+	for _, req := range matched {
+		device, err := svc.Approve(req.RequestID)
+		if err == nil && device == nil {
+			err = fmt.Errorf("request no longer pending")
+		}
+		if err != nil {
+			failed++
+			fmt.Fprintf(w, "Failed %s: %v\n", req.RequestID, err)
+			continue
+		}
+		fmt.Fprintf(w, "Approved %s: %s (%s)\n", req.RequestID, termSafe(device.DisplayName), device.DeviceID)
+	}
+	fmt.Fprintf(w, "Approved %d of %d request(s)\n", len(matched)-failed, len(matched))
+	if failed > 0 {
+		return fmt.Errorf("%d approval(s) failed", failed)
+	}
+	return nil
+}
+
 var nodesRejectCmd = &cobra.Command{
 	Use:   "reject [request-id]",
 	Short: "Reject a pending pairing request",
@@ -86,11 +166,57 @@ var nodesRejectCmd = &cobra.Command{
 			return fmt.Errorf("request not found: %s", reqID)
 		}
 
-		fmt.Printf("Rejected request %s from %s\n", reqID, removed.DisplayName)
+		fmt.Printf("Rejected request %s from %s\n", reqID, termSafe(removed.DisplayName))
 		return nil
 	},
 }
 
+var nodesRenameCmd = &cobra.Command{
+	Use:   "rename [device-id] [name]",
+	Short: "Set the display name of a paired device",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := openPairingStore()
+		if err != nil {
+			return err
+		}
+		svc := pairing.NewService(store)
+
+		if err := svc.RenameDevice(args[0], args[1]); err != nil {
+			return fmt.Errorf("rename failed: %w", err)
+		}
+
+		fmt.Printf("Renamed device %s to %q\n", args[0], strings.TrimSpace(args[1]))
+		return nil
+	},
+}
+
+var nodesTagCmd = &cobra.Command{
+	Use:   "tag [device-id] [tags...]",
+	Short: "Replace the tags of a paired device (no tags clears them)",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := openPairingStore()
+		if err != nil {
+			return err
+		}
+
+		if err := store.SetDeviceTags(args[0], args[1:]); err != nil {
+			return fmt.Errorf("tag failed: %w", err)
+		}
+
+		tags := store.GetPairedDevice(args[0]).Tags
+		if len(tags) == 0 {
+			fmt.Printf("Cleared tags of device %s\n", args[0])
+			return nil
+		}
+		fmt.Printf("Tagged device %s: %s\n", args[0], strings.Join(tags, ", "))
+		return nil
+	},
+}
+
+var statusTag string
+
 var nodesStatusCmd = &cobra.Command{
 	Use:   "status",
 	Short: "List paired devices",
@@ -99,18 +225,152 @@ var nodesStatusCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
+		listPaired(cmd.OutOrStdout(), store, statusTag, time.Now())
+		return nil
+	},
+}
+
+// listPaired prints the paired devices, only those tagged tag unless tag
+// is empty.
+func listPaired(w io.Writer, store *pairing.Store, tag string, now time.Time) {
+	paired := store.ListPaired()
+	if tag != "" {
+		paired = store.GetByTag(tag)
+	}
+	if len(paired) == 0 {
+		if tag != "" {
+			fmt.Fprintf(w, "No paired devices tagged %q.\n", tag)
+			return
+		}
+		fmt.Fprintln(w, "No paired devices.")
+		return
+	}
+
+	fmt.Fprintf(w, "%-36s  %-20s  %-15s  %-23s  %-19s  %-24s  %s\n", "DEVICE ID", "NAME", "PLATFORM", "KEY", "APPROVED", "USAGE", "TAGS")
+	for _, dev := range paired {
+		approved := time.UnixMilli(dev.ApprovedAtMs).Format(time.DateTime)
+		fmt.Fprintf(w, "%-36s  %-20s  %-15s  %-23s  %-19s  %-24s  %s\n", dev.DeviceID, termSafe(dev.DisplayName), termSafe(dev.Platform),
+			pairing.KeyFingerprint(dev.PublicKey), approved, dev.UsageSummary(now), strings.Join(dev.Tags, ","))
+	}
+}
+
+var nodesShowCmd = &cobra.Command{
+	Use:   "show [request-id|device-id]",
+	Short: "Show full details of a pending request or paired device",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := openPairingStore()
+		if err != nil {
+			return err
+		}
+		return showPairingEntry(cmd.OutOrStdout(), store, args[0], time.Now())
+	},
+}
 
-		paired := store.ListPaired()
-		if len(paired) == 0 {
-			fmt.Println("No paired devices.")
-			return nil
+// showPairingEntry prints the pending request with ID id or, failing that,
+// the paired device with that ID.
+func showPairingEntry(w io.Writer, store *pairing.Store, id string, now time.Time) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	row := func(label, value string) {
+		if value == "" {
+			value = "-"
 		}
+		fmt.Fprintf(tw, "%s:\t%s\n", label, termSafe(value))
+	}
+	age := func(ms int64) string {
+		return time.Duration((now.UnixMilli() - ms) * int64(time.Millisecond)).Round(time.Second).String()
+	}
+
+	if req := store.GetPendingRequest(id); req != nil {
+		row("Pending request", req.RequestID)
+		row("Device ID", req.DeviceID)
+		row("Key fingerprint", pairing.KeyFingerprint(req.PublicKey))
+		row("Name", req.DisplayName)
+		row("Platform", req.Platform)
+		row("Client", pairing.ClientLabel(req.ClientID, req.ClientMode))
+		row("Role", req.Role)
+		row("Scopes", strings.Join(req.Scopes, ","))
+		row("Remote IP", req.RemoteIP)
+		row("Repair", fmt.Sprintf("%t", req.IsRepair))
+		row("Age", age(req.Timestamp))
+		return tw.Flush()
+	}
+	if dev := store.GetPairedDevice(id); dev != nil {
+		row("Paired device", dev.DeviceID)
+		row("Key fingerprint", pairing.KeyFingerprint(dev.PublicKey))
+		row("Previous keys", fmt.Sprintf("%d", max(len(dev.PublicKeys)-1, 0)))
+		row("Name", dev.DisplayName)
+		row("Platform", dev.Platform)
+		row("Client", pairing.ClientLabel(dev.ClientID, dev.ClientMode))
+		row("Role", dev.Role)
+		row("Scopes", strings.Join(dev.Scopes, ","))
+		row("Remote IP", dev.RemoteIP)
+		row("Tags", strings.Join(dev.Tags, ","))
+		row("Approved", fmt.Sprintf("%s (%s ago)", time.UnixMilli(dev.ApprovedAtMs).Format(time.DateTime), age(dev.ApprovedAtMs)))
+		row("Usage", dev.UsageSummary(now))
+		return tw.Flush()
+	}
+	return fmt.Errorf("no pending request or paired device with ID %s", id)
+}
+
+var (
+	exportOut   string
+	importMerge bool
+)
 
-		fmt.Printf("%-36s  %-20s  %-15s  %s\n", "DEVICE ID", "NAME", "PLATFORM", "APPROVED")
-		for _, dev := range paired {
-			approved := time.UnixMilli(dev.ApprovedAtMs).Format(time.DateTime)
-			fmt.Printf("%-36s  %-20s  %-15s  %s\n", dev.DeviceID, dev.DisplayName, dev.Platform, approved)
+var nodesExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export pairing state (pending requests, devices and tokens) as JSON",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := openPairingStore()
+		if err != nil {
+			return err
 		}
+
+		data, err := store.Export()
+		if err != nil {
+			return err
+		}
+		if exportOut == "" {
+			_, err := fmt.Fprintln(cmd.OutOrStdout(), string(data))
+			return err
+		}
+		// The export holds device tokens; keep it private.
+		if err := os.WriteFile(exportOut, data, 0600); err != nil {
+			return fmt.Errorf("write export: %w", err)
+		}
+		if err := os.Chmod(exportOut, 0600); err != nil {
+			return fmt.Errorf("chmod export: %w", err)
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Exported %d paired devices and %d pending requests to %s\n",
+			len(store.ListPaired()), len(store.ListPending()), exportOut)
+		return nil
+	},
+}
+
+var nodesImportCmd = &cobra.Command{
+	Use:   "import [file]",
+	Short: "Import pairing state written by 'nodes export'",
+	Long: `Import pairing state written by 'nodes export'. By default the current state
+is replaced; with --merge imported devices are added, overwriting any with the same ID.
+A running server picks up the change on SIGHUP.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		data, err := os.ReadFile(args[0])
+		if err != nil {
+			return fmt.Errorf("read import: %w", err)
+		}
+		store, err := openPairingStore()
+		if err != nil {
+			return err
+		}
+
+		if err := store.Import(data, importMerge); err != nil {
+			return fmt.Errorf("import failed: %w", err)
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Imported %s: %d paired devices, %d pending requests\n",
+			args[0], len(store.ListPaired()), len(store.ListPending()))
 		return nil
 	},
 }
@@ -119,16 +379,50 @@ func init() {
 	rootCmd.AddCommand(nodesCmd)
 	nodesCmd.AddCommand(nodesPendingCmd)
 	nodesCmd.AddCommand(nodesApproveCmd)
+	nodesCmd.AddCommand(nodesApproveAllCmd)
 	nodesCmd.AddCommand(nodesRejectCmd)
+	nodesCmd.AddCommand(nodesRenameCmd)
+	nodesCmd.AddCommand(nodesTagCmd)
 	nodesCmd.AddCommand(nodesStatusCmd)
+	nodesCmd.AddCommand(nodesShowCmd)
+	nodesCmd.AddCommand(nodesWatchCmd)
+	nodesCmd.AddCommand(nodesExportCmd)
+	nodesCmd.AddCommand(nodesImportCmd)
+
+	nodesApproveAllCmd.Flags().StringVar(&approveAllPlatform, "platform", "", "Only approve requests from this platform, e.g. ios")
+	nodesApproveAllCmd.Flags().DurationVar(&approveAllSince, "since", 0, "Only approve requests received within this long, e.g. 10m")
+	nodesApproveAllCmd.Flags().BoolVarP(&approveAllYes, "yes", "y", false, "Approve without asking for confirmation")
+	nodesStatusCmd.Flags().StringVar(&statusTag, "tag", "", "Only list devices with this tag")
+	nodesExportCmd.Flags().StringVar(&exportOut, "out", "", "Write the export to this file (mode 0600) instead of stdout")
+	nodesImportCmd.Flags().BoolVar(&importMerge, "merge", false, "Merge with existing state instead of replacing it")
 }
 
 func openPairingStore() (*pairing.Store, error) {
 	// Root flags are parsed before Run, so cfgStateDir is populated
 	path := filepath.Join(cfgStateDir, "pairing")
-	store, err := pairing.NewStore(path)
+	store, err := newPairingStore(path, cfgStrictPerms)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open pairing store at %s: %w", path, err)
 	}
 	return store, nil
 }
+
+// newPairingStore opens the store at path, rejecting loose permissions
+// when strict is set and tightening them otherwise.
+func newPairingStore(path string, strict bool) (*pairing.Store, error) {
+	if strict {
+		return pairing.NewStrictStore(path)
+	}
+	return pairing.NewStore(path)
+}
+
+// termSafe escapes the non-printable runes in s, such as ANSI and OSC
+// escape sequences in a client-supplied display name, so printing it
+// cannot drive the operator's terminal.
+func termSafe(s string) string {
+	if !strings.ContainsFunc(s, func(r rune) bool { return !strconv.IsPrint(r) }) {
+		return s
+	}
+	q := strconv.Quote(s)
+	return q[1 : len(q)-1]
+}
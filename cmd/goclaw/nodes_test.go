@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rvald/goclaw/internal/pairing"
+)
+
+func TestShowPairingEntry(t *testing.T) {
+	store, err := pairing.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	key := base64.RawURLEncoding.EncodeToString(make([]byte, 32))
+	deviceID := pairing.DeriveDeviceID(key)
+	now := time.Now()
+
+	if err := store.AddPending(pairing.PendingRequest{
+		RequestID:   "req-0123456789",
+		DeviceID:    deviceID,
+		PublicKey:   key,
+		DisplayName: "Kitchen iPhone",
+		Platform:    "ios",
+		ClientID:    "iphone-1",
+		ClientMode:  "node",
+		Role:        "node",
+		Scopes:      []string{"camera", "location"},
+		RemoteIP:    "192.168.1.20",
+		IsRepair:    true,
+		Timestamp:   now.Add(-90 * time.Second).UnixMilli(),
+	}); err != nil {
+		t.Fatalf("AddPending: %v", err)
+	}
+	if err := store.SetPaired(pairing.PairedDevice{
+		DeviceID:     deviceID,
+		PublicKey:    key,
+		DisplayName:  "Kitchen iPhone",
+		Platform:     "ios",
+		Role:         "node",
+		RemoteIP:     "192.168.1.20",
+		Tags:         []string{"kitchen", "lobby"},
+		ApprovedAtMs: now.Add(-time.Hour).UnixMilli(),
+	}); err != nil {
+		t.Fatalf("SetPaired: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		id   string
+		want []string
+	}{
+		{
+			name: "pending request",
+			id:   "req-0123456789",
+			want: []string{
+				"Pending request:", "req-0123456789",
+				deviceID,
+				"66:68:7a:ad:f8:62:bd:77",
+				"iphone-1 (node)",
+				"camera,location",
+				"192.168.1.20",
+				"Repair:", "true",
+				"1m30s",
+			},
+		},
+		{
+			name: "paired device",
+			id:   deviceID,
+			want: []string{
+				"Paired device:", deviceID,
+				"66:68:7a:ad:f8:62:bd:77",
+				"Kitchen iPhone",
+				"kitchen,lobby",
+				"(1h0m0s ago)",
+				"never used",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := showPairingEntry(&buf, store, tt.id, now); err != nil {
+				t.Fatalf("showPairingEntry: %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(buf.String(), want) {
+					t.Errorf("output missing %q:\n%s", want, buf.String())
+				}
+			}
+		})
+	}
+
+	t.Run("not found", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := showPairingEntry(&buf, store, "nope", now)
+		if err == nil || !strings.Contains(err.Error(), "nope") {
+			t.Fatalf("showPairingEntry(nope) = %v, want not-found error", err)
+		}
+		if buf.Len() != 0 {
+			t.Errorf("unexpected output: %q", buf.String())
+		}
+	})
+}
+
+func TestApproveAll(t *testing.T) {
+	now := time.Now()
+	ids := make(map[string]string) // request ID → device ID
+	newStore := func(t *testing.T) *pairing.Store {
+		t.Helper()
+		store, err := pairing.NewStore(t.TempDir())
+		if err != nil {
+			t.Fatalf("NewStore: %v", err)
+		}
+		for i, req := range []pairing.PendingRequest{
+			{RequestID: "req-ios-new", Platform: "ios", Timestamp: now.Add(-time.Minute).UnixMilli()},
+			{RequestID: "req-ios-old", Platform: "ios", Timestamp: now.Add(-2 * time.Hour).UnixMilli()},
+			{RequestID: "req-android", Platform: "android", Timestamp: now.Add(-time.Minute).UnixMilli()},
+			{RequestID: "req-ios-repair", Platform: "ios", Timestamp: now.Add(-time.Minute).UnixMilli(), IsRepair: true},
+			{RequestID: "req-ios-operator", Platform: "ios", Role: "operator", Scopes: []string{"operator.admin"}, Timestamp: now.Add(-time.Minute).UnixMilli()},
+		} {
+			raw := make([]byte, 32)
+			raw[0] = byte(i + 1)
+			req.PublicKey = base64.RawURLEncoding.EncodeToString(raw)
+			req.DeviceID = pairing.DeriveDeviceID(req.PublicKey)
+			ids[req.RequestID] = req.DeviceID
+			if err := store.AddPending(req); err != nil {
+				t.Fatalf("AddPending: %v", err)
+			}
+		}
+		return store
+	}
+	pendingIDs := func(store *pairing.Store) map[string]bool {
+		ids := make(map[string]bool)
+		for _, req := range store.ListPending() {
+			ids[req.RequestID] = true
+		}
+		return ids
+	}
+
+	t.Run("filters exclude some requests", func(t *testing.T) {
+		store := newStore(t)
+		var out bytes.Buffer
+		filter := pairing.PendingFilter{Platform: "ios", Since: time.Hour}
+		if err := approveAll(strings.NewReader("y\n"), &out, pairing.NewService(store), store, filter, false, now); err != nil {
+			t.Fatalf("approveAll: %v\n%s", err, out.String())
+		}
+		if !strings.Contains(out.String(), "Approved 1 of 1 request(s)") {
+			t.Errorf("output:\n%s", out.String())
+		}
+		if store.GetPairedDevice(ids["req-ios-new"]) == nil {
+			t.Error("req-ios-new was not approved")
+		}
+		left := pendingIDs(store)
+		for _, id := range []string{"req-ios-old", "req-android", "req-ios-repair", "req-ios-operator"} {
+			if !left[id] {
+				t.Errorf("%s should still be pending", id)
+			}
+		}
+	})
+
+	t.Run("declined prompt approves nothing", func(t *testing.T) {
+		store := newStore(t)
+		var out bytes.Buffer
+		if err := approveAll(strings.NewReader("n\n"), &out, pairing.NewService(store), store, pairing.PendingFilter{}, false, now); err != nil {
+			t.Fatalf("approveAll: %v\n%s", err, out.String())
+		}
+		if !strings.Contains(out.String(), "Approve 3 request(s)? [y/N]") || !strings.Contains(out.String(), "Aborted.") {
+			t.Errorf("output:\n%s", out.String())
+		}
+		if n := len(store.ListPaired()); n != 0 {
+			t.Errorf("%d devices paired after declining", n)
+		}
+	})
+
+	t.Run("yes skips the prompt", func(t *testing.T) {
+		store := newStore(t)
+		var out bytes.Buffer
+		if err := approveAll(strings.NewReader(""), &out, pairing.NewService(store), store, pairing.PendingFilter{}, true, now); err != nil {
+			t.Fatalf("approveAll: %v\n%s", err, out.String())
+		}
+		if strings.Contains(out.String(), "[y/N]") {
+			t.Errorf("prompted despite --yes:\n%s", out.String())
+		}
+		if left := pendingIDs(store); len(left) != 2 || !left["req-ios-repair"] || !left["req-ios-operator"] {
+			t.Errorf("pending after approve-all = %v, want only the repair and operator requests", left)
+		}
+	})
+}
+
+func TestListPaired_TagFilter(t *testing.T) {
+	store, err := pairing.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	now := time.Now()
+	for i, name := range []string{"Lobby iPad", "Dock Pixel"} {
+		if err := store.SetPaired(pairing.PairedDevice{
+			DeviceID:     fmt.Sprintf("dev-%d", i),
+			DisplayName:  name,
+			ApprovedAtMs: now.UnixMilli(),
+		}); err != nil {
+			t.Fatalf("SetPaired: %v", err)
+		}
+	}
+	if err := store.SetDeviceTags("dev-0", []string{"lobby", "floor-1"}); err != nil {
+		t.Fatalf("SetDeviceTags: %v", err)
+	}
+
+	var buf bytes.Buffer
+	listPaired(&buf, store, "", now)
+	if !strings.Contains(buf.String(), "Dock Pixel") || !strings.Contains(buf.String(), "floor-1,lobby") {
+		t.Errorf("unfiltered listing missing a device or tags:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	listPaired(&buf, store, "Lobby", now)
+	if !strings.Contains(buf.String(), "Lobby iPad") || strings.Contains(buf.String(), "Dock Pixel") {
+		t.Errorf("listing tagged lobby:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	listPaired(&buf, store, "dock", now)
+	if got := buf.String(); got != "No paired devices tagged \"dock\".\n" {
+		t.Errorf("listing tagged dock = %q", got)
+	}
+}
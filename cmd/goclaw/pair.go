@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/rvald/goclaw/internal/pairing"
+	"github.com/rvald/goclaw/internal/qrcode"
+	"github.com/spf13/cobra"
+)
+
+var (
+	pairQRAddr  string
+	pairQRPort  int
+	pairQRToken string
+)
+
+var pairCmd = &cobra.Command{
+	Use:   "pair",
+	Short: "Out-of-band device enrollment",
+}
+
+var pairQRCmd = &cobra.Command{
+	Use:   "qr",
+	Short: "Print an enrollment QR code for a new device",
+	Long: `Print a QR code that a node app can scan to learn the gateway address
+and auth token. The payload expires after ten minutes.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		addr := pairQRAddr
+		if addr == "" {
+			host := lanIPv4()
+			if host == "" {
+				return fmt.Errorf("no LAN address found; pass --addr")
+			}
+			addr = net.JoinHostPort(host, strconv.Itoa(pairQRPort))
+		}
+
+		payload, err := pairing.BuildEnrollmentQR(addr, pairQRToken)
+		if err != nil {
+			return err
+		}
+		code, err := qrcode.Encode([]byte(payload))
+		if err != nil {
+			return fmt.Errorf("encode QR: %w", err)
+		}
+
+		fmt.Print(code.String())
+		fmt.Println()
+		fmt.Println(payload)
+		fmt.Printf("Expires in %s\n", pairing.EnrollmentTTL)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(pairCmd)
+	pairCmd.AddCommand(pairQRCmd)
+
+	pairQRCmd.Flags().StringVar(&pairQRAddr, "addr", "", "Gateway address (host:port or ws:// URL); defaults to the first LAN IPv4")
+	pairQRCmd.Flags().IntVar(&pairQRPort, "port", envInt("GOCLAW_PORT", 18789), "Gateway port used with the detected LAN address")
+	pairQRCmd.Flags().StringVar(&pairQRToken, "token", envStr("GOCLAW_TOKEN", ""), "Gateway auth token to embed")
+}
+
+// lanIPv4 returns the first non-loopback IPv4 address of an up interface.
+func lanIPv4() string {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return ""
+	}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, _ := iface.Addrs()
+		for _, a := range addrs {
+			ipnet, ok := a.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			if ip4 := ipnet.IP.To4(); ip4 != nil && !ip4.IsLinkLocalUnicast() {
+				return ip4.String()
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/rvald/goclaw/internal/logger"
+	"github.com/rvald/goclaw/internal/pairing"
+)
+
+// logLevelFile, when present in the state dir, overrides --log-level on
+// SIGHUP, e.g. `echo debug > $STATE_DIR/log-level && kill -HUP <pid>`.
+const logLevelFile = "log-level"
+
+// watchReload reloads runtime state on each SIGHUP until ctx is done.
+func watchReload(ctx context.Context, cfg Config, store *pairing.Store) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(hup)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				reload(cfg, store)
+			}
+		}
+	}()
+}
+
+// reload re-reads pairing state (picking up CLI approvals made while the
+// server runs) and the log level.
+func reload(cfg Config, store *pairing.Store) {
+	slog.Info("SIGHUP received, reloading")
+	if err := store.Reload(); err != nil {
+		slog.Error("pairing state reload failed", "error", err)
+	} else {
+		slog.Info("pairing state reloaded", "paired", len(store.ListPaired()), "pending", len(store.ListPending()))
+	}
+
+	name := cfg.LogLevel
+	if data, err := os.ReadFile(filepath.Join(cfg.StateDir, logLevelFile)); err == nil {
+		name = strings.TrimSpace(string(data))
+	}
+	lvl, err := logger.ParseLevel(name)
+	if err != nil {
+		slog.Error("log level not changed", "error", err)
+		return
+	}
+	logger.SetLevel(lvl)
+	slog.Info("log level set", "level", lvl.String())
+}
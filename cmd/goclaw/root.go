@@ -4,21 +4,59 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/spf13/cobra"
 )
 
 var (
 	// Persistent flags
-	cfgStateDir string
+	cfgStateDir    string
+	cfgStrictPerms bool
 	
 	// Server flags (now persistent or specific to server cmd, 
 	// but often useful to have global config)
-	cfgPort         int
-	cfgBind         string
-	cfgAuthToken    string
-	cfgDiscordToken string
-	cfgGuildID      string
+	cfgPort            int
+	cfgBind            string
+	cfgBindAddr        string
+	cfgAuthTokens      []string
+	cfgTokenFile       string
+	cfgAdminTokens     []string
+	cfgDiscordToken    string
+	cfgGuildID         string
+	cfgDiscordAdmins   []string
+	cfgDiscordNotify   string
+	cfgDiscordCooldown time.Duration
+	cfgDiscordCleanup  bool
+	cfgDiscordEvents   string
+	cfgPairingWebhook  string
+	cfgMDNSName        string
+	cfgMDNSDisplayName string
+	cfgLogLevel        string
+	cfgLogFormat       string
+	cfgLogMaxSize      int
+	cfgLogMaxBackups   int
+	cfgLogMaxAge       int
+	cfgLogCompress     bool
+	cfgAllowedOrigins  []string
+	cfgAllowCIDRs      []string
+	cfgDenyCIDRs       []string
+	cfgCompression     bool
+	cfgIdleTimeout     time.Duration
+	cfgTickInterval    time.Duration
+	cfgTickStats       bool
+	cfgConfigFile      string
+	cfgMaxInvokes      int
+	cfgMaxDeviceConns  int
+	cfgReconnectGrace  time.Duration
+	cfgStaticMapURL    string
+	cfgStaticMapKey    string
+	cfgInvokeTimeout   time.Duration
+	cfgInvokeTimeouts  []string
+	cfgServerKey       string
+	cfgNodeScopes      []string
+	cfgAutoApprove     string
+	cfgAllowTokenless  bool
 )
 
 var rootCmd = &cobra.Command{
@@ -30,6 +68,7 @@ var rootCmd = &cobra.Command{
 func init() {
 	// Global flags
 	rootCmd.PersistentFlags().StringVar(&cfgStateDir, "state-dir", defaultStateDir(), "Directory for persistent state")
+	rootCmd.PersistentFlags().BoolVar(&cfgStrictPerms, "strict-perms", os.Getenv("GOCLAW_STRICT_PERMS") == "1", "Refuse to start if state files are readable by others instead of fixing them")
 	
 	// Server-specific flags (can be global if other commands need them, 
 	// but ideally 'nodes' command only needs state-dir)
@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"crypto/ed25519"
+	"encoding/base64"
 	"fmt"
 	"log/slog"
 	"os"
@@ -14,7 +16,10 @@ import (
 	"github.com/rvald/goclaw/internal/discovery"
 	"github.com/rvald/goclaw/internal/gateway"
 	"github.com/rvald/goclaw/internal/logger"
+	"github.com/rvald/goclaw/internal/netutil"
+	"github.com/rvald/goclaw/internal/node"
 	"github.com/rvald/goclaw/internal/pairing"
+	"github.com/rvald/goclaw/internal/protocol"
 	"github.com/spf13/cobra"
 )
 
@@ -22,23 +27,79 @@ var serverCmd = &cobra.Command{
 	Use:   "server",
 	Short: "Start the gateway server",
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if cfgConfigFile != "" {
+			if err := loadConfigFile(cfgConfigFile, cmd.Flags()); err != nil {
+				return err
+			}
+		}
+
 		// Setup config from flags
 		cfg := Config{
-			Port:         cfgPort,
-			Bind:         cfgBind,
-			AuthToken:    cfgAuthToken,
-			DiscordToken: cfgDiscordToken,
-			GuildID:      cfgGuildID,
-			StateDir:     cfgStateDir,
-			TickInterval: 15 * time.Second,
+			Port:            cfgPort,
+			Bind:            cfgBind,
+			BindAddr:        cfgBindAddr,
+			AuthTokens:      cfgAuthTokens,
+			TokenFile:       cfgTokenFile,
+			AdminTokens:     cfgAdminTokens,
+			DiscordToken:    cfgDiscordToken,
+			GuildID:         cfgGuildID,
+			DiscordAdmins:   cfgDiscordAdmins,
+			DiscordNotify:   cfgDiscordNotify,
+			DiscordCooldown: cfgDiscordCooldown,
+			DiscordCleanup:  cfgDiscordCleanup,
+			DiscordEvents:   cfgDiscordEvents,
+			PairingWebhook:  cfgPairingWebhook,
+			MDNSName:        cfgMDNSName,
+			MDNSDisplayName: cfgMDNSDisplayName,
+			LogLevel:        cfgLogLevel,
+			LogFormat:       cfgLogFormat,
+			LogMaxSize:      cfgLogMaxSize,
+			LogMaxBackups:   cfgLogMaxBackups,
+			LogMaxAge:       cfgLogMaxAge,
+			LogCompress:     cfgLogCompress,
+			AllowedOrigins:  cfgAllowedOrigins,
+			AllowCIDRs:      cfgAllowCIDRs,
+			DenyCIDRs:       cfgDenyCIDRs,
+			Compression:     cfgCompression,
+			IdleTimeout:     cfgIdleTimeout,
+			MaxInvokes:      cfgMaxInvokes,
+			MaxDeviceConns:  cfgMaxDeviceConns,
+			ReconnectGrace:  cfgReconnectGrace,
+			StaticMapURL:    cfgStaticMapURL,
+			StaticMapKey:    cfgStaticMapKey,
+			InvokeTimeout:   cfgInvokeTimeout,
+			InvokeTimeouts:  cfgInvokeTimeouts,
+			ServerKey:       cfgServerKey,
+			NodeScopes:      cfgNodeScopes,
+			AutoApprove:     cfgAutoApprove,
+			AllowTokenless:  cfgAllowTokenless,
+			StateDir:        cfgStateDir,
+			StrictPerms:     cfgStrictPerms,
+			TickInterval:    cfgTickInterval,
+			TickStats:       cfgTickStats,
 		}
 
-		if err := validateConfig(cfg); err != nil {
+		if err := validateConfig(&cfg); err != nil {
 			return err
 		}
 
 		// Configure logging
-		logger.Setup(cfg.StateDir)
+		level, err := logger.ParseLevel(cfg.LogLevel)
+		if err != nil {
+			return err
+		}
+		format, err := logger.ParseFormat(cfg.LogFormat)
+		if err != nil {
+			return err
+		}
+		logger.Setup(cfg.StateDir, logger.LogConfig{
+			Level:      level,
+			Format:     format,
+			MaxSizeMB:  cfg.LogMaxSize,
+			MaxBackups: cfg.LogMaxBackups,
+			MaxAgeDays: cfg.LogMaxAge,
+			Compress:   cfg.LogCompress,
+		})
 
 		return runServer(cfg)
 	},
@@ -48,36 +109,92 @@ func init() {
 	rootCmd.AddCommand(serverCmd)
 
 	// Local flags for server
+	serverCmd.Flags().StringVar(&cfgConfigFile, "config", envStr("GOCLAW_CONFIG", ""), "YAML file of flag values, applied under flags and environment variables")
 	serverCmd.Flags().IntVar(&cfgPort, "port", envInt("GOCLAW_PORT", 18789), "WebSocket server port")
 	serverCmd.Flags().StringVar(&cfgBind, "bind", envStr("GOCLAW_BIND", "loopback"), "Bind mode: loopback or lan")
-	serverCmd.Flags().StringVar(&cfgAuthToken, "token", envStr("GOCLAW_TOKEN", ""), "Auth token for node connections")
+	serverCmd.Flags().StringVar(&cfgBindAddr, "bind-addr", envStr("GOCLAW_BIND_ADDR", ""), "Listen on exactly this IP address, overriding --bind")
+	serverCmd.Flags().StringSliceVar(&cfgAuthTokens, "token", envTokens(), "Auth token for node connections; repeat or comma-separate to accept several during rotation")
+	serverCmd.Flags().StringArrayVar(&cfgAdminTokens, "admin-token", envSecret("GOCLAW_ADMIN_TOKEN"), "Token that also grants operators the scopes they request, such as operator.admin; repeat to accept several")
+	serverCmd.Flags().StringVar(&cfgTokenFile, "token-file", envStr("GOCLAW_TOKEN_FILE", ""), "Read auth tokens, one per line, from this file (mode 0600) instead of --token")
 	serverCmd.Flags().StringVar(&cfgDiscordToken, "discord-token", envStr("DISCORD_BOT_TOKEN", ""), "Discord bot token")
 	serverCmd.Flags().StringVar(&cfgGuildID, "guild-id", envStr("DISCORD_GUILD_ID", ""), "Discord guild ID")
+	serverCmd.Flags().StringSliceVar(&cfgDiscordAdmins, "discord-admins", envList("GOCLAW_DISCORD_ADMINS"), "Discord user or role IDs allowed to run privileged commands (empty: everyone)")
+	serverCmd.Flags().StringVar(&cfgDiscordNotify, "discord-notify-channel", envStr("GOCLAW_DISCORD_NOTIFY_CHANNEL", ""), "Discord channel ID to post pending pairing requests to")
+	serverCmd.Flags().DurationVar(&cfgDiscordCooldown, "discord-cooldown", envDuration("GOCLAW_DISCORD_COOLDOWN", 10*time.Second), "Per-user wait between runs of the same device command (0 disables)")
+	serverCmd.Flags().BoolVar(&cfgDiscordCleanup, "discord-cleanup", os.Getenv("GOCLAW_DISCORD_CLEANUP") == "1", "Delete the bot's slash commands on shutdown")
+	serverCmd.Flags().StringVar(&cfgDiscordEvents, "discord-events-channel", envStr("GOCLAW_DISCORD_EVENTS_CHANNEL", ""), "Discord channel ID to post gateway events to (node connects, pairing requests, shutdown)")
+	serverCmd.Flags().StringVar(&cfgPairingWebhook, "pairing-webhook", envStr("GOCLAW_PAIRING_WEBHOOK", ""), "URL to POST new pending pairing requests to")
+	serverCmd.Flags().StringVar(&cfgMDNSName, "mdns-name", envStr("GOCLAW_MDNS_NAME", ""), "mDNS instance name (default: hostname)")
+	serverCmd.Flags().StringVar(&cfgMDNSDisplayName, "mdns-display-name", envStr("GOCLAW_MDNS_DISPLAY_NAME", ""), "mDNS display name (default: instance name)")
+	serverCmd.Flags().StringVar(&cfgLogLevel, "log-level", envStr("GOCLAW_LOG_LEVEL", "info"), "Log level: debug, info, warn or error")
+	serverCmd.Flags().StringVar(&cfgLogFormat, "log-format", envStr("GOCLAW_LOG_FORMAT", ""), "Console log format: text or json (default: text on a terminal, json otherwise); the log file is always JSON")
+	serverCmd.Flags().IntVar(&cfgLogMaxSize, "log-max-size", envInt("GOCLAW_LOG_MAX_SIZE", logger.DefaultLogConfig.MaxSizeMB), "Rotate the log file after this many megabytes")
+	serverCmd.Flags().IntVar(&cfgLogMaxBackups, "log-max-backups", envInt("GOCLAW_LOG_MAX_BACKUPS", logger.DefaultLogConfig.MaxBackups), "Rotated log files to keep (0 keeps all)")
+	serverCmd.Flags().IntVar(&cfgLogMaxAge, "log-max-age", envInt("GOCLAW_LOG_MAX_AGE", logger.DefaultLogConfig.MaxAgeDays), "Days to keep rotated log files (0 keeps them regardless of age)")
+	serverCmd.Flags().BoolVar(&cfgLogCompress, "log-compress", os.Getenv("GOCLAW_LOG_COMPRESS") != "0", "Gzip rotated log files")
+	serverCmd.Flags().StringSliceVar(&cfgAllowedOrigins, "allowed-origins", envList("GOCLAW_ALLOWED_ORIGINS"), "Browser origins allowed to open WebSockets (exact, or .suffix); empty allows all")
+	serverCmd.Flags().StringSliceVar(&cfgAllowCIDRs, "allow-cidr", envList("GOCLAW_ALLOW_CIDR"), "Only accept connections from these CIDRs (loopback always allowed)")
+	serverCmd.Flags().StringSliceVar(&cfgDenyCIDRs, "deny-cidr", envList("GOCLAW_DENY_CIDR"), "Reject connections from these CIDRs")
+	serverCmd.Flags().BoolVar(&cfgCompression, "compression", os.Getenv("GOCLAW_COMPRESSION") == "1", "Negotiate WebSocket permessage-deflate (less bandwidth, more CPU)")
+	serverCmd.Flags().DurationVar(&cfgIdleTimeout, "idle-timeout", envDuration("GOCLAW_IDLE_TIMEOUT", 0), "Close connections that send no frame for this long, pings aside (0 disables)")
+	serverCmd.Flags().DurationVar(&cfgTickInterval, "tick-interval", envDuration("GOCLAW_TICK_INTERVAL", 15*time.Second), "Interval between tick events (0 disables)")
+	serverCmd.Flags().BoolVar(&cfgTickStats, "tick-stats", os.Getenv("GOCLAW_TICK_STATS") == "1", "Include the connected node count in tick events")
+	serverCmd.Flags().StringVar(&cfgStaticMapURL, "static-map-url", envStr("GOCLAW_STATIC_MAP_URL", discord.DefaultStaticMapURL), "Static map image URL template for /locate ({lat}, {lon}, {key}); empty disables")
+	serverCmd.Flags().StringVar(&cfgStaticMapKey, "static-map-key", envStr("GOCLAW_STATIC_MAP_KEY", ""), "API key substituted for {key} in --static-map-url")
+	serverCmd.Flags().DurationVar(&cfgInvokeTimeout, "invoke-timeout", envDuration("GOCLAW_INVOKE_TIMEOUT", 0), "Timeout for Discord device commands without their own (0: built-in 10s)")
+	serverCmd.Flags().StringSliceVar(&cfgInvokeTimeouts, "invoke-timeouts", envList("GOCLAW_INVOKE_TIMEOUTS"), "Per-command timeouts as command=duration, e.g. camera.snap=1m")
+	serverCmd.Flags().IntVar(&cfgMaxInvokes, "max-invokes-per-node", envInt("GOCLAW_MAX_INVOKES_PER_NODE", 0), "Max concurrent commands per node; extra commands queue (0: unlimited)")
+	serverCmd.Flags().IntVar(&cfgMaxDeviceConns, "max-conns-per-device", envInt("GOCLAW_MAX_CONNS_PER_DEVICE", 0), "Max concurrent connections per device ID; extra connections are refused (0: unlimited)")
+	serverCmd.Flags().DurationVar(&cfgReconnectGrace, "reconnect-grace", envDuration("GOCLAW_RECONNECT_GRACE", 0), "Keep a disconnected node's pending invokes this long for it to reconnect (0 disables)")
+	serverCmd.Flags().StringSliceVar(&cfgNodeScopes, "node-default-scopes", envList("GOCLAW_NODE_DEFAULT_SCOPES"), "Scopes granted to nodes that pair without requesting any")
+	serverCmd.Flags().StringVar(&cfgAutoApprove, "auto-approve", envStr("GOCLAW_AUTO_APPROVE", "loopback-only"), "Devices paired without operator approval: loopback-only, none, tofu, or cidr:<list>")
+	serverCmd.Flags().BoolVar(&cfgAllowTokenless, "allow-tokenless-devices", os.Getenv("GOCLAW_ALLOW_TOKENLESS_DEVICES") == "1", "Admit paired devices whose device token could not be saved instead of failing the connect")
+	serverCmd.Flags().StringVar(&cfgServerKey, "server-key", envStr("GOCLAW_SERVER_KEY", ""), "Ed25519 key file for signing connect challenges, created if missing (empty: unsigned)")
 }
 
 func runServer(cfg Config) error {
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer cancel()
 
+	// validateConfig already rejected malformed CIDRs.
+	allowCIDRs, _ := netutil.ParseCIDRs(cfg.AllowCIDRs)
+	denyCIDRs, _ := netutil.ParseCIDRs(cfg.DenyCIDRs)
+
 	// 1. Initialize Pairing State
-	pairingStore, err := pairing.NewStore(filepath.Join(cfg.StateDir, "pairing"))
+	pairingStore, err := newPairingStore(filepath.Join(cfg.StateDir, "pairing"), cfg.StrictPerms)
 	if err != nil {
 		return fmt.Errorf("pairing store: %w", err)
 	}
 	pairingSvc := pairing.NewService(pairingStore)
+	// validateConfig already rejected a malformed policy.
+	autoApprove, _ := pairing.ParseAutoApprovePolicy(cfg.AutoApprove)
+	pairingSvc.WithAutoApprovePolicy(autoApprove)
+	if autoApprove.IsTOFU() {
+		slog.Warn("pairing auto-approves the first device from each remote IP (--auto-approve tofu)")
+	}
+	if len(cfg.NodeScopes) > 0 {
+		pairingSvc.WithRoleDefaultScopes(map[string][]string{"node": cfg.NodeScopes})
+	}
+	watchReload(ctx, cfg, pairingStore)
+	if cfg.PairingWebhook != "" {
+		pairingSvc.OnPending(pairing.WebhookNotifier(cfg.PairingWebhook))
+	}
 
 	// 2. Initialize Discovery (Bonjour)
 	mdnsCfg := discovery.Config{
-		InstanceName: "OpenClaw Gateway", // TODO: Make configurable or use hostname
+		InstanceName: cfg.MDNSName, // empty = hostname
 		Port:         cfg.Port,
 		LanHost:      "", // auto-detect
 		Meta: discovery.Metadata{
 			Role:        "gateway",
 			Transport:   "gateway",
 			GatewayPort: fmt.Sprintf("%d", cfg.Port),
-			DisplayName: "OpenClaw Gateway",
+			DisplayName: cfg.MDNSDisplayName,
+			Version:     version,
+			Protocol:    protocol.ServerProtocol,
 		},
 	}
+	mdnsActive := false
 	advertiser, err := discovery.NewAdvertiser(mdnsCfg)
 	if err != nil {
 		slog.Warn("failed to init bonjour", "error", err)
@@ -87,72 +204,146 @@ func runServer(cfg Config) error {
 			slog.Warn("failed to start bonjour", "error", err)
 		} else {
 			slog.Info("bonjour advertising started")
+			mdnsActive = true
 			defer advertiser.Stop()
 		}
 	}
 
+	var serverKey ed25519.PrivateKey
+	if cfg.ServerKey != "" {
+		if serverKey, err = loadServerKey(cfg.ServerKey); err != nil {
+			return err
+		}
+		// Clients pin this to verify challenge signatures.
+		pub := serverKey.Public().(ed25519.PublicKey)
+		slog.Info("signing connect challenges", "serverKey", base64.RawURLEncoding.EncodeToString(pub))
+	}
+
 	// 3. Create Gateway
 	gw, err := gateway.New(gateway.GatewayConfig{
-		Port:         cfg.Port,
-		Bind:         cfg.Bind,
-		AuthToken:    cfg.AuthToken,
-		TickInterval: cfg.TickInterval,
-		PairingSvc:   pairingSvc,
+		Port:              cfg.Port,
+		Bind:              cfg.Bind,
+		BindAddr:          cfg.BindAddr,
+		AuthTokens:        cfg.AuthTokens,
+		AdminTokens:       cfg.AdminTokens,
+		TickInterval:      cfg.TickInterval,
+		TickStats:         cfg.TickStats,
+		PairingSvc:        pairingSvc,
+		Build:             buildInfo(),
+		AllowedOrigins:    cfg.AllowedOrigins,
+		AllowCIDRs:        allowCIDRs,
+		DenyCIDRs:         denyCIDRs,
+		EnableCompression: cfg.Compression,
+		IdleTimeout:       cfg.IdleTimeout,
+		MaxInvokesPerNode: cfg.MaxInvokes,
+		MaxConnsPerDevice: cfg.MaxDeviceConns,
+		ServerKey:         serverKey,
+
+		AllowTokenlessDevices: cfg.AllowTokenless,
+		ReconnectGrace:        cfg.ReconnectGrace,
 	})
 	if err != nil {
 		return fmt.Errorf("gateway init: %w", err)
 	}
+	if err := gw.Listen(); err != nil {
+		return fmt.Errorf("gateway listen: %w", err)
+	}
+	gw.SetComponent("mdns", mdnsActive)
 
 	// 4. Discord Bot
 	var bot *discord.Bot
 	if cfg.DiscordToken != "" {
 		bot, err = discord.NewBot(discord.BotConfig{
-			Token:   cfg.DiscordToken,
-			GuildID: cfg.GuildID,
+			Token:           cfg.DiscordToken,
+			GuildID:         cfg.GuildID,
+			Admins:          cfg.DiscordAdmins,
+			NotifyChannelID: cfg.DiscordNotify,
+			Cooldown:        cfg.DiscordCooldown,
+			CleanupCommands: cfg.DiscordCleanup,
+			EventsChannelID: cfg.DiscordEvents,
 		})
 		if err != nil {
 			return fmt.Errorf("discord init: %w", err)
 		}
 		router := discord.NewCommandRouter(gw.Invoker(), gw.Registry())
 		router.WithPairing(pairingSvc, pairingStore)
+		router.WithOperators(gw.Operators())
+		router.WithStaticMap(cfg.StaticMapURL, cfg.StaticMapKey)
+		// validateConfig already rejected malformed timeouts.
+		timeouts, _ := parseInvokeTimeouts(cfg.InvokeTimeouts)
+		router.WithInvokeTimeouts(int(cfg.InvokeTimeout.Milliseconds()), timeouts)
 		bot.SetRouter(router)
+		bot.SetRegistry(gw.Registry())
 		bot.RegisterCommands(router.Commands())
 
 		if err := bot.Start(ctx); err != nil {
 			slog.Warn("discord failed to connect", "error", err)
 			bot = nil
+		} else {
+			if cfg.DiscordNotify != "" {
+				pairingSvc.OnPending(bot.NotifyPending)
+			}
+			gw.Registry().OnRegister(func(n *node.NodeSession) {
+				bot.NodesChanged()
+				bot.PostEvent("Node connected", fmt.Sprintf("%s (`%s`, %s)",
+					discord.SafeName(n.DisplayName), discord.SafeCode(n.NodeID), discord.SafeName(n.Platform)))
+			})
+			gw.Registry().OnUnregister(func(nodeID string) {
+				bot.NodesChanged()
+				bot.PostEvent("Node disconnected", fmt.Sprintf("`%s`", discord.SafeCode(nodeID)))
+			})
+			pairingSvc.OnPending(func(req pairing.PendingRequest) {
+				bot.PostEvent("Pairing request", fmt.Sprintf("%s from %s (request `%s`)",
+					discord.SafeName(req.DisplayName), req.RemoteIP, req.RequestID))
+			})
 		}
 	}
 
+	gw.SetComponent("discord", bot != nil)
+
 	// Banner
-	printBanner(cfg, bot != nil)
+	printBanner(cfg, gw.Addr(), bot != nil)
 
-	// Run
+	// Run the gateway on its own context: cancelling it closes every socket
+	// at once, which would cut short Shutdown's wait for in-flight invokes.
+	runCtx, stopRun := context.WithCancel(context.Background())
+	defer stopRun()
+	shutdownDone := make(chan struct{})
 	go func() {
+		defer close(shutdownDone)
 		<-ctx.Done()
 		slog.Info("shutting down...")
 		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer shutdownCancel()
 
-		if bot != nil {
-			bot.Stop()
-		}
 		if advertiser != nil {
 			advertiser.Stop()
 		}
-		gw.Shutdown(shutdownCtx)
+		if bot != nil {
+			bot.PostEvent("Gateway shutting down", "")
+		}
+		// The bot stays up until invokes drain so their replies still reach Discord.
+		gw.Shutdown(shutdownCtx, gateway.ShutdownSignal)
+		if bot != nil {
+			bot.Stop()
+		}
+		stopRun()
 	}()
 
-	return gw.Run(ctx)
+	err = gw.Run(runCtx)
+	if ctx.Err() != nil {
+		<-shutdownDone
+	}
+	return err
 }
 
-func printBanner(cfg Config, discordConnected bool) {
-	bindAddr := "127.0.0.1"
-	if cfg.Bind == "lan" {
-		bindAddr = "0.0.0.0"
+func printBanner(cfg Config, addr string, discordConnected bool) {
+	bind := cfg.Bind
+	if cfg.BindAddr != "" {
+		bind = cfg.BindAddr
 	}
 	authMode := "none"
-	if cfg.AuthToken != "" {
+	if len(cfg.AuthTokens) > 0 {
 		authMode = "token"
 	}
 	discordStatus := "disabled"
@@ -162,9 +353,9 @@ func printBanner(cfg Config, discordConnected bool) {
 
 	fmt.Printf("\n")
 	fmt.Printf("  goclaw v%s\n", version)
-	fmt.Printf("  ws://%s:%d  auth=%s  bind=%s\n", bindAddr, cfg.Port, authMode, cfg.Bind)
+	fmt.Printf("  ws://%s  auth=%s  bind=%s\n", addr, authMode, bind)
 	fmt.Printf("  discord: %s  pairing: enabled  bonjour: enabled\n", discordStatus)
 	fmt.Printf("  state: %s\n", cfg.StateDir)
-	fmt.Printf("  health: http://%s:%d/health\n", bindAddr, cfg.Port)
+	fmt.Printf("  health: http://%s/health\n", addr)
 	fmt.Printf("\n")
 }
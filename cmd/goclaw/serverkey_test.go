@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadServerKey_CreatesAndReloads(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.key")
+
+	key, err := loadServerKey(path)
+	if err != nil {
+		t.Fatalf("loadServerKey: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("key file not written: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("key file mode = %04o, want 0600", perm)
+	}
+
+	again, err := loadServerKey(path)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if !bytes.Equal(key, again) {
+		t.Error("reloaded key differs from the generated one")
+	}
+}
+
+func TestLoadServerKey_RejectsGarbage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.key")
+	if err := os.WriteFile(path, []byte("not-a-key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadServerKey(path); err == nil {
+		t.Error("expected an error for a malformed key file")
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunTokenGenerate(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 20; i++ {
+		var buf bytes.Buffer
+		if err := runTokenGenerate(&buf, ""); err != nil {
+			t.Fatalf("runTokenGenerate: %v", err)
+		}
+
+		token := strings.SplitN(buf.String(), "\n", 2)[0]
+		raw, err := base64.RawURLEncoding.DecodeString(token)
+		if err != nil {
+			t.Fatalf("token %q is not base64url: %v", token, err)
+		}
+		if len(raw) != 32 {
+			t.Errorf("token decodes to %d bytes, want 32", len(raw))
+		}
+		if seen[token] {
+			t.Fatalf("duplicate token %q", token)
+		}
+		seen[token] = true
+
+		if !strings.Contains(buf.String(), "export GOCLAW_TOKEN="+token) {
+			t.Errorf("output missing export guidance:\n%s", buf.String())
+		}
+	}
+}
+
+func TestRunTokenGenerate_Out(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	// Pre-existing file with loose permissions must be tightened.
+	if err := os.WriteFile(path, []byte("old\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := runTokenGenerate(&buf, path); err != nil {
+		t.Fatalf("runTokenGenerate: %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("file mode = %o, want 600", perm)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := strings.TrimSpace(string(data))
+	if raw, err := base64.RawURLEncoding.DecodeString(token); err != nil || len(raw) != 32 {
+		t.Errorf("file token %q invalid (err=%v)", token, err)
+	}
+	if strings.Contains(buf.String(), token) {
+		t.Error("token must not be echoed to stdout when --out is set")
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+
+	"github.com/rvald/goclaw/internal/gateway"
+	"github.com/spf13/cobra"
+)
+
+var versionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "Print version and build information",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		printVersion(cmd.OutOrStdout())
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(versionCmd)
+}
+
+// buildInfo returns the build metadata reported by /health.
+func buildInfo() gateway.BuildInfo {
+	return gateway.BuildInfo{
+		Version:   version,
+		Commit:    commit,
+		BuildDate: buildDate,
+	}
+}
+
+func printVersion(w io.Writer) {
+	fmt.Fprintf(w, "goclaw v%s\n", version)
+	fmt.Fprintf(w, "  commit:     %s\n", commit)
+	fmt.Fprintf(w, "  built:      %s\n", buildDate)
+	fmt.Fprintf(w, "  go version: %s\n", runtime.Version())
+}
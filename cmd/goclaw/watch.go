@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"slices"
+	"syscall"
+	"time"
+
+	"github.com/rvald/goclaw/internal/pairing"
+	"github.com/spf13/cobra"
+)
+
+const (
+	ansiClear = "\033[H\033[2J"
+	ansiBold  = "\033[1m"
+	ansiReset = "\033[0m"
+)
+
+var watchInterval time.Duration
+
+var nodesWatchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Live-tail pending pairing requests",
+	Long: `Poll the pairing store and redraw the pending requests whenever they change.
+Requests that arrived since the previous redraw are marked with '*'. Press Ctrl-C to exit.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if watchInterval <= 0 {
+			return fmt.Errorf("--interval must be positive")
+		}
+		store, err := openPairingStore()
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer cancel()
+
+		return watchPending(ctx, cmd.OutOrStdout(), store, watchInterval, isTerminal(os.Stdout))
+	},
+}
+
+func init() {
+	nodesWatchCmd.Flags().DurationVar(&watchInterval, "interval", 2*time.Second, "How often to poll for pending requests")
+}
+
+// watchPending redraws the pending table each time the set of requests
+// changes, until ctx is done. With tty set the screen is cleared between
+// redraws and new rows are bold.
+func watchPending(ctx context.Context, w io.Writer, store *pairing.Store, interval time.Duration, tty bool) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var seen map[string]bool
+	var lastIDs []string
+	for {
+		// The server writes the store from another process.
+		if err := store.Reload(); err != nil {
+			fmt.Fprintf(w, "reload failed: %v\n", err)
+		} else {
+			pending := store.ListPending()
+			ids := pendingIDs(pending)
+			if seen == nil || !slices.Equal(ids, lastIDs) {
+				if tty {
+					fmt.Fprint(w, ansiClear)
+				}
+				renderPending(w, pending, seen, tty)
+				seen = make(map[string]bool, len(ids))
+				for _, id := range ids {
+					seen[id] = true
+				}
+				lastIDs = ids
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// renderPending writes the pending table. Rows whose request ID is not in
+// seen are marked as new; a nil seen (first draw) marks nothing.
+func renderPending(w io.Writer, pending []pairing.PendingRequest, seen map[string]bool, tty bool) {
+	fmt.Fprintf(w, "Pending requests (%d) — %s\n\n", len(pending), time.Now().Format(time.TimeOnly))
+	if len(pending) == 0 {
+		fmt.Fprintln(w, "No pending requests.")
+		return
+	}
+
+	fmt.Fprintf(w, "  %-36s  %-20s  %-15s  %s\n", "REQUEST ID", "DEVICE NAME", "IP", "RECEIVED")
+	for _, req := range pending {
+		line := fmt.Sprintf("%-36s  %-20s  %-15s  %s", req.RequestID, termSafe(req.DisplayName), req.RemoteIP,
+			time.UnixMilli(req.Timestamp).Format(time.TimeOnly))
+		if seen == nil || seen[req.RequestID] {
+			fmt.Fprintf(w, "  %s\n", line)
+			continue
+		}
+		if tty {
+			line = ansiBold + line + ansiReset
+		}
+		fmt.Fprintf(w, "* %s\n", line)
+	}
+}
+
+// pendingIDs returns the sorted request IDs of pending.
+func pendingIDs(pending []pairing.PendingRequest) []string {
+	ids := make([]string, len(pending))
+	for i, req := range pending {
+		ids[i] = req.RequestID
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// isTerminal reports whether f is a character device, so ANSI escapes are
+// only written to interactive terminals.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rvald/goclaw/internal/pairing"
+)
+
+func TestWatchPending_MarksNewRequests(t *testing.T) {
+	dir := t.TempDir()
+	store, err := pairing.NewStore(dir)
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	if err := store.AddPending(pairing.PendingRequest{RequestID: "req-old", DeviceID: "d1", Timestamp: time.Now().UnixMilli()}); err != nil {
+		t.Fatalf("AddPending: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var buf bytes.Buffer
+	done := make(chan error, 1)
+	go func() { done <- watchPending(ctx, &buf, store, 10*time.Millisecond, false) }()
+
+	// A second store on the same dir stands in for the running server.
+	time.Sleep(30 * time.Millisecond)
+	server, err := pairing.NewStore(dir)
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	if err := server.AddPending(pairing.PendingRequest{RequestID: "req-new", DeviceID: "d2", Timestamp: time.Now().UnixMilli()}); err != nil {
+		t.Fatalf("AddPending: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("watchPending: %v", err)
+	}
+
+	out := buf.String()
+	if n := strings.Count(out, "Pending requests"); n != 2 {
+		t.Errorf("redraws = %d, want 2 (initial and on change):\n%s", n, out)
+	}
+	if !strings.Contains(out, "* req-new") {
+		t.Errorf("new request not marked:\n%s", out)
+	}
+	if strings.Contains(out, "* req-old") {
+		t.Errorf("existing request marked as new:\n%s", out)
+	}
+	if strings.Contains(out, "\033[") {
+		t.Errorf("ANSI escapes written to non-terminal:\n%s", out)
+	}
+}
+
+func TestRenderPending_EscapesDisplayName(t *testing.T) {
+	var buf bytes.Buffer
+	renderPending(&buf, []pairing.PendingRequest{
+		{RequestID: "req-1", DisplayName: "Phone\x1b[2J\x1b]0;owned\x07"},
+	}, nil, false)
+
+	out := buf.String()
+	if strings.ContainsAny(out, "\x1b\x07") {
+		t.Errorf("control characters written to the terminal:\n%q", out)
+	}
+	if !strings.Contains(out, `Phone\x1b[2J\x1b]0;owned\a`) {
+		t.Errorf("display name not escaped:\n%s", out)
+	}
+}
@@ -3,24 +3,75 @@ package discord
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"slices"
+	"sync"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
 )
 
+// DefaultPrivilegedCommands are the slash commands gated by BotConfig.Admins
+// when BotConfig.PrivilegedCommands is empty. It covers every built-in
+// command: even the read-only status, info and nodes reveal which devices
+// are connected and what they can do.
+var DefaultPrivilegedCommands = []string{
+	"snap", "record", "locate", "status", "info", "nodes", "notify", "clipboard",
+	"devices", "device", "approve", "approve-all", "reject", "revoke", "rename", "tag", "operators",
+}
+
 // BotConfig holds the configuration for the Discord bot.
 type BotConfig struct {
 	Token   string
 	GuildID string
+
+	// Admins lists Discord user IDs and/or role IDs allowed to run
+	// privileged commands. Empty leaves every command open.
+	Admins []string
+	// PrivilegedCommands overrides DefaultPrivilegedCommands.
+	PrivilegedCommands []string
+	// NotifyChannelID is the channel that receives pending pairing
+	// requests with Approve/Reject buttons. Empty disables notifications.
+	NotifyChannelID string
+	// Cooldown is how long a user must wait between runs of the same
+	// device command (see cooldownCommands). Zero disables cooldowns.
+	Cooldown time.Duration
+	// CleanupCommands deletes the slash commands this bot registered when
+	// it stops, so they do not linger while the gateway is down.
+	CleanupCommands bool
+	// EventsChannelID receives batched gateway events (nodes connecting
+	// and disconnecting, pairing requests, shutdown). Empty disables them.
+	EventsChannelID string
 }
 
+// commandCleanupTimeout bounds how long Stop spends deleting commands.
+const commandCleanupTimeout = 5 * time.Second
+
+// presenceDebounce coalesces bursts of node connects/disconnects into a
+// single presence update.
+const presenceDebounce = 5 * time.Second
+
 // Bot wraps a discordgo session with command routing.
 type Bot struct {
 	config   BotConfig
 	session  *discordgo.Session
 	router   *CommandRouter
 	commands []SlashCommand
+	registry NodeRegistry // optional — drives the presence node count
+	cooldown *cooldowns
+
+	eventsMu      sync.Mutex
+	events        []botEvent
+	droppedEvents int
+	eventsTimer   *time.Timer
+
+	createdMu sync.Mutex
+	created   []*discordgo.ApplicationCommand // registered by Start; deleted on Stop with CleanupCommands
+
+	presenceMu    sync.Mutex
+	presenceTimer *time.Timer
 }
 
 // NewBot validates config and creates a new Bot.
@@ -28,7 +79,7 @@ func NewBot(config BotConfig) (*Bot, error) {
 	if config.Token == "" {
 		return nil, fmt.Errorf("discord bot token is required")
 	}
-	return &Bot{config: config}, nil
+	return &Bot{config: config, cooldown: newCooldowns(config.Cooldown)}, nil
 }
 
 // SetRouter sets the command router for handling slash commands.
@@ -36,6 +87,12 @@ func (b *Bot) SetRouter(router *CommandRouter) {
 	b.router = router
 }
 
+// SetRegistry sets the node registry whose size is shown in the bot's
+// presence. Call NodesChanged when nodes connect or disconnect.
+func (b *Bot) SetRegistry(registry NodeRegistry) {
+	b.registry = registry
+}
+
 // RegisterCommands stores commands for registration on Start.
 func (b *Bot) RegisterCommands(cmds []SlashCommand) {
 	b.commands = cmds
@@ -60,15 +117,21 @@ func (b *Bot) Start(ctx context.Context) error {
 	}
 
 	log.Printf("discord: connected as %s", b.session.State.User.Username)
+	if len(b.config.Admins) == 0 {
+		log.Printf("discord: no admins configured; privileged commands are open to every guild member")
+	}
+	b.updatePresence()
 
 	// Register slash commands
 	if len(b.commands) > 0 {
 		appCmds := toApplicationCommands(b.commands)
 		for _, cmd := range appCmds {
-			_, err := b.session.ApplicationCommandCreate(b.session.State.User.ID, b.config.GuildID, cmd)
+			created, err := b.session.ApplicationCommandCreate(b.session.State.User.ID, b.config.GuildID, cmd)
 			if err != nil {
 				log.Printf("discord: failed to register command %q: %v", cmd.Name, err)
+				continue
 			}
+			b.trackCommand(created)
 		}
 	}
 
@@ -77,28 +140,181 @@ func (b *Bot) Start(ctx context.Context) error {
 
 // Stop closes the Discord session.
 func (b *Bot) Stop() error {
+	b.presenceMu.Lock()
+	if b.presenceTimer != nil {
+		b.presenceTimer.Stop()
+		b.presenceTimer = nil
+	}
+	b.presenceMu.Unlock()
+
+	// Send queued events (including any shutdown notice) now rather than
+	// dropping them with the session.
+	b.flushEvents()
+
 	if b.session != nil {
+		if b.config.CleanupCommands {
+			b.unregisterCommands()
+		}
 		return b.session.Close()
 	}
 	return nil
 }
 
+// trackCommand records a command created by this process for cleanup.
+func (b *Bot) trackCommand(cmd *discordgo.ApplicationCommand) {
+	if cmd == nil || cmd.ID == "" {
+		return
+	}
+	b.createdMu.Lock()
+	defer b.createdMu.Unlock()
+	b.created = append(b.created, cmd)
+}
+
+// commandDeleter is the part of *discordgo.Session used for cleanup.
+type commandDeleter interface {
+	ApplicationCommandDelete(appID, guildID, cmdID string, options ...discordgo.RequestOption) error
+}
+
+// unregisterCommands deletes the commands this process registered,
+// giving up after commandCleanupTimeout. Commands that fail to delete are
+// logged and kept for a later attempt.
+func (b *Bot) unregisterCommands() {
+	ctx, cancel := context.WithTimeout(context.Background(), commandCleanupTimeout)
+	defer cancel()
+
+	b.createdMu.Lock()
+	defer b.createdMu.Unlock()
+
+	remaining, err := deleteCommands(ctx, b.session, b.session.State.User.ID, b.config.GuildID, b.created)
+	if err != nil {
+		log.Printf("discord: command cleanup incomplete (%d left): %v", len(remaining), err)
+	} else {
+		log.Printf("discord: removed %d slash commands", len(b.created))
+	}
+	b.created = remaining
+}
+
+// deleteCommands deletes cmds one by one until ctx is done. It returns the
+// commands that were not deleted and the joined errors.
+func deleteCommands(ctx context.Context, d commandDeleter, appID, guildID string, cmds []*discordgo.ApplicationCommand) ([]*discordgo.ApplicationCommand, error) {
+	var remaining []*discordgo.ApplicationCommand
+	var errs []error
+	for i, cmd := range cmds {
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, err)
+			remaining = append(remaining, cmds[i:]...)
+			break
+		}
+		if err := d.ApplicationCommandDelete(appID, guildID, cmd.ID, discordgo.WithContext(ctx)); err != nil {
+			errs = append(errs, fmt.Errorf("delete %q: %w", cmd.Name, err))
+			remaining = append(remaining, cmd)
+		}
+	}
+	return remaining, errors.Join(errs...)
+}
+
+// NodesChanged schedules a presence update. Calls within presenceDebounce
+// of each other share one update, which reports the count at that time.
+func (b *Bot) NodesChanged() {
+	b.presenceMu.Lock()
+	defer b.presenceMu.Unlock()
+	if b.presenceTimer != nil {
+		return
+	}
+	b.presenceTimer = time.AfterFunc(presenceDebounce, func() {
+		b.presenceMu.Lock()
+		b.presenceTimer = nil
+		b.presenceMu.Unlock()
+		b.updatePresence()
+	})
+}
+
+// updatePresence sets the bot's status to the current node count.
+func (b *Bot) updatePresence() {
+	if b.session == nil || b.registry == nil {
+		return
+	}
+	err := b.session.UpdateStatusComplex(discordgo.UpdateStatusData{
+		Activities: []*discordgo.Activity{
+			{Name: presenceText(len(b.registry.List())), Type: discordgo.ActivityTypeWatching},
+		},
+		Status: "online",
+	})
+	if err != nil {
+		log.Printf("discord: failed to update presence: %v", err)
+	}
+}
+
+// presenceText describes n connected nodes; Discord renders it after
+// "Watching".
+func presenceText(n int) string {
+	switch n {
+	case 0:
+		return "no devices"
+	case 1:
+		return "1 device"
+	default:
+		return fmt.Sprintf("%d devices", n)
+	}
+}
+
 // handleInteraction routes InteractionCreate events to CommandRouter handlers.
 func (b *Bot) handleInteraction(s *discordgo.Session, i *discordgo.InteractionCreate) {
-	if i.Type != discordgo.InteractionApplicationCommand {
+	if b.router == nil {
 		return
 	}
-	if b.router == nil {
+	if i.Type == discordgo.InteractionApplicationCommandAutocomplete {
+		b.handleAutocomplete(s, i)
+		return
+	}
+	if i.Type == discordgo.InteractionMessageComponent {
+		b.handleComponent(s, i)
+		return
+	}
+	if i.Type != discordgo.InteractionApplicationCommand {
 		return
 	}
 
 	data := i.ApplicationCommandData()
 	ctx := context.Background()
 
-	// Defer immediately to avoid Discord's 3s interaction timeout.
-	if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+	if !b.authorized(i, data.Name) {
+		if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content:         fmt.Sprintf("🚫 You are not authorized to use `/%s`", data.Name),
+				Flags:           discordgo.MessageFlagsEphemeral,
+				AllowedMentions: noMentions(),
+			},
+		}); err != nil {
+			log.Printf("discord: failed to send unauthorized reply: %v", err)
+		}
+		return
+	}
+
+	if remaining, wait := b.onCooldown(i, data.Name); wait {
+		if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content:         fmt.Sprintf("⏳ `/%s` is on cooldown, try again in %s", data.Name, remaining.Round(time.Second)),
+				Flags:           discordgo.MessageFlagsEphemeral,
+				AllowedMentions: noMentions(),
+			},
+		}); err != nil {
+			log.Printf("discord: failed to send cooldown reply: %v", err)
+		}
+		return
+	}
+
+	// Defer immediately to avoid Discord's 3s interaction timeout. The
+	// deferral fixes whether the reply is ephemeral.
+	deferred := &discordgo.InteractionResponse{
 		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
-	}); err != nil {
+	}
+	if ephemeralCommands[data.Name] {
+		deferred.Data = &discordgo.InteractionResponseData{Flags: discordgo.MessageFlagsEphemeral}
+	}
+	if err := s.InteractionRespond(i.Interaction, deferred); err != nil {
 		log.Printf("discord: failed to defer interaction: %v", err)
 	}
 
@@ -126,46 +342,217 @@ func (b *Bot) handleInteraction(s *discordgo.Session, i *discordgo.InteractionCr
 
 	switch data.Name {
 	case "snap":
-		resp = b.router.HandleSnap(ctx, strOpt("node"), strOpt("facing"), intOpt("quality", 80))
+		resp = b.router.HandleSnap(ctx, strOpt("node"), strOpt("facing"), strOpt("format"), intOpt("quality", DefaultSnapQuality))
+	case "record":
+		resp = b.router.HandleRecord(ctx, strOpt("node"), strOpt("facing"), intOpt("duration", DefaultRecordSeconds))
 	case "locate":
 		resp = b.router.HandleLocate(ctx, strOpt("node"))
 	case "status":
 		resp = b.router.HandleStatus(ctx, strOpt("node"))
+	case "info":
+		resp = b.router.HandleInfo(ctx, strOpt("node"))
+	case "clipboard":
+		resp = b.router.HandleClipboard(ctx, strOpt("node"), strOpt("text"))
 	case "nodes":
-		resp = b.router.HandleNodes()
+		resp = b.router.HandleNodes(strOpt("platform"), strOpt("tag"))
 	case "notify":
 		resp = b.router.HandleNotify(ctx, strOpt("node"), strOpt("title"), strOpt("body"))
 	case "devices":
 		resp = b.router.HandleDevices()
+	case "device":
+		resp = b.router.HandleDevice(strOpt("id"))
 	case "approve":
-		resp = b.router.HandleApprove(strOpt("request"))
+		resp = b.router.HandleApprove(strOpt("request"), strOpt("scopes"))
+	case "approve-all":
+		resp = b.router.HandleApproveAll(strOpt("platform"), strOpt("since"), strOpt("confirm"))
 	case "reject":
 		resp = b.router.HandleReject(strOpt("request"))
 	case "revoke":
 		resp = b.router.HandleRevoke(strOpt("device"), strOpt("role"))
+	case "rename":
+		resp = b.router.HandleRename(strOpt("device"), strOpt("name"))
+	case "tag":
+		resp = b.router.HandleTag(strOpt("device"), strOpt("tags"))
+	case "operators":
+		resp = b.router.HandleOperators()
 	default:
 		resp = CommandResponse{Message: fmt.Sprintf("Unknown command: %s", data.Name)}
 	}
 
-	// Send response as a follow-up (supports attachments).
+	// Send response as a follow-up (supports attachments). An embed
+	// replaces the plain-text content when the handler provides one.
+	var flags discordgo.MessageFlags
+	if resp.Ephemeral {
+		flags = discordgo.MessageFlagsEphemeral
+	}
 	followup := &discordgo.WebhookParams{
-		Content: resp.Message,
+		Content:         resp.Message,
+		Flags:           flags,
+		AllowedMentions: noMentions(),
+	}
+	if resp.Embed != nil {
+		followup.Content = ""
+		followup.Embeds = []*discordgo.MessageEmbed{resp.Embed}
 	}
 
 	// If we have image data, attach it as a file.
 	if len(resp.ImageData) > 0 {
+		name, contentType := resp.ImageName, resp.ImageType
+		if name == "" {
+			name = "snap.png"
+		}
+		if contentType == "" {
+			contentType = "image/png"
+		}
 		followup.Files = []*discordgo.File{
 			{
-				Name:        "snap.png",
-				ContentType: "image/png",
+				Name:        name,
+				ContentType: contentType,
 				Reader:      bytes.NewReader(resp.ImageData),
 			},
 		}
 	}
+	if resp.File != nil {
+		followup.Files = []*discordgo.File{resp.File}
+	}
 
 	if _, err := s.FollowupMessageCreate(i.Interaction, true, followup); err != nil {
 		log.Printf("discord: failed to send follow-up: %v", err)
+		return
+	}
+
+	// Paginated output continues in further follow-ups, in order.
+	for _, msg := range resp.Messages {
+		if _, err := s.FollowupMessageCreate(i.Interaction, true, &discordgo.WebhookParams{Content: msg, Flags: flags, AllowedMentions: noMentions()}); err != nil {
+			log.Printf("discord: failed to send follow-up: %v", err)
+			return
+		}
+	}
+}
+
+// authorized reports whether the invoking user may run command. Commands
+// outside the privileged set, and every command when no admins are
+// configured, are allowed.
+func (b *Bot) authorized(i *discordgo.InteractionCreate, command string) bool {
+	if len(b.config.Admins) == 0 {
+		return true
+	}
+	privileged := b.config.PrivilegedCommands
+	if len(privileged) == 0 {
+		privileged = DefaultPrivilegedCommands
+	}
+	if !slices.Contains(privileged, command) {
+		return true
+	}
+
+	userID, roles := interactionUser(i)
+	for _, id := range b.config.Admins {
+		if id == userID || slices.Contains(roles, id) {
+			return true
+		}
+	}
+	return false
+}
+
+// interactionUser returns the invoking user's ID and guild roles. Guild
+// interactions carry the user under Member; DMs carry it directly.
+func interactionUser(i *discordgo.InteractionCreate) (userID string, roles []string) {
+	if i.Member != nil {
+		roles = i.Member.Roles
+		if i.Member.User != nil {
+			userID = i.Member.User.ID
+		}
+	} else if i.User != nil {
+		userID = i.User.ID
+	}
+	return userID, roles
+}
+
+// onCooldown reports whether the invoking user must wait before running
+// command again, and how long.
+func (b *Bot) onCooldown(i *discordgo.InteractionCreate, command string) (time.Duration, bool) {
+	if !cooldownCommands[command] {
+		return 0, false
+	}
+	userID, _ := interactionUser(i)
+	remaining, ok := b.cooldown.allow(userID, command)
+	return remaining, !ok
+}
+
+// NotifyPending posts a pending pairing request with Approve/Reject buttons
+// to the notify channel. It is an OnPending listener and does not block.
+func (b *Bot) NotifyPending(req PendingRequest) {
+	if b.session == nil || b.config.NotifyChannelID == "" {
+		return
+	}
+	go func() {
+		if _, err := b.session.ChannelMessageSendComplex(b.config.NotifyChannelID, PendingNotification(req)); err != nil {
+			log.Printf("discord: failed to post pending request %s: %v", req.RequestID, err)
+		}
+	}()
+}
+
+// handleComponent handles pairing button presses, replacing the original
+// message with the outcome and disabling its buttons.
+func (b *Bot) handleComponent(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	customID := i.MessageComponentData().CustomID
+	action, requestID, ok := parsePairingCustomID(customID)
+	if !ok {
+		return
+	}
+
+	if !b.authorized(i, action) {
+		if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content:         fmt.Sprintf("🚫 You are not authorized to %s pairing requests", action),
+				Flags:           discordgo.MessageFlagsEphemeral,
+				AllowedMentions: noMentions(),
+			},
+		}); err != nil {
+			log.Printf("discord: failed to send unauthorized reply: %v", err)
+		}
+		return
+	}
+
+	resp := b.router.HandleComponent(customID)
+	if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Content:         resp.Message,
+			Components:      PairingButtons(requestID, true),
+			AllowedMentions: noMentions(),
+		},
+	}); err != nil {
+		log.Printf("discord: failed to update pairing message: %v", err)
+	}
+}
+
+// handleAutocomplete answers autocomplete requests for the focused option.
+func (b *Bot) handleAutocomplete(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	choices := b.autocompleteChoices(i)
+	if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{Choices: choices},
+	}); err != nil {
+		log.Printf("discord: failed to send autocomplete: %v", err)
+	}
+}
+
+// autocompleteChoices returns the suggestions for the focused option. Only
+// the "node" option is autocompleted, and only for users authorized to run
+// the command, since the suggestions list the connected nodes.
+func (b *Bot) autocompleteChoices(i *discordgo.InteractionCreate) []*discordgo.ApplicationCommandOptionChoice {
+	data := i.ApplicationCommandData()
+	if !b.authorized(i, data.Name) {
+		return []*discordgo.ApplicationCommandOptionChoice{}
+	}
+	for _, opt := range data.Options {
+		if opt.Focused && opt.Name == "node" {
+			return b.router.AutocompleteNodes(opt.StringValue())
+		}
 	}
+	return []*discordgo.ApplicationCommandOptionChoice{}
 }
 
 // SlashCommand defines a Discord slash command with options.
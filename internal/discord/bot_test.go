@@ -2,10 +2,18 @@ package discord
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
+	"unicode/utf8"
 
 	"github.com/bwmarrin/discordgo"
+	"github.com/rvald/goclaw/internal/pairing"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -28,6 +36,16 @@ func (m *MockRegistry) List() []*NodeSession {
 	return m.nodes 
 }
 
+func (m *MockRegistry) ListByPlatform(platform string) []*NodeSession {
+    var out []*NodeSession
+    for _, n := range m.nodes {
+        if strings.EqualFold(n.Platform, platform) {
+            out = append(out, n)
+        }
+    }
+    return out
+}
+
 func (m *MockRegistry) Get(id string) (*NodeSession, bool) {
     for _, n := range m.nodes {
         if n.NodeID == id {
@@ -86,12 +104,145 @@ func TestHandler_Snap_Success(t *testing.T) {
         nodes: []*NodeSession{{NodeID: "iphone-1", DisplayName: "Ricardo's iPhone"}},
     }
     router := NewCommandRouter(invoker, registry)
-    resp := router.HandleSnap(context.Background(), "iphone-1", "back", 80)
+    resp := router.HandleSnap(context.Background(), "iphone-1", "back", "", 80)
     assert.True(t, resp.OK)
     assert.Contains(t, resp.Message, "Ricardo's iPhone")
     assert.NotEmpty(t, resp.ImageData) // decoded base64
 }
 
+func TestHandler_Snap_ValidatesOptions(t *testing.T) {
+    tests := []struct {
+        name       string
+        facing     string
+        format     string
+        quality    int
+        wantParams string
+    }{
+        {name: "defaults", facing: "", quality: 0, wantParams: `{"facing":"back","quality":80}`},
+        {name: "quality clamped high", facing: "front", quality: 200, wantParams: `{"facing":"front","quality":100}`},
+        {name: "negative quality defaulted", facing: "back", quality: -5, wantParams: `{"facing":"back","quality":80}`},
+        {name: "facing case-insensitive", facing: "Front", quality: 1, wantParams: `{"facing":"front","quality":1}`},
+        {name: "format requested", facing: "back", format: "JPG", quality: 80, wantParams: `{"facing":"back","format":"jpeg","quality":80}`},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            var got InvokeRequest
+            invoker := &MockInvoker{
+                InvokeFn: func(ctx context.Context, req InvokeRequest) (InvokeResult, error) {
+                    got = req
+                    return InvokeResult{OK: true, PayloadJSON: ptrStr(`{"imageBase64":"iVBORw0KGgo="}`)}, nil
+                },
+            }
+            router := NewCommandRouter(invoker, &MockRegistry{nodes: []*NodeSession{{NodeID: "iphone-1"}}})
+            resp := router.HandleSnap(context.Background(), "", tt.facing, tt.format, tt.quality)
+            require.True(t, resp.OK, resp.Message)
+            assert.Equal(t, tt.wantParams, got.ParamsJSON)
+        })
+    }
+}
+
+func TestHandler_Snap_AttachmentFormat(t *testing.T) {
+    jpeg := base64.StdEncoding.EncodeToString([]byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00"))
+    tests := []struct {
+        name     string
+        payload  string
+        wantName string
+        wantType string
+    }{
+        {name: "reported jpeg", payload: `{"imageBase64":"` + jpeg + `","format":"jpeg"}`, wantName: "snap.jpg", wantType: "image/jpeg"},
+        {name: "reported jpg", payload: `{"imageBase64":"` + jpeg + `","format":"JPG"}`, wantName: "snap.jpg", wantType: "image/jpeg"},
+        {name: "reported png", payload: `{"imageBase64":"iVBORw0KGgo=","format":"png"}`, wantName: "snap.png", wantType: "image/png"},
+        {name: "unreported jpeg is sniffed", payload: `{"imageBase64":"` + jpeg + `"}`, wantName: "snap.jpg", wantType: "image/jpeg"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            invoker := &MockInvoker{
+                InvokeFn: func(ctx context.Context, req InvokeRequest) (InvokeResult, error) {
+                    return InvokeResult{OK: true, PayloadJSON: ptrStr(tt.payload)}, nil
+                },
+            }
+            router := NewCommandRouter(invoker, &MockRegistry{nodes: []*NodeSession{{NodeID: "iphone-1"}}})
+            resp := router.HandleSnap(context.Background(), "", "back", "", 80)
+            require.True(t, resp.OK, resp.Message)
+            assert.Equal(t, tt.wantName, resp.ImageName)
+            assert.Equal(t, tt.wantType, resp.ImageType)
+        })
+    }
+}
+
+func TestHandler_Snap_BadFormat(t *testing.T) {
+    invoker := &MockInvoker{
+        InvokeFn: func(ctx context.Context, req InvokeRequest) (InvokeResult, error) {
+            t.Fatal("invalid format must not reach the device")
+            return InvokeResult{}, nil
+        },
+    }
+    router := NewCommandRouter(invoker, &MockRegistry{nodes: []*NodeSession{{NodeID: "iphone-1"}}})
+    resp := router.HandleSnap(context.Background(), "", "back", "gif", 80)
+    assert.False(t, resp.OK)
+    assert.Contains(t, resp.Message, "gif")
+    for format := range imageContentTypes {
+        assert.Contains(t, resp.Message, format, "accepted formats should all be listed")
+    }
+}
+
+func TestHandler_Snap_BadFacing(t *testing.T) {
+    invoker := &MockInvoker{
+        InvokeFn: func(ctx context.Context, req InvokeRequest) (InvokeResult, error) {
+            t.Fatal("invalid facing must not reach the device")
+            return InvokeResult{}, nil
+        },
+    }
+    router := NewCommandRouter(invoker, &MockRegistry{nodes: []*NodeSession{{NodeID: "iphone-1"}}})
+    resp := router.HandleSnap(context.Background(), "", "sideways", "", 80)
+    assert.False(t, resp.OK)
+    assert.Contains(t, resp.Message, `"sideways"`)
+    assert.Contains(t, resp.Message, "front or back")
+}
+
+func TestHandler_Record_Success(t *testing.T) {
+    video := []byte("\x00\x00\x00\x18ftypmp42 fake video")
+    invoker := &MockInvoker{
+        InvokeFn: func(ctx context.Context, req InvokeRequest) (InvokeResult, error) {
+            assert.Equal(t, "media.record", req.Command)
+            assert.JSONEq(t, `{"durationMs":30000,"facing":"front"}`, req.ParamsJSON, "duration is capped")
+            payload := fmt.Sprintf(`{"videoBase64":%q,"format":"MOV","durationMs":30000,"bytes":%d}`,
+                base64.StdEncoding.EncodeToString(video), len(video))
+            return InvokeResult{OK: true, PayloadJSON: &payload}, nil
+        },
+    }
+    registry := &MockRegistry{
+        nodes: []*NodeSession{{NodeID: "iphone-1", DisplayName: "Ricardo's iPhone"}},
+    }
+    router := NewCommandRouter(invoker, registry)
+    resp := router.HandleRecord(context.Background(), "iphone-1", "front", 600)
+    require.True(t, resp.OK, resp.Message)
+    assert.Contains(t, resp.Message, "Ricardo's iPhone")
+    require.NotNil(t, resp.File)
+    assert.Equal(t, "video/quicktime", resp.File.ContentType)
+    assert.Equal(t, "record.mov", resp.File.Name)
+    got, err := io.ReadAll(resp.File.Reader)
+    require.NoError(t, err)
+    assert.Equal(t, video, got)
+}
+
+func TestHandler_Record_OverLimit(t *testing.T) {
+    big := base64.StdEncoding.EncodeToString(make([]byte, MaxRecordBytes+1))
+    invoker := &MockInvoker{
+        InvokeFn: func(ctx context.Context, req InvokeRequest) (InvokeResult, error) {
+            payload := fmt.Sprintf(`{"videoBase64":%q,"format":"mp4","durationMs":10000}`, big)
+            return InvokeResult{OK: true, PayloadJSON: &payload}, nil
+        },
+    }
+    registry := &MockRegistry{nodes: []*NodeSession{{NodeID: "iphone-1"}}}
+    router := NewCommandRouter(invoker, registry)
+    resp := router.HandleRecord(context.Background(), "", "", DefaultRecordSeconds)
+    assert.False(t, resp.OK)
+    assert.Nil(t, resp.File)
+    assert.Contains(t, resp.Message, "too large")
+    assert.Contains(t, resp.Message, "shorter duration")
+}
+
 func TestHandler_Snap_NodeOffline(t *testing.T) {
     invoker := &MockInvoker{
         InvokeFn: func(ctx context.Context, req InvokeRequest) (InvokeResult, error) {
@@ -100,11 +251,35 @@ func TestHandler_Snap_NodeOffline(t *testing.T) {
     }
     registry := &MockRegistry{nodes: nil}
     router := NewCommandRouter(invoker, registry)
-    resp := router.HandleSnap(context.Background(), "", "back", 80)
+    resp := router.HandleSnap(context.Background(), "", "back", "", 80)
     assert.False(t, resp.OK)
     assert.Contains(t, resp.Message, "No iOS device connected")
 }
 
+func TestRouter_InvokeTimeouts(t *testing.T) {
+    timeouts := map[string]int{}
+    invoker := &MockInvoker{
+        InvokeFn: func(ctx context.Context, req InvokeRequest) (InvokeResult, error) {
+            timeouts[req.Command] = req.TimeoutMs
+            return InvokeResult{OK: false}, nil
+        },
+    }
+    registry := &MockRegistry{nodes: []*NodeSession{{NodeID: "iphone-1"}}}
+    router := NewCommandRouter(invoker, registry)
+
+    run := func() {
+        router.HandleSnap(context.Background(), "iphone-1", "back", "", 80)
+        router.HandleLocate(context.Background(), "iphone-1")
+        router.HandleStatus(context.Background(), "iphone-1")
+    }
+    run()
+    assert.Equal(t, map[string]int{"camera.snap": 30000, "location.get": 15000, "device.status": DefaultInvokeTimeoutMs}, timeouts)
+
+    router.WithInvokeTimeouts(20000, map[string]int{"camera.snap": 60000})
+    run()
+    assert.Equal(t, map[string]int{"camera.snap": 60000, "location.get": 15000, "device.status": 20000}, timeouts)
+}
+
 func TestHandler_Locate_Success(t *testing.T) {
     invoker := &MockInvoker{
         InvokeFn: func(ctx context.Context, req InvokeRequest) (InvokeResult, error) {
@@ -119,8 +294,10 @@ func TestHandler_Locate_Success(t *testing.T) {
         nodes: []*NodeSession{{NodeID: "iphone-1"}},
     }
     router := NewCommandRouter(invoker, registry)
+    router.WithStaticMap("", "")
     resp := router.HandleLocate(context.Background(), "iphone-1")
     assert.True(t, resp.OK)
+    assert.Empty(t, resp.ImageData)
     assert.Contains(t, resp.Message, "40.7128")
     assert.Contains(t, resp.Message, "-74.0060")
     assert.Contains(t, resp.Message, "google.com/maps")
@@ -153,10 +330,56 @@ func TestHandler_Status_Success(t *testing.T) {
     assert.Contains(t, resp.Message, "wifi")
 }
 
+func TestHandler_Info_Success(t *testing.T) {
+    invoker := &MockInvoker{
+        InvokeFn: func(ctx context.Context, req InvokeRequest) (InvokeResult, error) {
+            assert.Equal(t, "device.info", req.Command)
+            return InvokeResult{
+                OK:          true,
+                PayloadJSON: ptrStr(`{"model":"iPhone15,2","osVersion":"17.4","uptimeSec":273600,"freeBytes":128000000000}`),
+            }, nil
+        },
+    }
+    registry := &MockRegistry{
+        nodes: []*NodeSession{{NodeID: "iphone-1", DisplayName: "Ricardo's iPhone", Platform: "ios"}},
+    }
+    router := NewCommandRouter(invoker, registry)
+    resp := router.HandleInfo(context.Background(), "iphone-1")
+    assert.True(t, resp.OK)
+    assert.Contains(t, resp.Message, "Ricardo's iPhone")
+    assert.Contains(t, resp.Message, "iPhone15,2")
+    assert.Contains(t, resp.Message, "ios 17.4")
+    assert.Contains(t, resp.Message, "128.0 GB")
+    assert.Contains(t, resp.Message, "3d 4h")
+    assert.NotContains(t, resp.Message, "unavailable")
+}
+
+func TestHandler_Info_FallsBackToConnectInfo(t *testing.T) {
+    invoker := &MockInvoker{
+        InvokeFn: func(ctx context.Context, req InvokeRequest) (InvokeResult, error) {
+            return InvokeResult{ID: "abc123def4567890"}, fmt.Errorf("invoke timeout after 10000ms")
+        },
+    }
+    registry := &MockRegistry{
+        nodes: []*NodeSession{{
+            NodeID: "iphone-1", Platform: "ios", Version: "1.2.0",
+            ModelIdentifier: "iPhone15,2", DeviceFamily: "iPhone",
+        }},
+    }
+    router := NewCommandRouter(invoker, registry)
+    resp := router.HandleInfo(context.Background(), "iphone-1")
+    assert.True(t, resp.OK)
+    assert.Contains(t, resp.Message, "live info unavailable: invoke timeout")
+    assert.Contains(t, resp.Message, "(request abc123de)")
+    assert.Contains(t, resp.Message, "iPhone15,2")
+    assert.Contains(t, resp.Message, "Family: iPhone")
+    assert.Contains(t, resp.Message, "App version: 1.2.0")
+}
+
 func TestHandler_Nodes_Empty(t *testing.T) {
     registry := &MockRegistry{nodes: nil}
     router := NewCommandRouter(nil, registry) // no invoker needed
-    resp := router.HandleNodes()
+    resp := router.HandleNodes("", "")
     assert.Contains(t, resp.Message, "No nodes connected")
 }
 
@@ -168,32 +391,77 @@ func TestHandler_Nodes_Connected(t *testing.T) {
         },
     }
     router := NewCommandRouter(nil, registry)
-    resp := router.HandleNodes()
+    resp := router.HandleNodes("", "")
     assert.Contains(t, resp.Message, "Ricardo's iPhone")
     assert.Contains(t, resp.Message, "Office iPad")
     assert.Contains(t, resp.Message, "2") // 2 devices
 }
 
+func TestHandler_Nodes_PlatformFilter(t *testing.T) {
+    registry := &MockRegistry{
+        nodes: []*NodeSession{
+            {NodeID: "iphone-1", DisplayName: "Ricardo's iPhone", Platform: "ios", Version: "1.2.0"},
+            {NodeID: "pixel-3", DisplayName: "Test Pixel", Platform: "android", Version: "1.0.0"},
+        },
+    }
+    router := NewCommandRouter(nil, registry)
+
+    resp := router.HandleNodes("android", "")
+    assert.Contains(t, resp.Message, "Test Pixel")
+    assert.NotContains(t, resp.Message, "Ricardo's iPhone")
+
+    resp = router.HandleNodes("macos", "")
+    assert.Contains(t, resp.Message, "No macos nodes connected")
+}
+
+func TestHandler_Nodes_TagFilter(t *testing.T) {
+    registry := &MockRegistry{
+        nodes: []*NodeSession{
+            {NodeID: "lobby-ipad", DisplayName: "Lobby iPad", Platform: "ios", DeviceID: "dev-lobby"},
+            {NodeID: "dock-pixel", DisplayName: "Dock Pixel", Platform: "android", DeviceID: "dev-dock"},
+            {NodeID: "legacy", DisplayName: "Legacy Node", Platform: "ios"},
+        },
+    }
+    store := &MockStore{paired: []PairedDevice{
+        {DeviceID: "dev-lobby", Tags: []string{"floor-1", "lobby"}},
+        {DeviceID: "dev-dock", Tags: []string{"warehouse-3"}},
+    }}
+    router := NewCommandRouter(nil, registry)
+    router.WithPairing(MockPairing{}, store)
+
+    resp := router.HandleNodes("", "Lobby")
+    assert.Contains(t, resp.Message, "Lobby iPad")
+    assert.NotContains(t, resp.Message, "Dock Pixel")
+    assert.NotContains(t, resp.Message, "Legacy Node")
+
+    resp = router.HandleNodes("ios", "warehouse-3")
+    assert.Contains(t, resp.Message, "No ios nodes tagged warehouse-3 connected")
+
+    // Filtering leaves the registry's own slice alone.
+    assert.Len(t, registry.nodes, 3)
+}
+
 func TestHandler_InvokeTimeout(t *testing.T) {
     invoker := &MockInvoker{
         InvokeFn: func(ctx context.Context, req InvokeRequest) (InvokeResult, error) {
-            return InvokeResult{OK: false}, fmt.Errorf("timeout after 30000ms")
+            return InvokeResult{ID: "abc123def4567890", OK: false}, fmt.Errorf("timeout after 30000ms")
         },
     }
     registry := &MockRegistry{
         nodes: []*NodeSession{{NodeID: "iphone-1"}},
     }
     router := NewCommandRouter(invoker, registry)
-    resp := router.HandleSnap(context.Background(), "iphone-1", "back", 80)
+    resp := router.HandleSnap(context.Background(), "iphone-1", "back", "", 80)
     assert.False(t, resp.OK)
     assert.Contains(t, resp.Message, "timed out")
+    assert.Contains(t, resp.Message, "(request abc123de)")
 }
 
 func TestHandler_Notify_Success(t *testing.T) {
     invoker := &MockInvoker{
         InvokeFn: func(ctx context.Context, req InvokeRequest) (InvokeResult, error) {
             assert.Equal(t, "system.notify", req.Command)
-            return InvokeResult{OK: true}, nil
+            return InvokeResult{OK: true, DurationMs: 1234}, nil
         },
     }
     registry := &MockRegistry{
@@ -203,4 +471,890 @@ func TestHandler_Notify_Success(t *testing.T) {
     resp := router.HandleNotify(context.Background(), "iphone-1", "Hello", "Testing notification")
     assert.True(t, resp.OK)
     assert.Contains(t, resp.Message, "sent")
-}
\ No newline at end of file
+    assert.Contains(t, resp.Message, "(took 1.2s)")
+}
+
+type MockStore struct {
+    pending []PendingRequest
+    paired  []PairedDevice
+}
+
+func (m *MockStore) ListPending() []PendingRequest { return m.pending }
+func (m *MockStore) ListPaired() []PairedDevice     { return m.paired }
+
+func (m *MockStore) GetPendingRequest(requestID string) *PendingRequest {
+    for i := range m.pending {
+        if m.pending[i].RequestID == requestID {
+            return &m.pending[i]
+        }
+    }
+    return nil
+}
+
+func (m *MockStore) GetPairedDevice(deviceID string) *PairedDevice {
+    for i := range m.paired {
+        if m.paired[i].DeviceID == deviceID {
+            return &m.paired[i]
+        }
+    }
+    return nil
+}
+
+func (m *MockStore) GetByTag(tag string) []PairedDevice {
+    var out []PairedDevice
+    for _, d := range m.paired {
+        if d.HasTag(tag) {
+            out = append(out, d)
+        }
+    }
+    return out
+}
+
+func TestHandler_Devices_ShowsKeyFingerprint(t *testing.T) {
+    key := base64.RawURLEncoding.EncodeToString(make([]byte, 32))
+    deviceID := pairing.DeriveDeviceID(key)
+    store := &MockStore{
+        paired:  []PairedDevice{{DeviceID: deviceID, PublicKey: key, Platform: "ios"}},
+        pending: []PendingRequest{{RequestID: "req-0123456789", DeviceID: deviceID, PublicKey: key}},
+    }
+    router := NewCommandRouter(nil, &MockRegistry{})
+    router.WithPairing(nil, store)
+
+    resp := router.HandleDevices()
+    assert.True(t, resp.OK)
+    assert.Equal(t, 2, strings.Count(resp.Message, "key `66:68:7a:ad:f8:62:bd:77`"))
+}
+
+// taggingPairing records the tags last set per device.
+type taggingPairing struct {
+    MockPairing
+    tags map[string][]string
+}
+
+func (p *taggingPairing) SetDeviceTags(deviceID string, tags []string) error {
+    if deviceID == "missing" {
+        return pairing.ErrDeviceNotFound
+    }
+    p.tags[deviceID] = tags
+    return nil
+}
+
+func TestHandler_Tag(t *testing.T) {
+    svc := &taggingPairing{tags: map[string][]string{}}
+    router := NewCommandRouter(nil, &MockRegistry{})
+    router.WithPairing(svc, &MockStore{})
+
+    resp := router.HandleTag("device-0123456789abcdef", "Lobby, warehouse-3 lobby")
+    assert.True(t, resp.OK)
+    assert.Equal(t, []string{"lobby", "warehouse-3"}, svc.tags["device-0123456789abcdef"])
+    assert.Contains(t, resp.Message, "`lobby`, `warehouse-3`")
+
+    resp = router.HandleTag("device-0123456789abcdef", "")
+    assert.True(t, resp.OK)
+    assert.Contains(t, resp.Message, "Cleared")
+    assert.Empty(t, svc.tags["device-0123456789abcdef"])
+
+    resp = router.HandleTag("device-0123456789abcdef", "bad/tag")
+    assert.False(t, resp.OK)
+    assert.Contains(t, resp.Message, "invalid character")
+
+    resp = router.HandleTag("missing", "lobby")
+    assert.False(t, resp.OK)
+    assert.Contains(t, resp.Message, "device not found")
+}
+
+func TestHandler_Devices_ShowsTags(t *testing.T) {
+    store := &MockStore{paired: []PairedDevice{{DeviceID: "device-0123456789abcdef", Tags: []string{"lobby", "warehouse-3"}}}}
+    router := NewCommandRouter(nil, &MockRegistry{})
+    router.WithPairing(nil, store)
+
+    assert.Contains(t, router.HandleDevices().Message, "tags `lobby,warehouse-3`")
+    assert.Contains(t, router.HandleDevice("device-0123456789abcdef").Message, "**Tags:** `lobby,warehouse-3`")
+}
+
+func TestHandler_Device(t *testing.T) {
+    key := base64.RawURLEncoding.EncodeToString(make([]byte, 32))
+    deviceID := pairing.DeriveDeviceID(key)
+    store := &MockStore{
+        pending: []PendingRequest{{
+            RequestID:   "req-0123456789",
+            DeviceID:    deviceID,
+            PublicKey:   key,
+            DisplayName: "Kitchen iPhone",
+            Platform:    "ios",
+            ClientID:    "iphone-1",
+            ClientMode:  "node",
+            Role:        "node",
+            Scopes:      []string{"camera", "location"},
+            RemoteIP:    "192.168.1.20",
+            IsRepair:    true,
+            Timestamp:   time.Now().Add(-time.Minute).UnixMilli(),
+        }},
+        paired: []PairedDevice{{
+            DeviceID:     deviceID,
+            PublicKey:    key,
+            DisplayName:  "Kitchen iPhone",
+            Platform:     "ios",
+            ApprovedAtMs: 1700000000000,
+        }},
+    }
+    router := NewCommandRouter(nil, &MockRegistry{})
+    router.WithPairing(nil, store)
+
+    resp := router.HandleDevice("req-0123456789")
+    assert.True(t, resp.OK)
+    assert.True(t, resp.Ephemeral)
+    for _, want := range []string{"Pending Request", deviceID, "66:68:7a:ad:f8:62:bd:77",
+        "iphone-1 (node)", "`camera,location`", "`192.168.1.20`", "**Repair:** yes", "**Age:** 1m0s"} {
+        assert.Contains(t, resp.Message, want)
+    }
+
+    resp = router.HandleDevice(deviceID)
+    assert.True(t, resp.OK)
+    assert.True(t, resp.Ephemeral)
+    for _, want := range []string{"Paired Device", deviceID, "66:68:7a:ad:f8:62:bd:77",
+        "<t:1700000000:R>", "never used"} {
+        assert.Contains(t, resp.Message, want)
+    }
+
+    resp = router.HandleDevice("unknown")
+    assert.False(t, resp.OK)
+    assert.True(t, resp.Ephemeral)
+    assert.Contains(t, resp.Message, "No pending request or paired device found for `unknown`")
+}
+
+func TestHandler_Devices_Paginated(t *testing.T) {
+    store := &MockStore{}
+    for i := 0; i < 50; i++ {
+        store.paired = append(store.paired, PairedDevice{
+            DeviceID:    fmt.Sprintf("%064x", i),
+            DisplayName: fmt.Sprintf("Synthetic Device %02d with a fairly long display name", i),
+            Platform:    "ios",
+        })
+    }
+    router := NewCommandRouter(nil, &MockRegistry{})
+    router.WithPairing(nil, store)
+
+    resp := router.HandleDevices()
+    assert.True(t, resp.OK)
+    require.NotEmpty(t, resp.Messages, "output should span multiple messages")
+
+    pages := append([]string{resp.Message}, resp.Messages...)
+    total := 0
+    for _, page := range pages {
+        assert.LessOrEqual(t, len(page), MaxMessageLen)
+        assert.True(t, strings.HasSuffix(page, "\n"), "page should end on an entry boundary")
+        total += strings.Count(page, "• ")
+    }
+    assert.Equal(t, 50, total)
+    assert.Contains(t, resp.Message, "**Paired Devices** (50)")
+}
+
+func TestHandler_Nodes_Paginated(t *testing.T) {
+    registry := &MockRegistry{}
+    for i := 0; i < 50; i++ {
+        registry.nodes = append(registry.nodes, &NodeSession{
+            NodeID:      fmt.Sprintf("node-%02d-%s", i, strings.Repeat("x", 32)),
+            DisplayName: fmt.Sprintf("Synthetic iPhone %02d", i),
+            Platform:    "ios",
+            Version:     "1.2.0",
+        })
+    }
+    router := NewCommandRouter(nil, registry)
+
+    resp := router.HandleNodes("", "")
+    require.NotEmpty(t, resp.Messages)
+    for _, page := range append([]string{resp.Message}, resp.Messages...) {
+        assert.LessOrEqual(t, len(page), MaxMessageLen)
+    }
+    assert.Contains(t, resp.Messages[len(resp.Messages)-1], "Synthetic iPhone 49")
+}
+
+func TestPaginate_SinglePage(t *testing.T) {
+    pages := paginate("header\n", []string{"a\n", "b\n"}, MaxMessageLen)
+    assert.Equal(t, []string{"header\na\nb\n"}, pages)
+}
+
+func TestHandler_Status_Embed(t *testing.T) {
+    invoker := &MockInvoker{
+        InvokeFn: func(ctx context.Context, req InvokeRequest) (InvokeResult, error) {
+            return InvokeResult{
+                OK:          true,
+                PayloadJSON: ptrStr(`{"battery":{"level":0.5,"state":"unplugged"},"thermal":{"state":"fair"},"storage":{"totalBytes":64000000000,"availableBytes":32000000000},"network":{"type":"wifi","ssid":"HomeWifi"}}`),
+            }, nil
+        },
+    }
+    registry := &MockRegistry{nodes: []*NodeSession{{NodeID: "iphone-1", DisplayName: "Ricardo's iPhone"}}}
+    router := NewCommandRouter(invoker, registry)
+
+    resp := router.HandleStatus(context.Background(), "iphone-1")
+    require.NotNil(t, resp.Embed)
+    assert.Contains(t, resp.Embed.Title, "Ricardo's iPhone")
+    require.Len(t, resp.Embed.Fields, 4)
+    assert.Equal(t, "50% (unplugged)", resp.Embed.Fields[0].Value)
+    assert.Equal(t, "fair", resp.Embed.Fields[1].Value)
+    assert.Equal(t, "wifi (HomeWifi)", resp.Embed.Fields[2].Value)
+    assert.Contains(t, resp.Embed.Fields[3].Value, "32 GB / 64 GB")
+    assert.Contains(t, resp.Message, "50%") // plain-text fallback kept
+}
+
+func TestHandler_Locate_Embed(t *testing.T) {
+    invoker := &MockInvoker{
+        InvokeFn: func(ctx context.Context, req InvokeRequest) (InvokeResult, error) {
+            return InvokeResult{
+                OK:          true,
+                PayloadJSON: ptrStr(`{"latitude":40.7128,"longitude":-74.0060,"altitude":10.5,"accuracy":5.0}`),
+            }, nil
+        },
+    }
+    registry := &MockRegistry{nodes: []*NodeSession{{NodeID: "iphone-1"}}}
+    router := NewCommandRouter(invoker, registry)
+    router.WithStaticMap("", "")
+
+    resp := router.HandleLocate(context.Background(), "iphone-1")
+    require.NotNil(t, resp.Embed)
+    assert.Contains(t, resp.Embed.URL, "google.com/maps")
+    assert.Nil(t, resp.Embed.Image, "no provider, no map image")
+    require.Len(t, resp.Embed.Fields, 3)
+    assert.Equal(t, "40.712800, -74.006000", resp.Embed.Fields[0].Value)
+    assert.Equal(t, "±5m", resp.Embed.Fields[1].Value)
+}
+
+func TestHandler_Locate_StaticMap(t *testing.T) {
+    png := []byte("\x89PNG\r\n\x1a\nfake map")
+    var gotQuery string
+    provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        gotQuery = r.URL.RawQuery
+        w.Header().Set("Content-Type", "image/png")
+        w.Write(png)
+    }))
+    defer provider.Close()
+
+    invoker := &MockInvoker{
+        InvokeFn: func(ctx context.Context, req InvokeRequest) (InvokeResult, error) {
+            return InvokeResult{
+                OK:          true,
+                PayloadJSON: ptrStr(`{"latitude":40.7128,"longitude":-74.0060,"altitude":10.5,"accuracy":5.0}`),
+            }, nil
+        },
+    }
+    registry := &MockRegistry{nodes: []*NodeSession{{NodeID: "iphone-1"}}}
+    router := NewCommandRouter(invoker, registry)
+    router.WithStaticMap(provider.URL+"/map?center={lat},{lon}&key={key}", "secret key")
+
+    resp := router.HandleLocate(context.Background(), "iphone-1")
+    require.True(t, resp.OK)
+    assert.Equal(t, png, resp.ImageData)
+    assert.Equal(t, "location.png", resp.ImageName)
+    assert.Equal(t, "center=40.712800,-74.006000&key=secret+key", gotQuery)
+    require.NotNil(t, resp.Embed.Image)
+    assert.Equal(t, "attachment://location.png", resp.Embed.Image.URL)
+    assert.Contains(t, resp.Message, "±5m") // caption kept
+    assert.NotContains(t, resp.Embed.URL, "secret")
+}
+
+func TestHandler_Locate_StaticMapFailureFallsBack(t *testing.T) {
+    provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        http.Error(w, "quota exceeded", http.StatusTooManyRequests)
+    }))
+    defer provider.Close()
+
+    invoker := &MockInvoker{
+        InvokeFn: func(ctx context.Context, req InvokeRequest) (InvokeResult, error) {
+            return InvokeResult{OK: true, PayloadJSON: ptrStr(`{"latitude":1,"longitude":2}`)}, nil
+        },
+    }
+    registry := &MockRegistry{nodes: []*NodeSession{{NodeID: "iphone-1"}}}
+    router := NewCommandRouter(invoker, registry)
+    router.WithStaticMap(provider.URL+"/map?c={lat},{lon}", "")
+
+    resp := router.HandleLocate(context.Background(), "iphone-1")
+    assert.True(t, resp.OK)
+    assert.Empty(t, resp.ImageData)
+    assert.Nil(t, resp.Embed.Image)
+    assert.Contains(t, resp.Message, "google.com/maps")
+}
+
+func TestHandler_Nodes_Embed(t *testing.T) {
+    registry := &MockRegistry{
+        nodes: []*NodeSession{
+            {NodeID: "iphone-1", DisplayName: "Ricardo's iPhone", Platform: "ios", Version: "1.2.0"},
+            {NodeID: "ipad-2", Platform: "ios", Version: "1.1.0"},
+        },
+    }
+    router := NewCommandRouter(nil, registry)
+
+    resp := router.HandleNodes("", "")
+    require.NotNil(t, resp.Embed)
+    require.Len(t, resp.Embed.Fields, 2)
+    assert.Equal(t, "Ricardo's iPhone", resp.Embed.Fields[0].Name)
+    assert.Contains(t, resp.Embed.Fields[0].Value, "iphone-1")
+    assert.Equal(t, "ipad-2", resp.Embed.Fields[1].Name) // falls back to node ID
+}
+
+func TestRouter_AutocompleteNodes(t *testing.T) {
+    registry := &MockRegistry{
+        nodes: []*NodeSession{
+            {NodeID: "iphone-1", DisplayName: "Ricardo's iPhone"},
+            {NodeID: "ipad-2", DisplayName: "Office iPad"},
+            {NodeID: "iphone-3"},
+        },
+    }
+    router := NewCommandRouter(nil, registry)
+
+    choices := router.AutocompleteNodes("iph")
+    require.Len(t, choices, 2)
+    assert.Equal(t, "Ricardo's iPhone", choices[0].Name)
+    assert.Equal(t, "iphone-1", choices[0].Value)
+    assert.Equal(t, "iphone-3", choices[1].Name) // unnamed node labelled by ID
+
+    choices = router.AutocompleteNodes("office")
+    require.Len(t, choices, 1)
+    assert.Equal(t, "ipad-2", choices[0].Value)
+
+    assert.Len(t, router.AutocompleteNodes(""), 3)
+    assert.Empty(t, router.AutocompleteNodes("android"))
+}
+
+func TestRouter_NodeOptionsAutocomplete(t *testing.T) {
+    router := NewCommandRouter(nil, &MockRegistry{})
+    for _, cmd := range router.Commands() {
+        for _, opt := range cmd.Options {
+            if opt.Name == "node" {
+                assert.True(t, opt.Autocomplete, "/%s node option", cmd.Name)
+            }
+        }
+    }
+}
+
+func TestBot_AutocompleteRequiresAuthorization(t *testing.T) {
+    bot, err := NewBot(BotConfig{Token: "t", Admins: []string{"user-admin"}})
+    require.NoError(t, err)
+    bot.SetRouter(NewCommandRouter(nil, &MockRegistry{
+        nodes: []*NodeSession{{NodeID: "iphone-1", DisplayName: "Ricardo's iPhone"}},
+    }))
+
+    autocomplete := func(userID string) *discordgo.InteractionCreate {
+        return &discordgo.InteractionCreate{Interaction: &discordgo.Interaction{
+            Type:   discordgo.InteractionApplicationCommandAutocomplete,
+            Member: &discordgo.Member{User: &discordgo.User{ID: userID}},
+            Data: discordgo.ApplicationCommandInteractionData{
+                Name: "snap",
+                Options: []*discordgo.ApplicationCommandInteractionDataOption{
+                    {Name: "node", Type: discordgo.ApplicationCommandOptionString, Value: "iph", Focused: true},
+                },
+            },
+        }}
+    }
+
+    assert.Len(t, bot.autocompleteChoices(autocomplete("user-admin")), 1)
+    assert.Empty(t, bot.autocompleteChoices(autocomplete("user-random")), "node IDs hidden from unauthorized users")
+}
+
+func TestBot_Authorization(t *testing.T) {
+    bot, err := NewBot(BotConfig{Token: "t", Admins: []string{"user-admin", "role-ops"}})
+    require.NoError(t, err)
+
+    guildUser := func(id string, roles ...string) *discordgo.InteractionCreate {
+        return &discordgo.InteractionCreate{Interaction: &discordgo.Interaction{
+            Member: &discordgo.Member{User: &discordgo.User{ID: id}, Roles: roles},
+        }}
+    }
+
+    assert.False(t, bot.authorized(guildUser("user-random"), "approve"), "unauthorized user blocked")
+    assert.True(t, bot.authorized(guildUser("user-admin"), "approve"), "admin user passes")
+    assert.True(t, bot.authorized(guildUser("user-random", "role-ops"), "snap"), "admin role passes")
+    assert.False(t, bot.authorized(guildUser("user-random"), "nodes"), "read-only command gated by default")
+    assert.True(t, bot.authorized(guildUser("user-random"), "custom"), "non-privileged command open")
+
+    dm := &discordgo.InteractionCreate{Interaction: &discordgo.Interaction{User: &discordgo.User{ID: "user-admin"}}}
+    assert.True(t, bot.authorized(dm, "revoke"), "DM user ID honoured")
+}
+
+func TestBot_AuthorizationOpenWithoutAdmins(t *testing.T) {
+    bot, err := NewBot(BotConfig{Token: "t"})
+    require.NoError(t, err)
+    i := &discordgo.InteractionCreate{Interaction: &discordgo.Interaction{User: &discordgo.User{ID: "anyone"}}}
+    assert.True(t, bot.authorized(i, "approve"))
+}
+
+func TestBot_AuthorizationCustomPrivileged(t *testing.T) {
+    bot, err := NewBot(BotConfig{Token: "t", Admins: []string{"user-admin"}, PrivilegedCommands: []string{"nodes"}})
+    require.NoError(t, err)
+    i := &discordgo.InteractionCreate{Interaction: &discordgo.Interaction{User: &discordgo.User{ID: "someone"}}}
+    assert.False(t, bot.authorized(i, "nodes"))
+    assert.True(t, bot.authorized(i, "approve"))
+}
+
+type MockPairing struct{}
+
+func (MockPairing) Approve(requestID string) (*PairedDevice, error) {
+    return &PairedDevice{DeviceID: "device-0123456789abcdef"}, nil
+}
+func (MockPairing) ApproveWithScopes(requestID string, scopes []string) (*PairedDevice, error) {
+    return &PairedDevice{DeviceID: "device-0123456789abcdef"}, nil
+}
+func (MockPairing) Reject(requestID string) (*PendingRequest, error) {
+    return &PendingRequest{DeviceID: "device-0123456789abcdef"}, nil
+}
+func (MockPairing) RenameDevice(deviceID, name string) error { return nil }
+func (MockPairing) SetDeviceTags(deviceID string, tags []string) error { return nil }
+func (MockPairing) RevokeDeviceToken(deviceID, role string) *pairing.DeviceAuthToken {
+    return &pairing.DeviceAuthToken{Role: role}
+}
+
+func TestHandler_PairingResponsesEphemeral(t *testing.T) {
+    router := NewCommandRouter(nil, &MockRegistry{})
+    router.WithPairing(MockPairing{}, &MockStore{})
+
+    for name, resp := range map[string]CommandResponse{
+        "devices": router.HandleDevices(),
+        "approve": router.HandleApprove("req-12345678", ""),
+        "reject":  router.HandleReject("req-12345678"),
+        "revoke":  router.HandleRevoke("device-0123456789abcdef", ""),
+    } {
+        assert.True(t, resp.OK, name)
+        assert.True(t, resp.Ephemeral, "/%s response should be ephemeral", name)
+        assert.True(t, ephemeralCommands[name], "/%s should defer ephemerally", name)
+    }
+
+    // Errors are kept private too.
+    assert.True(t, router.HandleApprove("", "").Ephemeral)
+
+    assert.False(t, router.HandleNodes("", "").Ephemeral)
+    assert.False(t, ephemeralCommands["snap"])
+}
+
+// recordingPairing records approvals, failing those listed in fail.
+type recordingPairing struct {
+    MockPairing
+    approved []string
+    fail     map[string]bool
+}
+
+func (p *recordingPairing) Approve(requestID string) (*PairedDevice, error) {
+    if p.fail[requestID] {
+        return nil, fmt.Errorf("store write failed")
+    }
+    p.approved = append(p.approved, requestID)
+    return &PairedDevice{DeviceID: "device-" + requestID}, nil
+}
+
+func TestHandler_ApproveAll(t *testing.T) {
+    now := time.Now().UnixMilli()
+    store := &MockStore{pending: []PendingRequest{
+        {RequestID: "req-ios-new", Platform: "ios", Timestamp: now - 60_000},
+        {RequestID: "req-ios-old", Platform: "ios", Timestamp: now - 3_600_000},
+        {RequestID: "req-android", Platform: "android", Timestamp: now - 60_000},
+        {RequestID: "req-ios-repair", Platform: "ios", Timestamp: now - 60_000, IsRepair: true},
+        {RequestID: "req-ios-operator", Platform: "ios", Role: "operator", Scopes: []string{"operator.admin"}, Timestamp: now - 60_000},
+    }}
+    codeFor := func(ids ...string) string {
+        var reqs []PendingRequest
+        for _, id := range ids {
+            reqs = append(reqs, PendingRequest{RequestID: id})
+        }
+        return pairing.BatchCode(reqs)
+    }
+
+    t.Run("without confirm only lists", func(t *testing.T) {
+        svc := &recordingPairing{}
+        router := NewCommandRouter(nil, &MockRegistry{})
+        router.WithPairing(svc, store)
+        resp := router.HandleApproveAll("ios", "", "")
+        assert.True(t, resp.Ephemeral)
+        assert.Contains(t, resp.Message, "would approve 2 request(s)")
+        assert.Contains(t, resp.Message, "req-ios-new")
+        assert.Contains(t, resp.Message, "req-ios-old")
+        assert.Contains(t, resp.Message, "confirm: "+codeFor("req-ios-new", "req-ios-old"))
+        assert.NotContains(t, resp.Message, "req-ios-repair")
+        assert.NotContains(t, resp.Message, "req-ios-operator")
+        assert.Empty(t, svc.approved)
+    })
+
+    t.Run("filters by platform and age", func(t *testing.T) {
+        svc := &recordingPairing{}
+        router := NewCommandRouter(nil, &MockRegistry{})
+        router.WithPairing(svc, store)
+        resp := router.HandleApproveAll("iOS", "10m", codeFor("req-ios-new"))
+        assert.True(t, resp.OK, resp.Message)
+        assert.Contains(t, resp.Message, "Approved 1 of 1")
+        assert.Equal(t, []string{"req-ios-new"}, svc.approved)
+    })
+
+    t.Run("refuses a code for other requests", func(t *testing.T) {
+        // The preview listed two requests; a third arrived since.
+        svc := &recordingPairing{}
+        router := NewCommandRouter(nil, &MockRegistry{})
+        router.WithPairing(svc, store)
+        resp := router.HandleApproveAll("", "", codeFor("req-ios-new", "req-ios-old"))
+        assert.False(t, resp.OK)
+        assert.Contains(t, resp.Message, "changed since the preview")
+        assert.Empty(t, svc.approved)
+    })
+
+    t.Run("reports failures", func(t *testing.T) {
+        svc := &recordingPairing{fail: map[string]bool{"req-android": true}}
+        router := NewCommandRouter(nil, &MockRegistry{})
+        router.WithPairing(svc, store)
+        resp := router.HandleApproveAll("", "", codeFor("req-ios-new", "req-ios-old", "req-android"))
+        assert.False(t, resp.OK)
+        assert.Contains(t, resp.Message, "Approved 2 of 3")
+        assert.Contains(t, resp.Message, "req-android")
+        assert.ElementsMatch(t, []string{"req-ios-new", "req-ios-old"}, svc.approved)
+    })
+
+    t.Run("bad since", func(t *testing.T) {
+        router := NewCommandRouter(nil, &MockRegistry{})
+        router.WithPairing(&recordingPairing{}, store)
+        resp := router.HandleApproveAll("", "yesterday", "x")
+        assert.False(t, resp.OK)
+        assert.Contains(t, resp.Message, "yesterday")
+    })
+}
+
+func TestParsePairingCustomID(t *testing.T) {
+    action, requestID, ok := parsePairingCustomID("pairing:approve:req-123")
+    assert.True(t, ok)
+    assert.Equal(t, "approve", action)
+    assert.Equal(t, "req-123", requestID)
+
+    action, requestID, ok = parsePairingCustomID("pairing:reject:req-456")
+    assert.True(t, ok)
+    assert.Equal(t, "reject", action)
+    assert.Equal(t, "req-456", requestID)
+
+    for _, bad := range []string{"", "pairing:", "pairing:approve:", "pairing:revoke:req-1", "other:approve:req-1"} {
+        _, _, ok := parsePairingCustomID(bad)
+        assert.False(t, ok, bad)
+    }
+}
+
+func TestPendingNotification_Buttons(t *testing.T) {
+    msg := PendingNotification(PendingRequest{RequestID: "req-123", DeviceID: "device-0123456789abcdef", DisplayName: "New iPhone"})
+    assert.Contains(t, msg.Content, "New iPhone")
+    require.Len(t, msg.Components, 1)
+    row := msg.Components[0].(discordgo.ActionsRow)
+    require.Len(t, row.Components, 2)
+    approve := row.Components[0].(discordgo.Button)
+    reject := row.Components[1].(discordgo.Button)
+    assert.Equal(t, "pairing:approve:req-123", approve.CustomID)
+    assert.Equal(t, "pairing:reject:req-123", reject.CustomID)
+    assert.False(t, approve.Disabled)
+}
+
+func TestHandler_ComponentDispatch(t *testing.T) {
+    router := NewCommandRouter(nil, &MockRegistry{})
+    router.WithPairing(MockPairing{}, &MockStore{})
+
+    resp := router.HandleComponent("pairing:approve:req-123")
+    assert.True(t, resp.OK)
+    assert.Contains(t, resp.Message, "Approved")
+
+    resp = router.HandleComponent("pairing:reject:req-123")
+    assert.True(t, resp.OK)
+    assert.Contains(t, resp.Message, "Rejected")
+
+    resp = router.HandleComponent("bogus")
+    assert.False(t, resp.OK)
+}
+
+func TestHandler_Clipboard_Read(t *testing.T) {
+    invoker := &MockInvoker{
+        InvokeFn: func(ctx context.Context, req InvokeRequest) (InvokeResult, error) {
+            assert.Equal(t, "clipboard.get", req.Command)
+            return InvokeResult{OK: true, PayloadJSON: ptrStr(`{"text":"https://example.com/article"}`)}, nil
+        },
+    }
+    registry := &MockRegistry{nodes: []*NodeSession{{NodeID: "iphone-1", DisplayName: "Ricardo's iPhone"}}}
+    router := NewCommandRouter(invoker, registry)
+
+    resp := router.HandleClipboard(context.Background(), "iphone-1", "")
+    assert.True(t, resp.OK)
+    assert.True(t, resp.Ephemeral)
+    assert.Contains(t, resp.Message, "> https://example.com/article")
+}
+
+func TestHandler_Clipboard_ReadEmptyAndLong(t *testing.T) {
+    payload := `{"text":""}`
+    invoker := &MockInvoker{
+        InvokeFn: func(ctx context.Context, req InvokeRequest) (InvokeResult, error) {
+            return InvokeResult{OK: true, PayloadJSON: ptrStr(payload)}, nil
+        },
+    }
+    registry := &MockRegistry{nodes: []*NodeSession{{NodeID: "iphone-1", DisplayName: "Ricardo's iPhone"}}}
+    router := NewCommandRouter(invoker, registry)
+
+    resp := router.HandleClipboard(context.Background(), "iphone-1", "")
+    assert.True(t, resp.OK)
+    assert.Contains(t, resp.Message, "empty")
+
+    payload = fmt.Sprintf(`{"text":%q}`, strings.Repeat("é", 3000))
+    resp = router.HandleClipboard(context.Background(), "iphone-1", "")
+    assert.True(t, resp.OK)
+    assert.LessOrEqual(t, len(resp.Message), MaxMessageLen)
+    assert.Contains(t, resp.Message, "truncated")
+}
+
+func TestHandler_Clipboard_Write(t *testing.T) {
+    var got InvokeRequest
+    invoker := &MockInvoker{
+        InvokeFn: func(ctx context.Context, req InvokeRequest) (InvokeResult, error) {
+            got = req
+            return InvokeResult{OK: true}, nil
+        },
+    }
+    registry := &MockRegistry{nodes: []*NodeSession{{NodeID: "iphone-1", DisplayName: "Ricardo's iPhone"}}}
+    router := NewCommandRouter(invoker, registry)
+
+    resp := router.HandleClipboard(context.Background(), "iphone-1", "hello \"world\"")
+    assert.True(t, resp.OK)
+    assert.Equal(t, "clipboard.set", got.Command)
+    assert.JSONEq(t, `{"text":"hello \"world\""}`, got.ParamsJSON)
+    assert.Contains(t, resp.Message, "Copied 13 characters")
+
+    got = InvokeRequest{}
+    resp = router.HandleClipboard(context.Background(), "iphone-1", strings.Repeat("x", MaxClipboardLen+1))
+    assert.False(t, resp.OK)
+    assert.Contains(t, resp.Message, "too long")
+    assert.Empty(t, got.Command, "oversized text should not reach the device")
+
+    // The cap counts characters, not bytes.
+    resp = router.HandleClipboard(context.Background(), "iphone-1", strings.Repeat("é", MaxClipboardLen))
+    assert.True(t, resp.OK)
+    assert.Equal(t, "clipboard.set", got.Command)
+}
+
+func TestPresenceText(t *testing.T) {
+    assert.Equal(t, "no devices", presenceText(0))
+    assert.Equal(t, "1 device", presenceText(1))
+    assert.Equal(t, "2 devices", presenceText(2))
+    assert.Equal(t, "12 devices", presenceText(12))
+}
+
+func TestBot_NodesChangedWithoutSession(t *testing.T) {
+    bot, err := NewBot(BotConfig{Token: "t"})
+    require.NoError(t, err)
+    bot.SetRegistry(&MockRegistry{})
+    bot.NodesChanged()
+    bot.NodesChanged() // coalesced into the pending update
+    require.NoError(t, bot.Stop())
+}
+
+func TestBot_Cooldown(t *testing.T) {
+    bot, err := NewBot(BotConfig{Token: "t", Cooldown: 10 * time.Second})
+    require.NoError(t, err)
+    now := time.Unix(1700000000, 0)
+    bot.cooldown.now = func() time.Time { return now }
+
+    user := func(id string) *discordgo.InteractionCreate {
+        return &discordgo.InteractionCreate{Interaction: &discordgo.Interaction{
+            Member: &discordgo.Member{User: &discordgo.User{ID: id}},
+        }}
+    }
+
+    _, wait := bot.onCooldown(user("u1"), "snap")
+    assert.False(t, wait, "first use passes")
+
+    now = now.Add(4 * time.Second)
+    remaining, wait := bot.onCooldown(user("u1"), "snap")
+    assert.True(t, wait, "second use within the window is rejected")
+    assert.Equal(t, 6*time.Second, remaining)
+
+    _, wait = bot.onCooldown(user("u2"), "snap")
+    assert.False(t, wait, "cooldown is per user")
+    _, wait = bot.onCooldown(user("u1"), "locate")
+    assert.False(t, wait, "cooldown is per command")
+    _, wait = bot.onCooldown(user("u1"), "nodes")
+    assert.False(t, wait, "read-only commands have no cooldown")
+
+    now = now.Add(6 * time.Second)
+    _, wait = bot.onCooldown(user("u1"), "snap")
+    assert.False(t, wait, "use after the window passes")
+}
+
+func TestCooldowns_Prune(t *testing.T) {
+    c := newCooldowns(time.Second)
+    now := time.Unix(1700000000, 0)
+    c.now = func() time.Time { return now }
+
+    for i := 0; i < 50; i++ {
+        c.allow(fmt.Sprintf("user-%d", i), "snap")
+    }
+    now = now.Add(2 * time.Second)
+    c.allow("user-new", "snap")
+    assert.Len(t, c.last, 1, "expired entries pruned")
+}
+
+type fakeDeleter struct {
+    deleted []string
+    fail    map[string]bool
+}
+
+func (f *fakeDeleter) ApplicationCommandDelete(appID, guildID, cmdID string, options ...discordgo.RequestOption) error {
+    if f.fail[cmdID] {
+        return fmt.Errorf("discord 500")
+    }
+    f.deleted = append(f.deleted, cmdID)
+    return nil
+}
+
+func TestBot_TrackCommand(t *testing.T) {
+    bot, err := NewBot(BotConfig{Token: "t"})
+    require.NoError(t, err)
+    bot.trackCommand(&discordgo.ApplicationCommand{ID: "1", Name: "snap"})
+    bot.trackCommand(nil)                                        // failed create
+    bot.trackCommand(&discordgo.ApplicationCommand{Name: "nodes"}) // no ID to delete by
+    bot.trackCommand(&discordgo.ApplicationCommand{ID: "2", Name: "locate"})
+    require.Len(t, bot.created, 2)
+    assert.Equal(t, "1", bot.created[0].ID)
+    assert.Equal(t, "2", bot.created[1].ID)
+}
+
+func TestDeleteCommands_PartialFailure(t *testing.T) {
+    cmds := []*discordgo.ApplicationCommand{
+        {ID: "1", Name: "snap"}, {ID: "2", Name: "locate"}, {ID: "3", Name: "nodes"},
+    }
+    d := &fakeDeleter{fail: map[string]bool{"2": true}}
+
+    remaining, err := deleteCommands(context.Background(), d, "app", "guild", cmds)
+    require.Error(t, err)
+    assert.Contains(t, err.Error(), "locate")
+    assert.Equal(t, []string{"1", "3"}, d.deleted, "a failure does not stop the rest")
+    require.Len(t, remaining, 1)
+    assert.Equal(t, "2", remaining[0].ID)
+}
+
+func TestDeleteCommands_StopsAtDeadline(t *testing.T) {
+    cmds := []*discordgo.ApplicationCommand{{ID: "1"}, {ID: "2"}}
+    d := &fakeDeleter{}
+    ctx, cancel := context.WithCancel(context.Background())
+    cancel()
+
+    remaining, err := deleteCommands(ctx, d, "app", "guild", cmds)
+    assert.ErrorIs(t, err, context.Canceled)
+    assert.Empty(t, d.deleted)
+    assert.Len(t, remaining, 2)
+}
+
+func TestFormatEvents(t *testing.T) {
+    at := time.Date(2026, 1, 2, 15, 4, 5, 0, time.Local)
+    msg := formatEvents([]botEvent{
+        {At: at, Title: "Node connected", Body: "iPhone (`iphone-1`, ios)"},
+        {At: at, Title: "Gateway shutting down"},
+    }, 0, MaxMessageLen)
+    assert.Equal(t, "`15:04:05` **Node connected** — iPhone (`iphone-1`, ios)\n`15:04:05` **Gateway shutting down**", msg)
+}
+
+func TestFormatEvents_Overflow(t *testing.T) {
+    events := make([]botEvent, 200)
+    for i := range events {
+        events[i] = botEvent{At: time.Now(), Title: "Node disconnected", Body: fmt.Sprintf("`node-%03d`", i)}
+    }
+    msg := formatEvents(events, 5, MaxMessageLen)
+    assert.LessOrEqual(t, len(msg), MaxMessageLen)
+    shown := strings.Count(msg, "**Node disconnected**")
+    assert.Contains(t, msg, fmt.Sprintf("…and %d more", 200-shown+5))
+}
+
+func TestBot_PostEventWithoutChannel(t *testing.T) {
+    bot, err := NewBot(BotConfig{Token: "t"})
+    require.NoError(t, err)
+    bot.PostEvent("Node connected", "iphone-1")
+    assert.Empty(t, bot.events, "no channel configured")
+    assert.Nil(t, bot.eventsTimer)
+
+    bot, err = NewBot(BotConfig{Token: "t", EventsChannelID: "chan"})
+    require.NoError(t, err)
+    bot.PostEvent("Node connected", "iphone-1")
+    bot.PostEvent("Node disconnected", "iphone-1")
+    assert.Len(t, bot.events, 2, "batched until the window elapses")
+    require.NoError(t, bot.Stop()) // flushes without a session
+    assert.Empty(t, bot.events)
+}
+
+type mockOperators []*OperatorSession
+
+func (m mockOperators) List() []*OperatorSession { return m }
+
+func TestHandler_Operators(t *testing.T) {
+    router := NewCommandRouter(nil, &MockRegistry{})
+    assert.False(t, router.HandleOperators().OK)
+    for _, c := range router.Commands() {
+        assert.NotEqual(t, "operators", c.Name, "/operators needs an operator registry")
+    }
+
+    router.WithOperators(mockOperators{})
+    resp := router.HandleOperators()
+    assert.Contains(t, resp.Message, "No operators connected")
+
+    op := &OperatorSession{ClientID: "console", DisplayName: "Ops Console", Platform: "macos",
+        Scopes: []string{"operator.admin"}, DeviceID: "device-0123456789abcdef", ConnectedAt: time.Unix(1700000000, 0)}
+    router.WithOperators(mockOperators{op})
+    resp = router.HandleOperators()
+    assert.True(t, resp.OK)
+    assert.True(t, resp.Ephemeral)
+    assert.Contains(t, resp.Message, "1 operator(s) connected")
+    assert.Contains(t, resp.Message, "**Ops Console** (`console`, macos)")
+    assert.Contains(t, resp.Message, "scopes `operator.admin`")
+    assert.Contains(t, resp.Message, "device `device-01234`")
+    assert.Contains(t, resp.Message, "<t:1700000000:R>")
+}
+
+func TestPendingNotification_EscapesName(t *testing.T) {
+    msg := PendingNotification(PendingRequest{RequestID: "req-1", DeviceID: "device-0123456789abcdef", DisplayName: "@everyone **hi**", Platform: "<@&123>"})
+    assert.NotContains(t, msg.Content, "@everyone")
+    assert.NotContains(t, msg.Content, "**hi**")
+    assert.NotContains(t, msg.Content, "<@&123>")
+    require.NotNil(t, msg.AllowedMentions)
+    assert.Empty(t, msg.AllowedMentions.Parse)
+}
+
+// hostilePairing approves and rejects devices whose names try to format
+// the reply and mention everyone.
+type hostilePairing struct{ MockPairing }
+
+func (hostilePairing) Approve(requestID string) (*PairedDevice, error) {
+    return &PairedDevice{DeviceID: "device-0123456789abcdef", DisplayName: "@everyone **hi**"}, nil
+}
+func (hostilePairing) Reject(requestID string) (*PendingRequest, error) {
+    return &PendingRequest{DeviceID: "device-0123456789abcdef", DisplayName: "@everyone **hi**"}, nil
+}
+
+func TestRouter_RepliesEscapeClientNames(t *testing.T) {
+    router := NewCommandRouter(nil, &MockRegistry{
+        nodes: []*NodeSession{{NodeID: "iphone-1", DisplayName: "@everyone **hi**", Platform: "<@&123>"}},
+    })
+    router.WithPairing(hostilePairing{}, &MockStore{})
+
+    for name, resp := range map[string]CommandResponse{
+        "approve": router.HandleApprove("req-12345678", ""),
+        "reject":  router.HandleReject("req-12345678"),
+        "nodes":   router.HandleNodes("", ""),
+    } {
+        msg := resp.Message
+        for _, m := range resp.Messages {
+            msg += m
+        }
+        assert.NotContains(t, msg, "@everyone", name)
+        assert.NotContains(t, msg, "**hi**", name)
+        assert.NotContains(t, msg, "<@&123>", name)
+    }
+}
+
+func TestSafeName(t *testing.T) {
+    assert.Equal(t, "New iPhone", SafeName("New iPhone"))
+    assert.Equal(t, "a b", SafeName("a\n\tb"))
+    assert.Equal(t, `\*\*bold\*\* \_x\_ \`+"`"+`code\`+"`", SafeName("**bold** _x_ `code`"))
+    assert.Equal(t, "@\u200beveryone", SafeName("@everyone"))
+
+    long := SafeName(strings.Repeat("x", MaxShownNameLen+10))
+    assert.Equal(t, MaxShownNameLen, utf8.RuneCountInString(long))
+    assert.True(t, strings.HasSuffix(long, "…"))
+}
+
+func TestSafeCode(t *testing.T) {
+    assert.Equal(t, "iphone-1", SafeCode("iphone-1"))
+    assert.Equal(t, "a b@everyone", SafeCode("a`\nb`@everyone"))
+    assert.Equal(t, MaxShownNameLen, utf8.RuneCountInString(SafeCode(strings.Repeat("x", 100))))
+}
@@ -0,0 +1,72 @@
+package discord
+
+import (
+	"sync"
+	"time"
+)
+
+// cooldownCommands are the commands rate-limited by BotConfig.Cooldown:
+// the ones that wake a device.
+var cooldownCommands = map[string]bool{
+	"snap":      true,
+	"record":    true,
+	"locate":    true,
+	"status":    true,
+	"info":      true,
+	"notify":    true,
+	"clipboard": true,
+}
+
+// cooldowns tracks when each user last ran each command.
+type cooldowns struct {
+	mu        sync.Mutex
+	window    time.Duration
+	last      map[string]time.Time // keyed by userID + "/" + command
+	lastPrune time.Time
+	now       func() time.Time
+}
+
+func newCooldowns(window time.Duration) *cooldowns {
+	return &cooldowns{
+		window: window,
+		last:   make(map[string]time.Time),
+		now:    time.Now,
+	}
+}
+
+// allow records a use of command by userID and reports whether it is
+// permitted. When it is not, remaining is the time left on the cooldown.
+func (c *cooldowns) allow(userID, command string) (remaining time.Duration, ok bool) {
+	if c.window <= 0 || userID == "" {
+		return 0, true
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	c.prune(now)
+
+	key := userID + "/" + command
+	if last, seen := c.last[key]; seen {
+		if elapsed := now.Sub(last); elapsed < c.window {
+			return c.window - elapsed, false
+		}
+	}
+	c.last[key] = now
+	return 0, true
+}
+
+// prune drops expired entries, at most once per window, so the map only
+// holds users active within the last window. Callers hold c.mu.
+func (c *cooldowns) prune(now time.Time) {
+	if now.Sub(c.lastPrune) < c.window {
+		return
+	}
+	c.lastPrune = now
+	for key, last := range c.last {
+		if now.Sub(last) >= c.window {
+			delete(c.last, key)
+		}
+	}
+}
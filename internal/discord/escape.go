@@ -0,0 +1,47 @@
+package discord
+
+import (
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// MaxShownNameLen is the longest client-supplied name shown in a message,
+// in runes; longer names are cut with an ellipsis.
+const MaxShownNameLen = 64
+
+// markdownEscaper backslash-escapes Discord Markdown and breaks mentions
+// with a zero-width space, so text renders literally.
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "*", `\*`, "_", `\_`, "~", `\~`, "`", "\\`", "|", `\|`, ">", `\>`,
+	"#", `\#`, "[", `\[`, "]", `\]`, "@", "@\u200b",
+)
+
+// SafeName prepares a client-supplied name, such as a device's display
+// name, for a message: it is flattened to one line, clamped to
+// MaxShownNameLen runes and escaped so it cannot format the message or
+// mention anyone.
+func SafeName(name string) string {
+	name = strings.Join(strings.Fields(name), " ")
+	if r := []rune(name); len(r) > MaxShownNameLen {
+		name = string(r[:MaxShownNameLen-1]) + "…"
+	}
+	return markdownEscaper.Replace(name)
+}
+
+// SafeCode prepares a client-supplied identifier, such as a node ID, for
+// an inline code span: it is flattened and clamped like SafeName, and
+// backticks, which would end the span, are dropped.
+func SafeCode(s string) string {
+	s = strings.ReplaceAll(strings.Join(strings.Fields(s), " "), "`", "")
+	if r := []rune(s); len(r) > MaxShownNameLen {
+		s = string(r[:MaxShownNameLen-1]) + "…"
+	}
+	return s
+}
+
+// noMentions allows no mentions in a message, whatever its content; every
+// message the bot sends uses it.
+func noMentions() *discordgo.MessageAllowedMentions {
+	return &discordgo.MessageAllowedMentions{}
+}
@@ -0,0 +1,92 @@
+package discord
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// eventBatchWindow collects gateway events posted close together into a
+// single channel message.
+const eventBatchWindow = 10 * time.Second
+
+// maxQueuedEvents caps the events held for one batch; later ones are only
+// counted.
+const maxQueuedEvents = 100
+
+// botEvent is a gateway event waiting to be posted.
+type botEvent struct {
+	At    time.Time
+	Title string
+	Body  string
+}
+
+// PostEvent queues a gateway event for the events channel. Events are sent
+// in batches every eventBatchWindow. It is a no-op when no events channel
+// is configured and never blocks. title and body are Markdown: pass
+// node-supplied values through SafeName or SafeCode. Mentions never ping.
+func (b *Bot) PostEvent(title, body string) {
+	if b.config.EventsChannelID == "" {
+		return
+	}
+
+	b.eventsMu.Lock()
+	defer b.eventsMu.Unlock()
+	if len(b.events) < maxQueuedEvents {
+		b.events = append(b.events, botEvent{At: time.Now(), Title: title, Body: body})
+	} else {
+		b.droppedEvents++
+	}
+	if b.eventsTimer == nil {
+		b.eventsTimer = time.AfterFunc(eventBatchWindow, b.flushEvents)
+	}
+}
+
+// flushEvents sends the queued events as one message.
+func (b *Bot) flushEvents() {
+	b.eventsMu.Lock()
+	if b.eventsTimer != nil {
+		b.eventsTimer.Stop()
+		b.eventsTimer = nil
+	}
+	events, dropped := b.events, b.droppedEvents
+	b.events, b.droppedEvents = nil, 0
+	b.eventsMu.Unlock()
+
+	if len(events) == 0 || b.session == nil {
+		return
+	}
+	msg := formatEvents(events, dropped, MaxMessageLen)
+	send := &discordgo.MessageSend{Content: msg, AllowedMentions: noMentions()}
+	if _, err := b.session.ChannelMessageSendComplex(b.config.EventsChannelID, send); err != nil {
+		log.Printf("discord: failed to post events: %v", err)
+	}
+}
+
+// formatEvents renders events one per line within limit bytes, ending with
+// a count of any that did not fit or were dropped.
+func formatEvents(events []botEvent, dropped, limit int) string {
+	var sb strings.Builder
+	for i, ev := range events {
+		line := fmt.Sprintf("`%s` **%s**", ev.At.Format(time.TimeOnly), ev.Title)
+		if ev.Body != "" {
+			line += " — " + ev.Body
+		}
+		// Leave room for the overflow line.
+		if sb.Len()+len(line)+1 > limit-40 {
+			dropped += len(events) - i
+			break
+		}
+		if sb.Len() > 0 {
+			sb.WriteByte('\n')
+		}
+		sb.WriteString(line)
+	}
+	if dropped > 0 {
+		fmt.Fprintf(&sb, "\n…and %d more", dropped)
+	}
+	return sb.String()
+}
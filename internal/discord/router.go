@@ -1,20 +1,156 @@
 package discord
 
 import (
+	"bytes"
 	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/bwmarrin/discordgo"
+	"github.com/rvald/goclaw/internal/pairing"
+)
+
+// MaxMessageLen is Discord's limit on the content of a single message.
+const MaxMessageLen = 2000
+
+// MaxAutocompleteChoices is Discord's limit on autocomplete suggestions.
+const MaxAutocompleteChoices = 25
+
+// maxChoiceNameLen is Discord's limit on an option choice label.
+const maxChoiceNameLen = 100
+
+// MaxClipboardLen caps the text, in characters, /clipboard will write to a
+// device.
+const MaxClipboardLen = 4000
+
+// MaxEmbedFields is Discord's limit on the number of fields in one embed.
+const MaxEmbedFields = 25
+
+// Video recording limits for /record.
+const (
+	DefaultRecordSeconds = 10
+	MaxRecordSeconds     = 30
+	// MaxRecordBytes keeps a decoded video under Discord's upload limit
+	// for servers without boosts.
+	MaxRecordBytes = 8 << 20
+)
+
+// DefaultStaticMapURL is the static map provider used by /locate unless
+// overridden with WithStaticMap.
+const DefaultStaticMapURL = "https://staticmap.openstreetmap.de/staticmap.php?center={lat},{lon}&zoom=15&size=400x300&markers={lat},{lon},red-pushpin"
+
+const (
+	staticMapTimeout  = 5 * time.Second
+	maxStaticMapBytes = 2 << 20
+	locationImageName = "location.png"
+)
+
+// DefaultInvokeTimeoutMs bounds a device command that has no entry in
+// DefaultInvokeTimeouts.
+const DefaultInvokeTimeoutMs = 10000
+
+// DefaultInvokeTimeouts are the per-command invoke timeouts, in
+// milliseconds, for commands slower than DefaultInvokeTimeoutMs. For
+// media.record it is the allowance for the upload, on top of the
+// recording itself.
+var DefaultInvokeTimeouts = map[string]int{
+	"camera.snap":  30000,
+	"media.record": 30000,
+	"location.get": 15000,
+}
+
+// videoContentTypes maps a media.record format to its MIME type.
+var videoContentTypes = map[string]string{
+	"mp4":  "video/mp4",
+	"mov":  "video/quicktime",
+	"webm": "video/webm",
+}
+
+// imageContentTypes maps a camera.snap format to its MIME type.
+var imageContentTypes = map[string]string{
+	"png":  "image/png",
+	"jpeg": "image/jpeg",
+	"heic": "image/heic",
+	"webp": "image/webp",
+}
+
+// Embed colors.
+const (
+	colorInfo = 0x5865F2
+	colorOK   = 0x57F287
+	colorWarn = 0xFEE75C
 )
 
 // CommandResponse is the result returned by command handlers.
 type CommandResponse struct {
 	OK        bool
 	Message   string
-	ImageData []byte // decoded image bytes, if applicable
+	Messages  []string                // continuation messages sent after Message when output is paginated
+	Embed     *discordgo.MessageEmbed // rich rendering; Message is the plain-text fallback
+	ImageData []byte                  // decoded image bytes, if applicable
+	ImageName string                  // attachment name for ImageData; empty means snap.png
+	ImageType string                  // MIME type of ImageData; empty means image/png
+	File      *discordgo.File         // attachment other than a snap image, e.g. a /record video
+	Ephemeral bool                    // visible only to the invoking user
+}
+
+// ephemeralCommands are the commands whose responses are marked Ephemeral.
+// The bot consults it before routing, since the deferred reply decides
+// whether the follow-ups are visible to the whole channel.
+var ephemeralCommands = map[string]bool{
+	"devices":     true,
+	"device":      true,
+	"approve":     true,
+	"approve-all": true,
+	"reject":      true,
+	"revoke":      true,
+	"clipboard":   true,
+	"operators":   true,
+}
+
+// ephemeral marks the response as visible only to the invoking user.
+func (c CommandResponse) ephemeral() CommandResponse {
+	c.Ephemeral = true
+	return c
+}
+
+// paginate joins lines into messages of at most limit bytes, never
+// splitting a line across messages. header starts the first message.
+func paginate(header string, lines []string, limit int) []string {
+	var pages []string
+	var sb strings.Builder
+	sb.WriteString(header)
+	for _, line := range lines {
+		if sb.Len() > 0 && sb.Len()+len(line) > limit {
+			pages = append(pages, sb.String())
+			sb.Reset()
+		}
+		sb.WriteString(line)
+	}
+	if sb.Len() > 0 {
+		pages = append(pages, sb.String())
+	}
+	return pages
+}
+
+// pagedResponse builds a successful response from paginated output.
+func pagedResponse(pages []string) CommandResponse {
+	resp := CommandResponse{OK: true}
+	if len(pages) > 0 {
+		resp.Message = pages[0]
+		resp.Messages = pages[1:]
+	}
+	return resp
 }
 
 // CommandRouter dispatches slash commands to the appropriate handler.
@@ -23,11 +159,61 @@ type CommandRouter struct {
 	registry NodeRegistry
 	pairing  PairingService // optional — nil when pairing is not enabled
 	store    PairingStore   // optional — nil when pairing is not enabled
+
+	operators OperatorRegistry // optional — nil hides /operators
+
+	mapURL    string // static map URL template; empty disables map images
+	mapAPIKey string
+	mapClient *http.Client
+
+	timeoutMs  int            // invoke timeout for commands not in timeouts
+	timeoutsMs map[string]int // per-command invoke timeouts
 }
 
 // NewCommandRouter creates a router backed by the given invoker and registry.
 func NewCommandRouter(invoker Invoker, registry NodeRegistry) *CommandRouter {
-	return &CommandRouter{invoker: invoker, registry: registry}
+	return &CommandRouter{
+		invoker:   invoker,
+		registry:  registry,
+		mapURL:    DefaultStaticMapURL,
+		mapClient: &http.Client{Timeout: staticMapTimeout},
+
+		timeoutMs:  DefaultInvokeTimeoutMs,
+		timeoutsMs: DefaultInvokeTimeouts,
+	}
+}
+
+// WithInvokeTimeouts sets the timeout of device commands to defaultMs,
+// or 0 to keep DefaultInvokeTimeoutMs, except for those in perCommand,
+// which overrides DefaultInvokeTimeouts entry by entry.
+func (r *CommandRouter) WithInvokeTimeouts(defaultMs int, perCommand map[string]int) {
+	if defaultMs > 0 {
+		r.timeoutMs = defaultMs
+	}
+	timeouts := make(map[string]int, len(DefaultInvokeTimeouts)+len(perCommand))
+	for cmd, ms := range DefaultInvokeTimeouts {
+		timeouts[cmd] = ms
+	}
+	for cmd, ms := range perCommand {
+		timeouts[cmd] = ms
+	}
+	r.timeoutsMs = timeouts
+}
+
+// invokeTimeout returns the timeout in milliseconds for a device command.
+func (r *CommandRouter) invokeTimeout(command string) int {
+	if ms, ok := r.timeoutsMs[command]; ok {
+		return ms
+	}
+	return r.timeoutMs
+}
+
+// WithStaticMap sets the provider /locate fetches a map image from.
+// urlTemplate may contain {lat}, {lon} and {key}, which are replaced with
+// the device coordinates and apiKey. An empty template disables the image.
+func (r *CommandRouter) WithStaticMap(urlTemplate, apiKey string) {
+	r.mapURL = urlTemplate
+	r.mapAPIKey = apiKey
 }
 
 // WithPairing attaches pairing service and store to the router.
@@ -36,6 +222,11 @@ func (r *CommandRouter) WithPairing(svc PairingService, store PairingStore) {
 	r.store = store
 }
 
+// WithOperators attaches the operator registry listed by /operators.
+func (r *CommandRouter) WithOperators(operators OperatorRegistry) {
+	r.operators = operators
+}
+
 // Commands returns the slash command definitions for Discord registration.
 func (r *CommandRouter) Commands() []SlashCommand {
 	cmds := []SlashCommand{
@@ -43,33 +234,65 @@ func (r *CommandRouter) Commands() []SlashCommand {
 			Name:        "snap",
 			Description: "Take a camera snapshot from a connected device",
 			Options: []*discordgo.ApplicationCommandOption{
-				{Type: discordgo.ApplicationCommandOptionString, Name: "node", Description: "Node ID (optional)"},
+				{Type: discordgo.ApplicationCommandOptionString, Name: "node", Description: "Node ID (optional)", Autocomplete: true},
 				{Type: discordgo.ApplicationCommandOptionString, Name: "facing", Description: "Camera facing: front or back",
 					Choices: []*discordgo.ApplicationCommandOptionChoice{
 						{Name: "Front", Value: "front"},
 						{Name: "Back", Value: "back"},
 					},
 				},
+				{Type: discordgo.ApplicationCommandOptionString, Name: "format", Description: "Image format (default: the device's choice)",
+					Choices: []*discordgo.ApplicationCommandOptionChoice{
+						{Name: "JPEG", Value: "jpeg"},
+						{Name: "PNG", Value: "png"},
+					},
+				},
 				{Type: discordgo.ApplicationCommandOptionInteger, Name: "quality", Description: "JPEG quality 1-100"},
 			},
 		},
+		{
+			Name:        "record",
+			Description: "Record a short video from a connected device",
+			Options: []*discordgo.ApplicationCommandOption{
+				{Type: discordgo.ApplicationCommandOptionInteger, Name: "duration",
+					Description: fmt.Sprintf("Length in seconds (default %d, max %d)", DefaultRecordSeconds, MaxRecordSeconds)},
+				{Type: discordgo.ApplicationCommandOptionString, Name: "facing", Description: "Camera facing: front or back",
+					Choices: []*discordgo.ApplicationCommandOptionChoice{
+						{Name: "Front", Value: "front"},
+						{Name: "Back", Value: "back"},
+					},
+				},
+				{Type: discordgo.ApplicationCommandOptionString, Name: "node", Description: "Node ID (optional)", Autocomplete: true},
+			},
+		},
 		{
 			Name:        "locate",
 			Description: "Get the current location of a device",
 			Options: []*discordgo.ApplicationCommandOption{
-				{Type: discordgo.ApplicationCommandOptionString, Name: "node", Description: "Node ID (optional)"},
+				{Type: discordgo.ApplicationCommandOptionString, Name: "node", Description: "Node ID (optional)", Autocomplete: true},
 			},
 		},
 		{
 			Name:        "status",
 			Description: "Get device status (battery, thermal, storage, network)",
 			Options: []*discordgo.ApplicationCommandOption{
-				{Type: discordgo.ApplicationCommandOptionString, Name: "node", Description: "Node ID (optional)"},
+				{Type: discordgo.ApplicationCommandOptionString, Name: "node", Description: "Node ID (optional)", Autocomplete: true},
+			},
+		},
+		{
+			Name:        "info",
+			Description: "Get device details (model, OS version, free storage, uptime)",
+			Options: []*discordgo.ApplicationCommandOption{
+				{Type: discordgo.ApplicationCommandOptionString, Name: "node", Description: "Node ID (optional)", Autocomplete: true},
 			},
 		},
 		{
 			Name:        "nodes",
 			Description: "List all connected nodes",
+			Options: []*discordgo.ApplicationCommandOption{
+				{Type: discordgo.ApplicationCommandOptionString, Name: "platform", Description: "Only nodes on this platform, e.g. ios (optional)"},
+				{Type: discordgo.ApplicationCommandOptionString, Name: "tag", Description: "Only nodes whose device has this tag (optional)"},
+			},
 		},
 		{
 			Name:        "notify",
@@ -77,7 +300,15 @@ func (r *CommandRouter) Commands() []SlashCommand {
 			Options: []*discordgo.ApplicationCommandOption{
 				{Type: discordgo.ApplicationCommandOptionString, Name: "title", Description: "Notification title", Required: true},
 				{Type: discordgo.ApplicationCommandOptionString, Name: "body", Description: "Notification body", Required: true},
-				{Type: discordgo.ApplicationCommandOptionString, Name: "node", Description: "Node ID (optional)"},
+				{Type: discordgo.ApplicationCommandOptionString, Name: "node", Description: "Node ID (optional)", Autocomplete: true},
+			},
+		},
+		{
+			Name:        "clipboard",
+			Description: "Read the device clipboard, or set it when text is given",
+			Options: []*discordgo.ApplicationCommandOption{
+				{Type: discordgo.ApplicationCommandOptionString, Name: "text", Description: "Text to copy to the device (omit to read)"},
+				{Type: discordgo.ApplicationCommandOptionString, Name: "node", Description: "Node ID (optional)", Autocomplete: true},
 			},
 		},
 	}
@@ -89,11 +320,28 @@ func (r *CommandRouter) Commands() []SlashCommand {
 				Name:        "devices",
 				Description: "List all paired and pending devices",
 			},
+			SlashCommand{
+				Name:        "device",
+				Description: "Show full details of a pending request or paired device",
+				Options: []*discordgo.ApplicationCommandOption{
+					{Type: discordgo.ApplicationCommandOptionString, Name: "id", Description: "Request ID or device ID", Required: true},
+				},
+			},
 			SlashCommand{
 				Name:        "approve",
 				Description: "Approve a pending device pairing request",
 				Options: []*discordgo.ApplicationCommandOption{
 					{Type: discordgo.ApplicationCommandOptionString, Name: "request", Description: "Request ID to approve", Required: true},
+					{Type: discordgo.ApplicationCommandOptionString, Name: "scopes", Description: "Comma-separated scopes to grant (default: as requested)"},
+				},
+			},
+			SlashCommand{
+				Name:        "approve-all",
+				Description: "Approve every pending pairing request matching the filters",
+				Options: []*discordgo.ApplicationCommandOption{
+					{Type: discordgo.ApplicationCommandOptionString, Name: "platform", Description: "Only requests from this platform, e.g. ios"},
+					{Type: discordgo.ApplicationCommandOptionString, Name: "since", Description: "Only requests received within this long, e.g. 10m"},
+					{Type: discordgo.ApplicationCommandOptionString, Name: "confirm", Description: "Code from the preview; without it the matching requests are only listed"},
 				},
 			},
 			SlashCommand{
@@ -111,12 +359,55 @@ func (r *CommandRouter) Commands() []SlashCommand {
 					{Type: discordgo.ApplicationCommandOptionString, Name: "role", Description: "Role to revoke (default: node)"},
 				},
 			},
+			SlashCommand{
+				Name:        "rename",
+				Description: "Set the display name of a paired device",
+				Options: []*discordgo.ApplicationCommandOption{
+					{Type: discordgo.ApplicationCommandOptionString, Name: "device", Description: "Device ID to rename", Required: true},
+					{Type: discordgo.ApplicationCommandOptionString, Name: "name", Description: "New display name", Required: true},
+				},
+			},
+			SlashCommand{
+				Name:        "tag",
+				Description: "Replace the tags of a paired device",
+				Options: []*discordgo.ApplicationCommandOption{
+					{Type: discordgo.ApplicationCommandOptionString, Name: "device", Description: "Device ID to tag", Required: true},
+					{Type: discordgo.ApplicationCommandOptionString, Name: "tags", Description: "Tags separated by commas or spaces; omit to clear"},
+				},
+			},
 		)
 	}
 
+	if r.operators != nil {
+		cmds = append(cmds, SlashCommand{Name: "operators", Description: "List connected operator clients"})
+	}
+
 	return cmds
 }
 
+// AutocompleteNodes returns connected nodes whose ID or display name starts
+// with prefix (case-insensitive), labelled by display name and valued by
+// node ID. At most MaxAutocompleteChoices are returned.
+func (r *CommandRouter) AutocompleteNodes(prefix string) []*discordgo.ApplicationCommandOptionChoice {
+	prefix = strings.ToLower(prefix)
+	choices := []*discordgo.ApplicationCommandOptionChoice{}
+	for _, n := range r.registry.List() {
+		if len(choices) == MaxAutocompleteChoices {
+			break
+		}
+		if !strings.HasPrefix(strings.ToLower(n.NodeID), prefix) &&
+			!strings.HasPrefix(strings.ToLower(n.DisplayName), prefix) {
+			continue
+		}
+		label := nodeLabel(n)
+		if runes := []rune(label); len(runes) > maxChoiceNameLen {
+			label = string(runes[:maxChoiceNameLen])
+		}
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: label, Value: n.NodeID})
+	}
+	return choices
+}
+
 // resolveNode picks a node by ID, or the first available if nodeID is empty.
 func (r *CommandRouter) resolveNode(nodeID string) (*NodeSession, error) {
 	if nodeID != "" {
@@ -133,23 +424,91 @@ func (r *CommandRouter) resolveNode(nodeID string) (*NodeSession, error) {
 	return nodes[0], nil
 }
 
-// HandleSnap requests a camera snapshot from the target node.
-func (r *CommandRouter) HandleSnap(ctx context.Context, nodeID, facing string, quality int) CommandResponse {
+// DefaultSnapQuality is the JPEG quality /snap uses when none is given.
+const DefaultSnapQuality = 80
+
+// normalizeFacing lowercases facing and defaults it to "back". ok is
+// false for anything other than front or back.
+func normalizeFacing(facing string) (string, bool) {
+	facing = strings.ToLower(strings.TrimSpace(facing))
+	switch facing {
+	case "":
+		return "back", true
+	case "front", "back":
+		return facing, true
+	}
+	return facing, false
+}
+
+// normalizeImageFormat canonicalizes a snap format ("jpg" is "jpeg"). An
+// empty format is valid and leaves the choice to the device.
+func normalizeImageFormat(format string) (string, bool) {
+	format = strings.ToLower(strings.TrimSpace(format))
+	if format == "jpg" {
+		format = "jpeg"
+	}
+	_, ok := imageContentTypes[format]
+	return format, ok || format == ""
+}
+
+// snapAttachment names and types a snap image by the format the node
+// reported, sniffing the bytes when the format is missing or unknown.
+func snapAttachment(format string, data []byte) (name, contentType string) {
+	format, _ = normalizeImageFormat(format)
+	if _, ok := imageContentTypes[format]; !ok {
+		format = "png"
+		sniffed := http.DetectContentType(data)
+		for f, ct := range imageContentTypes {
+			if ct == sniffed {
+				format = f
+			}
+		}
+	}
+	ext := format
+	if format == "jpeg" {
+		ext = "jpg"
+	}
+	return "snap." + ext, imageContentTypes[format]
+}
+
+// HandleSnap requests a camera snapshot from the target node. format asks
+// for "png", "jpeg", "heic" or "webp"; empty lets the device choose. quality is clamped
+// to 1–100, with 0 or less meaning DefaultSnapQuality.
+func (r *CommandRouter) HandleSnap(ctx context.Context, nodeID, facing, format string, quality int) CommandResponse {
 	node, err := r.resolveNode(nodeID)
 	if err != nil {
 		return CommandResponse{OK: false, Message: "📱 No iOS device connected"}
 	}
 
+	facing, ok := normalizeFacing(facing)
+	if !ok {
+		return CommandResponse{OK: false, Message: fmt.Sprintf("❌ Invalid facing %q (use front or back)", facing)}
+	}
+	format, ok = normalizeImageFormat(format)
+	if !ok {
+		return CommandResponse{OK: false, Message: fmt.Sprintf("❌ Invalid format %q (use png, jpeg, heic or webp)", format)}
+	}
+	if quality <= 0 {
+		quality = DefaultSnapQuality
+	}
+	quality = min(quality, 100)
+	snapParams := map[string]any{"facing": facing, "quality": quality}
+	if format != "" {
+		snapParams["format"] = format
+	}
+	params, _ := json.Marshal(snapParams)
+
 	result, err := r.invoker.Invoke(ctx, InvokeRequest{
-		NodeID:    node.NodeID,
-		Command:   "camera.snap",
-		TimeoutMs: 30000,
+		NodeID:     node.NodeID,
+		Command:    "camera.snap",
+		ParamsJSON: string(params),
+		TimeoutMs:  r.invokeTimeout("camera.snap"),
 	})
 	if err != nil {
 		if strings.Contains(err.Error(), "timeout") {
-			return CommandResponse{OK: false, Message: "⏱️ Camera request timed out"}
+			return CommandResponse{OK: false, Message: "⏱️ Camera request timed out" + requestRef(result)}
 		}
-		return CommandResponse{OK: false, Message: fmt.Sprintf("❌ Error: %s", err.Error())}
+		return CommandResponse{OK: false, Message: fmt.Sprintf("❌ Error: %s%s", err.Error(), requestRef(result))}
 	}
 
 	if !result.OK {
@@ -182,10 +541,95 @@ func (r *CommandRouter) HandleSnap(ctx context.Context, nodeID, facing string, q
 		return CommandResponse{OK: false, Message: fmt.Sprintf("❌ Camera snap decode failed: %v", err)}
 	}
 
+	name, contentType := snapAttachment(payload.Format, imageData)
 	return CommandResponse{
 		OK:        true,
-		Message:   fmt.Sprintf("📸 Photo from %s (%dx%d %s)", node.DisplayName, payload.Width, payload.Height, payload.Format),
+		Message:   fmt.Sprintf("📸 Photo from %s (%dx%d %s)%s", SafeName(nodeLabel(node)), payload.Width, payload.Height, payload.Format, took(result)),
 		ImageData: imageData,
+		ImageName: name,
+		ImageType: contentType,
+	}
+}
+
+// HandleRecord records a video of durationSec seconds (clamped to
+// [1, MaxRecordSeconds]) and returns it as an attachment.
+func (r *CommandRouter) HandleRecord(ctx context.Context, nodeID, facing string, durationSec int) CommandResponse {
+	node, err := r.resolveNode(nodeID)
+	if err != nil {
+		return CommandResponse{OK: false, Message: "📱 No iOS device connected"}
+	}
+
+	facing, ok := normalizeFacing(facing)
+	if !ok {
+		return CommandResponse{OK: false, Message: fmt.Sprintf("❌ Invalid facing %q (use front or back)", facing)}
+	}
+	durationSec = min(max(durationSec, 1), MaxRecordSeconds)
+	params, _ := json.Marshal(map[string]any{"facing": facing, "durationMs": durationSec * 1000})
+
+	result, err := r.invoker.Invoke(ctx, InvokeRequest{
+		NodeID:     node.NodeID,
+		Command:    "media.record",
+		ParamsJSON: string(params),
+		TimeoutMs:  durationSec*1000 + r.invokeTimeout("media.record"), // recording plus upload
+	})
+	if err != nil {
+		if strings.Contains(err.Error(), "timeout") {
+			return CommandResponse{OK: false, Message: "⏱️ Recording timed out" + requestRef(result)}
+		}
+		return CommandResponse{OK: false, Message: fmt.Sprintf("❌ Error: %s%s", err.Error(), requestRef(result))}
+	}
+	if !result.OK {
+		return CommandResponse{OK: false, Message: r.invokeErrorMessage(result, "❌ Recording failed")}
+	}
+	if result.PayloadJSON == nil {
+		return CommandResponse{OK: false, Message: "❌ Recording missing payload"}
+	}
+
+	var payload struct {
+		VideoBase64 string `json:"videoBase64"`
+		Format      string `json:"format"`
+		DurationMs  int    `json:"durationMs"`
+		Bytes       int    `json:"bytes"`
+	}
+	if err := json.Unmarshal([]byte(*result.PayloadJSON), &payload); err != nil {
+		return CommandResponse{OK: false, Message: fmt.Sprintf("❌ Recording decode failed: %v", err)}
+	}
+	if payload.VideoBase64 == "" {
+		return CommandResponse{OK: false, Message: "❌ Recording payload missing video data"}
+	}
+
+	// Check the size before decoding so an oversized video is never held
+	// twice. DecodedLen counts up to 2 bytes of padding, hence the slack.
+	tooLarge := func(n int) CommandResponse {
+		return CommandResponse{OK: false, Message: fmt.Sprintf(
+			"📼 The video is too large to post (%.1f MB, max %d MB). Try a shorter duration.",
+			float64(n)/(1<<20), MaxRecordBytes>>20)}
+	}
+	if n := base64.StdEncoding.DecodedLen(len(payload.VideoBase64)); n > MaxRecordBytes+2 {
+		return tooLarge(n)
+	}
+	video, err := base64.StdEncoding.DecodeString(payload.VideoBase64)
+	if err != nil {
+		return CommandResponse{OK: false, Message: fmt.Sprintf("❌ Recording decode failed: %v", err)}
+	}
+	if len(video) > MaxRecordBytes {
+		return tooLarge(len(video))
+	}
+
+	format := strings.ToLower(payload.Format)
+	contentType, ok := videoContentTypes[format]
+	if !ok {
+		format, contentType = "mp4", videoContentTypes["mp4"]
+	}
+
+	return CommandResponse{
+		OK:      true,
+		Message: fmt.Sprintf("🎥 %.1fs video from %s%s", float64(payload.DurationMs)/1000, SafeName(nodeLabel(node)), took(result)),
+		File: &discordgo.File{
+			Name:        "record." + format,
+			ContentType: contentType,
+			Reader:      bytes.NewReader(video),
+		},
 	}
 }
 
@@ -199,10 +643,10 @@ func (r *CommandRouter) HandleLocate(ctx context.Context, nodeID string) Command
 	result, err := r.invoker.Invoke(ctx, InvokeRequest{
 		NodeID:    node.NodeID,
 		Command:   "location.get",
-		TimeoutMs: 15000,
+		TimeoutMs: r.invokeTimeout("location.get"),
 	})
 	if err != nil {
-		return CommandResponse{OK: false, Message: fmt.Sprintf("❌ Error: %s", err.Error())}
+		return CommandResponse{OK: false, Message: fmt.Sprintf("❌ Error: %s%s", err.Error(), requestRef(result))}
 	}
 	if !result.OK {
 		return CommandResponse{OK: false, Message: r.invokeErrorMessage(result, "❌ Location request failed")}
@@ -222,10 +666,91 @@ func (r *CommandRouter) HandleLocate(ctx context.Context, nodeID string) Command
 	}
 
 	mapURL := fmt.Sprintf("https://google.com/maps?q=%f,%f", loc.Latitude, loc.Longitude)
-	msg := fmt.Sprintf("📍 Location: %f, %f (±%.0fm, alt %.1fm)\n%s",
-		loc.Latitude, loc.Longitude, loc.Accuracy, loc.Altitude, mapURL)
+	msg := fmt.Sprintf("📍 Location: %f, %f (±%.0fm, alt %.1fm)%s\n%s",
+		loc.Latitude, loc.Longitude, loc.Accuracy, loc.Altitude, took(result), mapURL)
 
-	return CommandResponse{OK: true, Message: msg}
+	embed := &discordgo.MessageEmbed{
+		Title: fmt.Sprintf("📍 %s", nodeLabel(node)),
+		URL:   mapURL,
+		Color: colorInfo,
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "Coordinates", Value: fmt.Sprintf("%f, %f", loc.Latitude, loc.Longitude)},
+			{Name: "Accuracy", Value: fmt.Sprintf("±%.0fm", loc.Accuracy), Inline: true},
+			{Name: "Altitude", Value: fmt.Sprintf("%.1fm", loc.Altitude), Inline: true},
+		},
+	}
+	resp := CommandResponse{OK: true, Message: msg, Embed: embed}
+
+	// The map is fetched here rather than linked from the embed so the
+	// provider's API key never reaches Discord. Without it the response
+	// is text only.
+	img, err := r.fetchStaticMap(ctx, loc.Latitude, loc.Longitude)
+	if err != nil {
+		log.Printf("discord: static map fetch failed: %v", err)
+		return resp
+	}
+	if img != nil {
+		resp.ImageData = img
+		resp.ImageName = locationImageName
+		embed.Image = &discordgo.MessageEmbedImage{URL: "attachment://" + locationImageName}
+	}
+	return resp
+}
+
+// fetchStaticMap downloads the map image for lat/lon from the configured
+// provider. It returns nil, nil when no provider is configured.
+func (r *CommandRouter) fetchStaticMap(ctx context.Context, lat, lon float64) ([]byte, error) {
+	if r.mapURL == "" {
+		return nil, nil
+	}
+	target := strings.NewReplacer(
+		"{lat}", strconv.FormatFloat(lat, 'f', 6, 64),
+		"{lon}", strconv.FormatFloat(lon, 'f', 6, 64),
+		"{key}", url.QueryEscape(r.mapAPIKey),
+	).Replace(r.mapURL)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := r.mapClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("static map provider returned %s", res.Status)
+	}
+	if ct := res.Header.Get("Content-Type"); !strings.HasPrefix(ct, "image/") {
+		return nil, fmt.Errorf("static map provider returned %q, want an image", ct)
+	}
+	data, err := io.ReadAll(io.LimitReader(res.Body, maxStaticMapBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxStaticMapBytes {
+		return nil, fmt.Errorf("static map larger than %d bytes", maxStaticMapBytes)
+	}
+	return data, nil
+}
+
+// deviceLabel returns a device's display name prepared by SafeName, or the
+// start of its device ID when unnamed, for message text.
+func deviceLabel(displayName, deviceID string) string {
+	if name := SafeName(displayName); name != "" {
+		return name
+	}
+	return deviceID[:min(12, len(deviceID))] + "…"
+}
+
+// nodeLabel returns the node's display name, or its ID when unnamed. It is
+// not escaped: pass it through SafeName for message text.
+func nodeLabel(n *NodeSession) string {
+	if n.DisplayName != "" {
+		return n.DisplayName
+	}
+	return n.NodeID
 }
 
 // HandleStatus requests device status (battery, thermal, storage, network).
@@ -238,10 +763,10 @@ func (r *CommandRouter) HandleStatus(ctx context.Context, nodeID string) Command
 	result, err := r.invoker.Invoke(ctx, InvokeRequest{
 		NodeID:    node.NodeID,
 		Command:   "device.status",
-		TimeoutMs: 10000,
+		TimeoutMs: r.invokeTimeout("device.status"),
 	})
 	if err != nil {
-		return CommandResponse{OK: false, Message: fmt.Sprintf("❌ Error: %s", err.Error())}
+		return CommandResponse{OK: false, Message: fmt.Sprintf("❌ Error: %s%s", err.Error(), requestRef(result))}
 	}
 	if !result.OK {
 		return CommandResponse{OK: false, Message: r.invokeErrorMessage(result, "❌ Device status failed")}
@@ -272,31 +797,180 @@ func (r *CommandRouter) HandleStatus(ctx context.Context, nodeID string) Command
 	}
 
 	batteryPct := int(status.Battery.Level * 100)
-	msg := fmt.Sprintf("🔋 Battery: %d%% (%s)\n🌡️ Thermal: %s\n📶 Network: %s\n💾 Storage: %.0f GB / %.0f GB",
+	storage := fmt.Sprintf("%.0f GB / %.0f GB",
+		float64(status.Storage.AvailableBytes)/1e9,
+		float64(status.Storage.TotalBytes)/1e9,
+	)
+	msg := fmt.Sprintf("🔋 Battery: %d%% (%s)\n🌡️ Thermal: %s\n📶 Network: %s\n💾 Storage: %s",
 		batteryPct,
 		status.Battery.State,
 		status.Thermal.State,
 		status.Network.Type,
-		float64(status.Storage.AvailableBytes)/1e9,
-		float64(status.Storage.TotalBytes)/1e9,
+		storage,
 	)
 
+	network := status.Network.Type
+	if status.Network.SSID != "" {
+		network += fmt.Sprintf(" (%s)", status.Network.SSID)
+	}
+	color := colorOK
+	if status.Thermal.State == "serious" || status.Thermal.State == "critical" || batteryPct < 20 {
+		color = colorWarn
+	}
+	embed := &discordgo.MessageEmbed{
+		Title: fmt.Sprintf("📱 %s", nodeLabel(node)),
+		Color: color,
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "🔋 Battery", Value: fmt.Sprintf("%d%% (%s)", batteryPct, orDash(status.Battery.State)), Inline: true},
+			{Name: "🌡️ Thermal", Value: orDash(status.Thermal.State), Inline: true},
+			{Name: "📶 Network", Value: orDash(network), Inline: true},
+			{Name: "💾 Storage", Value: storage + " free", Inline: true},
+		},
+	}
+
+	return CommandResponse{OK: true, Message: msg + took(result), Embed: embed}
+}
+
+// HandleInfo requests static device details (model, OS version, free
+// storage, uptime). When the device cannot answer, it reports what the
+// node sent at connect time instead.
+func (r *CommandRouter) HandleInfo(ctx context.Context, nodeID string) CommandResponse {
+	node, err := r.resolveNode(nodeID)
+	if err != nil {
+		return CommandResponse{OK: false, Message: "📱 No iOS device connected"}
+	}
+
+	result, err := r.invoker.Invoke(ctx, InvokeRequest{
+		NodeID:    node.NodeID,
+		Command:   "device.info",
+		TimeoutMs: r.invokeTimeout("device.info"),
+	})
+	var reason string
+	switch {
+	case err != nil:
+		reason = err.Error() + requestRef(result)
+	case !result.OK && result.Error != nil && result.Error.Message != "":
+		reason = result.Error.Message + requestRef(result)
+	case !result.OK:
+		reason = "device.info failed" + requestRef(result)
+	case result.PayloadJSON == nil:
+		reason = "missing payload"
+	}
+
+	var info struct {
+		Model     string `json:"model"`
+		OSVersion string `json:"osVersion"`
+		UptimeSec int64  `json:"uptimeSec"`
+		FreeBytes int64  `json:"freeBytes"`
+	}
+	if reason == "" {
+		if err := json.Unmarshal([]byte(*result.PayloadJSON), &info); err != nil {
+			reason = fmt.Sprintf("decode failed: %v", err)
+		}
+	}
+	if reason != "" {
+		return r.connectInfo(node, reason)
+	}
+
+	model := info.Model
+	if model == "" {
+		model = node.ModelIdentifier
+	}
+	msg := fmt.Sprintf("ℹ️ **%s**\nModel: %s\nOS: %s %s\nFree storage: %.1f GB\nUptime: %s%s",
+		SafeName(nodeLabel(node)), orDash(SafeName(model)), SafeName(node.Platform), orDash(SafeName(info.OSVersion)),
+		float64(info.FreeBytes)/1e9, formatUptime(time.Duration(info.UptimeSec)*time.Second), took(result))
+	return CommandResponse{OK: true, Message: msg}
+}
+
+// connectInfo describes node from its connect-time client info, for when
+// the device cannot be asked directly.
+func (r *CommandRouter) connectInfo(node *NodeSession, reason string) CommandResponse {
+	msg := fmt.Sprintf("ℹ️ **%s** (live info unavailable: %s)\nModel: %s\nFamily: %s\nPlatform: %s\nApp version: %s",
+		SafeName(nodeLabel(node)), reason, orDash(SafeName(node.ModelIdentifier)), orDash(SafeName(node.DeviceFamily)),
+		orDash(SafeName(node.Platform)), orDash(SafeName(node.Version)))
 	return CommandResponse{OK: true, Message: msg}
 }
 
-// HandleNodes lists all connected nodes.
-func (r *CommandRouter) HandleNodes() CommandResponse {
+// formatUptime renders d to its two largest units, e.g. "3d 4h" or "12m".
+func formatUptime(d time.Duration) string {
+	days := int(d / (24 * time.Hour))
+	hours := int(d % (24 * time.Hour) / time.Hour)
+	mins := int(d % time.Hour / time.Minute)
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%dd %dh", days, hours)
+	case hours > 0:
+		return fmt.Sprintf("%dh %dm", hours, mins)
+	default:
+		return fmt.Sprintf("%dm", mins)
+	}
+}
+
+// HandleNodes lists connected nodes, only those on platform and those whose
+// paired device carries tag when either is set.
+func (r *CommandRouter) HandleNodes(platform, tag string) CommandResponse {
 	nodes := r.registry.List()
+	if platform != "" {
+		nodes = r.registry.ListByPlatform(platform)
+	}
+	if tag != "" {
+		if r.store == nil {
+			return CommandResponse{Message: "❌ Device pairing is not enabled"}
+		}
+		tagged := make(map[string]bool)
+		for _, d := range r.store.GetByTag(tag) {
+			tagged[d.DeviceID] = true
+		}
+		var matched []*NodeSession
+		for _, n := range nodes {
+			if tagged[n.DeviceID] {
+				matched = append(matched, n)
+			}
+		}
+		nodes = matched
+	}
 	if len(nodes) == 0 {
+		switch {
+		case tag != "" && platform != "":
+			return CommandResponse{Message: fmt.Sprintf("No %s nodes tagged %s connected", platform, tag)}
+		case tag != "":
+			return CommandResponse{Message: fmt.Sprintf("No nodes tagged %s connected", tag)}
+		case platform != "":
+			return CommandResponse{Message: fmt.Sprintf("No %s nodes connected", platform)}
+		}
 		return CommandResponse{Message: "No nodes connected"}
 	}
 
-	var sb strings.Builder
-	sb.WriteString(fmt.Sprintf("📱 %d device(s) connected:\n", len(nodes)))
+	lines := make([]string, 0, len(nodes))
 	for _, n := range nodes {
-		sb.WriteString(fmt.Sprintf("• %s (%s %s) — %s\n", n.DisplayName, n.Platform, n.Version, n.NodeID))
+		lines = append(lines, fmt.Sprintf("• %s (%s %s) — %s\n", SafeName(n.DisplayName), SafeName(n.Platform), SafeName(n.Version), SafeName(n.NodeID)))
 	}
-	return CommandResponse{OK: true, Message: sb.String()}
+	header := fmt.Sprintf("📱 %d device(s) connected:\n", len(nodes))
+	resp := pagedResponse(paginate(header, lines, MaxMessageLen))
+
+	// One embed field per node; larger fleets fall back to paginated text.
+	if len(nodes) <= MaxEmbedFields && len(resp.Messages) == 0 {
+		embed := &discordgo.MessageEmbed{
+			Title: fmt.Sprintf("📱 %d device(s) connected", len(nodes)),
+			Color: colorInfo,
+		}
+		for _, n := range nodes {
+			embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+				Name:  nodeLabel(n),
+				Value: fmt.Sprintf("%s %s\n`%s`", n.Platform, n.Version, n.NodeID),
+			})
+		}
+		resp.Embed = embed
+	}
+	return resp
+}
+
+// orDash substitutes a dash for empty embed field values, which Discord rejects.
+func orDash(s string) string {
+	if s == "" {
+		return "—"
+	}
+	return s
 }
 
 // HandleNotify sends a push notification to the target node.
@@ -309,23 +983,143 @@ func (r *CommandRouter) HandleNotify(ctx context.Context, nodeID, title, body st
 	result, err := r.invoker.Invoke(ctx, InvokeRequest{
 		NodeID:    nd.NodeID,
 		Command:   "system.notify",
-		TimeoutMs: 10000,
+		TimeoutMs: r.invokeTimeout("system.notify"),
 	})
 	if err != nil {
-		return CommandResponse{Message: fmt.Sprintf("❌ invoke error: %v", err)}
+		return CommandResponse{Message: fmt.Sprintf("❌ invoke error: %v%s", err, requestRef(result))}
 	}
 	if !result.OK {
 		return CommandResponse{Message: r.invokeErrorMessage(result, "❌ Notification failed")}
 	}
 
-	return CommandResponse{OK: true, Message: fmt.Sprintf("✅ Notification sent to **%s**", nd.DisplayName)}
+	return CommandResponse{OK: true, Message: fmt.Sprintf("✅ Notification sent to **%s**%s", SafeName(nodeLabel(nd)), took(result))}
+}
+
+// HandleClipboard reads the device clipboard when text is empty, and sets
+// it to text otherwise. Responses are ephemeral since clipboards often hold
+// secrets.
+func (r *CommandRouter) HandleClipboard(ctx context.Context, nodeID, text string) CommandResponse {
+	nd, err := r.resolveNode(nodeID)
+	if err != nil {
+		return CommandResponse{Message: "📱 No iOS device connected"}.ephemeral()
+	}
+
+	if text != "" {
+		if n := utf8.RuneCountInString(text); n > MaxClipboardLen {
+			return CommandResponse{Message: fmt.Sprintf("❌ Text too long (%d characters, max %d)", n, MaxClipboardLen)}.ephemeral()
+		}
+		params, _ := json.Marshal(map[string]string{"text": text})
+		result, err := r.invoker.Invoke(ctx, InvokeRequest{
+			NodeID:     nd.NodeID,
+			Command:    "clipboard.set",
+			ParamsJSON: string(params),
+			TimeoutMs:  r.invokeTimeout("clipboard.set"),
+		})
+		if err != nil {
+			return CommandResponse{Message: fmt.Sprintf("❌ Error: %s%s", err.Error(), requestRef(result))}.ephemeral()
+		}
+		if !result.OK {
+			return CommandResponse{Message: r.invokeErrorMessage(result, "❌ Clipboard write failed")}.ephemeral()
+		}
+		return CommandResponse{OK: true, Message: fmt.Sprintf("📋 Copied %d characters to **%s**", utf8.RuneCountInString(text), SafeName(nodeLabel(nd)))}.ephemeral()
+	}
+
+	result, err := r.invoker.Invoke(ctx, InvokeRequest{
+		NodeID:    nd.NodeID,
+		Command:   "clipboard.get",
+		TimeoutMs: r.invokeTimeout("clipboard.get"),
+	})
+	if err != nil {
+		return CommandResponse{Message: fmt.Sprintf("❌ Error: %s%s", err.Error(), requestRef(result))}.ephemeral()
+	}
+	if !result.OK {
+		return CommandResponse{Message: r.invokeErrorMessage(result, "❌ Clipboard read failed")}.ephemeral()
+	}
+
+	var clip struct {
+		Text string `json:"text"`
+	}
+	if result.PayloadJSON != nil {
+		if err := json.Unmarshal([]byte(*result.PayloadJSON), &clip); err != nil {
+			return CommandResponse{Message: fmt.Sprintf("❌ Clipboard decode failed: %v", err)}.ephemeral()
+		}
+	}
+	if clip.Text == "" {
+		return CommandResponse{OK: true, Message: fmt.Sprintf("📋 Clipboard on **%s** is empty", SafeName(nodeLabel(nd)))}.ephemeral()
+	}
+
+	header := fmt.Sprintf("📋 Clipboard from **%s**:\n", SafeName(nodeLabel(nd)))
+	return CommandResponse{OK: true, Message: header + quoteText(clip.Text, MaxMessageLen-len(header))}.ephemeral()
+}
+
+// quoteText renders text as a Discord block quote of at most limit bytes,
+// truncating on a rune boundary when it does not fit.
+func quoteText(text string, limit int) string {
+	const marker = "\n…(truncated)"
+	quoted := "> " + strings.ReplaceAll(text, "\n", "\n> ")
+	if len(quoted) <= limit {
+		return quoted
+	}
+	cut := limit - len(marker)
+	for cut > 0 && !utf8.RuneStart(quoted[cut]) {
+		cut--
+	}
+	return quoted[:cut] + marker
 }
 
 func (r *CommandRouter) invokeErrorMessage(result InvokeResult, fallback string) string {
 	if result.Error != nil && result.Error.Message != "" {
-		return fmt.Sprintf("❌ %s", result.Error.Message)
+		return fmt.Sprintf("❌ %s%s", result.Error.Message, requestRef(result))
+	}
+	return fallback + requestRef(result)
+}
+
+// took returns " (took 1.2s)" for the invoke behind result, or "" when
+// its duration is unknown.
+func took(result InvokeResult) string {
+	if result.DurationMs <= 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (took %.1fs)", float64(result.DurationMs)/1000)
+}
+
+// invokeRefLen is how much of the invoke ID error messages show; enough
+// to find the invoke in gateway and node logs.
+const invokeRefLen = 8
+
+// requestRef returns " (request <id>)" naming the invoke behind result,
+// or "" when it has no ID.
+func requestRef(result InvokeResult) string {
+	if result.ID == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (request %s)", result.ID[:min(len(result.ID), invokeRefLen)])
+}
+
+// HandleOperators lists connected operator clients with their scopes.
+func (r *CommandRouter) HandleOperators() CommandResponse {
+	if r.operators == nil {
+		return CommandResponse{Message: "❌ Operator tracking is not enabled"}.ephemeral()
+	}
+	ops := r.operators.List()
+	if len(ops) == 0 {
+		return CommandResponse{OK: true, Message: "No operators connected."}.ephemeral()
+	}
+
+	lines := make([]string, 0, len(ops))
+	for _, op := range ops {
+		name := op.DisplayName
+		if name == "" {
+			name = op.ClientID
+		}
+		line := fmt.Sprintf("• **%s** (`%s`, %s) · scopes `%s`", SafeName(name), SafeCode(op.ClientID), orDash(SafeName(op.Platform)), orDash(strings.Join(op.Scopes, ",")))
+		if op.DeviceID != "" {
+			line += fmt.Sprintf(" · device `%s`", op.DeviceID[:min(12, len(op.DeviceID))])
+		}
+		lines = append(lines, line+fmt.Sprintf(" · since <t:%d:R>\n", op.ConnectedAt.Unix()))
 	}
-	return fallback
+	header := fmt.Sprintf("🧑‍💻 %d operator(s) connected:\n", len(ops))
+	return pagedResponse(paginate(header, lines, MaxMessageLen)).ephemeral()
 }
 
 // --- Device Pairing Handlers ---
@@ -333,101 +1127,309 @@ func (r *CommandRouter) invokeErrorMessage(result InvokeResult, fallback string)
 // HandleDevices lists all paired and pending devices.
 func (r *CommandRouter) HandleDevices() CommandResponse {
 	if r.store == nil {
-		return CommandResponse{Message: "❌ Device pairing is not enabled"}
+		return CommandResponse{Message: "❌ Device pairing is not enabled"}.ephemeral()
 	}
 
 	paired := r.store.ListPaired()
 	pending := r.store.ListPending()
 
 	if len(paired) == 0 && len(pending) == 0 {
-		return CommandResponse{OK: true, Message: "No devices found."}
+		return CommandResponse{OK: true, Message: "No devices found."}.ephemeral()
 	}
 
-	var sb strings.Builder
+	var lines []string
 
 	if len(paired) > 0 {
-		sb.WriteString(fmt.Sprintf("**Paired Devices** (%d)\n", len(paired)))
+		lines = append(lines, fmt.Sprintf("**Paired Devices** (%d)\n", len(paired)))
 		for _, d := range paired {
-			name := d.DisplayName
-			if name == "" {
-				name = d.DeviceID[:12] + "…"
+			name := deviceLabel(d.DisplayName, d.DeviceID)
+			var tags string
+			if len(d.Tags) > 0 {
+				tags = fmt.Sprintf(" · tags `%s`", strings.Join(d.Tags, ","))
 			}
-			sb.WriteString(fmt.Sprintf("• `%s` — %s (%s)\n", d.DeviceID[:12], name, d.Platform))
+			lines = append(lines, fmt.Sprintf("• `%s` — %s (%s) · key `%s` · %s%s\n", d.DeviceID[:12], name, SafeName(d.Platform), pairing.KeyFingerprint(d.PublicKey), d.UsageSummary(time.Now()), tags))
 		}
 	}
 
 	if len(pending) > 0 {
+		header := fmt.Sprintf("**Pending Requests** (%d)\n", len(pending))
 		if len(paired) > 0 {
-			sb.WriteString("\n")
+			header = "\n" + header
 		}
-		sb.WriteString(fmt.Sprintf("**Pending Requests** (%d)\n", len(pending)))
+		lines = append(lines, header)
 		for _, p := range pending {
-			name := p.DisplayName
-			if name == "" {
-				name = p.DeviceID[:12] + "…"
-			}
-			sb.WriteString(fmt.Sprintf("• `%s` — %s (request: `%s`)\n", p.DeviceID[:12], name, p.RequestID[:8]))
+			name := deviceLabel(p.DisplayName, p.DeviceID)
+			lines = append(lines, fmt.Sprintf("• `%s` — %s · key `%s` (request: `%s`)\n", p.DeviceID[:12], name, pairing.KeyFingerprint(p.PublicKey), p.RequestID[:8]))
 		}
 	}
 
-	return CommandResponse{OK: true, Message: sb.String()}
+	return pagedResponse(paginate("", lines, MaxMessageLen)).ephemeral()
 }
 
-// HandleApprove approves a pending device pairing request.
-func (r *CommandRouter) HandleApprove(requestID string) CommandResponse {
+// HandleDevice shows the pending request with ID id or, failing that, the
+// paired device with that ID, in full, to inform an approve or reject.
+func (r *CommandRouter) HandleDevice(id string) CommandResponse {
+	if r.store == nil {
+		return CommandResponse{Message: "❌ Device pairing is not enabled"}.ephemeral()
+	}
+	if id == "" {
+		return CommandResponse{Message: "❌ Request or device ID is required"}.ephemeral()
+	}
+
+	now := time.Now()
+	var sb strings.Builder
+	field := func(label, value string) {
+		if value == "" {
+			value = "—"
+		}
+		fmt.Fprintf(&sb, "**%s:** %s\n", label, value)
+	}
+	code := func(s string) string {
+		if s == "" {
+			return ""
+		}
+		return "`" + s + "`"
+	}
+
+	if req := r.store.GetPendingRequest(id); req != nil {
+		sb.WriteString("**Pending Request**\n")
+		field("Request", code(req.RequestID))
+		field("Device", code(req.DeviceID))
+		field("Key", code(pairing.KeyFingerprint(req.PublicKey)))
+		field("Name", SafeName(req.DisplayName))
+		field("Platform", SafeName(req.Platform))
+		field("Client", SafeName(pairing.ClientLabel(req.ClientID, req.ClientMode)))
+		field("Role", req.Role)
+		field("Scopes", code(strings.Join(req.Scopes, ",")))
+		field("IP", code(req.RemoteIP))
+		if req.IsRepair {
+			field("Repair", "yes — this device is already paired under another key")
+		} else {
+			field("Repair", "no")
+		}
+		field("Age", now.Sub(time.UnixMilli(req.Timestamp)).Round(time.Second).String())
+		return CommandResponse{OK: true, Message: sb.String()}.ephemeral()
+	}
+	if dev := r.store.GetPairedDevice(id); dev != nil {
+		sb.WriteString("**Paired Device**\n")
+		field("Device", code(dev.DeviceID))
+		field("Key", code(pairing.KeyFingerprint(dev.PublicKey)))
+		field("Name", SafeName(dev.DisplayName))
+		field("Platform", SafeName(dev.Platform))
+		field("Client", SafeName(pairing.ClientLabel(dev.ClientID, dev.ClientMode)))
+		field("Role", dev.Role)
+		field("Scopes", code(strings.Join(dev.Scopes, ",")))
+		field("IP", code(dev.RemoteIP))
+		field("Tags", code(strings.Join(dev.Tags, ",")))
+		field("Approved", fmt.Sprintf("<t:%d:R>", dev.ApprovedAtMs/1000))
+		field("Usage", dev.UsageSummary(now))
+		return CommandResponse{OK: true, Message: sb.String()}.ephemeral()
+	}
+	return CommandResponse{Message: fmt.Sprintf("❌ No pending request or paired device found for `%s`", id)}.ephemeral()
+}
+
+// HandleApprove approves a pending device pairing request. A non-empty
+// scopes (comma-separated) replaces the scopes the device requested.
+func (r *CommandRouter) HandleApprove(requestID, scopes string) CommandResponse {
 	if r.pairing == nil {
-		return CommandResponse{Message: "❌ Device pairing is not enabled"}
+		return CommandResponse{Message: "❌ Device pairing is not enabled"}.ephemeral()
 	}
 	if requestID == "" {
-		return CommandResponse{Message: "❌ Request ID is required"}
+		return CommandResponse{Message: "❌ Request ID is required"}.ephemeral()
 	}
 
-	device, err := r.pairing.Approve(requestID)
+	var (
+		device *PairedDevice
+		err    error
+	)
+	granted := parseScopes(scopes)
+	if granted != nil {
+		device, err = r.pairing.ApproveWithScopes(requestID, granted)
+	} else {
+		device, err = r.pairing.Approve(requestID)
+	}
 	if err != nil {
-		return CommandResponse{Message: fmt.Sprintf("❌ Approve failed: %v", err)}
+		return CommandResponse{Message: fmt.Sprintf("❌ Approve failed: %v", err)}.ephemeral()
 	}
 	if device == nil {
-		return CommandResponse{Message: fmt.Sprintf("❌ No pending request found for `%s`", requestID)}
+		return CommandResponse{Message: fmt.Sprintf("❌ No pending request found for `%s`", requestID)}.ephemeral()
+	}
+
+	msg := fmt.Sprintf("✅ Approved device **%s** (`%s`)", deviceLabel(device.DisplayName, device.DeviceID), device.DeviceID[:12])
+	if granted != nil {
+		msg += fmt.Sprintf(" with scopes `%s`", strings.Join(granted, ","))
+	}
+	return CommandResponse{OK: true, Message: msg}.ephemeral()
+}
+
+// HandleApproveAll approves the pending requests matching platform and
+// since (a duration such as "10m"); empty filters match everything, and
+// repair and operator requests are always left for individual approval
+// (see pairing.PendingFilter). Without confirm it only lists what would be
+// approved, with a code to pass as confirm; the code only approves while
+// the matches are exactly the listed ones.
+func (r *CommandRouter) HandleApproveAll(platform, since, confirm string) CommandResponse {
+	if r.pairing == nil || r.store == nil {
+		return CommandResponse{Message: "❌ Device pairing is not enabled"}.ephemeral()
+	}
+	filter := pairing.PendingFilter{Platform: platform}
+	if since != "" {
+		d, err := time.ParseDuration(since)
+		if err != nil || d <= 0 {
+			return CommandResponse{Message: fmt.Sprintf("❌ Invalid since %q (use a duration like 10m)", since)}.ephemeral()
+		}
+		filter.Since = d
+	}
+
+	matched := filter.Select(r.store.ListPending(), time.Now())
+	if len(matched) == 0 {
+		return CommandResponse{OK: true, Message: "No matching pending requests."}.ephemeral()
+	}
+
+	code := pairing.BatchCode(matched)
+	if confirm == "" {
+		lines := make([]string, 0, len(matched))
+		for _, req := range matched {
+			lines = append(lines, fmt.Sprintf("• **%s** (%s, %s) — `%s`\n", orDash(SafeName(req.DisplayName)), orDash(SafeName(req.Platform)), req.RemoteIP, req.RequestID))
+		}
+		header := fmt.Sprintf("⚠️ This would approve %d request(s) as nodes. Run again with `confirm: %s` to approve them:\n", len(matched), code)
+		return pagedResponse(paginate(header, lines, MaxMessageLen)).ephemeral()
+	}
+	if confirm != code {
+		return CommandResponse{Message: "❌ The matching requests changed since the preview, or the code is wrong. Run `/approve-all` without `confirm` to preview again."}.ephemeral()
+	}
+
+	var failures []string
+	for _, req := range matched {
+		device, err := r.pairing.Approve(req.RequestID)
+		if err == nil && device == nil {
+			err = fmt.Errorf("no longer pending")
+		}
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("• `%s`: %v\n", req.RequestID, err))
+		}
+	}
+	header := fmt.Sprintf("✅ Approved %d of %d request(s)\n", len(matched)-len(failures), len(matched))
+	if len(failures) == 0 {
+		return CommandResponse{OK: true, Message: strings.TrimSuffix(header, "\n")}.ephemeral()
+	}
+	resp := pagedResponse(paginate(header+"Failed:\n", failures, MaxMessageLen))
+	resp.OK = false
+	return resp.ephemeral()
+}
+
+// Pairing buttons carry custom IDs of the form "pairing:<action>:<requestID>".
+const (
+	pairingButtonPrefix  = "pairing:"
+	pairingActionApprove = "approve"
+	pairingActionReject  = "reject"
+)
+
+// PendingNotification builds the message announcing a new pending request,
+// with Approve/Reject buttons bound to its request ID. The request's name
+// and platform come from an unauthenticated client, so they are escaped
+// and mentions are disabled.
+func PendingNotification(req PendingRequest) *discordgo.MessageSend {
+	content := fmt.Sprintf("🔔 Pairing request from **%s** (%s) — device `%s`, request `%s`",
+		deviceLabel(req.DisplayName, req.DeviceID), SafeName(req.Platform), req.DeviceID[:min(12, len(req.DeviceID))], req.RequestID)
+	if req.RemoteIP != "" {
+		content += fmt.Sprintf(" from `%s`", req.RemoteIP)
+	}
+	return &discordgo.MessageSend{
+		Content:         content,
+		Components:      PairingButtons(req.RequestID, false),
+		AllowedMentions: noMentions(),
 	}
+}
+
+// PairingButtons returns the Approve/Reject action row for requestID.
+func PairingButtons(requestID string, disabled bool) []discordgo.MessageComponent {
+	return []discordgo.MessageComponent{
+		discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			discordgo.Button{
+				Label:    "Approve",
+				Style:    discordgo.SuccessButton,
+				Disabled: disabled,
+				CustomID: pairingButtonPrefix + pairingActionApprove + ":" + requestID,
+			},
+			discordgo.Button{
+				Label:    "Reject",
+				Style:    discordgo.DangerButton,
+				Disabled: disabled,
+				CustomID: pairingButtonPrefix + pairingActionReject + ":" + requestID,
+			},
+		}},
+	}
+}
 
-	name := device.DisplayName
-	if name == "" {
-		name = device.DeviceID[:12] + "…"
+// parsePairingCustomID splits a pairing button custom ID into its action
+// and request ID.
+func parsePairingCustomID(customID string) (action, requestID string, ok bool) {
+	rest, ok := strings.CutPrefix(customID, pairingButtonPrefix)
+	if !ok {
+		return "", "", false
+	}
+	action, requestID, ok = strings.Cut(rest, ":")
+	if !ok || requestID == "" {
+		return "", "", false
+	}
+	if action != pairingActionApprove && action != pairingActionReject {
+		return "", "", false
+	}
+	return action, requestID, true
+}
+
+// HandleComponent dispatches a button press by its custom ID.
+func (r *CommandRouter) HandleComponent(customID string) CommandResponse {
+	action, requestID, ok := parsePairingCustomID(customID)
+	if !ok {
+		return CommandResponse{Message: fmt.Sprintf("❌ Unknown action: %s", customID)}
+	}
+	if action == pairingActionApprove {
+		return r.HandleApprove(requestID, "")
 	}
-	return CommandResponse{OK: true, Message: fmt.Sprintf("✅ Approved device **%s** (`%s`)", name, device.DeviceID[:12])}
+	return r.HandleReject(requestID)
+}
+
+// parseScopes splits a comma-separated scope list, dropping blanks.
+// Returns nil when no scopes are given.
+func parseScopes(s string) []string {
+	var out []string
+	for _, scope := range strings.Split(s, ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			out = append(out, scope)
+		}
+	}
+	return out
 }
 
 // HandleReject rejects a pending device pairing request.
 func (r *CommandRouter) HandleReject(requestID string) CommandResponse {
 	if r.pairing == nil {
-		return CommandResponse{Message: "❌ Device pairing is not enabled"}
+		return CommandResponse{Message: "❌ Device pairing is not enabled"}.ephemeral()
 	}
 	if requestID == "" {
-		return CommandResponse{Message: "❌ Request ID is required"}
+		return CommandResponse{Message: "❌ Request ID is required"}.ephemeral()
 	}
 
 	rejected, err := r.pairing.Reject(requestID)
 	if err != nil {
-		return CommandResponse{Message: fmt.Sprintf("❌ Reject failed: %v", err)}
+		return CommandResponse{Message: fmt.Sprintf("❌ Reject failed: %v", err)}.ephemeral()
 	}
 	if rejected == nil {
-		return CommandResponse{Message: fmt.Sprintf("❌ No pending request found for `%s`", requestID)}
+		return CommandResponse{Message: fmt.Sprintf("❌ No pending request found for `%s`", requestID)}.ephemeral()
 	}
 
-	name := rejected.DisplayName
-	if name == "" {
-		name = rejected.DeviceID[:12] + "…"
-	}
-	return CommandResponse{OK: true, Message: fmt.Sprintf("🚫 Rejected device **%s** (`%s`)", name, rejected.DeviceID[:12])}
+	return CommandResponse{OK: true, Message: fmt.Sprintf("🚫 Rejected device **%s** (`%s`)", deviceLabel(rejected.DisplayName, rejected.DeviceID), rejected.DeviceID[:12])}.ephemeral()
 }
 
 // HandleRevoke revokes a paired device's access token.
 func (r *CommandRouter) HandleRevoke(deviceID, role string) CommandResponse {
 	if r.pairing == nil {
-		return CommandResponse{Message: "❌ Device pairing is not enabled"}
+		return CommandResponse{Message: "❌ Device pairing is not enabled"}.ephemeral()
 	}
 	if deviceID == "" {
-		return CommandResponse{Message: "❌ Device ID is required"}
+		return CommandResponse{Message: "❌ Device ID is required"}.ephemeral()
 	}
 	if role == "" {
 		role = "node"
@@ -435,8 +1437,49 @@ func (r *CommandRouter) HandleRevoke(deviceID, role string) CommandResponse {
 
 	tok := r.pairing.RevokeDeviceToken(deviceID, role)
 	if tok == nil {
-		return CommandResponse{Message: fmt.Sprintf("❌ No token found for device `%s` role `%s`", deviceID[:min(12, len(deviceID))], role)}
+		return CommandResponse{Message: fmt.Sprintf("❌ No token found for device `%s` role `%s`", deviceID[:min(12, len(deviceID))], role)}.ephemeral()
 	}
 
-	return CommandResponse{OK: true, Message: fmt.Sprintf("🔒 Revoked token for device `%s` role `%s`", deviceID[:min(12, len(deviceID))], role)}
+	return CommandResponse{OK: true, Message: fmt.Sprintf("🔒 Revoked token for device `%s` role `%s`", deviceID[:min(12, len(deviceID))], role)}.ephemeral()
+}
+
+// HandleRename sets a paired device's display name.
+func (r *CommandRouter) HandleRename(deviceID, name string) CommandResponse {
+	if r.pairing == nil {
+		return CommandResponse{Message: "❌ Device pairing is not enabled"}
+	}
+	if deviceID == "" {
+		return CommandResponse{Message: "❌ Device ID is required"}
+	}
+
+	if err := r.pairing.RenameDevice(deviceID, name); err != nil {
+		return CommandResponse{Message: fmt.Sprintf("❌ Rename failed: %v", err)}
+	}
+
+	return CommandResponse{OK: true, Message: fmt.Sprintf("✏️ Renamed device `%s` to **%s**", deviceID[:min(12, len(deviceID))], strings.TrimSpace(name))}
+}
+
+// HandleTag replaces a paired device's tags with those in tags, separated
+// by commas or whitespace. Empty tags clears them.
+func (r *CommandRouter) HandleTag(deviceID, tags string) CommandResponse {
+	if r.pairing == nil {
+		return CommandResponse{Message: "❌ Device pairing is not enabled"}
+	}
+	if deviceID == "" {
+		return CommandResponse{Message: "❌ Device ID is required"}
+	}
+
+	list, err := pairing.NormalizeTags(strings.FieldsFunc(tags, func(c rune) bool { return c == ',' || unicode.IsSpace(c) }))
+	if err == nil {
+		err = r.pairing.SetDeviceTags(deviceID, list)
+	}
+	if err != nil {
+		return CommandResponse{Message: fmt.Sprintf("❌ Tag failed: %v", err)}
+	}
+
+	short := deviceID[:min(12, len(deviceID))]
+	if len(list) == 0 {
+		return CommandResponse{OK: true, Message: fmt.Sprintf("🏷️ Cleared tags of device `%s`", short)}
+	}
+	return CommandResponse{OK: true, Message: fmt.Sprintf("🏷️ Tagged device `%s`: %s", short, "`"+strings.Join(list, "`, `")+"`")}
 }
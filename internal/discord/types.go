@@ -11,6 +11,7 @@ import (
 type InvokeRequest = node.InvokeRequest
 type InvokeResult = node.InvokeResult
 type NodeSession = node.NodeSession
+type OperatorSession = node.OperatorSession
 
 // Type aliases for pairing types.
 type PairedDevice = pairing.PairedDevice
@@ -24,13 +25,22 @@ type Invoker interface {
 // NodeRegistry provides read access to connected nodes.
 type NodeRegistry interface {
 	List() []*NodeSession
+	ListByPlatform(platform string) []*NodeSession
 	Get(id string) (*NodeSession, bool)
 }
 
+// OperatorRegistry provides read access to connected operator clients.
+type OperatorRegistry interface {
+	List() []*OperatorSession
+}
+
 // PairingService provides pairing operations for Discord commands.
 type PairingService interface {
 	Approve(requestID string) (*PairedDevice, error)
+	ApproveWithScopes(requestID string, scopes []string) (*PairedDevice, error)
 	Reject(requestID string) (*PendingRequest, error)
+	RenameDevice(deviceID, name string) error
+	SetDeviceTags(deviceID string, tags []string) error
 	RevokeDeviceToken(deviceID, role string) *pairing.DeviceAuthToken
 }
 
@@ -38,5 +48,8 @@ type PairingService interface {
 type PairingStore interface {
 	ListPending() []PendingRequest
 	ListPaired() []PairedDevice
+	GetPendingRequest(requestID string) *PendingRequest
+	GetPairedDevice(deviceID string) *PairedDevice
+	GetByTag(tag string) []PairedDevice
 }
 
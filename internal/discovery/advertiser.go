@@ -4,12 +4,18 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 	"log/slog"
 
 	"github.com/hashicorp/mdns"
 )
 
+// ServiceType is the DNS-SD service type gateways advertise.
+const ServiceType = "_openclaw-gw._tcp"
+
 // Metadata holds the TXT record fields for the service.
 type Metadata struct {
 	Role        string // e.g., "gateway"
@@ -18,87 +24,256 @@ type Metadata struct {
 	LanHost     string // e.g., "my-mac.local"
 	DisplayName string // e.g., "My Mac"
 	RemoteID    string // e.g., device ID of the gateway
+	Version     string // gateway version, e.g., "0.1.0"
+	Protocol    int    // wire protocol version; 0 = omit
 }
 
+// txtRecords renders the metadata as key=value TXT entries.
+func (m Metadata) txtRecords() []string {
+	txt := []string{
+		fmt.Sprintf("role=%s", m.Role),
+		fmt.Sprintf("transport=%s", m.Transport),
+		fmt.Sprintf("gatewayPort=%s", m.GatewayPort),
+		fmt.Sprintf("lanHost=%s", m.LanHost),
+		fmt.Sprintf("displayName=%s", m.DisplayName),
+	}
+	if m.RemoteID != "" {
+		txt = append(txt, fmt.Sprintf("remoteId=%s", m.RemoteID))
+	}
+	if m.Version != "" {
+		txt = append(txt, fmt.Sprintf("version=%s", m.Version))
+	}
+	if m.Protocol != 0 {
+		txt = append(txt, fmt.Sprintf("protocol=%d", m.Protocol))
+	}
+	return txt
+}
+
+// DefaultInterfacePollInterval is how often the advertiser checks for
+// network interface changes when Config.InterfacePollInterval is zero.
+const DefaultInterfacePollInterval = 10 * time.Second
+
 // Config holds configuration for the mDNS advertiser.
 type Config struct {
-	InstanceName string // Name of the service instance
+	InstanceName string // Name of the service instance; defaults to the OS hostname
 	Port         int    // Port where the service is running
-	LanHost      string // Optional: Hostname to advertise
+	LanHost      string // Optional: Hostname to advertise; empty = auto-detect
 	Meta         Metadata
+
+	// InterfacePollInterval controls how often interfaces are re-checked
+	// so the advertisement follows Wi-Fi reconnects and new links.
+	// 0 = DefaultInterfacePollInterval, negative disables the watcher.
+	InterfacePollInterval time.Duration
 }
 
 // Advertiser manages the mDNS service registration.
 type Advertiser struct {
-	servers []*mdns.Server
-	cfg     Config
+	cfg         Config
+	autoLanHost bool // LanHost was detected at Start, so the watcher re-detects it
+
+	mu       sync.Mutex
+	txt      []string // TXT records; rebuilt when a detected LanHost changes
+	servers  []*mdns.Server
+	ifaceKey string // eligible interfaces and addresses the servers were bound to
+	stopCh   chan struct{}
+	doneCh   chan struct{}
+
+	// Overridable for tests.
+	interfaces func() ([]net.Interface, error)
+	addrs      func(net.Interface) ([]net.Addr, error)
+	newServer  func(*mdns.Config) (*mdns.Server, error)
 }
 
 // NewAdvertiser creates a new advertiser with the given config.
+// An empty InstanceName falls back to the OS hostname, and an empty
+// Meta.DisplayName falls back to the instance name.
 func NewAdvertiser(cfg Config) (*Advertiser, error) {
-	if cfg.InstanceName == "" {
-		return nil, fmt.Errorf("instance name is required")
-	}
 	if cfg.Port <= 0 {
 		return nil, fmt.Errorf("port must be > 0")
 	}
+	if cfg.InstanceName == "" {
+		host, err := os.Hostname()
+		if err != nil || host == "" {
+			return nil, fmt.Errorf("instance name is required (hostname unavailable: %v)", err)
+		}
+		cfg.InstanceName = host
+	}
+	if cfg.Meta.DisplayName == "" {
+		cfg.Meta.DisplayName = cfg.InstanceName
+	}
+	if cfg.InterfacePollInterval == 0 {
+		cfg.InterfacePollInterval = DefaultInterfacePollInterval
+	}
 
 	return &Advertiser{
-		cfg: cfg,
+		cfg:        cfg,
+		interfaces: net.Interfaces,
+		addrs:      func(iface net.Interface) ([]net.Addr, error) { return iface.Addrs() },
+		newServer:  mdns.NewServer,
 	}, nil
 }
 
 // Start begins advertising the service.
-// It returns immediately, running the server in a goroutine (managed by mdns lib).
+// It returns immediately, running the server in a goroutine (managed by mdns lib),
+// and starts the interface watcher unless it is disabled.
 func (a *Advertiser) Start() error {
-	// Build TXT records
-	txt := []string{
-		fmt.Sprintf("role=%s", a.cfg.Meta.Role),
-		fmt.Sprintf("transport=%s", a.cfg.Meta.Transport),
-		fmt.Sprintf("gatewayPort=%s", a.cfg.Meta.GatewayPort),
-		fmt.Sprintf("lanHost=%s", a.cfg.Meta.LanHost),
-		fmt.Sprintf("displayName=%s", a.cfg.Meta.DisplayName),
-	}
-	if a.cfg.Meta.RemoteID != "" {
-		txt = append(txt, fmt.Sprintf("remoteId=%s", a.cfg.Meta.RemoteID))
-	}
-
-	// Create service definition
-	// Service Type: _openclaw-gw._tcp
-	service, err := mdns.NewMDNSService(
-		a.cfg.InstanceName,
-		"_openclaw-gw._tcp",
-		"",
-		"",
-		a.cfg.Port,
-		nil, // IPs (nil = all interfaces)
-		txt,
-	)
+	if a.cfg.Meta.LanHost == "" {
+		a.cfg.Meta.LanHost = a.cfg.LanHost
+	}
+	if a.cfg.Meta.LanHost == "" {
+		a.autoLanHost = true
+		a.cfg.Meta.LanHost = a.detectLanHost()
+		slog.Info("mdns lanHost detected", "lanHost", a.cfg.Meta.LanHost)
+	}
+
+	a.mu.Lock()
+	a.txt = a.cfg.Meta.txtRecords()
+	a.mu.Unlock()
+
+	ifaces, err := a.eligibleInterfaces()
 	if err != nil {
-		return fmt.Errorf("create mdns service: %w", err)
+		return err
+	}
+	if err := a.rebind(ifaces, a.interfaceIPs(ifaces)); err != nil {
+		return err
 	}
 
-	// Create and start servers on multicast-capable interfaces.
-	// mdns.NewServer triggers advertisement immediately.
-	ifaces, err := net.Interfaces()
+	if a.cfg.InterfacePollInterval > 0 {
+		stopCh, doneCh := make(chan struct{}), make(chan struct{})
+		a.mu.Lock()
+		a.stopCh, a.doneCh = stopCh, doneCh
+		a.mu.Unlock()
+		go a.watchInterfaces(a.cfg.InterfacePollInterval, stopCh, doneCh)
+	}
+	return nil
+}
+
+// eligibleInterfaces returns the up, multicast-capable interfaces that
+// pass the GOCLAW_MDNS_IFACE filter.
+func (a *Advertiser) eligibleInterfaces() ([]net.Interface, error) {
+	ifaces, err := a.interfaces()
 	if err != nil {
-		return fmt.Errorf("list interfaces: %w", err)
+		return nil, fmt.Errorf("list interfaces: %w", err)
 	}
 
-	var servers []*mdns.Server
 	ifaceFilter := strings.TrimSpace(os.Getenv("GOCLAW_MDNS_IFACE"))
+	var eligible []net.Interface
 	for _, iface := range ifaces {
-		iface := iface
 		if ifaceFilter != "" && iface.Name != ifaceFilter {
 			continue
 		}
 		if (iface.Flags&net.FlagUp) == 0 || (iface.Flags&net.FlagMulticast) == 0 {
 			continue
 		}
+		eligible = append(eligible, iface)
+	}
+	return eligible, nil
+}
+
+// interfaceAddrs pairs an interface with its addresses.
+type interfaceAddrs struct {
+	iface net.Interface
+	addrs []net.Addr
+}
+
+// detectLanHost picks the host clients should dial, from the current
+// interfaces and the OS hostname.
+func (a *Advertiser) detectLanHost() string {
+	ifaces, err := a.interfaces()
+	if err != nil {
+		slog.Warn("mdns lanHost detection: list interfaces", "error", err)
+	}
+	list := make([]interfaceAddrs, 0, len(ifaces))
+	for _, iface := range ifaces {
+		addrs, _ := a.addrs(iface)
+		list = append(list, interfaceAddrs{iface: iface, addrs: addrs})
+	}
+	hostname, _ := os.Hostname()
+	return pickLanHost(list, strings.TrimSpace(os.Getenv("GOCLAW_MDNS_IFACE")), hostname)
+}
+
+// pickLanHost returns the first routable IPv4 address (not loopback or
+// link-local) of an up, non-loopback interface, considering only the
+// interface named filter when it is set. Without one it falls back to
+// hostname under .local, or "" when the hostname is unknown.
+func pickLanHost(ifaces []interfaceAddrs, filter, hostname string) string {
+	for _, ia := range ifaces {
+		if filter != "" && ia.iface.Name != filter {
+			continue
+		}
+		if ia.iface.Flags&net.FlagUp == 0 || ia.iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		for _, addr := range ia.addrs {
+			ipnet, ok := addr.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			if ip4 := ipnet.IP.To4(); ip4 != nil && !ip4.IsLoopback() && !ip4.IsLinkLocalUnicast() {
+				return ip4.String()
+			}
+		}
+	}
+	if hostname == "" {
+		return ""
+	}
+	return strings.TrimSuffix(hostname, ".local") + ".local"
+}
+
+// interfaceIPs returns the addresses to advertise for ifaces: their
+// unicast IPs other than loopback and link-local ones, sorted.
+func (a *Advertiser) interfaceIPs(ifaces []net.Interface) []net.IP {
+	var ips []net.IP
+	for _, iface := range ifaces {
+		addrs, err := a.addrs(iface)
+		if err != nil {
+			slog.Warn("mdns interface addresses", "iface", iface.Name, "error", err)
+			continue
+		}
+		for _, addr := range addrs {
+			ipnet, ok := addr.(*net.IPNet)
+			if !ok || ipnet.IP.IsLoopback() || ipnet.IP.IsLinkLocalUnicast() {
+				continue
+			}
+			ips = append(ips, ipnet.IP)
+		}
+	}
+	sort.Slice(ips, func(i, j int) bool { return ips[i].String() < ips[j].String() })
+	return ips
+}
 
-		server, err := mdns.NewServer(&mdns.Config{
-			Zone:             service,
-			Iface:            &iface,
+// newService builds the service record advertising ips. It never resolves
+// the hostname: with no usable address it advertises loopback, so the
+// gateway is at least discoverable from this host.
+func (a *Advertiser) newService(ips []net.IP) (*mdns.MDNSService, error) {
+	if len(ips) == 0 {
+		slog.Warn("mdns found no interface addresses, advertising loopback")
+		ips = []net.IP{net.IPv4(127, 0, 0, 1)}
+	}
+	a.mu.Lock()
+	txt := a.txt
+	a.mu.Unlock()
+	service, err := mdns.NewMDNSService(a.cfg.InstanceName, ServiceType, "", "", a.cfg.Port, ips, txt)
+	if err != nil {
+		return nil, fmt.Errorf("create mdns service: %w", err)
+	}
+	return service, nil
+}
+
+// rebind replaces the running servers with a fresh set bound to ifaces,
+// advertising ips. mdns.NewServer triggers advertisement immediately.
+func (a *Advertiser) rebind(ifaces []net.Interface, ips []net.IP) error {
+	service, err := a.newService(ips)
+	if err != nil {
+		return err
+	}
+
+	var servers []*mdns.Server
+	for _, iface := range ifaces {
+		iface := iface
+		server, err := a.newServer(&mdns.Config{
+			Zone:              service,
+			Iface:             &iface,
 			LogEmptyResponses: true,
 		})
 		if err != nil {
@@ -110,28 +285,115 @@ func (a *Advertiser) Start() error {
 	}
 
 	// Fallback to default interface if none succeeded and no explicit filter.
+	ifaceFilter := strings.TrimSpace(os.Getenv("GOCLAW_MDNS_IFACE"))
+	var bindErr error
 	if len(servers) == 0 && ifaceFilter == "" {
-		server, err := mdns.NewServer(&mdns.Config{
-			Zone:             service,
+		server, err := a.newServer(&mdns.Config{
+			Zone:              service,
 			LogEmptyResponses: true,
 		})
 		if err != nil {
-			return fmt.Errorf("start mdns server: %w", err)
+			bindErr = fmt.Errorf("start mdns server: %w", err)
+		} else {
+			servers = append(servers, server)
 		}
-		servers = append(servers, server)
-	}
-	if len(servers) == 0 {
-		return fmt.Errorf("no mdns interfaces bound (filter=%q)", ifaceFilter)
+	} else if len(servers) == 0 {
+		bindErr = fmt.Errorf("no mdns interfaces bound (filter=%q)", ifaceFilter)
 	}
 
+	a.mu.Lock()
+	old := a.servers
 	a.servers = servers
-	return nil
+	a.ifaceKey = interfaceKey(ifaces, ips)
+	a.mu.Unlock()
+
+	shutdownServers(old)
+	return bindErr
 }
 
-// Stop shuts down the mDNS advertisement.
+// watchInterfaces polls the eligible interfaces and their addresses and
+// rebinds whenever they change, re-detecting LanHost first when Start
+// detected it. It exits when Stop closes stopCh.
+func (a *Advertiser) watchInterfaces(interval time.Duration, stopCh <-chan struct{}, doneCh chan<- struct{}) {
+	defer close(doneCh)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+
+		ifaces, err := a.eligibleInterfaces()
+		if err != nil {
+			slog.Warn("mdns interface poll failed", "error", err)
+			continue
+		}
+		ips := a.interfaceIPs(ifaces)
+		key := interfaceKey(ifaces, ips)
+		var lanHost string
+		if a.autoLanHost {
+			lanHost = a.detectLanHost()
+		}
+		a.mu.Lock()
+		hostChanged := a.autoLanHost && lanHost != a.cfg.Meta.LanHost
+		changed := key != a.ifaceKey || hostChanged
+		prev := a.ifaceKey
+		if hostChanged {
+			slog.Info("mdns lanHost changed", "from", a.cfg.Meta.LanHost, "to", lanHost)
+			a.cfg.Meta.LanHost = lanHost
+			a.txt = a.cfg.Meta.txtRecords()
+		}
+		a.mu.Unlock()
+		if !changed {
+			continue
+		}
+
+		slog.Info("mdns interfaces changed, rebinding", "from", prev, "to", key)
+		if err := a.rebind(ifaces, ips); err != nil {
+			slog.Warn("mdns rebind failed", "error", err)
+		}
+	}
+}
+
+// interfaceKey identifies an interface set and its sorted addresses,
+// independent of interface order.
+func interfaceKey(ifaces []net.Interface, ips []net.IP) string {
+	names := make([]string, 0, len(ifaces))
+	for _, iface := range ifaces {
+		names = append(names, iface.Name)
+	}
+	sort.Strings(names)
+	addrs := make([]string, len(ips))
+	for i, ip := range ips {
+		addrs[i] = ip.String()
+	}
+	return strings.Join(names, ",") + " " + strings.Join(addrs, ",")
+}
+
+// Stop cancels the interface watcher and shuts down the mDNS advertisement.
 func (a *Advertiser) Stop() error {
+	a.mu.Lock()
+	stopCh, doneCh := a.stopCh, a.doneCh
+	a.stopCh = nil
+	a.mu.Unlock()
+	if stopCh != nil {
+		close(stopCh)
+		<-doneCh
+	}
+
+	a.mu.Lock()
+	servers := a.servers
+	a.servers = nil
+	a.mu.Unlock()
+	return shutdownServers(servers)
+}
+
+func shutdownServers(servers []*mdns.Server) error {
 	var firstErr error
-	for _, server := range a.servers {
+	for _, server := range servers {
 		if server == nil {
 			continue
 		}
@@ -1,16 +1,31 @@
 package discovery
 
 import (
+	"net"
+	"os"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/hashicorp/mdns"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
+// ipNet parses cidr into an interface address, keeping the host IP.
+func ipNet(t *testing.T, cidr string) net.Addr {
+	t.Helper()
+	ip, n, err := net.ParseCIDR(cidr)
+	require.NoError(t, err)
+	n.IP = ip
+	return n
+}
+
 func TestAdvertiser_StartStop(t *testing.T) {
-	// 1. Setup config
-	cfg := Config{
+	t.Setenv("GOCLAW_MDNS_IFACE", "")
+
+	adv, err := NewAdvertiser(Config{
 		InstanceName: "TestGateway",
 		Port:         18789,
 		LanHost:      "test-host.local",
@@ -20,27 +35,60 @@ func TestAdvertiser_StartStop(t *testing.T) {
 			GatewayPort: "18789",
 			DisplayName: "Test Gateway",
 		},
-	}
-
-	// 2. Create Advertiser
-	adv, err := NewAdvertiser(cfg)
+		InterfacePollInterval: -1,
+	})
 	require.NoError(t, err)
 	require.NotNil(t, adv)
 
-	// 3. Start (Async)
-	err = adv.Start()
-	require.NoError(t, err)
+	// The advertised addresses come from the interfaces, not from
+	// resolving the hostname.
+	adv.interfaces = func() ([]net.Interface, error) {
+		return []net.Interface{
+			{Index: 1, Name: "lo0", Flags: net.FlagUp | net.FlagLoopback | net.FlagMulticast},
+			{Index: 2, Name: "en0", Flags: net.FlagUp | net.FlagMulticast},
+		}, nil
+	}
+	adv.addrs = func(iface net.Interface) ([]net.Addr, error) {
+		if iface.Name == "lo0" {
+			return []net.Addr{ipNet(t, "127.0.0.1/8")}, nil
+		}
+		return []net.Addr{ipNet(t, "fe80::1/64"), ipNet(t, "192.168.1.20/24")}, nil
+	}
+	var zones []*mdns.MDNSService
+	adv.newServer = func(cfg *mdns.Config) (*mdns.Server, error) {
+		zones = append(zones, cfg.Zone.(*mdns.MDNSService))
+		return nil, nil
+	}
 
-	// Allow some time for goroutines to spin up
-	time.Sleep(100 * time.Millisecond)
+	require.NoError(t, adv.Start())
+	require.Len(t, zones, 2)
+	for _, zone := range zones {
+		assert.Equal(t, "TestGateway", zone.Instance)
+		assert.Equal(t, 18789, zone.Port)
+		require.Len(t, zone.IPs, 1)
+		assert.Equal(t, "192.168.1.20", zone.IPs[0].String())
+		assert.Contains(t, zone.TXT, "lanHost=test-host.local")
+	}
+	require.NoError(t, adv.Stop())
+}
 
-	// 4. Verify (We can't easily verify the network broadcast in a unit test 
-	// without a full mDNS client listener, but we can verify internal state 
-	// if we expose it, or just ensure no panic/error during lifecycle)
-	
-	// 5. Stop
-	err = adv.Stop()
+func TestAdvertiser_NoAddressesAdvertisesLoopback(t *testing.T) {
+	t.Setenv("GOCLAW_MDNS_IFACE", "")
+
+	adv, err := NewAdvertiser(Config{InstanceName: "TestGateway", Port: 18789, LanHost: "gw.local", InterfacePollInterval: -1})
 	require.NoError(t, err)
+	adv.interfaces = func() ([]net.Interface, error) { return nil, nil }
+	var zone *mdns.MDNSService
+	adv.newServer = func(cfg *mdns.Config) (*mdns.Server, error) {
+		zone = cfg.Zone.(*mdns.MDNSService)
+		return nil, nil
+	}
+
+	require.NoError(t, adv.Start())
+	require.NotNil(t, zone)
+	require.Len(t, zone.IPs, 1)
+	assert.True(t, zone.IPs[0].IsLoopback())
+	require.NoError(t, adv.Stop())
 }
 
 func TestAdvertiser_ConfigValidation(t *testing.T) {
@@ -67,12 +115,12 @@ func TestAdvertiser_ConfigValidation(t *testing.T) {
 			wantErr: true,
 		},
 		{
-			name: "Missing Name",
+			name: "Missing Name Uses Hostname",
 			cfg: Config{
 				InstanceName: "",
 				Port:         8080,
 			},
-			wantErr: true,
+			wantErr: false,
 		},
 	}
 
@@ -87,3 +135,269 @@ func TestAdvertiser_ConfigValidation(t *testing.T) {
 		})
 	}
 }
+
+func TestNewAdvertiser_ResolvesNames(t *testing.T) {
+	hostname, err := os.Hostname()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name            string
+		cfg             Config
+		wantInstance    string
+		wantDisplayName string
+	}{
+		{
+			name:            "Explicit names",
+			cfg:             Config{InstanceName: "gw-kitchen", Port: 18789, Meta: Metadata{DisplayName: "Kitchen Gateway"}},
+			wantInstance:    "gw-kitchen",
+			wantDisplayName: "Kitchen Gateway",
+		},
+		{
+			name:            "Display name defaults to instance name",
+			cfg:             Config{InstanceName: "gw-kitchen", Port: 18789},
+			wantInstance:    "gw-kitchen",
+			wantDisplayName: "gw-kitchen",
+		},
+		{
+			name:            "Empty names default to hostname",
+			cfg:             Config{Port: 18789},
+			wantInstance:    hostname,
+			wantDisplayName: hostname,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			adv, err := NewAdvertiser(tt.cfg)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantInstance, adv.cfg.InstanceName)
+			assert.Equal(t, tt.wantDisplayName, adv.cfg.Meta.DisplayName)
+		})
+	}
+}
+
+func TestMetadata_TXTRecords(t *testing.T) {
+	meta := Metadata{
+		Role:        "gateway",
+		Transport:   "gateway",
+		GatewayPort: "18789",
+		LanHost:     "gw.local",
+		DisplayName: "Test Gateway",
+		Version:     "0.1.0",
+		Protocol:    3,
+	}
+
+	txt := meta.txtRecords()
+	assert.Equal(t, []string{
+		"role=gateway",
+		"transport=gateway",
+		"gatewayPort=18789",
+		"lanHost=gw.local",
+		"displayName=Test Gateway",
+		"version=0.1.0",
+		"protocol=3",
+	}, txt)
+
+	// Unset version/protocol are omitted rather than advertised empty.
+	txt = Metadata{Role: "gateway"}.txtRecords()
+	for _, rec := range txt {
+		assert.NotContains(t, rec, "version=")
+		assert.NotContains(t, rec, "protocol=")
+	}
+}
+
+func TestAdvertiser_RebindsOnInterfaceChange(t *testing.T) {
+	t.Setenv("GOCLAW_MDNS_IFACE", "")
+
+	var mu sync.Mutex
+	current := []net.Interface{
+		{Index: 1, Name: "lo0", Flags: net.FlagUp | net.FlagLoopback},
+		{Index: 2, Name: "en0", Flags: net.FlagUp | net.FlagMulticast},
+	}
+	var bound []string
+
+	adv, err := NewAdvertiser(Config{
+		InstanceName:          "TestGateway",
+		Port:                  18789,
+		InterfacePollInterval: 10 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	adv.interfaces = func() ([]net.Interface, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]net.Interface(nil), current...), nil
+	}
+	adv.addrs = func(net.Interface) ([]net.Addr, error) { return nil, nil }
+	adv.newServer = func(cfg *mdns.Config) (*mdns.Server, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if cfg.Iface != nil {
+			bound = append(bound, cfg.Iface.Name)
+		}
+		return nil, nil
+	}
+
+	require.NoError(t, adv.Start())
+	mu.Lock()
+	assert.Equal(t, []string{"en0"}, bound)
+	// Wi-Fi comes up on a second interface.
+	current = append(current, net.Interface{Index: 3, Name: "en1", Flags: net.FlagUp | net.FlagMulticast})
+	mu.Unlock()
+
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(bound) == 3
+	}, 2*time.Second, 5*time.Millisecond)
+	mu.Lock()
+	assert.ElementsMatch(t, []string{"en0", "en1"}, bound[1:])
+	mu.Unlock()
+
+	require.NoError(t, adv.Stop())
+
+	// Watcher is stopped: further changes are not picked up.
+	mu.Lock()
+	current = current[:1]
+	n := len(bound)
+	mu.Unlock()
+	time.Sleep(50 * time.Millisecond)
+	mu.Lock()
+	assert.Equal(t, n, len(bound))
+	mu.Unlock()
+}
+
+func TestAdvertiser_RebindsOnAddressChange(t *testing.T) {
+	t.Setenv("GOCLAW_MDNS_IFACE", "")
+
+	var mu sync.Mutex
+	addr := "192.168.1.20/24"
+	var advertised []string
+
+	adv, err := NewAdvertiser(Config{
+		InstanceName:          "TestGateway",
+		Port:                  18789,
+		LanHost:               "gw.local",
+		InterfacePollInterval: 10 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	adv.interfaces = func() ([]net.Interface, error) {
+		return []net.Interface{{Index: 2, Name: "en0", Flags: net.FlagUp | net.FlagMulticast}}, nil
+	}
+	adv.addrs = func(net.Interface) ([]net.Addr, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return []net.Addr{ipNet(t, addr)}, nil
+	}
+	adv.newServer = func(cfg *mdns.Config) (*mdns.Server, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		advertised = append(advertised, cfg.Zone.(*mdns.MDNSService).IPs[0].String())
+		return nil, nil
+	}
+
+	require.NoError(t, adv.Start())
+	defer adv.Stop()
+
+	// Wi-Fi reconnects with a new lease on the same interface.
+	mu.Lock()
+	addr = "192.168.1.31/24"
+	mu.Unlock()
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(advertised) == 2
+	}, 2*time.Second, 5*time.Millisecond)
+	mu.Lock()
+	assert.Equal(t, []string{"192.168.1.20", "192.168.1.31"}, advertised)
+	mu.Unlock()
+}
+
+func TestAdvertiser_RedetectsLanHost(t *testing.T) {
+	t.Setenv("GOCLAW_MDNS_IFACE", "")
+
+	var mu sync.Mutex
+	addr := "192.168.1.20/24"
+	var lanHosts []string
+
+	adv, err := NewAdvertiser(Config{
+		InstanceName:          "TestGateway",
+		Port:                  18789,
+		InterfacePollInterval: 10 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	adv.interfaces = func() ([]net.Interface, error) {
+		return []net.Interface{{Index: 2, Name: "en0", Flags: net.FlagUp | net.FlagMulticast}}, nil
+	}
+	adv.addrs = func(net.Interface) ([]net.Addr, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return []net.Addr{ipNet(t, addr)}, nil
+	}
+	adv.newServer = func(cfg *mdns.Config) (*mdns.Server, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, txt := range cfg.Zone.(*mdns.MDNSService).TXT {
+			if host, ok := strings.CutPrefix(txt, "lanHost="); ok {
+				lanHosts = append(lanHosts, host)
+			}
+		}
+		return nil, nil
+	}
+
+	require.NoError(t, adv.Start())
+	defer adv.Stop()
+
+	// The detected address goes away; the new one is advertised instead.
+	mu.Lock()
+	addr = "10.0.0.7/24"
+	mu.Unlock()
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(lanHosts) == 2
+	}, 2*time.Second, 5*time.Millisecond)
+	mu.Lock()
+	assert.Equal(t, []string{"192.168.1.20", "10.0.0.7"}, lanHosts)
+	mu.Unlock()
+}
+
+func TestAdvertiser_WatcherDisabled(t *testing.T) {
+	adv, err := NewAdvertiser(Config{InstanceName: "TestGateway", Port: 18789, LanHost: "gw.local", InterfacePollInterval: -1})
+	require.NoError(t, err)
+	adv.interfaces = func() ([]net.Interface, error) { return nil, nil }
+	adv.newServer = func(*mdns.Config) (*mdns.Server, error) { return nil, nil }
+
+	require.NoError(t, adv.Start())
+	assert.Nil(t, adv.stopCh)
+	require.NoError(t, adv.Stop())
+}
+
+func TestPickLanHost(t *testing.T) {
+	ipNet := func(cidr string) net.Addr { return ipNet(t, cidr) }
+	up := net.FlagUp | net.FlagMulticast
+	ifaces := []interfaceAddrs{
+		{iface: net.Interface{Name: "lo", Flags: up | net.FlagLoopback}, addrs: []net.Addr{ipNet("127.0.0.1/8")}},
+		{iface: net.Interface{Name: "eth0", Flags: 0}, addrs: []net.Addr{ipNet("10.0.0.5/24")}},
+		{iface: net.Interface{Name: "wlan0", Flags: up}, addrs: []net.Addr{ipNet("fe80::1/64"), ipNet("169.254.3.4/16"), ipNet("192.168.1.20/24")}},
+		{iface: net.Interface{Name: "eth1", Flags: up}, addrs: []net.Addr{ipNet("172.16.0.9/16")}},
+	}
+
+	tests := []struct {
+		name     string
+		ifaces   []interfaceAddrs
+		filter   string
+		hostname string
+		want     string
+	}{
+		{name: "first routable IPv4", ifaces: ifaces, hostname: "mac", want: "192.168.1.20"},
+		{name: "interface filter", ifaces: ifaces, filter: "eth1", hostname: "mac", want: "172.16.0.9"},
+		{name: "filtered interface down", ifaces: ifaces, filter: "eth0", hostname: "mac", want: "mac.local"},
+		{name: "no interfaces", hostname: "mac.local", want: "mac.local"},
+		{name: "nothing known", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, pickLanHost(tt.ifaces, tt.filter, tt.hostname))
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/mdns"
+)
+
+// DiscoveredGateway is a gateway found on the LAN by Browse.
+type DiscoveredGateway struct {
+	Name        string // instance name, e.g., "kitchen-mac"
+	Host        string // advertised host name, e.g., "kitchen-mac.local."
+	Addr        net.IP // first resolved address, if any
+	Port        int
+	Role        string
+	Version     string
+	Protocol    int
+	DisplayName string
+}
+
+// Browse queries the LAN for gateways advertising ServiceType and returns
+// what answered within timeout, deduplicated by instance name. Reaching
+// the timeout is not an error; a cancelled ctx returns the partial results
+// along with ctx.Err().
+func Browse(ctx context.Context, timeout time.Duration) ([]DiscoveredGateway, error) {
+	entries := make(chan *mdns.ServiceEntry, 16)
+	results := make(chan []DiscoveredGateway, 1)
+	go func() { results <- collectGateways(entries) }()
+
+	params := mdns.DefaultParams(ServiceType)
+	params.Entries = entries
+	params.Timeout = timeout
+	params.DisableIPv6 = true
+	err := mdns.QueryContext(ctx, params)
+
+	close(entries)
+	found := <-results
+
+	if err != nil {
+		return found, fmt.Errorf("mdns query: %w", err)
+	}
+	return found, ctx.Err()
+}
+
+// collectGateways drains entries until closed, keeping the last answer per
+// instance name, and returns them sorted by name.
+func collectGateways(entries <-chan *mdns.ServiceEntry) []DiscoveredGateway {
+	byName := make(map[string]DiscoveredGateway)
+	for e := range entries {
+		if e == nil {
+			continue
+		}
+		gw := newDiscoveredGateway(e)
+		byName[gw.Name] = gw
+	}
+
+	found := make([]DiscoveredGateway, 0, len(byName))
+	for _, gw := range byName {
+		found = append(found, gw)
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].Name < found[j].Name })
+	return found
+}
+
+// newDiscoveredGateway converts an mDNS answer, parsing the TXT records
+// written by Metadata.txtRecords.
+func newDiscoveredGateway(e *mdns.ServiceEntry) DiscoveredGateway {
+	gw := DiscoveredGateway{
+		Name: instanceName(e.Name),
+		Host: e.Host,
+		Port: e.Port,
+		Addr: e.AddrV4,
+	}
+	if gw.Addr == nil {
+		gw.Addr = e.AddrV6
+	}
+
+	for _, field := range e.InfoFields {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "role":
+			gw.Role = value
+		case "version":
+			gw.Version = value
+		case "protocol":
+			gw.Protocol, _ = strconv.Atoi(value)
+		case "displayName":
+			gw.DisplayName = value
+		}
+	}
+	return gw
+}
+
+// instanceName strips the service and domain suffix from a full service
+// instance name ("name._openclaw-gw._tcp.local.") and unescapes spaces.
+func instanceName(full string) string {
+	name := full
+	if i := strings.Index(name, "."+ServiceType); i >= 0 {
+		name = name[:i]
+	}
+	return strings.ReplaceAll(name, `\ `, " ")
+}
@@ -0,0 +1,52 @@
+package discovery
+
+import (
+	"net"
+	"testing"
+
+	"github.com/hashicorp/mdns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewDiscoveredGateway(t *testing.T) {
+	entry := &mdns.ServiceEntry{
+		Name:   `Kitchen\ Mac._openclaw-gw._tcp.local.`,
+		Host:   "kitchen-mac.local.",
+		AddrV4: net.ParseIP("192.168.1.20"),
+		Port:   18789,
+		InfoFields: []string{
+			"role=gateway",
+			"transport=gateway",
+			"displayName=Kitchen",
+			"version=0.1.0",
+			"protocol=3",
+			"malformed",
+		},
+	}
+
+	gw := newDiscoveredGateway(entry)
+	assert.Equal(t, "Kitchen Mac", gw.Name)
+	assert.Equal(t, "kitchen-mac.local.", gw.Host)
+	assert.Equal(t, "192.168.1.20", gw.Addr.String())
+	assert.Equal(t, 18789, gw.Port)
+	assert.Equal(t, "gateway", gw.Role)
+	assert.Equal(t, "Kitchen", gw.DisplayName)
+	assert.Equal(t, "0.1.0", gw.Version)
+	assert.Equal(t, 3, gw.Protocol)
+}
+
+func TestCollectGateways_Dedupes(t *testing.T) {
+	entries := make(chan *mdns.ServiceEntry, 4)
+	entries <- &mdns.ServiceEntry{Name: "b._openclaw-gw._tcp.local.", Port: 1}
+	entries <- &mdns.ServiceEntry{Name: "a._openclaw-gw._tcp.local.", Port: 2}
+	entries <- &mdns.ServiceEntry{Name: "b._openclaw-gw._tcp.local.", Port: 3}
+	entries <- nil
+	close(entries)
+
+	found := collectGateways(entries)
+	require.Len(t, found, 2)
+	assert.Equal(t, "a", found[0].Name)
+	assert.Equal(t, "b", found[1].Name)
+	assert.Equal(t, 3, found[1].Port, "later answer for the same instance wins")
+}
@@ -2,14 +2,20 @@ package gateway
 
 import (
 	"crypto/subtle"
+	"net/http"
+	"strings"
 
 	"github.com/rvald/goclaw/internal/protocol"
 )
 
 // AuthConfig holds the server-side authentication settings.
 type AuthConfig struct {
-	Mode  string `json:"mode"`  // "none" or "token"
-	Token string `json:"token"` // required when Mode == "token"
+	Mode   string   `json:"mode"`   // "none" or "token"
+	Tokens []string `json:"tokens"` // any one is accepted; required when Mode == "token"
+
+	// AdminTokens authenticate like Tokens and also grant an operator the
+	// scopes it claims, such as operator.admin. Optional.
+	AdminTokens []string `json:"adminTokens,omitempty"`
 }
 
 // AuthResult is the outcome of an authentication attempt.
@@ -17,27 +23,48 @@ type AuthResult struct {
 	OK     bool   // whether authentication succeeded
 	Method string // which auth method was used (e.g. "token", "none")
 	Reason string // failure reason, empty on success
+	Admin  bool   // whether one of the AdminTokens was presented
 }
 
 // Authenticate checks the provided credentials against the server config.
 func Authenticate(cfg AuthConfig, provided *protocol.ConnectAuth) AuthResult {
+	admin := provided != nil && provided.Token != "" && matchToken(cfg.AdminTokens, provided.Token)
+
 	switch cfg.Mode {
 
 	case "none":
-		return AuthResult{OK: true, Method: "none"}
+		return AuthResult{OK: true, Method: "none", Admin: admin}
 
 	case "token":
 		if provided == nil || provided.Token == "" {
 			return AuthResult{OK: false, Method: "token", Reason: "token_missing"}
 		}
 
-		if subtle.ConstantTimeCompare([]byte(cfg.Token), []byte(provided.Token)) != 1 {
+		if !admin && !matchToken(cfg.Tokens, provided.Token) {
 			return AuthResult{OK: false, Method: "token", Reason: "token_mismatch"}
 		}
 
-		return AuthResult{OK: true, Method: "token"}
+		return AuthResult{OK: true, Method: "token", Admin: admin}
 
 	default:
 		return AuthResult{OK: false, Reason: "unknown_auth_mode"}
 	}
 }
+
+// matchToken reports whether provided is one of tokens. It compares
+// against every token so the timing doesn't reveal which one (if any)
+// matched.
+func matchToken(tokens []string, provided string) bool {
+	match := 0
+	for _, token := range tokens {
+		match |= subtle.ConstantTimeCompare([]byte(token), []byte(provided))
+	}
+	return match == 1
+}
+
+// AuthenticateHTTP checks an operator HTTP request's "Authorization: Bearer"
+// token against the server config.
+func AuthenticateHTTP(cfg AuthConfig, r *http.Request) AuthResult {
+	token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return Authenticate(cfg, &protocol.ConnectAuth{Token: strings.TrimSpace(token)})
+}
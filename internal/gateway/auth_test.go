@@ -8,7 +8,7 @@ import (
 )
 
 func TestAuth_TokenMatch(t *testing.T) {
-	cfg := AuthConfig{Mode: "token", Token: "secret-123"}
+	cfg := AuthConfig{Mode: "token", Tokens: []string{"secret-123"}}
 	provided := &ConnectAuth{Token: "secret-123"}
 	result := Authenticate(cfg, provided)
 	assert.True(t, result.OK)
@@ -17,7 +17,7 @@ func TestAuth_TokenMatch(t *testing.T) {
 }
 
 func TestAuth_TokenMismatch(t *testing.T) {
-	cfg := AuthConfig{Mode: "token", Token: "secret-123"}
+	cfg := AuthConfig{Mode: "token", Tokens: []string{"secret-123"}}
 	provided := &ConnectAuth{Token: "wrong-token"}
 	result := Authenticate(cfg, provided)
 	assert.False(t, result.OK)
@@ -25,14 +25,14 @@ func TestAuth_TokenMismatch(t *testing.T) {
 }
 
 func TestAuth_TokenMissing(t *testing.T) {
-	cfg := AuthConfig{Mode: "token", Token: "secret-123"}
+	cfg := AuthConfig{Mode: "token", Tokens: []string{"secret-123"}}
 	result := Authenticate(cfg, nil)
 	assert.False(t, result.OK)
 	assert.Equal(t, "token_missing", result.Reason)
 }
 
 func TestAuth_TokenEmptyString(t *testing.T) {
-	cfg := AuthConfig{Mode: "token", Token: "secret-123"}
+	cfg := AuthConfig{Mode: "token", Tokens: []string{"secret-123"}}
 	provided := &ConnectAuth{Token: ""}
 	result := Authenticate(cfg, provided)
 	assert.False(t, result.OK)
@@ -55,9 +55,36 @@ func TestAuth_ModeNoneIgnoresToken(t *testing.T) {
 }
 
 func TestAuth_ConstantTimeCompare(t *testing.T) {
-	cfg := AuthConfig{Mode: "token", Token: "secret-123-correct"}
+	cfg := AuthConfig{Mode: "token", Tokens: []string{"secret-123-correct"}}
 	r1 := Authenticate(cfg, &ConnectAuth{Token: "secret-123-WRONG!"})
 	r2 := Authenticate(cfg, &ConnectAuth{Token: "XXXXXXXXXXXXXXXX!"})
 	assert.False(t, r1.OK)
 	assert.False(t, r2.OK)
-}
\ No newline at end of file
+}
+
+func TestAuth_MultipleTokens(t *testing.T) {
+	cfg := AuthConfig{Mode: "token", Tokens: []string{"old-token", "new-token"}}
+	assert.True(t, Authenticate(cfg, &ConnectAuth{Token: "old-token"}).OK)
+	assert.True(t, Authenticate(cfg, &ConnectAuth{Token: "new-token"}).OK)
+
+	result := Authenticate(cfg, &ConnectAuth{Token: "other-token"})
+	assert.False(t, result.OK)
+	assert.Equal(t, "token_mismatch", result.Reason)
+}
+
+func TestAuth_AdminTokens(t *testing.T) {
+	cfg := AuthConfig{Mode: "token", Tokens: []string{"node-token"}, AdminTokens: []string{"admin-token"}}
+
+	node := Authenticate(cfg, &ConnectAuth{Token: "node-token"})
+	assert.True(t, node.OK)
+	assert.False(t, node.Admin)
+
+	admin := Authenticate(cfg, &ConnectAuth{Token: "admin-token"})
+	assert.True(t, admin.OK)
+	assert.True(t, admin.Admin)
+
+	// Without token auth, an admin token still marks the connection admin.
+	open := AuthConfig{Mode: "none", AdminTokens: []string{"admin-token"}}
+	assert.True(t, Authenticate(open, &ConnectAuth{Token: "admin-token"}).Admin)
+	assert.False(t, Authenticate(open, nil).Admin)
+}
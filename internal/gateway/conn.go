@@ -2,14 +2,19 @@ package gateway
 
 import (
 	"context"
+	"crypto/ed25519"
 	"crypto/rand"
+	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"net"
+	"sort"
 	"sync"
 	"time"
 
+	"github.com/gorilla/websocket"
 	"github.com/rvald/goclaw/internal/pairing"
 	"github.com/rvald/goclaw/internal/protocol"
 )
@@ -23,6 +28,12 @@ const (
 	StateClosed        ConnState = "closed"
 
 	MaxMessageSize = 512 * 1024 // 512KB
+
+	// closeWriteWait bounds how long sending a close frame may take.
+	closeWriteWait = time.Second
+
+	// idleCloseReason accompanies the close frame sent on idle timeout.
+	idleCloseReason = protocol.CodeIdleTimeout
 )
 
 // WebSocket is the interface for the underlying WebSocket connection.
@@ -31,7 +42,9 @@ type WebSocket interface {
 	WriteMessage(messageType int, data []byte) error
 	SetReadLimit(limit int64)
 	SetReadDeadline(t time.Time) error
+	SetWriteDeadline(t time.Time) error
 	SetPongHandler(h func(appData string) error)
+	WriteControl(messageType int, data []byte, deadline time.Time) error
 	Close() error
 }
 
@@ -53,33 +66,141 @@ type Conn struct {
 	ConnectParams *protocol.ConnectParams
 	mu            sync.Mutex
 	writeMu       sync.Mutex
+	eventMu       sync.Mutex   // held from stamping an event's seq until it is written
+	eventSeq      int          // seq of the last event sent; guarded by eventMu
+	log           *slog.Logger // carries connId, then deviceId/nodeId once known
 
 	// Device pairing fields (optional — nil when pairing is not enabled).
 	pairingSvc     *pairing.Service
 	remoteAddr     string
 	isLocal        bool
+	dryRun         bool // set by ?dryRun=1; see sendDryRun
 	challengeNonce string
 	pongWait       time.Duration
 	pingPeriod     time.Duration
+	writeWait      time.Duration
+	idleTimeout    time.Duration
+	idleTimer      *time.Timer // reset by each inbound frame once authenticated
+	serverVersion  string
+	serverKey      ed25519.PrivateKey // optional; signs the challenge and hello-ok
+	clientNonces   *nonceCache        // may be nil; see ServerConfig
+	allowTokenless bool               // see ServerConfig.AllowTokenlessDevices
+	metrics        *Metrics           // may be nil; see ServerConfig
+
+	// afterPairingCheck, when set, runs between the pairing check and the
+	// device token issue. Tests use it to simulate a concurrent revoke.
+	afterPairingCheck func()
+
+	// Protocol is the version negotiated in the connect handshake.
+	Protocol int
+
+	// wantTicks is false when the client opted out of tick events.
+	wantTicks bool
+
+	// codec encodes outgoing frames: JSON until the connect request asks
+	// for another encoding. Guarded by mu.
+	codec protocol.Codec
 
 	// Set after successful device verification.
 	DeviceID    string
 	DeviceToken string
+
+	// AuthMethod is how the connect request authenticated ("none" or
+	// "token").
+	AuthMethod string
+
+	// Scopes are the scopes the server granted, never simply those the
+	// connect request claimed: all claimed ones for an admin token, else
+	// those the paired device was approved for. Nil for token-only
+	// clients.
+	Scopes []string
+
+	ConnectedAt time.Time
+
+	// ctx is cancelled by shutdown; see Context.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// metricsRole is the role label the conn was counted under in
+	// Metrics.ConnectionsTotal; empty until then. Set by the gateway.
+	metricsRole string
+}
+
+// ConnInfo is an operator-facing snapshot of a connection.
+type ConnInfo struct {
+	ConnID        string    `json:"connId"`
+	DeviceID      string    `json:"deviceId,omitempty"`
+	NodeID        string    `json:"nodeId,omitempty"`
+	Role          string    `json:"role,omitempty"`
+	RemoteIP      string    `json:"remoteIp,omitempty"`
+	State         ConnState `json:"state"`
+	ConnectedAtMs int64     `json:"connectedAtMs"`
 }
 
 // NewConn creates a new connection in the connecting state.
 func NewConn(ws WebSocket, config ServerConfig, handler ConnHandler) *Conn {
+	id := generateID()
+	ctx, cancel := context.WithCancel(context.Background())
 	return &Conn{
-		ws:         ws,
-		auth:       config.Auth,
-		handler:    handler,
-		State:      StateConnecting,
-		ConnID:     generateID(),
-		pongWait:   config.PongWait,
-		pingPeriod: config.PingPeriod,
+		ws:             ws,
+		auth:           config.Auth,
+		handler:        handler,
+		State:          StateConnecting,
+		ConnID:         id,
+		log:            slog.With("connId", id),
+		pongWait:       config.PongWait,
+		pingPeriod:     config.PingPeriod,
+		writeWait:      config.WriteWait,
+		idleTimeout:    config.IdleTimeout,
+		serverVersion:  config.Build.Version,
+		serverKey:      config.ServerKey,
+		allowTokenless: config.AllowTokenlessDevices,
+		metrics:        config.metrics,
+		clientNonces:   config.clientNonces,
+		wantTicks:      true,
+		codec:          protocol.JSON,
+		ConnectedAt:    time.Now(),
+		ctx:            ctx,
+		cancel:         cancel,
 	}
 }
 
+// Context returns a context cancelled once the connection has closed, for
+// work done on the connection's behalf.
+func (c *Conn) Context() context.Context {
+	return c.ctx
+}
+
+// Info returns a snapshot of the connection. Handshake fields are only
+// reported once authenticated, when they are no longer being written.
+func (c *Conn) Info() ConnInfo {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	info := ConnInfo{
+		ConnID:        c.ConnID,
+		RemoteIP:      remoteIP(c.remoteAddr),
+		State:         c.State,
+		ConnectedAtMs: c.ConnectedAt.UnixMilli(),
+	}
+	if c.State == StateAuthenticated && c.ConnectParams != nil {
+		info.DeviceID = c.DeviceID
+		info.Role = c.ConnectParams.Role
+		if info.Role == "" {
+			info.Role = "node"
+		}
+		if info.Role == "node" {
+			info.NodeID = c.ConnectParams.Client.ID
+		}
+	}
+	return info
+}
+
+// Logger returns the connection's contextual logger.
+func (c *Conn) Logger() *slog.Logger {
+	return c.log
+}
+
 // WithPairing attaches a pairing service and connection metadata to the conn.
 func (c *Conn) WithPairing(svc *pairing.Service, remoteAddr string, isLocal bool) {
 	c.pairingSvc = svc
@@ -87,20 +208,98 @@ func (c *Conn) WithPairing(svc *pairing.Service, remoteAddr string, isLocal bool
 	c.isLocal = isLocal
 }
 
-// SendEvent sends an event frame to this connection (thread-safe).
+// SendEvent sends an event frame to this connection (thread-safe). Each
+// event carries the next seq, starting at 1 with the challenge, so clients
+// can detect gaps.
 func (c *Conn) SendEvent(event string, payload any) error {
-	data, err := protocol.MarshalEvent(event, payload)
+	frame, err := protocol.NewEventFrame(event, payload)
+	if err != nil {
+		return err
+	}
+
+	// Stamp and write under one lock so events reach the wire in seq order.
+	c.eventMu.Lock()
+	defer c.eventMu.Unlock()
+	seq := c.eventSeq + 1
+	frame.Seq = &seq
+	if err := c.writeFrame(frame); err != nil {
+		return err
+	}
+	c.eventSeq = seq
+	return nil
+}
+
+// SendResponse sends a response frame to this connection (thread-safe).
+func (c *Conn) SendResponse(id string, ok bool, payload any, errShape *protocol.ErrorShape) error {
+	frame, err := protocol.NewResponseFrame(id, ok, payload, errShape)
+	if err != nil {
+		return err
+	}
+	return c.writeFrame(frame)
+}
+
+// writeFrame encodes frame with the connection's codec and sends it.
+func (c *Conn) writeFrame(frame any) error {
+	c.mu.Lock()
+	codec := c.codec
+	c.mu.Unlock()
+
+	data, err := codec.Encode(frame)
 	if err != nil {
 		return err
 	}
-	return c.writeMessage(1, data)
+	return c.writeMessage(messageTypeFor(codec), data)
+}
+
+// codecFor returns the codec for an incoming message: binary messages
+// carry msgpack, text messages JSON.
+func codecFor(messageType int) protocol.Codec {
+	if messageType == websocket.BinaryMessage {
+		return protocol.Msgpack
+	}
+	return protocol.JSON
 }
 
-// writeMessage sends data with write serialization.
+// messageTypeFor is the WebSocket message type frames encoded by codec
+// are sent as.
+func messageTypeFor(codec protocol.Codec) int {
+	if codec.Binary() {
+		return websocket.BinaryMessage
+	}
+	return websocket.TextMessage
+}
+
+// writeMessage sends data with write serialization. Each write is bounded
+// by writeWait; a failed write closes the socket, which ends Run.
 func (c *Conn) writeMessage(messageType int, data []byte) error {
+	if messageType == websocket.TextMessage || messageType == websocket.BinaryMessage {
+		c.logFrame("out", codecFor(messageType), data)
+	}
 	c.writeMu.Lock()
 	defer c.writeMu.Unlock()
-	return c.ws.WriteMessage(messageType, data)
+
+	if c.writeWait > 0 {
+		c.ws.SetWriteDeadline(time.Now().Add(c.writeWait))
+	}
+	err := c.ws.WriteMessage(messageType, data)
+	if err != nil {
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			c.log.Warn("write timed out, closing connection", "writeWait", c.writeWait)
+			c.metrics.incError("write_timeout")
+		}
+		c.ws.Close()
+	}
+	return err
+}
+
+// Close sends a WebSocket close frame with code and reason, then closes
+// the socket. It does not wait on writeMu, so a stuck writer cannot delay it.
+func (c *Conn) Close(code int, reason string) {
+	msg := websocket.FormatCloseMessage(code, reason)
+	if err := c.ws.WriteControl(websocket.CloseMessage, msg, time.Now().Add(closeWriteWait)); err != nil {
+		c.log.Debug("close frame not sent", "error", err)
+	}
+	c.ws.Close()
 }
 
 // Run drives the connection lifecycle: challenge → connect → read loop.
@@ -134,39 +333,57 @@ func (c *Conn) Run(ctx context.Context) {
 	}
 
 	// 2. Wait for connect request
-	_, data, err := c.ws.ReadMessage()
+	messageType, data, err := c.ws.ReadMessage()
 	if err != nil {
 		return
 	}
-	if err := c.processConnect(data); err != nil {
+	c.logFrame("in", codecFor(messageType), data)
+	if err := c.processConnect(codecFor(messageType), data); err != nil {
 		return
 	}
 
+	// Pongs keep the read deadline alive but not this timer, so a session
+	// that answers pings yet never sends a frame is still reclaimed.
+	if c.idleTimeout > 0 {
+		c.idleTimer = time.AfterFunc(c.idleTimeout, c.closeIdle)
+		defer c.idleTimer.Stop()
+	}
+
 	// 3. Authenticated read loop
 	for {
-		_, data, err := c.ws.ReadMessage()
+		messageType, data, err := c.ws.ReadMessage()
 		if err != nil {
 			return
 		}
-		c.processRequest(data)
+		c.logFrame("in", codecFor(messageType), data)
+		c.processRequest(codecFor(messageType), data)
 	}
 }
 
 func (c *Conn) sendChallenge() error {
 	c.challengeNonce = generateID()
-	payload := map[string]any{
-		"nonce": c.challengeNonce,
-		"ts":    time.Now().Unix(),
-	}
-	data, err := protocol.MarshalEvent("connect.challenge", payload)
-	if err != nil {
-		return err
-	}
-	return c.writeMessage(1, data)
+	// Protocols lets a client work out the negotiated version, and so the
+	// signing payload prefix, before it signs the connect request.
+	payload := protocol.ConnectChallenge{
+		Nonce:         c.challengeNonce,
+		Ts:            time.Now().Unix(),
+		Protocols:     protocol.SupportedProtocols,
+		ServerVersion: c.serverVersion,
+		Protocol:      protocol.ServerProtocol,
+	}
+	if c.serverKey != nil {
+		payload.ServerKey = base64.RawURLEncoding.EncodeToString(c.serverKey.Public().(ed25519.PublicKey))
+		sig := ed25519.Sign(c.serverKey, []byte(pairing.BuildChallengePayload(payload.Nonce, payload.Ts)))
+		payload.Signature = base64.RawURLEncoding.EncodeToString(sig)
+	}
+	return c.SendEvent("connect.challenge", payload)
 }
 
-func (c *Conn) processConnect(data []byte) error {
-	frame, err := protocol.ParseFrame(data)
+// processConnect handles the connect request, decoded with codec. Later
+// frames from the client may use either encoding; frames to it use the
+// one named in params.Encoding.
+func (c *Conn) processConnect(codec protocol.Codec, data []byte) error {
+	frame, err := codec.Decode(data)
 	if err != nil {
 		return err
 	}
@@ -177,31 +394,67 @@ func (c *Conn) processConnect(data []byte) error {
 	}
 
 	if req.Method != "connect" {
-		c.sendError(req.ID, "INVALID_METHOD", "first request must be connect")
+		c.sendError(req.ID, protocol.CodeInvalidMethod, "first request must be connect")
 		return fmt.Errorf("first request must be connect")
 	}
 
 	var params protocol.ConnectParams
 	if req.Params != nil {
 		if err := json.Unmarshal(req.Params, &params); err != nil {
-			c.sendError(req.ID, "INVALID_JSON", fmt.Sprintf("invalid connect params: %v", err))
+			c.sendError(req.ID, protocol.CodeInvalidJSON, fmt.Sprintf("invalid connect params: %v", err))
 			return err
 		}
 	}
 
-	// Validate protocol version
-	if err := protocol.ValidateConnect(params); err != nil {
+	if c.dryRun || params.DryRun {
+		// Diagnostics are for clients that could connect: refuse them
+		// the same way a real connect would before reporting anything.
+		if result := Authenticate(c.auth, params.Auth); !result.OK {
+			c.log.Warn("dry-run connect auth failed", "reason", result.Reason)
+			c.sendError(req.ID, protocol.CodeUnauthorized, result.Reason)
+			return fmt.Errorf("auth failed: %s", result.Reason)
+		}
+		c.sendDryRun(req.ID, params)
+		return errDryRun
+	}
+
+	// Negotiate protocol version
+	proto, err := protocol.NegotiateProtocol(params)
+	if err != nil {
 		fe := err.(*protocol.FrameError)
 		c.sendError(req.ID, fe.Code, fe.Message)
 		return err
 	}
+	c.Protocol = proto
+
+	// Replies from here on, including connect errors, use the requested encoding.
+	outCodec, err := protocol.CodecByName(params.Encoding)
+	if err != nil {
+		fe := err.(*protocol.FrameError)
+		c.sendError(req.ID, fe.Code, fe.Message)
+		return err
+	}
+	c.mu.Lock()
+	c.codec = outCodec
+	c.mu.Unlock()
 
 	// Authenticate (legacy token auth)
 	result := Authenticate(c.auth, params.Auth)
 	if !result.OK {
-		c.sendError(req.ID, "UNAUTHORIZED", result.Reason)
+		c.log.Warn("connect auth failed", "reason", result.Reason)
+		c.sendError(req.ID, protocol.CodeUnauthorized, result.Reason)
 		return fmt.Errorf("auth failed: %s", result.Reason)
 	}
+	c.AuthMethod = result.Method
+	if result.Admin {
+		c.Scopes = params.Scopes
+	}
+
+	// A reused client nonce means a replayed connect request.
+	if params.ClientNonce != "" && !c.clientNonces.use(params.ClientNonce) {
+		c.sendError(req.ID, protocol.CodeInvalidNonce, "client nonce already used")
+		return fmt.Errorf("client nonce reused")
+	}
 
 	// Device identity verification (when pairing is enabled + client sends device payload)
 	var deviceToken string
@@ -215,6 +468,7 @@ func (c *Conn) processConnect(data []byte) error {
 
 	// Store connect params
 	c.ConnectParams = &params
+	c.wantTicks = params.WantTicks == nil || *params.WantTicks
 	if deviceToken != "" {
 		c.DeviceToken = deviceToken
 	}
@@ -222,15 +476,12 @@ func (c *Conn) processConnect(data []byte) error {
 	// Send success response with a full hello-ok payload.
 	responsePayload := map[string]any{
 		"type":     "hello-ok",
-		"protocol": protocol.ServerProtocol,
+		"protocol": proto,
 		"server": map[string]any{
 			"version": "goclaw",
 			"connId":  c.ConnID,
 		},
-		"features": map[string]any{
-			"methods": []string{},
-			"events":  []string{},
-		},
+		"features": protocol.ServerFeatures(),
 		"snapshot": map[string]any{
 			"presence":    []any{},
 			"health":      map[string]any{},
@@ -246,12 +497,23 @@ func (c *Conn) processConnect(data []byte) error {
 	if deviceToken != "" {
 		responsePayload["auth"] = protocol.HelloAuthInfo{DeviceToken: deviceToken}
 	}
-
-	resData, err := protocol.MarshalResponse(req.ID, true, responsePayload, nil)
-	if err != nil {
-		return err
+	if c.serverKey != nil && params.ClientNonce != "" {
+		role := params.Role
+		if role == "" {
+			role = "node"
+		}
+		hello := pairing.BuildHelloPayload(pairing.HelloPayloadParams{
+			ClientNonce: params.ClientNonce,
+			Nonce:       c.challengeNonce,
+			ConnID:      c.ConnID,
+			Role:        role,
+			Scopes:      c.Scopes,
+		})
+		sig := ed25519.Sign(c.serverKey, []byte(hello))
+		responsePayload["signature"] = base64.RawURLEncoding.EncodeToString(sig)
 	}
-	if err := c.writeMessage(1, resData); err != nil {
+
+	if err := c.SendResponse(req.ID, true, responsePayload, nil); err != nil {
 		return err
 	}
 
@@ -259,7 +521,10 @@ func (c *Conn) processConnect(data []byte) error {
 	c.State = StateAuthenticated
 	c.mu.Unlock()
 
-	c.handler.OnAuthenticated(c)
+	if err := c.handler.OnAuthenticated(c); err != nil {
+		c.log.Warn("post-auth handler failed", "error", err)
+	}
+	c.log.Info("connection authenticated", "role", params.Role, "clientId", params.Client.ID, "platform", params.Client.Platform)
 	return nil
 }
 
@@ -269,30 +534,16 @@ func (c *Conn) verifyDevice(reqID string, params protocol.ConnectParams) (string
 	dev := params.Device
 
 	// 1. Build the signing payload with full context
-	role := params.Role
-	if role == "" {
-		role = "node"
-	}
-
-	authToken := ""
-	if c.auth.Mode == "token" {
-		authToken = c.auth.Token
-	}
-
-	payload := pairing.BuildAuthPayload(pairing.AuthPayloadParams{
-		DeviceID:   dev.ID,
-		ClientID:   params.Client.ID,
-		ClientMode: params.Client.Mode,
-		Role:       role,
-		Scopes:     params.Scopes,
-		SignedAtMs: dev.SignedAt,
-		Token:      authToken,
-		Nonce:      dev.Nonce,
-	})
+	role, authToken, payload := c.deviceAuthPayload(params, c.Protocol)
 
 	// 2. Verify the signature
-	if !pairing.VerifySignature(dev.PublicKey, payload, dev.Signature) {
-		slog.Warn(
+	valid, err := pairing.VerifySignatureAlg(dev.Algorithm, dev.PublicKey, payload, dev.Signature)
+	if err != nil {
+		c.sendError(reqID, protocol.CodeUnsupportedAlg, err.Error())
+		return "", err
+	}
+	if !valid {
+		c.log.Warn(
 			"device signature verification failed",
 			"deviceId", dev.ID,
 			"clientId", params.Client.ID,
@@ -303,63 +554,132 @@ func (c *Conn) verifyDevice(reqID string, params protocol.ConnectParams) (string
 			"noncePresent", dev.Nonce != "",
 			"tokenPresent", authToken != "",
 		)
-		c.sendError(reqID, "INVALID_SIGNATURE", "device signature verification failed")
+		c.sendError(reqID, protocol.CodeInvalidSignature, "device signature verification failed")
 		return "", fmt.Errorf("device signature verification failed")
 	}
 
 	// 3. Verify nonce matches the challenge we sent
 	if dev.Nonce != c.challengeNonce {
-		c.sendError(reqID, "INVALID_NONCE", "nonce does not match challenge")
+		c.sendError(reqID, protocol.CodeInvalidNonce, "nonce does not match challenge")
 		return "", fmt.Errorf("nonce mismatch")
 	}
 
-	// 4. Derive device ID and verify it matches
-	derivedID := pairing.DeriveDeviceID(dev.PublicKey)
-	if derivedID != dev.ID {
-		c.sendError(reqID, "INVALID_DEVICE_ID", "device ID does not match public key")
+	// 4. Verify the device ID matches the key. A device that rotated its
+	// key keeps the ID of its paired record.
+	if err := c.pairingSvc.VerifyDeviceID(dev.ID, dev.PublicKey); err != nil {
+		c.sendError(reqID, protocol.CodeInvalidDeviceID, "device ID does not match public key")
 		return "", fmt.Errorf("device ID mismatch")
 	}
-	c.DeviceID = derivedID
+	deviceID := dev.ID
+	c.DeviceID = deviceID
+	c.log = c.log.With("deviceId", deviceID)
 
 	// 5. Check pairing status
 	action := c.pairingSvc.CheckPairingStatus(pairing.CheckPairingParams{
-		DeviceID:  derivedID,
-		PublicKey: dev.PublicKey,
-		Role:      role,
-		Scopes:    params.Scopes,
-		IsLocal:   c.isLocal,
+		DeviceID:    deviceID,
+		PublicKey:   dev.PublicKey,
+		DisplayName: params.Client.DisplayName,
+		Platform:    params.Client.Platform,
+		ClientID:    params.Client.ID,
+		ClientMode:  params.Client.Mode,
+		Role:        role,
+		Scopes:      params.Scopes,
+		RemoteIP:    remoteIP(c.remoteAddr),
+		IsLocal:     c.isLocal,
 	})
 
 	switch action.Status {
 	case "paired", "auto-approved":
+		if action.Device != nil && c.Scopes == nil {
+			c.Scopes = action.Device.GrantedScopes(role, params.Scopes)
+		}
+		if c.afterPairingCheck != nil {
+			c.afterPairingCheck()
+		}
 		// Ensure device has a valid token
-		tok := c.pairingSvc.EnsureDeviceToken(derivedID, role, params.Scopes)
+		tok := c.pairingSvc.EnsureDeviceToken(deviceID, role, params.Scopes)
 		if tok != nil {
 			return tok.Token, nil
 		}
-		// Fallback: paired but token generation failed — still allow connection
-		return "", nil
+		// Either the device left the store after the pairing check, e.g.
+		// a concurrent revoke, or its new token could not be saved. Only
+		// the latter may be admitted, and only when policy allows it.
+		if c.allowTokenless && c.pairingSvc.IsPaired(deviceID) {
+			c.log.Warn("admitting paired device without a device token", "status", action.Status)
+			return "", nil
+		}
+		c.sendError(reqID, protocol.CodeTokenIssueFailed, "device token could not be issued; retry the connection")
+		return "", fmt.Errorf("device token issue failed after pairing status %s", action.Status)
 
-	case "pairing-required":
+	case "pairing-required", "rate-limited":
+		// reason tells the client which pairing UX to show: a new device,
+		// a re-pair after a key change, or try again later. Rate limiting
+		// keeps its own error code.
 		errPayload := map[string]any{
 			"requestId": action.RequestID,
+			"reason":    action.Cause,
+			"isRepair":  action.IsRepair,
 		}
 		errJSON, _ := json.Marshal(errPayload)
-		c.sendError(reqID, "NOT_PAIRED", string(errJSON))
-		return "", fmt.Errorf("device not paired, requestId=%s", action.RequestID)
+		if action.Status == "rate-limited" {
+			c.sendError(reqID, protocol.CodePairingRateLimited, string(errJSON))
+			return "", fmt.Errorf("pairing rate limited: %s", action.Reason)
+		}
+		c.sendError(reqID, protocol.CodeNotPaired, string(errJSON))
+		return "", fmt.Errorf("device not paired (%s), requestId=%s", action.Cause, action.RequestID)
+
+	case "error":
+		c.log.Warn("pairing failed", "reason", action.Reason)
+		c.sendError(reqID, protocol.CodePairingError, "pairing failed; retry the connection")
+		return "", fmt.Errorf("pairing failed: %s", action.Reason)
 
 	default:
-		c.sendError(reqID, "PAIRING_ERROR", "unexpected pairing status")
+		c.sendError(reqID, protocol.CodePairingError, "unexpected pairing status")
 		return "", fmt.Errorf("unexpected pairing status: %s", action.Status)
 	}
 }
 
-func (c *Conn) processRequest(data []byte) {
-	frame, err := protocol.ParseFrame(data)
+// deviceAuthPayload returns the effective role, the shared token bound into
+// the signature (empty unless token auth is on) and the payload the device
+// must have signed under protocol version proto.
+func (c *Conn) deviceAuthPayload(params protocol.ConnectParams, proto int) (role, authToken, payload string) {
+	role = params.Role
+	if role == "" {
+		role = "node"
+	}
+	if c.auth.Mode == "token" && params.Auth != nil {
+		// Several tokens may be valid during rotation; bind the one the
+		// client presented.
+		authToken = params.Auth.Token
+	}
+	payload = pairing.BuildAuthPayload(pairing.AuthPayloadParams{
+		DeviceID:   params.Device.ID,
+		ClientID:   params.Client.ID,
+		ClientMode: params.Client.Mode,
+		Role:       role,
+		Scopes:     params.Scopes,
+		SignedAtMs: params.Device.SignedAt,
+		Token:      authToken,
+		Nonce:      params.Device.Nonce,
+		Protocol:   proto,
+		Algorithm:  params.Device.Algorithm,
+	})
+	return role, authToken, payload
+}
+
+func (c *Conn) processRequest(codec protocol.Codec, data []byte) {
+	if c.idleTimer != nil {
+		c.idleTimer.Reset(c.idleTimeout)
+	}
+
+	frame, err := codec.Decode(data)
 	if err != nil {
+		c.rejectFrame(err)
 		return
 	}
 
+	// Only requests get a reply; client events are fire-and-forget
+	// notifications, so unknown ones are dropped without an error.
 	req, ok := frame.(*protocol.RequestFrame)
 	if !ok {
 		return
@@ -368,12 +688,31 @@ func (c *Conn) processRequest(data []byte) {
 	c.handler.OnRequest(c, req)
 }
 
+// rejectFrame answers an undecodable frame with an error response when its
+// request ID could be recovered, and otherwise just logs it.
+func (c *Conn) rejectFrame(err error) {
+	c.metrics.incError("protocol")
+	fe, ok := err.(*protocol.FrameError)
+	if !ok || fe.ID == "" {
+		c.log.Debug("dropped undecodable frame", "error", err)
+		return
+	}
+	code := protocol.CodeInvalidFrame
+	if fe.Code == protocol.CodeInvalidJSON {
+		code = fe.Code
+	}
+	c.sendError(fe.ID, code, fe.Error())
+}
+
 func (c *Conn) sendError(id, code, message string) {
-	data, _ := protocol.MarshalResponse(id, false, nil, &protocol.ErrorShape{
-		Code:    code,
-		Message: message,
-	})
-	c.writeMessage(1, data)
+	c.SendResponse(id, false, nil, protocol.NewError(code, message))
+}
+
+// closeIdle closes a connection that sent no frame within idleTimeout.
+func (c *Conn) closeIdle() {
+	c.log.Info("closing idle connection", "idleTimeout", c.idleTimeout)
+	c.metrics.incError("idle_timeout")
+	c.Close(websocket.ClosePolicyViolation, idleCloseReason)
 }
 
 func (c *Conn) shutdown() {
@@ -383,9 +722,11 @@ func (c *Conn) shutdown() {
 	c.mu.Unlock()
 
 	c.ws.Close()
+	c.cancel()
 
 	if wasAuthenticated {
 		c.handler.OnDisconnected(c)
+		c.log.Info("connection closed")
 	}
 }
 
@@ -404,6 +745,74 @@ func (c *Conn) pingLoop(ctx context.Context) {
 	}
 }
 
+// logFrame records a one-line summary of a frame at debug level. Bodies
+// are reduced to their top-level keys so secrets never reach the log; the
+// check up front keeps this free when debug logging is off.
+func (c *Conn) logFrame(dir string, codec protocol.Codec, data []byte) {
+	ctx := context.Background()
+	if !c.log.Enabled(ctx, slog.LevelDebug) {
+		return
+	}
+
+	attrs := []slog.Attr{
+		slog.String("dir", dir),
+		slog.Int("bytes", len(data)),
+	}
+	frame, err := codec.Decode(data)
+	if err != nil {
+		attrs = append(attrs, slog.String("parseError", err.Error()))
+	}
+	switch f := frame.(type) {
+	case *protocol.RequestFrame:
+		attrs = append(attrs,
+			slog.String("type", string(f.Type)),
+			slog.String("id", f.ID),
+			slog.String("method", f.Method),
+			slog.Any("paramKeys", jsonKeys(f.Params)),
+		)
+	case *protocol.ResponseFrame:
+		attrs = append(attrs,
+			slog.String("type", string(f.Type)),
+			slog.String("id", f.ID),
+			slog.Bool("ok", f.OK),
+			slog.Any("payloadKeys", jsonKeys(f.Payload)),
+		)
+		if f.Error != nil {
+			attrs = append(attrs, slog.String("errorCode", f.Error.Code))
+		}
+	case *protocol.EventFrame:
+		attrs = append(attrs,
+			slog.String("type", string(f.Type)),
+			slog.String("event", f.Event),
+			slog.Any("payloadKeys", jsonKeys(f.Payload)),
+		)
+	}
+	c.log.LogAttrs(ctx, slog.LevelDebug, "frame", attrs...)
+}
+
+// jsonKeys returns the sorted top-level keys of a JSON object, or nil.
+func jsonKeys(raw json.RawMessage) []string {
+	var obj map[string]json.RawMessage
+	if len(raw) == 0 || json.Unmarshal(raw, &obj) != nil {
+		return nil
+	}
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// remoteIP strips the port from a "host:port" remote address.
+func remoteIP(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
 func generateID() string {
 	b := make([]byte, 16)
 	rand.Read(b)
@@ -6,11 +6,17 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/gorilla/websocket"
 	. "github.com/rvald/goclaw/internal/protocol"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
@@ -23,6 +29,7 @@ var base64Url = base64.RawURLEncoding
 type MockWebSocket struct {
 	Incoming chan []byte // test writes here → conn reads
 	Outgoing chan []byte // conn writes here → test reads
+	Controls [][]byte    // control frame payloads written by conn
 	closed   bool
 	mu       sync.Mutex
 }
@@ -60,9 +67,23 @@ func (m *MockWebSocket) SetReadDeadline(t time.Time) error {
 	return nil
 }
 
+func (m *MockWebSocket) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
 func (m *MockWebSocket) SetPongHandler(h func(appData string) error) {
 }
 
+func (m *MockWebSocket) WriteControl(messageType int, data []byte, deadline time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return fmt.Errorf("connection closed")
+	}
+	m.Controls = append(m.Controls, data)
+	return nil
+}
+
 func (m *MockWebSocket) Close() error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -116,10 +137,40 @@ func TestConn_SendsChallenge(t *testing.T) {
 	assert.NotNil(t, evt.Payload) // should contain nonce + ts
 }
 
+func TestConn_EventsCarryIncreasingSeq(t *testing.T) {
+	ws := NewMockWebSocket()
+	handler := &MockConnHandler{}
+	conn := NewConn(ws, ServerConfig{Auth: AuthConfig{Mode: "none"}}, handler)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go conn.Run(ctx)
+
+	challenge := readFrame(t, ws).(*EventFrame)
+	require.NotNil(t, challenge.Seq)
+	assert.Equal(t, 1, *challenge.Seq)
+
+	connectReq, _ := MarshalRequest("req-1", "connect", ConnectParams{
+		MinProtocol: 3, MaxProtocol: 3,
+		Client: ClientInfo{ID: "iphone-1", Version: "1.0", Platform: "ios", Mode: "node"},
+	})
+	ws.Incoming <- connectReq
+	res := readFrame(t, ws).(*ResponseFrame) // hello-ok: responses carry no seq
+	require.True(t, res.OK)
+
+	require.NoError(t, conn.SendEvent("tick", map[string]any{"ts": 1}))
+	require.NoError(t, conn.SendEvent("tick", map[string]any{"ts": 2}))
+	first := readFrame(t, ws).(*EventFrame)
+	second := readFrame(t, ws).(*EventFrame)
+	require.NotNil(t, first.Seq)
+	require.NotNil(t, second.Seq)
+	assert.Equal(t, 2, *first.Seq)
+	assert.Equal(t, 3, *second.Seq)
+}
+
 func TestConn_HandshakeHappy(t *testing.T) {
 	ws := NewMockWebSocket()
 	handler := &MockConnHandler{}
-	auth := AuthConfig{Mode: "token", Token: "secret"}
+	auth := AuthConfig{Mode: "token", Tokens: []string{"secret"}}
 	conn := NewConn(ws, ServerConfig{Auth: auth}, handler)
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -144,7 +195,11 @@ func TestConn_HandshakeHappy(t *testing.T) {
 	var payload map[string]any
 	require.NoError(t, json.Unmarshal(res.Payload, &payload))
 	assert.Equal(t, "hello-ok", payload["type"])
-	assert.Equal(t, float64(ServerProtocol), payload["protocol"])
+	assert.Equal(t, float64(3), payload["protocol"], "negotiated from client range [3, 3]")
+	features, ok := payload["features"].(map[string]any)
+	require.True(t, ok)
+	assert.Contains(t, features["methods"], "node.invoke.result")
+	assert.Contains(t, features["events"], "tick")
 	snapshot, ok := payload["snapshot"].(map[string]any)
 	require.True(t, ok)
 	_, hasPresence := snapshot["presence"]
@@ -163,7 +218,7 @@ func TestConn_HandshakeHappy(t *testing.T) {
 func TestConn_AuthFail(t *testing.T) {
 	ws := NewMockWebSocket()
 	handler := &MockConnHandler{}
-	auth := AuthConfig{Mode: "token", Token: "secret"}
+	auth := AuthConfig{Mode: "token", Tokens: []string{"secret"}}
 	conn := NewConn(ws, ServerConfig{Auth: auth}, handler)
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -263,6 +318,52 @@ func TestConn_RequestRoutingAfterAuth(t *testing.T) {
 	handler.mu.Unlock()
 }
 
+func TestConn_MalformedFrameAfterAuth(t *testing.T) {
+	ws := NewMockWebSocket()
+	handler := &MockConnHandler{}
+	metrics := NewMetrics()
+	conn := NewConn(ws, ServerConfig{Auth: AuthConfig{Mode: "none"}, metrics: metrics}, handler)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go conn.Run(ctx)
+	_ = readFrame(t, ws) // challenge
+	connectReq, _ := MarshalRequest("req-1", "connect", ConnectParams{
+		MinProtocol: 3, MaxProtocol: 3,
+		Client: ClientInfo{ID: "iphone-1", Version: "1.0", Platform: "ios", Mode: "node"},
+	})
+	ws.Incoming <- connectReq
+	_ = readFrame(t, ws) // hello-ok
+
+	// Frames with a recoverable ID get an error response.
+	for _, tt := range []struct{ data, id, code string }{
+		{`{"type":"req","id":"req-2"}`, "req-2", "INVALID_FRAME"},
+		{`{"type":"req","id":"req-3","method":42}`, "req-3", "INVALID_JSON"},
+	} {
+		ws.Incoming <- []byte(tt.data)
+		res, ok := readFrame(t, ws).(*ResponseFrame)
+		require.True(t, ok)
+		assert.Equal(t, tt.id, res.ID)
+		assert.False(t, res.OK)
+		require.NotNil(t, res.Error)
+		assert.Equal(t, tt.code, res.Error.Code)
+	}
+
+	// Without one there is nothing to answer; the frame is only counted.
+	before := testutil.ToFloat64(metrics.ErrorsTotal.WithLabelValues("protocol"))
+	ws.Incoming <- []byte(`{broken json`)
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(metrics.ErrorsTotal.WithLabelValues("protocol")) == before+1
+	}, time.Second, 10*time.Millisecond)
+	select {
+	case data := <-ws.Outgoing:
+		t.Fatalf("unexpected frame: %s", data)
+	case <-time.After(50 * time.Millisecond):
+	}
+	handler.mu.Lock()
+	assert.Empty(t, handler.Requests)
+	handler.mu.Unlock()
+}
+
 func TestConn_GracefulClose(t *testing.T) {
 	ws := NewMockWebSocket()
 	handler := &MockConnHandler{}
@@ -302,6 +403,113 @@ func TestConn_ContextCancel(t *testing.T) {
 	assert.Equal(t, StateClosed, conn.State)
 }
 
+// stallingWebSocket stops draining writes once stalled, like a client that
+// stopped reading: writes block until the write deadline passes.
+type stallingWebSocket struct {
+	*MockWebSocket
+	stalled  atomic.Bool
+	deadline atomic.Int64 // unix nanos
+}
+
+func (s *stallingWebSocket) SetWriteDeadline(t time.Time) error {
+	s.deadline.Store(t.UnixNano())
+	return nil
+}
+
+func (s *stallingWebSocket) WriteMessage(messageType int, data []byte) error {
+	if !s.stalled.Load() {
+		return s.MockWebSocket.WriteMessage(messageType, data)
+	}
+	if d := s.deadline.Load(); d == 0 {
+		select {} // no deadline: blocks forever, the bug this guards against
+	} else {
+		time.Sleep(time.Until(time.Unix(0, d)))
+	}
+	return os.ErrDeadlineExceeded
+}
+
+func TestConn_WriteTimeoutTearsDown(t *testing.T) {
+	ws := &stallingWebSocket{MockWebSocket: NewMockWebSocket()}
+	handler := &MockConnHandler{}
+	conn := NewConn(ws, ServerConfig{Auth: AuthConfig{Mode: "none"}, WriteWait: 50 * time.Millisecond}, handler)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		conn.Run(ctx)
+		close(done)
+	}()
+
+	_ = readFrame(t, ws.MockWebSocket)
+	connectReq, _ := MarshalRequest("req-1", "connect", ConnectParams{
+		MinProtocol: 3, MaxProtocol: 3,
+		Client: ClientInfo{ID: "iphone-1", Version: "1.0", Platform: "ios", Mode: "node"},
+	})
+	ws.Incoming <- connectReq
+	_ = readFrame(t, ws.MockWebSocket)
+
+	ws.stalled.Store(true)
+	err := conn.SendEvent("tick", nil)
+	require.Error(t, err)
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("conn did not shut down after write timeout")
+	}
+	handler.mu.Lock()
+	assert.Len(t, handler.DisconnectedCalls, 1)
+	handler.mu.Unlock()
+	assert.Equal(t, StateClosed, conn.State)
+}
+
+func TestConn_IdleTimeoutCloses(t *testing.T) {
+	ws := NewMockWebSocket()
+	handler := &MockConnHandler{}
+	conn := NewConn(ws, ServerConfig{Auth: AuthConfig{Mode: "none"}, IdleTimeout: 100 * time.Millisecond}, handler)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		conn.Run(ctx)
+		close(done)
+	}()
+
+	_ = readFrame(t, ws)
+	connectReq, _ := MarshalRequest("req-1", "connect", ConnectParams{
+		MinProtocol: 3, MaxProtocol: 3,
+		Client: ClientInfo{ID: "iphone-1", Version: "1.0", Platform: "ios", Mode: "node"},
+	})
+	ws.Incoming <- connectReq
+	_ = readFrame(t, ws)
+
+	// Regular frames keep the connection open past the timeout.
+	for i := range 5 {
+		time.Sleep(40 * time.Millisecond)
+		req, _ := MarshalRequest(fmt.Sprintf("req-%d", i+2), "node.invoke.result", map[string]any{"id": "inv-1", "ok": true})
+		ws.Incoming <- req
+	}
+	select {
+	case <-done:
+		t.Fatal("active connection was closed as idle")
+	default:
+	}
+
+	// Silence closes it.
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("idle connection was not closed")
+	}
+	ws.mu.Lock()
+	require.Len(t, ws.Controls, 1)
+	assert.Equal(t, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "IDLE_TIMEOUT"), ws.Controls[0])
+	ws.mu.Unlock()
+	handler.mu.Lock()
+	assert.Len(t, handler.DisconnectedCalls, 1)
+	handler.mu.Unlock()
+}
+
 func readFrame(t *testing.T, ws *MockWebSocket) any {
 	t.Helper()
 	select {
@@ -319,9 +527,16 @@ func readFrame(t *testing.T, ws *MockWebSocket) any {
 
 // signDevicePayload creates a valid signed device connect payload for testing.
 func signDevicePayload(t *testing.T, privKey ed25519.PrivateKey, pubKey ed25519.PublicKey, nonce string, params ConnectParams) *DeviceConnectPayload {
+	t.Helper()
+	deviceID := pairingPkg.DeriveDeviceID(base64Url.EncodeToString(pubKey))
+	return signDevicePayloadAs(t, deviceID, privKey, pubKey, nonce, params)
+}
+
+// signDevicePayloadAs is signDevicePayload for a device presenting its key
+// under deviceID, as a device does after rotating its key.
+func signDevicePayloadAs(t *testing.T, deviceID string, privKey ed25519.PrivateKey, pubKey ed25519.PublicKey, nonce string, params ConnectParams) *DeviceConnectPayload {
 	t.Helper()
 	pubKeyB64 := base64Url.EncodeToString(pubKey)
-	deviceID := pairingPkg.DeriveDeviceID(pubKeyB64)
 	signedAt := time.Now().UnixMilli()
 
 	role := params.Role
@@ -330,6 +545,7 @@ func signDevicePayload(t *testing.T, privKey ed25519.PrivateKey, pubKey ed25519.
 	}
 
 	authToken := ""
+	proto, _ := NegotiateProtocol(params)
 	payload := pairingPkg.BuildAuthPayload(pairingPkg.AuthPayloadParams{
 		DeviceID:   deviceID,
 		ClientID:   params.Client.ID,
@@ -339,6 +555,7 @@ func signDevicePayload(t *testing.T, privKey ed25519.PrivateKey, pubKey ed25519.
 		SignedAtMs: signedAt,
 		Token:      authToken,
 		Nonce:      nonce,
+		Protocol:   proto,
 	})
 
 	sig := ed25519.Sign(privKey, []byte(payload))
@@ -409,6 +626,95 @@ func TestConn_DevicePairing_LoopbackAutoApprove(t *testing.T) {
 	handler.mu.Unlock()
 }
 
+func TestConn_DevicePairing_ConnectRecordsTokenUse(t *testing.T) {
+	store, err := pairingPkg.NewStore(t.TempDir())
+	require.NoError(t, err)
+	svc := pairingPkg.NewService(store)
+
+	pubKey, privKey, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	deviceID := pairingPkg.DeriveDeviceID(base64Url.EncodeToString(pubKey))
+
+	connect := func() {
+		t.Helper()
+		ws := NewMockWebSocket()
+		conn := NewConn(ws, ServerConfig{Auth: AuthConfig{Mode: "none"}}, &MockConnHandler{})
+		conn.WithPairing(svc, "127.0.0.1:54321", true)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go conn.Run(ctx)
+
+		evt := readFrame(t, ws).(*EventFrame)
+		challengePayload := make(map[string]any)
+		json.Unmarshal(evt.Payload, &challengePayload)
+		nonce := challengePayload["nonce"].(string)
+
+		connectParams := ConnectParams{
+			MinProtocol: 3, MaxProtocol: 3,
+			Client: ClientInfo{ID: "iphone-1", Version: "1.0", Platform: "ios", Mode: "node"},
+		}
+		connectParams.Device = signDevicePayload(t, privKey, pubKey, nonce, connectParams)
+		connectReq, _ := MarshalRequest("req-1", "connect", connectParams)
+		ws.Incoming <- connectReq
+
+		res := readFrame(t, ws).(*ResponseFrame)
+		require.True(t, res.OK, "expected OK response, got error: %+v", res.Error)
+	}
+
+	// The first connect pairs the device and issues its token; the second
+	// reuses it.
+	start := time.Now().UnixMilli()
+	connect()
+	connect()
+
+	device := store.GetPairedDevice(deviceID)
+	require.NotNil(t, device)
+	tok := device.Tokens["node"]
+	assert.Equal(t, int64(2), tok.UseCount)
+	assert.GreaterOrEqual(t, tok.LastUsedMs, start)
+}
+
+func TestConn_DevicePairing_Protocol4SignsV3Payload(t *testing.T) {
+	store, err := pairingPkg.NewStore(t.TempDir())
+	require.NoError(t, err)
+	svc := pairingPkg.NewService(store)
+
+	pubKey, privKey, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	ws := NewMockWebSocket()
+	conn := NewConn(ws, ServerConfig{Auth: AuthConfig{Mode: "none"}}, &MockConnHandler{})
+	conn.WithPairing(svc, "127.0.0.1:54321", true)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go conn.Run(ctx)
+
+	evt := readFrame(t, ws).(*EventFrame)
+	var challenge struct {
+		Nonce     string
+		Protocols []int
+	}
+	require.NoError(t, json.Unmarshal(evt.Payload, &challenge))
+	assert.Equal(t, SupportedProtocols, challenge.Protocols)
+
+	connectParams := ConnectParams{
+		MinProtocol: 3, MaxProtocol: 4,
+		Client: ClientInfo{ID: "iphone-1", Version: "1.0", Platform: "ios", Mode: "node"},
+	}
+	connectParams.Device = signDevicePayload(t, privKey, pubKey, challenge.Nonce, connectParams)
+	connectReq, _ := MarshalRequest("req-1", "connect", connectParams)
+	ws.Incoming <- connectReq
+
+	res := readFrame(t, ws).(*ResponseFrame)
+	require.True(t, res.OK, "expected OK response, got error: %+v", res.Error)
+	var hello map[string]any
+	require.NoError(t, json.Unmarshal(res.Payload, &hello))
+	assert.Equal(t, float64(4), hello["protocol"])
+	assert.Equal(t, 4, conn.Protocol)
+}
+
 func TestConn_DevicePairing_InvalidSignature(t *testing.T) {
 	store, err := pairingPkg.NewStore(t.TempDir())
 	require.NoError(t, err)
@@ -536,7 +842,335 @@ func TestConn_DevicePairing_RemoteRequiresPairing(t *testing.T) {
 	assert.False(t, res.OK)
 	assert.Equal(t, "NOT_PAIRED", res.Error.Code)
 	// Error message contains JSON with requestId
-	assert.Contains(t, res.Error.Message, "requestId")
+	var notPaired map[string]any
+	require.NoError(t, json.Unmarshal([]byte(res.Error.Message), &notPaired))
+	assert.NotEmpty(t, notPaired["requestId"])
+	assert.Equal(t, "new-device", notPaired["reason"])
+	assert.Equal(t, false, notPaired["isRepair"])
+}
+
+func TestConn_DevicePairing_UnsupportedAlgorithm(t *testing.T) {
+	store, err := pairingPkg.NewStore(t.TempDir())
+	require.NoError(t, err)
+	svc := pairingPkg.NewService(store)
+
+	pubKey, privKey, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	ws := NewMockWebSocket()
+	conn := NewConn(ws, ServerConfig{Auth: AuthConfig{Mode: "none"}}, &MockConnHandler{})
+	conn.WithPairing(svc, "127.0.0.1:54321", true)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go conn.Run(ctx)
+
+	evt := readFrame(t, ws).(*EventFrame)
+	challengePayload := make(map[string]any)
+	json.Unmarshal(evt.Payload, &challengePayload)
+	nonce := challengePayload["nonce"].(string)
+
+	connectParams := ConnectParams{
+		MinProtocol: 3, MaxProtocol: 3,
+		Client: ClientInfo{ID: "iphone-1", Version: "1.0", Platform: "ios", Mode: "node"},
+	}
+	connectParams.Device = signDevicePayload(t, privKey, pubKey, nonce, connectParams)
+	connectParams.Device.Algorithm = "rsa-pss"
+
+	connectReq, _ := MarshalRequest("req-1", "connect", connectParams)
+	ws.Incoming <- connectReq
+
+	res := readFrame(t, ws).(*ResponseFrame)
+	assert.False(t, res.OK)
+	assert.Equal(t, "UNSUPPORTED_ALGORITHM", res.Error.Code)
+	assert.Contains(t, res.Error.Message, "rsa-pss")
+	assert.Empty(t, store.ListPaired(), "rejected device must not be auto-approved")
+}
+
+func TestConn_DevicePairing_KeyChanged(t *testing.T) {
+	store, err := pairingPkg.NewStore(t.TempDir())
+	require.NoError(t, err)
+	svc := pairingPkg.NewService(store)
+
+	pubKey, privKey, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	oldKey, _, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	// The device ID is paired, but under a key the device no longer holds.
+	deviceID := pairingPkg.DeriveDeviceID(base64Url.EncodeToString(pubKey))
+	require.NoError(t, store.SetPaired(pairingPkg.PairedDevice{
+		DeviceID:  deviceID,
+		PublicKey: base64Url.EncodeToString(oldKey),
+	}))
+
+	ws := NewMockWebSocket()
+	conn := NewConn(ws, ServerConfig{Auth: AuthConfig{Mode: "none"}}, &MockConnHandler{})
+	conn.WithPairing(svc, "192.168.1.100:54321", false)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go conn.Run(ctx)
+
+	evt := readFrame(t, ws).(*EventFrame)
+	challengePayload := make(map[string]any)
+	json.Unmarshal(evt.Payload, &challengePayload)
+	nonce := challengePayload["nonce"].(string)
+
+	connectParams := ConnectParams{
+		MinProtocol: 3, MaxProtocol: 3,
+		Client: ClientInfo{ID: "iphone-1", Version: "1.0", Platform: "ios", Mode: "node"},
+	}
+	connectParams.Device = signDevicePayload(t, privKey, pubKey, nonce, connectParams)
+
+	connectReq, _ := MarshalRequest("req-1", "connect", connectParams)
+	ws.Incoming <- connectReq
+
+	res := readFrame(t, ws).(*ResponseFrame)
+	assert.False(t, res.OK)
+	assert.Equal(t, "NOT_PAIRED", res.Error.Code)
+	var notPaired map[string]any
+	require.NoError(t, json.Unmarshal([]byte(res.Error.Message), &notPaired))
+	assert.Equal(t, "key-changed", notPaired["reason"])
+	assert.Equal(t, true, notPaired["isRepair"])
+
+	pending := store.ListPending()
+	require.Len(t, pending, 1)
+	assert.True(t, pending[0].IsRepair)
+}
+
+func TestConn_DevicePairing_RotatedKeys(t *testing.T) {
+	store, err := pairingPkg.NewStore(t.TempDir())
+	require.NoError(t, err)
+	svc := pairingPkg.NewService(store)
+
+	oldPub, oldPriv, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	newPub, newPriv, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	unknownPub, unknownPriv, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	// The device was paired under its first key, then rotated to a new
+	// one and was approved again, keeping its device ID.
+	deviceID := pairingPkg.DeriveDeviceID(base64Url.EncodeToString(oldPub))
+	require.NoError(t, store.SetPaired(pairingPkg.PairedDevice{
+		DeviceID:   deviceID,
+		PublicKey:  base64Url.EncodeToString(newPub),
+		PublicKeys: []string{base64Url.EncodeToString(oldPub), base64Url.EncodeToString(newPub)},
+		Role:       "node",
+	}))
+
+	connect := func(t *testing.T, id string, priv ed25519.PrivateKey, pub ed25519.PublicKey) *ResponseFrame {
+		t.Helper()
+		ws := NewMockWebSocket()
+		conn := NewConn(ws, ServerConfig{Auth: AuthConfig{Mode: "none"}}, &MockConnHandler{})
+		conn.WithPairing(svc, "192.168.1.100:54321", false)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		t.Cleanup(cancel)
+		go conn.Run(ctx)
+
+		evt := readFrame(t, ws).(*EventFrame)
+		challengePayload := make(map[string]any)
+		json.Unmarshal(evt.Payload, &challengePayload)
+		nonce := challengePayload["nonce"].(string)
+
+		connectParams := ConnectParams{
+			MinProtocol: 3, MaxProtocol: 3,
+			Client: ClientInfo{ID: "iphone-1", Version: "1.0", Platform: "ios", Mode: "node"},
+		}
+		connectParams.Device = signDevicePayloadAs(t, id, priv, pub, nonce, connectParams)
+		connectReq, _ := MarshalRequest("req-1", "connect", connectParams)
+		ws.Incoming <- connectReq
+		return readFrame(t, ws).(*ResponseFrame)
+	}
+
+	t.Run("current key", func(t *testing.T) {
+		res := connect(t, deviceID, newPriv, newPub)
+		assert.True(t, res.OK, "expected OK response, got error: %+v", res.Error)
+	})
+
+	t.Run("prior key", func(t *testing.T) {
+		res := connect(t, deviceID, oldPriv, oldPub)
+		assert.True(t, res.OK, "expected OK response, got error: %+v", res.Error)
+	})
+
+	t.Run("unknown key", func(t *testing.T) {
+		res := connect(t, deviceID, unknownPriv, unknownPub)
+		require.False(t, res.OK)
+		assert.Equal(t, "NOT_PAIRED", res.Error.Code)
+		var notPaired map[string]any
+		require.NoError(t, json.Unmarshal([]byte(res.Error.Message), &notPaired))
+		assert.Equal(t, "key-changed", notPaired["reason"])
+	})
+
+	t.Run("unknown key under an unpaired ID", func(t *testing.T) {
+		res := connect(t, pairingPkg.DeriveDeviceID(base64Url.EncodeToString(newPub)), unknownPriv, unknownPub)
+		require.False(t, res.OK)
+		assert.Equal(t, CodeInvalidDeviceID, res.Error.Code)
+	})
+}
+
+func TestConn_DevicePairing_TokenIssueFailed(t *testing.T) {
+	tests := []struct {
+		name   string
+		allow  bool
+		revoke bool // revoke the device between the pairing check and token issue
+		wantOK bool
+	}{
+		{name: "token write fails", allow: false, wantOK: false},
+		{name: "token write fails, tokenless allowed", allow: true, wantOK: true},
+		{name: "revoked mid-handshake", allow: false, revoke: true, wantOK: false},
+		{name: "revoked mid-handshake, tokenless allowed", allow: true, revoke: true, wantOK: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			store, err := pairingPkg.NewStore(dir)
+			require.NoError(t, err)
+			svc := pairingPkg.NewService(store)
+
+			pubKey, privKey, err := ed25519.GenerateKey(nil)
+			require.NoError(t, err)
+			pubKeyB64 := base64Url.EncodeToString(pubKey)
+			deviceID := pairingPkg.DeriveDeviceID(pubKeyB64)
+			require.NoError(t, store.SetPaired(pairingPkg.PairedDevice{
+				DeviceID:  deviceID,
+				PublicKey: pubKeyB64,
+				Role:      "node",
+			}))
+
+			ws := NewMockWebSocket()
+			conn := NewConn(ws, ServerConfig{Auth: AuthConfig{Mode: "none"}, AllowTokenlessDevices: tt.allow}, &MockConnHandler{})
+			conn.WithPairing(svc, "192.168.1.100:54321", false)
+			conn.afterPairingCheck = func() {
+				if tt.revoke {
+					// Another process drops the device from paired.json.
+					require.NoError(t, os.WriteFile(filepath.Join(dir, "paired.json"), []byte("{}"), 0600))
+					require.NoError(t, store.Reload())
+					return
+				}
+				// Block the paired.json write so the token cannot be saved.
+				require.NoError(t, os.Mkdir(filepath.Join(dir, "paired.json.tmp"), 0700))
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go conn.Run(ctx)
+
+			evt := readFrame(t, ws).(*EventFrame)
+			challengePayload := make(map[string]any)
+			json.Unmarshal(evt.Payload, &challengePayload)
+			nonce := challengePayload["nonce"].(string)
+
+			connectParams := ConnectParams{
+				MinProtocol: 3, MaxProtocol: 3,
+				Client: ClientInfo{ID: "iphone-1", Version: "1.0", Platform: "ios", Mode: "node"},
+			}
+			connectParams.Device = signDevicePayload(t, privKey, pubKey, nonce, connectParams)
+
+			connectReq, _ := MarshalRequest("req-1", "connect", connectParams)
+			ws.Incoming <- connectReq
+
+			res := readFrame(t, ws).(*ResponseFrame)
+			if !tt.wantOK {
+				assert.False(t, res.OK)
+				assert.Equal(t, "TOKEN_ISSUE_FAILED", res.Error.Code)
+				return
+			}
+			assert.True(t, res.OK, "expected OK response, got error: %+v", res.Error)
+			time.Sleep(50 * time.Millisecond)
+			assert.Equal(t, deviceID, conn.DeviceID)
+			assert.Empty(t, conn.DeviceToken)
+		})
+	}
+}
+
+func TestConn_DevicePairing_PendingCarriesClientMetadata(t *testing.T) {
+	store, err := pairingPkg.NewStore(t.TempDir())
+	require.NoError(t, err)
+	svc := pairingPkg.NewService(store)
+
+	pubKey, privKey, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	ws := NewMockWebSocket()
+	handler := &MockConnHandler{}
+	auth := AuthConfig{Mode: "none"}
+	conn := NewConn(ws, ServerConfig{Auth: auth}, handler)
+	conn.WithPairing(svc, "192.168.1.100:54321", false)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go conn.Run(ctx)
+
+	challengeFrame := readFrame(t, ws)
+	evt := challengeFrame.(*EventFrame)
+	challengePayload := make(map[string]any)
+	json.Unmarshal(evt.Payload, &challengePayload)
+	nonce := challengePayload["nonce"].(string)
+
+	connectParams := ConnectParams{
+		MinProtocol: 3, MaxProtocol: 3,
+		Client: ClientInfo{ID: "iphone-1", DisplayName: "Kitchen iPhone", Version: "1.0", Platform: "ios", Mode: "node"},
+	}
+	dev := signDevicePayload(t, privKey, pubKey, nonce, connectParams)
+	connectParams.Device = dev
+
+	connectReq, _ := MarshalRequest("req-1", "connect", connectParams)
+	ws.Incoming <- connectReq
+
+	frame := readFrame(t, ws)
+	res := frame.(*ResponseFrame)
+	require.False(t, res.OK)
+	require.Equal(t, "NOT_PAIRED", res.Error.Code)
+
+	pending := store.ListPending()
+	require.Len(t, pending, 1)
+	assert.Equal(t, "Kitchen iPhone", pending[0].DisplayName)
+	assert.Equal(t, "ios", pending[0].Platform)
+	assert.Equal(t, "iphone-1", pending[0].ClientID)
+	assert.Equal(t, "192.168.1.100", pending[0].RemoteIP)
+}
+
+func TestConn_DevicePairing_RateLimited(t *testing.T) {
+	store, err := pairingPkg.NewStore(t.TempDir())
+	require.NoError(t, err)
+	svc := pairingPkg.NewService(store)
+	svc.WithLimits(pairingPkg.Limits{MaxPending: 1})
+	store.AddPending(pairingPkg.PendingRequest{RequestID: "req-existing", DeviceID: "other", Timestamp: time.Now().UnixMilli()})
+
+	pubKey, privKey, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	ws := NewMockWebSocket()
+	conn := NewConn(ws, ServerConfig{Auth: AuthConfig{Mode: "none"}}, &MockConnHandler{})
+	conn.WithPairing(svc, "192.168.1.100:54321", false)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go conn.Run(ctx)
+
+	evt := readFrame(t, ws).(*EventFrame)
+	challengePayload := make(map[string]any)
+	json.Unmarshal(evt.Payload, &challengePayload)
+	nonce := challengePayload["nonce"].(string)
+
+	connectParams := ConnectParams{
+		MinProtocol: 3, MaxProtocol: 3,
+		Client: ClientInfo{ID: "iphone-1", Version: "1.0", Platform: "ios", Mode: "node"},
+	}
+	connectParams.Device = signDevicePayload(t, privKey, pubKey, nonce, connectParams)
+
+	connectReq, _ := MarshalRequest("req-1", "connect", connectParams)
+	ws.Incoming <- connectReq
+
+	res := readFrame(t, ws).(*ResponseFrame)
+	assert.False(t, res.OK)
+	assert.Equal(t, "PAIRING_RATE_LIMITED", res.Error.Code)
+	assert.Contains(t, res.Error.Message, `"reason":"rate-limited"`)
+	assert.Len(t, store.ListPending(), 1)
 }
 
 func TestServer_IsLoopback(t *testing.T) {
@@ -560,3 +1194,174 @@ func TestServer_IsLoopback(t *testing.T) {
 		})
 	}
 }
+
+// captureHandler records slog output for assertions.
+type captureHandler struct {
+	mu      *sync.Mutex
+	records *[]capturedRecord
+	attrs   []slog.Attr
+	level   slog.Level
+}
+
+type capturedRecord struct {
+	Level   slog.Level
+	Message string
+	Attrs   map[string]any
+}
+
+// captureLogs installs a capturing default logger at level until the test ends.
+func captureLogs(t *testing.T, level slog.Level) *captureHandler {
+	t.Helper()
+	h := &captureHandler{mu: &sync.Mutex{}, records: &[]capturedRecord{}, level: level}
+	prev := slog.Default()
+	slog.SetDefault(slog.New(h))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return h
+}
+
+func (h *captureHandler) Enabled(_ context.Context, l slog.Level) bool { return l >= h.level }
+
+func (h *captureHandler) Handle(_ context.Context, r slog.Record) error {
+	rec := capturedRecord{Level: r.Level, Message: r.Message, Attrs: map[string]any{}}
+	for _, a := range h.attrs {
+		rec.Attrs[a.Key] = a.Value.Any()
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		rec.Attrs[a.Key] = a.Value.Any()
+		return true
+	})
+	h.mu.Lock()
+	*h.records = append(*h.records, rec)
+	h.mu.Unlock()
+	return nil
+}
+
+func (h *captureHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := *h
+	clone.attrs = append(append([]slog.Attr{}, h.attrs...), attrs...)
+	return &clone
+}
+
+func (h *captureHandler) WithGroup(string) slog.Handler { return h }
+
+// Find returns captured records with the given message.
+func (h *captureHandler) Find(msg string) []capturedRecord {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var out []capturedRecord
+	for _, r := range *h.records {
+		if r.Message == msg {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+func TestConn_DebugFrameLogging(t *testing.T) {
+	logs := captureLogs(t, slog.LevelDebug)
+
+	ws := NewMockWebSocket()
+	handler := &MockConnHandler{}
+	conn := NewConn(ws, ServerConfig{Auth: AuthConfig{Mode: "token", Tokens: []string{"secret"}}}, handler)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go conn.Run(ctx)
+
+	_ = readFrame(t, ws) // connect.challenge
+	connectReq, _ := MarshalRequest("req-1", "connect", ConnectParams{
+		MinProtocol: 3, MaxProtocol: 3,
+		Client: ClientInfo{ID: "iphone-1", Version: "1.0", Platform: "ios", Mode: "node"},
+		Auth:   &ConnectAuth{Token: "secret"},
+	})
+	ws.Incoming <- connectReq
+	_ = readFrame(t, ws) // hello-ok
+
+	var in, out []capturedRecord
+	for _, r := range logs.Find("frame") {
+		assert.Equal(t, slog.LevelDebug, r.Level)
+		assert.Equal(t, conn.ConnID, r.Attrs["connId"])
+		for _, v := range r.Attrs {
+			assert.NotEqual(t, "secret", v, "frame log must not carry token values")
+		}
+		if r.Attrs["dir"] == "in" {
+			in = append(in, r)
+		} else {
+			out = append(out, r)
+		}
+	}
+
+	require.Len(t, in, 1)
+	assert.Equal(t, "req", in[0].Attrs["type"])
+	assert.Equal(t, "req-1", in[0].Attrs["id"])
+	assert.Equal(t, "connect", in[0].Attrs["method"])
+	assert.Contains(t, in[0].Attrs["paramKeys"], "auth")
+
+	require.Len(t, out, 2)
+	assert.Equal(t, "connect.challenge", out[0].Attrs["event"])
+	assert.Equal(t, true, out[1].Attrs["ok"])
+}
+
+func TestConn_FrameLoggingDisabledAtInfo(t *testing.T) {
+	logs := captureLogs(t, slog.LevelInfo)
+
+	ws := NewMockWebSocket()
+	conn := NewConn(ws, ServerConfig{Auth: AuthConfig{Mode: "none"}}, &MockConnHandler{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go conn.Run(ctx)
+
+	_ = readFrame(t, ws)
+	assert.Empty(t, logs.Find("frame"))
+}
+
+func TestConn_LoggerCarriesDeviceID(t *testing.T) {
+	logs := captureLogs(t, slog.LevelInfo)
+
+	store, err := pairingPkg.NewStore(t.TempDir())
+	require.NoError(t, err)
+	svc := pairingPkg.NewService(store)
+	pubKey, privKey, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	ws := NewMockWebSocket()
+	conn := NewConn(ws, ServerConfig{Auth: AuthConfig{Mode: "none"}}, &MockConnHandler{})
+	conn.WithPairing(svc, "127.0.0.1:54321", true)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go conn.Run(ctx)
+
+	evt := readFrame(t, ws).(*EventFrame)
+	challengePayload := make(map[string]any)
+	json.Unmarshal(evt.Payload, &challengePayload)
+	connectParams := ConnectParams{
+		MinProtocol: 3, MaxProtocol: 3,
+		Client: ClientInfo{ID: "iphone-1", Version: "1.0", Platform: "ios", Mode: "node"},
+	}
+	connectParams.Device = signDevicePayload(t, privKey, pubKey, challengePayload["nonce"].(string), connectParams)
+	connectReq, _ := MarshalRequest("req-1", "connect", connectParams)
+	ws.Incoming <- connectReq
+	res := readFrame(t, ws).(*ResponseFrame)
+	require.True(t, res.OK)
+
+	require.Eventually(t, func() bool { return len(logs.Find("connection authenticated")) == 1 }, time.Second, 5*time.Millisecond)
+	rec := logs.Find("connection authenticated")[0]
+	assert.Equal(t, conn.ConnID, rec.Attrs["connId"])
+	assert.Equal(t, conn.DeviceID, rec.Attrs["deviceId"])
+}
+
+func TestGateway_OnAuthenticatedTagsNodeID(t *testing.T) {
+	logs := captureLogs(t, slog.LevelInfo)
+
+	gw, err := New(GatewayConfig{})
+	require.NoError(t, err)
+	conn := NewConn(NewMockWebSocket(), ServerConfig{Auth: AuthConfig{Mode: "none"}}, gw)
+	conn.ConnectParams = &ConnectParams{Client: ClientInfo{ID: "iphone-1", Mode: "node"}}
+
+	require.NoError(t, gw.OnAuthenticated(conn))
+	conn.Logger().Info("probe")
+
+	rec := logs.Find("probe")
+	require.Len(t, rec, 1)
+	assert.Equal(t, "iphone-1", rec[0].Attrs["nodeId"])
+	assert.Equal(t, conn.ConnID, rec[0].Attrs["connId"])
+}
@@ -0,0 +1,139 @@
+package gateway
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/rvald/goclaw/internal/pairing"
+	"github.com/rvald/goclaw/internal/protocol"
+)
+
+// errDryRun ends a connection after its dry-run diagnostics were sent.
+var errDryRun = errors.New("dry-run connect")
+
+// DryRunCheck is the outcome of one handshake check.
+type DryRunCheck struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// DryRunResult is the response payload of a dry-run connect. It reports
+// every check instead of stopping at the first failure.
+type DryRunResult struct {
+	Type            string        `json:"type"` // "dry-run"
+	WouldAccept     bool          `json:"wouldAccept"`
+	Checks          []DryRunCheck `json:"checks"`
+	DerivedDeviceID string        `json:"derivedDeviceId,omitempty"`
+	PairingStatus   string        `json:"pairingStatus,omitempty"`
+	RequestID       string        `json:"requestId,omitempty"`
+}
+
+// diagnose runs the connect validation, auth and device checks without
+// side effects: no token is minted, no pending request or paired device
+// is created and the session is never registered. The caller has already
+// authenticated; see processConnect.
+func (c *Conn) diagnose(params protocol.ConnectParams) DryRunResult {
+	res := DryRunResult{Type: "dry-run"}
+	check := func(name string, ok bool, detail string) {
+		res.Checks = append(res.Checks, DryRunCheck{Name: name, OK: ok, Detail: detail})
+	}
+
+	proto, err := protocol.NegotiateProtocol(params)
+	if err != nil {
+		check("protocol", false, err.Error())
+	} else {
+		check("protocol", true, fmt.Sprintf("v%d", proto))
+	}
+
+	if auth := Authenticate(c.auth, params.Auth); auth.OK {
+		check("auth", true, auth.Method)
+	} else {
+		check("auth", false, auth.Reason)
+	}
+
+	switch {
+	case c.pairingSvc == nil:
+		check("device", true, "pairing disabled")
+	case params.Device == nil:
+		check("device", true, "no device identity presented")
+	default:
+		c.dryRunDevice(params, proto, check, &res)
+	}
+
+	res.WouldAccept = true
+	for _, ch := range res.Checks {
+		if !ch.OK {
+			res.WouldAccept = false
+		}
+	}
+	return res
+}
+
+// dryRunDevice mirrors verifyDevice, using PeekPairingStatus in place of
+// CheckPairingStatus. Pairing status is only looked up once the client
+// proved it holds the device key, so it cannot be probed for other devices.
+// proto is 0 when negotiation failed: the signed payload depends on the
+// version, so the signature is then not checked at all.
+func (c *Conn) dryRunDevice(params protocol.ConnectParams, proto int, check func(string, bool, string), res *DryRunResult) {
+	dev := params.Device
+	role, _, payload := c.deviceAuthPayload(params, proto)
+
+	if proto == 0 {
+		check("signature", false, "skipped: no protocol version negotiated")
+	} else if valid, err := pairing.VerifySignatureAlg(dev.Algorithm, dev.PublicKey, payload, dev.Signature); err != nil {
+		check("signature", false, err.Error())
+	} else {
+		check("signature", valid, "")
+	}
+	if dev.Nonce == c.challengeNonce {
+		check("nonce", true, "")
+	} else {
+		check("nonce", false, "nonce does not match challenge")
+	}
+
+	res.DerivedDeviceID = pairing.DeriveDeviceID(dev.PublicKey)
+	if c.pairingSvc.VerifyDeviceID(dev.ID, dev.PublicKey) == nil {
+		check("deviceId", true, "")
+	} else {
+		check("deviceId", false, "device ID does not match public key")
+	}
+
+	for _, ch := range res.Checks {
+		if !ch.OK && ch.Name != "protocol" {
+			check("pairing", false, "skipped: device identity not verified")
+			return
+		}
+	}
+
+	action := c.pairingSvc.PeekPairingStatus(pairing.CheckPairingParams{
+		DeviceID:  dev.ID,
+		PublicKey: dev.PublicKey,
+		Role:      role,
+		Scopes:    params.Scopes,
+		RemoteIP:  remoteIP(c.remoteAddr),
+		IsLocal:   c.isLocal,
+	})
+	res.PairingStatus = action.Status
+	res.RequestID = action.RequestID
+	switch action.Status {
+	case "paired", "auto-approve":
+		check("pairing", true, action.Status)
+	default:
+		detail := action.Status
+		if action.Reason != "" {
+			detail += ": " + action.Reason
+		}
+		check("pairing", false, detail)
+	}
+}
+
+// sendDryRun answers a dry-run connect with its diagnostics. The response
+// is OK even when checks fail; WouldAccept carries the verdict.
+func (c *Conn) sendDryRun(reqID string, params protocol.ConnectParams) {
+	res := c.diagnose(params)
+	c.log.Info("dry-run connect", "wouldAccept", res.WouldAccept, "pairingStatus", res.PairingStatus)
+	if err := c.SendResponse(reqID, true, res, nil); err != nil {
+		c.log.Debug("dry-run response failed", "error", err)
+	}
+}
@@ -2,10 +2,19 @@ package gateway
 
 import (
 	"context"
+	"crypto/ed25519"
 	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"slices"
+	"sort"
 	"sync"
 	"time"
 
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/rvald/goclaw/internal/node"
 	"github.com/rvald/goclaw/internal/pairing"
 	"github.com/rvald/goclaw/internal/protocol"
@@ -15,13 +24,87 @@ import (
 type InvokeRequest = node.InvokeRequest
 type InvokeResult = node.InvokeResult
 
+const (
+	// ScopeOperatorAdmin grants operators node.list and node.invoke.
+	ScopeOperatorAdmin = "operator.admin"
+
+	// defaultOperatorInvokeTimeoutMs applies when node.invoke omits timeoutMs.
+	defaultOperatorInvokeTimeoutMs = 10000
+
+	// maxOperatorInvokeTimeoutMs caps the timeoutMs of a node.invoke, so
+	// an operator cannot hold a node's invoke slot indefinitely.
+	maxOperatorInvokeTimeoutMs = 120000
+
+	// nodeIDConflictReason accompanies the close frame sent to a node
+	// whose client ID is already registered by a different device.
+	nodeIDConflictReason = protocol.CodeNodeIDConflict
+
+	// tooManyConnsReason accompanies the close frame sent to a connection
+	// that would exceed MaxConnsPerDevice.
+	tooManyConnsReason = protocol.CodeTooManyConnections
+
+	// shutdownRetryAfter is the reconnect delay suggested to clients by a
+	// planned shutdown.
+	shutdownRetryAfter = 5 * time.Second
+
+	// errorShutdownTimeout bounds the Shutdown that Run performs when the
+	// server fails.
+	errorShutdownTimeout = 5 * time.Second
+)
+
+// Shutdown reasons, reported in the shutdown event.
+const (
+	ShutdownSignal = "signal" // the process was told to stop, e.g. for a restart
+	ShutdownError  = "error"  // the gateway hit an unrecoverable error
+)
+
 // GatewayConfig configures the gateway.
 type GatewayConfig struct {
-	Port         int
-	Bind         string // "loopback" or "lan"
-	AuthToken    string
-	TickInterval time.Duration
-	PairingSvc   *pairing.Service // optional — nil disables device pairing
+	Port           int
+	Bind           string   // "loopback" or "lan"
+	BindAddr       string   // optional IP to listen on; overrides Bind
+	AuthTokens     []string // accepted shared tokens; empty disables token auth
+	AdminTokens    []string // tokens that also grant operator scopes; see AuthConfig
+	TickInterval   time.Duration
+	TickStats      bool             // add server stats (connected nodes) to tick payloads
+	PairingSvc     *pairing.Service // optional — nil disables device pairing
+	Build          BuildInfo        // optional, reported by /health
+	AllowedOrigins []string         // optional WebSocket Origin allow-list; see ServerConfig
+	AllowCIDRs     []*net.IPNet     // optional remote IP allow-list; see ServerConfig
+	DenyCIDRs      []*net.IPNet     // optional remote IP deny-list
+
+	// EnableCompression negotiates permessage-deflate; see ServerConfig.
+	EnableCompression bool
+
+	// IdleTimeout closes connections that send no frame for this long;
+	// see ServerConfig. 0 disables.
+	IdleTimeout time.Duration
+
+	// MaxInvokesPerNode caps concurrent invokes per node; excess invokes
+	// queue. 0 means unlimited.
+	MaxInvokesPerNode int
+
+	// MaxConnsPerDevice caps concurrent authenticated connections sharing
+	// one device ID; connections beyond it are refused. 0 means unlimited.
+	MaxConnsPerDevice int
+
+	// ServerKey signs connect challenges; see ServerConfig. Optional.
+	ServerKey ed25519.PrivateKey
+
+	// AllowTokenlessDevices admits paired devices whose token could not be
+	// issued; see ServerConfig.
+	AllowTokenlessDevices bool
+
+	// ReconnectGrace keeps a disconnected node's pending invokes alive this
+	// long, for a reconnect from the same device to adopt. 0 cancels them
+	// on disconnect.
+	ReconnectGrace time.Duration
+
+	// Metrics, when set, is a registry the gateway registers its metrics
+	// with and serves on /metrics; see ServerConfig. A registry holds one
+	// gateway's metrics. Nil gives the gateway a registry of its own, which
+	// also serves the Go runtime and process metrics.
+	Metrics *prometheus.Registry
 }
 
 // Gateway is the top-level orchestrator that ties together the WebSocket
@@ -31,43 +114,128 @@ type Gateway struct {
 	server   *Server
 	registry *node.Registry
 	invoker  *node.Invoker
-	conns    map[*Conn]bool
+	conns    map[*Conn]bool // node conns, the targets of broadcast
 	connsMu  sync.Mutex
+	handlers map[string]RequestHandler // by method; see Handle
+
+	operators *node.OperatorRegistry
+
+	// deviceConns holds the authenticated connections of each device ID,
+	// for MaxConnsPerDevice. Guarded by connsMu.
+	deviceConns map[string]map[*Conn]bool
+
+	// subs holds, per operator conn, the node IDs whose events it
+	// subscribed to ("" for every node). Guarded by connsMu.
+	subs map[*Conn]map[string]bool
+
+	recent  *RecentLog // served on /recent
+	metrics *Metrics   // registered on config.Metrics
 }
 
 // New creates and wires up a new Gateway.
 func New(config GatewayConfig) (*Gateway, error) {
+	if config.Metrics == nil {
+		// Serve the Go runtime and process metrics alongside the gateway's,
+		// as the default registry would.
+		config.Metrics = prometheus.NewRegistry()
+		config.Metrics.MustRegister(
+			collectors.NewGoCollector(),
+			collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		)
+	}
+	metrics := NewMetrics()
+	if err := metrics.Register(config.Metrics); err != nil {
+		return nil, err
+	}
 	reg := node.NewRegistry()
 	inv := node.NewInvoker(reg)
+	recent := NewRecentLog(DefaultRecentEvents)
+	inv.WithMaxInFlightPerNode(config.MaxInvokesPerNode)
+	inv.WithReconnectGrace(config.ReconnectGrace)
+	inv.WithObserver(metricsObserver{metrics: metrics, recent: recent})
+	if config.PairingSvc != nil {
+		config.PairingSvc.OnPending(func(req pairing.PendingRequest) {
+			recent.Add(RecentEvent{Kind: "pairing", Detail: fmt.Sprintf("request %s from device %s at %s", req.RequestID, req.DeviceID, req.RemoteIP)})
+		})
+	}
+	// Set from Len rather than Inc/Dec: a reconnect replaces its session
+	// without an unregister.
+	reg.OnRegister(func(*node.NodeSession) { metrics.RegisteredNodes.Set(float64(reg.Len())) })
+	reg.OnUnregister(func(string) { metrics.RegisteredNodes.Set(float64(reg.Len())) })
 
 	gw := &Gateway{
 		config:   config,
 		registry: reg,
 		invoker:  inv,
 		conns:    make(map[*Conn]bool),
+		handlers: make(map[string]RequestHandler),
+
+		operators: node.NewOperatorRegistry(),
+
+		deviceConns: make(map[string]map[*Conn]bool),
+		subs:        make(map[*Conn]map[string]bool),
+
+		recent:  recent,
+		metrics: metrics,
 	}
 
-	authCfg := AuthConfig{Mode: "none"}
-	if config.AuthToken != "" {
-		authCfg = AuthConfig{Mode: "token", Token: config.AuthToken}
+	gw.registerHandlers()
+	gw.watchPresence()
+
+	authCfg := AuthConfig{Mode: "none", AdminTokens: config.AdminTokens}
+	if len(config.AuthTokens) > 0 {
+		authCfg.Mode = "token"
+		authCfg.Tokens = config.AuthTokens
 	}
 
 	gw.server = NewServer(ServerConfig{
-		Port:       config.Port,
-		Bind:       config.Bind,
-		Auth:       authCfg,
-		PairingSvc: config.PairingSvc,
+		Port:              config.Port,
+		Bind:              config.Bind,
+		BindAddr:          config.BindAddr,
+		Auth:              authCfg,
+		PairingSvc:        config.PairingSvc,
+		Build:             config.Build,
+		AllowedOrigins:    config.AllowedOrigins,
+		AllowCIDRs:        config.AllowCIDRs,
+		DenyCIDRs:         config.DenyCIDRs,
+		EnableCompression: config.EnableCompression,
+		IdleTimeout:       config.IdleTimeout,
+		ServerKey:         config.ServerKey,
+
+		AllowTokenlessDevices: config.AllowTokenlessDevices,
+		Metrics:               config.Metrics,
+		metrics:               metrics,
 	}, gw)
+	gw.server.nodeCount = reg.Len
+	gw.server.recent = recent
 	return gw, nil
 }
 
-// Run starts the gateway server and tick loop. Blocks until ctx is cancelled.
-// Run starts the gateway server and tick loop. Blocks until ctx is cancelled.
+// Listen binds the gateway's port ahead of Run, so Addr is known early.
+func (gw *Gateway) Listen() error { return gw.server.Listen() }
+
+// Addr returns the address the gateway is listening on, or "" before it
+// has bound.
+func (gw *Gateway) Addr() string { return gw.server.Addr() }
+
+// Run starts the gateway server and tick loop. Blocks until ctx is
+// cancelled or the server fails; in the latter case it shuts the gateway
+// down with ShutdownError, so clients learn not to reconnect, and returns
+// the server's error.
 func (gw *Gateway) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx) // stops the tick loop on failure too
+	defer cancel()
 	if gw.config.TickInterval > 0 {
 		go gw.tickLoop(ctx)
 	}
-	return gw.server.ListenAndServe(ctx)
+	err := gw.server.ListenAndServe(ctx)
+	if err != nil && ctx.Err() == nil {
+		slog.Error("gateway server failed", "error", err)
+		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), errorShutdownTimeout)
+		defer shutdownCancel()
+		gw.Shutdown(shutdownCtx, ShutdownError)
+	}
+	return err
 }
 
 // Invoker returns the gateway's invoker for external use (e.g. Discord bot).
@@ -76,12 +244,48 @@ func (gw *Gateway) Invoker() *node.Invoker { return gw.invoker }
 // Registry returns the gateway's node registry for external use.
 func (gw *Gateway) Registry() *node.Registry { return gw.registry }
 
+// Operators returns the gateway's operator registry for external use.
+func (gw *Gateway) Operators() *node.OperatorRegistry { return gw.operators }
+
+// Ready reports whether the gateway is serving normally. It turns false
+// as soon as Shutdown starts; /health then answers 503 "draining".
+func (gw *Gateway) Ready() bool { return !gw.server.draining.Load() }
+
+// SetComponent records whether an optional subsystem such as "discord" or
+// "mdns" is active, for /health.
+func (gw *Gateway) SetComponent(name string, active bool) {
+	gw.server.setComponent(name, active)
+}
+
+// PublicKey returns the public half of the configured server key, which
+// clients pin to verify challenge signatures, or nil when there is none.
+func (gw *Gateway) PublicKey() ed25519.PublicKey {
+	if gw.config.ServerKey == nil {
+		return nil
+	}
+	return gw.config.ServerKey.Public().(ed25519.PublicKey)
+}
+
 // PairingSvc returns the gateway's pairing service for external use (e.g. Discord bot).
 func (gw *Gateway) PairingSvc() *pairing.Service { return gw.config.PairingSvc }
 
-// Shutdown sends a shutdown event to all connections and gracefully stops the server.
-func (gw *Gateway) Shutdown(ctx context.Context) error {
-	gw.broadcast("shutdown", nil)
+// Shutdown stops accepting invokes and waits, until ctx is done, for the
+// in-flight ones to get their results. It then sends a shutdown event
+// carrying reason to all connections and stops the server, closing their
+// sockets. Every reason but ShutdownError tells clients to reconnect.
+func (gw *Gateway) Shutdown(ctx context.Context, reason string) error {
+	gw.server.draining.Store(true)
+	gw.invoker.Close()
+	if err := gw.invoker.WaitIdle(ctx); err != nil {
+		slog.Warn("shutdown: closing with invokes still in flight", "error", err)
+	}
+	evt := protocol.ShutdownEvent{Reason: reason}
+	if reason != ShutdownError {
+		evt.Reconnect = true
+		evt.RetryAfterMs = shutdownRetryAfter.Milliseconds()
+	}
+	gw.broadcast("shutdown", evt)
+	gw.broadcastOperators("", "shutdown", evt, "")
 	return gw.server.Shutdown(ctx)
 }
 
@@ -91,12 +295,20 @@ func (gw *Gateway) OnAuthenticated(conn *Conn) error {
 	if conn.ConnectParams == nil {
 		return nil
 	}
+	if err := gw.trackDevice(conn); err != nil {
+		conn.Close(websocket.ClosePolicyViolation, tooManyConnsReason)
+		return err
+	}
 	role := conn.ConnectParams.Role
 	if role == "" {
 		role = "node"
 	}
 	// Only register node sessions; operator sessions should not receive node commands.
 	if role != "node" {
+		if role == "operator" {
+			gw.registerOperator(conn)
+		}
+		gw.countConnection(conn, role)
 		return nil
 	}
 
@@ -108,40 +320,270 @@ func (gw *Gateway) OnAuthenticated(conn *Conn) error {
 		conn.ConnectParams.Client.Version,
 		conn.ConnectParams.Commands,
 		func(event string, payload any) error {
+			if req, ok := payload.(protocol.NodeInvokeRequest); ok {
+				conn.log.Info("invoke sent", "invokeId", req.ID, "command", req.Command)
+			}
 			return conn.SendEvent(event, payload)
 		},
 	)
 
-	gw.registry.Register(session)
+	session.DeviceID = conn.DeviceID
+	session.ModelIdentifier = conn.ConnectParams.Client.ModelIdentifier
+	session.DeviceFamily = conn.ConnectParams.Client.DeviceFamily
+
+	// Tag the conn's logger before the session is visible to other goroutines.
+	conn.log = conn.log.With("nodeId", session.NodeID)
+	if err := gw.registry.Register(session); err != nil {
+		// Another device is live under this node ID; rather than
+		// silently evict it, turn this one away.
+		conn.Close(websocket.ClosePolicyViolation, nodeIDConflictReason)
+		return err
+	}
 
 	gw.connsMu.Lock()
 	gw.conns[conn] = true
 	gw.connsMu.Unlock()
 
+	gw.countConnection(conn, role)
+	return nil
+}
+
+// countConnection records an accepted connection in
+// Metrics.ConnectionsTotal; OnDisconnected then observes its lifetime in
+// Metrics.ConnectionDuration.
+func (gw *Gateway) countConnection(conn *Conn, role string) {
+	conn.metricsRole = role
+	gw.metrics.ConnectionsTotal.WithLabelValues(conn.AuthMethod, role).Inc()
+	gw.recent.Add(RecentEvent{
+		Kind:   "connect",
+		ConnID: conn.ConnID,
+		NodeID: conn.ConnectParams.Client.ID,
+		Detail: fmt.Sprintf("%s via %s auth", role, conn.AuthMethod),
+	})
+}
+
+// trackDevice counts conn against its device's MaxConnsPerDevice, failing
+// if the device is already at the cap.
+func (gw *Gateway) trackDevice(conn *Conn) error {
+	if conn.DeviceID == "" {
+		return nil
+	}
+	gw.connsMu.Lock()
+	defer gw.connsMu.Unlock()
+	conns := gw.deviceConns[conn.DeviceID]
+	if limit := gw.config.MaxConnsPerDevice; limit > 0 && len(conns) >= limit {
+		return fmt.Errorf("device %s already has %d connections", conn.DeviceID, len(conns))
+	}
+	if conns == nil {
+		conns = make(map[*Conn]bool)
+		gw.deviceConns[conn.DeviceID] = conns
+	}
+	conns[conn] = true
 	return nil
 }
 
+// RequestHandler handles one request method from an authenticated conn.
+type RequestHandler func(conn *Conn, req *protocol.RequestFrame) error
+
+// Handle registers h for method, replacing any existing handler. It must
+// be called before Run.
+func (gw *Gateway) Handle(method string, h RequestHandler) {
+	gw.handlers[method] = h
+}
+
+// registerHandlers installs the built-in request methods. Keep them in
+// step with protocol.ServerFeatures.
+func (gw *Gateway) registerHandlers() {
+	gw.Handle("node.invoke.result", gw.handleInvokeResult)
+	gw.Handle("node.list", gw.handleNodeList)
+	gw.Handle("node.invoke", gw.handleNodeInvoke)
+	gw.Handle("node.event", gw.handleNodeEvent)
+	gw.Handle("node.event.subscribe", gw.handleNodeEventSubscribe)
+	gw.Handle("node.event.unsubscribe", gw.handleNodeEventUnsubscribe)
+}
+
 func (gw *Gateway) OnRequest(conn *Conn, req *protocol.RequestFrame) error {
-	switch req.Method {
-	case "node.invoke.result":
-		var result protocol.NodeInvokeResult
-		if req.Params != nil {
-			json.Unmarshal(req.Params, &result)
+	h, ok := gw.handlers[req.Method]
+	if !ok {
+		conn.log.Debug("unknown request method", "method", req.Method)
+		gw.metrics.incError("unknown_method")
+		conn.sendError(req.ID, protocol.CodeUnknownMethod, fmt.Sprintf("unknown method %q", req.Method))
+		return nil
+	}
+	return h(conn, req)
+}
+
+func (gw *Gateway) handleInvokeResult(conn *Conn, req *protocol.RequestFrame) error {
+	var result protocol.NodeInvokeResult
+	if req.Params != nil {
+		if err := json.Unmarshal(req.Params, &result); err != nil {
+			conn.sendError(req.ID, protocol.CodeInvalidJSON, fmt.Sprintf("invalid node.invoke.result params: %v", err))
+			return nil
+		}
+	}
+	// Only the node an invoke went to may answer it: the sender must be
+	// the registered session for result.NodeID, and the invoker checks
+	// that node ID against the invoke's.
+	if session, ok := gw.registry.Get(result.NodeID); !ok || session.ConnID != conn.ConnID {
+		conn.log.Warn("invoke result from a conn that is not its node", "invokeId", result.ID, "resultNodeId", result.NodeID)
+		conn.sendError(req.ID, protocol.CodeForbidden, "node.invoke.result must come from the node the invoke was sent to")
+		return nil
+	}
+	ack := protocol.NodeInvokeAck{ID: result.ID, NodeID: result.NodeID}
+	if gw.invoker.HandleResult(result) {
+		log := conn.log.With("invokeId", result.ID, "ok", result.OK)
+		if result.Error != nil {
+			log = log.With("errorCode", result.Error.Code)
+		}
+		log.Info("invoke result")
+		return conn.SendEvent("node.invoke.ack", ack)
+	}
+	retryable := false
+	ack.Error = &protocol.ErrorShape{
+		Code:      protocol.CodeStaleResult,
+		Message:   "no invoke is waiting for this result; it timed out, was cancelled or was already answered",
+		Retryable: &retryable,
+	}
+	conn.log.Debug("dropped stale invoke result", "invokeId", result.ID)
+	return conn.SendEvent("node.invoke.stale", ack)
+}
+
+func (gw *Gateway) handleNodeList(conn *Conn, req *protocol.RequestFrame) error {
+	if !isOperatorAdmin(conn) {
+		return gw.forbid(conn, req)
+	}
+	return conn.SendResponse(req.ID, true, gw.nodeList(), nil)
+}
+
+func (gw *Gateway) handleNodeInvoke(conn *Conn, req *protocol.RequestFrame) error {
+	if !isOperatorAdmin(conn) {
+		return gw.forbid(conn, req)
+	}
+	var params protocol.NodeInvokeParams
+	if req.Params != nil {
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			conn.sendError(req.ID, protocol.CodeInvalidJSON, fmt.Sprintf("invalid node.invoke params: %v", err))
+			return nil
+		}
+	}
+	if params.DeviceID != "" {
+		session, ok := gw.registry.GetByDeviceID(params.DeviceID)
+		if !ok {
+			conn.sendError(req.ID, protocol.CodeInvokeFailed, fmt.Sprintf("device %s not connected", params.DeviceID))
+			return nil
 		}
-		gw.invoker.HandleResult(result)
+		if params.NodeID != "" && params.NodeID != session.NodeID {
+			conn.sendError(req.ID, protocol.CodeInvokeFailed, fmt.Sprintf("node %q is not device %s", params.NodeID, params.DeviceID))
+			return nil
+		}
+		params.NodeID = session.NodeID
+	}
+	if params.NodeID == "" || params.Command == "" {
+		conn.sendError(req.ID, protocol.CodeMissingField, "node.invoke requires nodeId or deviceId, and command")
+		return nil
+	}
+	// Invoke blocks until the node answers; don't stall this conn's read loop.
+	go gw.operatorInvoke(conn, req.ID, params)
+	return nil
+}
+
+// isOperatorAdmin reports whether conn is an operator granted
+// operator.admin; see Conn.Scopes.
+func isOperatorAdmin(conn *Conn) bool {
+	if conn.ConnectParams == nil || conn.ConnectParams.Role != "operator" {
+		return false
 	}
+	return slices.Contains(conn.Scopes, ScopeOperatorAdmin)
+}
+
+func (gw *Gateway) forbid(conn *Conn, req *protocol.RequestFrame) error {
+	conn.Logger().Warn("operator request denied", "method", req.Method)
+	conn.sendError(req.ID, protocol.CodeForbidden, fmt.Sprintf("%s requires role operator with scope %s", req.Method, ScopeOperatorAdmin))
 	return nil
 }
 
+// nodeList snapshots the registry, sorted by node ID.
+func (gw *Gateway) nodeList() protocol.NodeListResult {
+	sessions := gw.registry.List()
+	nodes := make([]protocol.NodeInfo, 0, len(sessions))
+	for _, s := range sessions {
+		nodes = append(nodes, protocol.NodeInfo{
+			NodeID:      s.NodeID,
+			DeviceID:    s.DeviceID,
+			DisplayName: s.DisplayName,
+			Platform:    s.Platform,
+			Version:     s.Version,
+			Commands:    s.Commands,
+		})
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].NodeID < nodes[j].NodeID })
+	return protocol.NodeListResult{Nodes: nodes}
+}
+
+// operatorInvokeTimeoutMs returns the timeout of a node.invoke that asked
+// for ms: the default when unset, capped at maxOperatorInvokeTimeoutMs.
+func operatorInvokeTimeoutMs(ms int) int {
+	if ms <= 0 {
+		return defaultOperatorInvokeTimeoutMs
+	}
+	return min(ms, maxOperatorInvokeTimeoutMs)
+}
+
+// operatorInvoke runs a node.invoke on behalf of an operator and replies
+// with the node's result. The timeout is capped at
+// maxOperatorInvokeTimeoutMs, and the invoke is cancelled if the operator
+// disconnects first.
+func (gw *Gateway) operatorInvoke(conn *Conn, reqID string, params protocol.NodeInvokeParams) {
+	// Stop waiting once the operator is gone: nobody is left to answer.
+	result, err := gw.invoker.Invoke(conn.Context(), node.InvokeRequest{
+		NodeID:     params.NodeID,
+		Command:    params.Command,
+		ParamsJSON: params.ParamsJSON,
+		TimeoutMs:  operatorInvokeTimeoutMs(params.TimeoutMs),
+	})
+	if err != nil {
+		conn.sendError(reqID, protocol.CodeInvokeFailed, fmt.Sprintf("invoke %s: %v", result.ID, err))
+		return
+	}
+
+	conn.SendResponse(reqID, result.OK, protocol.NodeInvokeResult{
+		ID:          result.ID,
+		NodeID:      params.NodeID,
+		OK:          result.OK,
+		PayloadJSON: result.PayloadJSON,
+		Error:       result.Error,
+	}, result.Error)
+}
+
 func (gw *Gateway) OnDisconnected(conn *Conn) {
+	if conn.metricsRole != "" {
+		took := time.Since(conn.ConnectedAt)
+		gw.metrics.ConnectionDuration.WithLabelValues(conn.AuthMethod, conn.metricsRole).Observe(took.Seconds())
+		gw.recent.Add(RecentEvent{
+			Kind:   "disconnect",
+			ConnID: conn.ConnID,
+			NodeID: conn.ConnectParams.Client.ID,
+			Detail: fmt.Sprintf("%s after %s", conn.metricsRole, took.Round(time.Second)),
+		})
+	}
+
 	gw.connsMu.Lock()
 	delete(gw.conns, conn)
+	delete(gw.subs, conn)
+	if conns := gw.deviceConns[conn.DeviceID]; conns[conn] {
+		delete(conns, conn)
+		if len(conns) == 0 {
+			delete(gw.deviceConns, conn.DeviceID)
+		}
+	}
 	gw.connsMu.Unlock()
 
 	if conn.ConnID != "" {
+		gw.operators.Unregister(conn.ConnID)
 		nodeID, ok := gw.registry.Unregister(conn.ConnID)
 		if ok {
-			gw.invoker.CancelPendingForNode(nodeID)
+			gw.invoker.NodeDisconnected(nodeID)
+			conn.Logger().Info("node unregistered")
 		}
 	}
 }
@@ -156,15 +598,30 @@ func (gw *Gateway) tickLoop(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			gw.broadcast("tick", map[string]any{"ts": time.Now().Unix()})
+			gw.broadcast("tick", gw.tickPayload())
 		}
 	}
 }
 
+// tickPayload is the body of a tick event.
+func (gw *Gateway) tickPayload() map[string]any {
+	payload := map[string]any{"ts": time.Now().Unix()}
+	if gw.config.TickStats {
+		payload["nodes"] = gw.registry.Len()
+		payload["operators"] = gw.operators.Len()
+	}
+	return payload
+}
+
+// broadcast sends an event to every connection, except ticks to those
+// that opted out of them.
 func (gw *Gateway) broadcast(event string, payload any) {
 	gw.connsMu.Lock()
 	conns := make([]*Conn, 0, len(gw.conns))
 	for c := range gw.conns {
+		if event == "tick" && !c.wantTicks {
+			continue
+		}
 		conns = append(conns, c)
 	}
 	gw.connsMu.Unlock()
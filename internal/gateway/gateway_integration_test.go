@@ -2,10 +2,18 @@ package gateway
 
 import (
 	"context"
+	"crypto/ed25519"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/rvald/goclaw/internal/node"
+	pairingPkg "github.com/rvald/goclaw/internal/pairing"
 	. "github.com/rvald/goclaw/internal/protocol"
 	"github.com/gorilla/websocket"
 	"github.com/stretchr/testify/assert"
@@ -16,8 +24,8 @@ func ptrStr(s string) *string { return &s }
 
 func TestIntegration_ConnectAndInvoke(t *testing.T) {
 	gw, err := New(GatewayConfig{
-		Port:      0,
-		AuthToken: "test-token",
+		Port:       0,
+		AuthTokens: []string{"test-token"},
 	})
 	require.NoError(t, err)
 
@@ -97,8 +105,8 @@ func TestIntegration_ConnectAndInvoke(t *testing.T) {
 
 func TestIntegration_OperatorSessionNotRegistered(t *testing.T) {
 	gw, err := New(GatewayConfig{
-		Port:      0,
-		AuthToken: "test-token",
+		Port:       0,
+		AuthTokens: []string{"test-token"},
 	})
 	require.NoError(t, err)
 
@@ -131,7 +139,7 @@ func TestIntegration_OperatorSessionNotRegistered(t *testing.T) {
 func TestIntegration_TickKeepAlive(t *testing.T) {
 	gw, err := New(GatewayConfig{
 		Port:         0,
-		AuthToken:    "test-token",
+		AuthTokens:   []string{"test-token"},
 		TickInterval: 100 * time.Millisecond, // fast for testing
 	})
 	require.NoError(t, err)
@@ -172,8 +180,65 @@ func TestIntegration_TickKeepAlive(t *testing.T) {
 	assert.GreaterOrEqual(t, tickCount, 2, "should have received at least 2 ticks in 500ms at 100ms interval")
 }
 
+func TestIntegration_TickOptOutAndStats(t *testing.T) {
+	gw, err := New(GatewayConfig{
+		Port:         0,
+		AuthTokens:   []string{"test-token"},
+		TickInterval: 50 * time.Millisecond,
+		TickStats:    true,
+	})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go gw.Run(ctx)
+	require.Eventually(t, func() bool { return gw.server.Addr() != "" }, 2*time.Second, 10*time.Millisecond)
+
+	noTicks := false
+	quiet := dialConnected(t, gw, ConnectParams{
+		MinProtocol: 3, MaxProtocol: 3,
+		Client:    ClientInfo{ID: "iphone-quiet", Version: "1.0", Platform: "ios", Mode: "node"},
+		Auth:      &ConnectAuth{Token: "test-token"},
+		WantTicks: &noTicks,
+	})
+	chatty := dialConnected(t, gw, ConnectParams{
+		MinProtocol: 3, MaxProtocol: 3,
+		Client: ClientInfo{ID: "iphone-chatty", Version: "1.0", Platform: "ios", Mode: "node"},
+		Auth:   &ConnectAuth{Token: "test-token"},
+	})
+
+	// ticks drains ws for 300ms (six tick intervals) and returns the tick payloads.
+	ticks := func(ws *websocket.Conn) []map[string]any {
+		ws.SetReadDeadline(time.Now().Add(300 * time.Millisecond))
+		var payloads []map[string]any
+		for {
+			_, msg, err := ws.ReadMessage()
+			if err != nil {
+				return payloads // deadline exceeded
+			}
+			frame, _ := ParseFrame(msg)
+			if evt, ok := frame.(*EventFrame); ok && evt.Event == "tick" {
+				var p map[string]any
+				json.Unmarshal(evt.Payload, &p)
+				payloads = append(payloads, p)
+			}
+		}
+	}
+
+	var wg sync.WaitGroup
+	var quietTicks, chattyTicks []map[string]any
+	wg.Add(2)
+	go func() { defer wg.Done(); quietTicks = ticks(quiet) }()
+	go func() { defer wg.Done(); chattyTicks = ticks(chatty) }()
+	wg.Wait()
+
+	assert.Empty(t, quietTicks, "opted-out client received ticks")
+	require.NotEmpty(t, chattyTicks)
+	assert.Contains(t, chattyTicks[0], "ts")
+	assert.Equal(t, float64(2), chattyTicks[0]["nodes"])
+}
+
 func TestIntegration_GracefulShutdown(t *testing.T) {
-	gw, err := New(GatewayConfig{Port: 0, AuthToken: "test-token"})
+	gw, err := New(GatewayConfig{Port: 0, AuthTokens: []string{"test-token"}})
 	require.NoError(t, err)
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -198,27 +263,231 @@ func TestIntegration_GracefulShutdown(t *testing.T) {
 	cancel()
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer shutdownCancel()
-	gw.Shutdown(shutdownCtx)
+	gw.Shutdown(shutdownCtx, ShutdownSignal)
 
 	// Client should see the connection close
 	ws.SetReadDeadline(time.Now().Add(2 * time.Second))
-	sawShutdown := false
+	var shutdown *ShutdownEvent
+	var readErr error
 	for {
 		_, msg, err := ws.ReadMessage()
 		if err != nil {
+			readErr = err
 			break
 		}
 		frame, _ := ParseFrame(msg)
 		if evt, ok := frame.(*EventFrame); ok && evt.Event == "shutdown" {
-			sawShutdown = true
+			shutdown = &ShutdownEvent{}
+			require.NoError(t, json.Unmarshal(evt.Payload, shutdown))
+		}
+	}
+
+	require.NotNil(t, shutdown, "should have received shutdown event before connection closed")
+	assert.Contains(t, ServerFeatures().Events, "shutdown", "the event should be advertised in hello-ok")
+	assert.Equal(t, ShutdownSignal, shutdown.Reason)
+	assert.True(t, shutdown.Reconnect)
+	assert.Equal(t, shutdownRetryAfter.Milliseconds(), shutdown.RetryAfterMs)
+	assert.True(t, websocket.IsCloseError(readErr, websocket.CloseGoingAway), "expected a going-away close frame, got %v", readErr)
+	if closeErr, ok := readErr.(*websocket.CloseError); ok {
+		assert.Equal(t, "gateway shutting down", closeErr.Text)
+	}
+}
+
+func TestIntegration_ServerFailureShutsDownWithError(t *testing.T) {
+	gw, err := New(GatewayConfig{Port: 0})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	runErr := make(chan error, 1)
+	go func() { runErr <- gw.Run(ctx) }()
+	require.Eventually(t, func() bool { return gw.server.Addr() != "" }, 2*time.Second, 10*time.Millisecond)
+
+	ws := dialConnected(t, gw, ConnectParams{
+		MinProtocol: 3, MaxProtocol: 3,
+		Client: ClientInfo{ID: "iphone-test", Version: "1.0", Platform: "ios", Mode: "node"},
+	})
+
+	// Losing the listener fails the server without ctx being cancelled.
+	gw.server.mu.Lock()
+	gw.server.ln.Close()
+	gw.server.mu.Unlock()
+
+	ws.SetReadDeadline(time.Now().Add(3 * time.Second))
+	var shutdown *ShutdownEvent
+	for shutdown == nil {
+		_, msg, err := ws.ReadMessage()
+		require.NoError(t, err, "connection closed before the shutdown event")
+		frame, _ := ParseFrame(msg)
+		if evt, ok := frame.(*EventFrame); ok && evt.Event == "shutdown" {
+			shutdown = &ShutdownEvent{}
+			require.NoError(t, json.Unmarshal(evt.Payload, shutdown))
 		}
 	}
+	assert.Equal(t, ShutdownError, shutdown.Reason)
+	assert.False(t, shutdown.Reconnect)
+	assert.Zero(t, shutdown.RetryAfterMs)
+
+	select {
+	case err := <-runErr:
+		assert.Error(t, err)
+	case <-time.After(3 * time.Second):
+		t.Fatal("Run did not return after the server failed")
+	}
+	assert.False(t, gw.Ready())
+}
+
+func TestIntegration_ShutdownDrainsInFlightInvokes(t *testing.T) {
+	gw, err := New(GatewayConfig{Port: 0, AuthTokens: []string{"test-token"}})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go gw.Run(ctx)
+	require.Eventually(t, func() bool { return gw.server.Addr() != "" }, 2*time.Second, 10*time.Millisecond)
+
+	ws := dialConnected(t, gw, ConnectParams{
+		MinProtocol: 3, MaxProtocol: 3,
+		Client:   ClientInfo{ID: "iphone-test", Version: "1.0", Platform: "ios", Mode: "node"},
+		Commands: []string{"camera.snap"},
+		Auth:     &ConnectAuth{Token: "test-token"},
+	})
+
+	type invokeOutcome struct {
+		result InvokeResult
+		err    error
+	}
+	invoked := make(chan invokeOutcome, 1)
+	go func() {
+		result, err := gw.invoker.Invoke(ctx, InvokeRequest{NodeID: "iphone-test", Command: "camera.snap", TimeoutMs: 5000})
+		invoked <- invokeOutcome{result, err}
+	}()
+
+	_, msg, err := ws.ReadMessage()
+	require.NoError(t, err)
+	frame, _ := ParseFrame(msg)
+	evt := frame.(*EventFrame)
+	require.Equal(t, "node.invoke.request", evt.Event)
+	var invokeReq NodeInvokeRequest
+	require.NoError(t, json.Unmarshal(evt.Payload, &invokeReq))
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer shutdownCancel()
+	shutdownDone := make(chan struct{})
+	go func() {
+		gw.Shutdown(shutdownCtx, ShutdownSignal)
+		close(shutdownDone)
+	}()
+
+	// New invokes are refused while the in-flight one drains.
+	require.Eventually(t, func() bool {
+		_, err := gw.invoker.Invoke(ctx, InvokeRequest{NodeID: "iphone-test", Command: "camera.snap", TimeoutMs: 100})
+		return errors.Is(err, node.ErrInvokerClosed)
+	}, 2*time.Second, 10*time.Millisecond)
+	select {
+	case <-shutdownDone:
+		t.Fatal("Shutdown returned before the in-flight invoke finished")
+	default:
+	}
+
+	resultReq, _ := MarshalRequest("n-1", "node.invoke.result", NodeInvokeResult{
+		ID: invokeReq.ID, NodeID: "iphone-test", OK: true, PayloadJSON: ptrStr(`{"format":"jpg"}`),
+	})
+	require.NoError(t, ws.WriteMessage(websocket.TextMessage, resultReq))
+
+	out := <-invoked
+	require.NoError(t, out.err)
+	assert.True(t, out.result.OK)
+	select {
+	case <-shutdownDone:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Shutdown did not return after invokes drained")
+	}
+}
+
+func TestIntegration_ShutdownDeadlineForcesClose(t *testing.T) {
+	gw, err := New(GatewayConfig{Port: 0, AuthTokens: []string{"test-token"}})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go gw.Run(ctx)
+	require.Eventually(t, func() bool { return gw.server.Addr() != "" }, 2*time.Second, 10*time.Millisecond)
+
+	ws := dialConnected(t, gw, ConnectParams{
+		MinProtocol: 3, MaxProtocol: 3,
+		Client:   ClientInfo{ID: "iphone-test", Version: "1.0", Platform: "ios", Mode: "node"},
+		Commands: []string{"camera.snap"},
+		Auth:     &ConnectAuth{Token: "test-token"},
+	})
+
+	invoked := make(chan error, 1)
+	go func() {
+		_, err := gw.invoker.Invoke(ctx, InvokeRequest{NodeID: "iphone-test", Command: "camera.snap", TimeoutMs: 10000})
+		invoked <- err
+	}()
+	_, _, err = ws.ReadMessage() // node.invoke.request, never answered
+	require.NoError(t, err)
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer shutdownCancel()
+	start := time.Now()
+	gw.Shutdown(shutdownCtx, ShutdownSignal)
+	assert.Less(t, time.Since(start), 2*time.Second)
+
+	// The socket is closed, so the stranded invoke fails rather than hanging.
+	select {
+	case err := <-invoked:
+		assert.Error(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("invoke still pending after forced close")
+	}
+}
+
+func TestIntegration_HealthReflectsDrain(t *testing.T) {
+	gw, err := New(GatewayConfig{Port: 0})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go gw.Run(ctx)
+	require.Eventually(t, func() bool { return gw.server.Addr() != "" }, 2*time.Second, 10*time.Millisecond)
+	gw.SetComponent("discord", false)
+	gw.SetComponent("mdns", true)
+
+	// A node that never answers keeps Shutdown draining.
+	sent := make(chan struct{}, 1)
+	gw.registry.Register(node.NewNodeSession("iphone-1", "conn-1", "", "ios", "1.0", nil, func(string, any) error {
+		sent <- struct{}{}
+		return nil
+	}))
+	go gw.invoker.Invoke(ctx, InvokeRequest{NodeID: "iphone-1", Command: "camera.snap", TimeoutMs: 5000})
+	<-sent
+
+	health := func() (int, map[string]any) {
+		resp, err := http.Get("http://" + gw.server.Addr() + "/health")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var body map[string]any
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		return resp.StatusCode, body
+	}
+
+	code, body := health()
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ok", body["status"])
+	assert.Equal(t, float64(1), body["nodes"])
+	assert.Equal(t, map[string]any{"discord": false, "mdns": true}, body["components"])
+	assert.True(t, gw.Ready())
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer shutdownCancel()
+	go gw.Shutdown(shutdownCtx, ShutdownSignal)
 
-	assert.True(t, sawShutdown, "should have received shutdown event before connection closed")
+	require.Eventually(t, func() bool { return !gw.Ready() }, 2*time.Second, 10*time.Millisecond)
+	code, body = health()
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "draining", body["status"])
 }
 
 func TestIntegration_ReconnectAfterDrop(t *testing.T) {
-	gw, err := New(GatewayConfig{Port: 0, AuthToken: "test-token"})
+	gw, err := New(GatewayConfig{Port: 0, AuthTokens: []string{"test-token"}})
 	require.NoError(t, err)
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -258,3 +527,1177 @@ func TestIntegration_ReconnectAfterDrop(t *testing.T) {
 	assert.Len(t, nodes, 1)
 	assert.Equal(t, "iphone-1", nodes[0].NodeID)
 }
+
+// dialConnected opens a WS to gw and completes the connect handshake.
+func dialConnected(t *testing.T, gw *Gateway, params ConnectParams) *websocket.Conn {
+	t.Helper()
+	ws, _, err := websocket.DefaultDialer.Dial("ws://"+gw.server.Addr()+"/ws", nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { ws.Close() })
+
+	_, _, err = ws.ReadMessage() // challenge
+	require.NoError(t, err)
+	connectReq, _ := MarshalRequest("connect-1", "connect", params)
+	require.NoError(t, ws.WriteMessage(websocket.TextMessage, connectReq))
+	_, msg, err := ws.ReadMessage()
+	require.NoError(t, err)
+	frame, _ := ParseFrame(msg)
+	require.True(t, frame.(*ResponseFrame).OK, "handshake failed: %s", msg)
+	return ws
+}
+
+// readResponse reads frames until the response with the given id arrives.
+func readResponse(t *testing.T, ws *websocket.Conn, id string) *ResponseFrame {
+	t.Helper()
+	ws.SetReadDeadline(time.Now().Add(3 * time.Second))
+	defer ws.SetReadDeadline(time.Time{})
+	for {
+		_, msg, err := ws.ReadMessage()
+		require.NoError(t, err)
+		frame, _ := ParseFrame(msg)
+		if res, ok := frame.(*ResponseFrame); ok && res.ID == id {
+			return res
+		}
+	}
+}
+
+func TestIntegration_OperatorNodeListAndInvoke(t *testing.T) {
+	gw, err := New(GatewayConfig{Port: 0, AuthTokens: []string{"test-token"}, AdminTokens: []string{"admin-token"}})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go gw.Run(ctx)
+	require.Eventually(t, func() bool { return gw.server.Addr() != "" }, 2*time.Second, 10*time.Millisecond)
+
+	nodeWS := dialConnected(t, gw, ConnectParams{
+		MinProtocol: 3, MaxProtocol: 3,
+		Client:   ClientInfo{ID: "iphone-test", DisplayName: "Test iPhone", Version: "1.0", Platform: "ios", Mode: "node"},
+		Commands: []string{"location.get"},
+		Auth:     &ConnectAuth{Token: "test-token"},
+	})
+	opWS := dialConnected(t, gw, ConnectParams{
+		MinProtocol: 3, MaxProtocol: 3,
+		Client: ClientInfo{ID: "openclaw-ios", Version: "1.0", Platform: "ios", Mode: "ui"},
+		Role:   "operator",
+		Scopes: []string{ScopeOperatorAdmin},
+		Auth:   &ConnectAuth{Token: "admin-token"},
+	})
+
+	// node.list returns the connected node.
+	listReq, _ := MarshalRequest("op-1", "node.list", nil)
+	require.NoError(t, opWS.WriteMessage(websocket.TextMessage, listReq))
+	res := readResponse(t, opWS, "op-1")
+	require.True(t, res.OK, "node.list failed: %+v", res.Error)
+	var list NodeListResult
+	require.NoError(t, json.Unmarshal(res.Payload, &list))
+	require.Len(t, list.Nodes, 1)
+	assert.Equal(t, "iphone-test", list.Nodes[0].NodeID)
+	assert.Equal(t, "Test iPhone", list.Nodes[0].DisplayName)
+	assert.Equal(t, []string{"location.get"}, list.Nodes[0].Commands)
+
+	// node.invoke round-trips through the node.
+	go func() {
+		_, msg, err := nodeWS.ReadMessage()
+		if err != nil {
+			return
+		}
+		frame, _ := ParseFrame(msg)
+		evt, ok := frame.(*EventFrame)
+		if !ok || evt.Event != "node.invoke.request" {
+			return
+		}
+		var invokeReq NodeInvokeRequest
+		json.Unmarshal(evt.Payload, &invokeReq)
+		resultReq, _ := MarshalRequest("n-1", "node.invoke.result", NodeInvokeResult{
+			ID: invokeReq.ID, NodeID: "iphone-test", OK: true,
+			PayloadJSON: ptrStr(`{"params":` + invokeReq.ParamsJSON + `}`),
+		})
+		nodeWS.WriteMessage(websocket.TextMessage, resultReq)
+	}()
+
+	invokeReq, _ := MarshalRequest("op-2", "node.invoke", NodeInvokeParams{
+		NodeID: "iphone-test", Command: "location.get", ParamsJSON: `{"accuracy":"high"}`, TimeoutMs: 3000,
+	})
+	require.NoError(t, opWS.WriteMessage(websocket.TextMessage, invokeReq))
+	res = readResponse(t, opWS, "op-2")
+	require.True(t, res.OK, "node.invoke failed: %+v", res.Error)
+	var result NodeInvokeResult
+	require.NoError(t, json.Unmarshal(res.Payload, &result))
+	require.NotNil(t, result.PayloadJSON)
+	assert.Contains(t, *result.PayloadJSON, `"accuracy":"high"`)
+}
+
+func TestIntegration_OperatorInvokeByDeviceID(t *testing.T) {
+	gw, err := New(GatewayConfig{Port: 0, AuthTokens: []string{"test-token"}, AdminTokens: []string{"admin-token"}})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go gw.Run(ctx)
+	require.Eventually(t, func() bool { return gw.server.Addr() != "" }, 2*time.Second, 10*time.Millisecond)
+
+	// A device-authenticated node session, answering invokes directly.
+	session := node.NewNodeSession("iphone-1", "conn-dev", "iPhone", "ios", "1.0", []string{"location.get"},
+		func(event string, payload any) error {
+			req := payload.(NodeInvokeRequest)
+			go gw.invoker.HandleResult(NodeInvokeResult{ID: req.ID, NodeID: req.NodeID, OK: true, PayloadJSON: ptrStr(`{"node":"` + req.NodeID + `"}`)})
+			return nil
+		})
+	session.DeviceID = "dev-abc"
+	require.NoError(t, gw.registry.Register(session))
+
+	opWS := dialConnected(t, gw, ConnectParams{
+		MinProtocol: 3, MaxProtocol: 3,
+		Client: ClientInfo{ID: "openclaw-ios", Version: "1.0", Platform: "ios", Mode: "ui"},
+		Role:   "operator",
+		Scopes: []string{ScopeOperatorAdmin},
+		Auth:   &ConnectAuth{Token: "admin-token"},
+	})
+
+	listReq, _ := MarshalRequest("op-1", "node.list", nil)
+	require.NoError(t, opWS.WriteMessage(websocket.TextMessage, listReq))
+	var list NodeListResult
+	require.NoError(t, json.Unmarshal(readResponse(t, opWS, "op-1").Payload, &list))
+	require.Len(t, list.Nodes, 1)
+	assert.Equal(t, "dev-abc", list.Nodes[0].DeviceID)
+
+	invokeReq, _ := MarshalRequest("op-2", "node.invoke", NodeInvokeParams{DeviceID: "dev-abc", Command: "location.get", TimeoutMs: 3000})
+	require.NoError(t, opWS.WriteMessage(websocket.TextMessage, invokeReq))
+	res := readResponse(t, opWS, "op-2")
+	require.True(t, res.OK, "node.invoke failed: %+v", res.Error)
+	var result NodeInvokeResult
+	require.NoError(t, json.Unmarshal(res.Payload, &result))
+	assert.Equal(t, "iphone-1", result.NodeID)
+	assert.Contains(t, *result.PayloadJSON, "iphone-1")
+
+	for id, params := range map[string]NodeInvokeParams{
+		"op-3": {DeviceID: "dev-unknown", Command: "location.get"},
+		"op-4": {DeviceID: "dev-abc", NodeID: "ipad-2", Command: "location.get"},
+	} {
+		req, _ := MarshalRequest(id, "node.invoke", params)
+		require.NoError(t, opWS.WriteMessage(websocket.TextMessage, req))
+		res := readResponse(t, opWS, id)
+		assert.False(t, res.OK, id)
+		require.NotNil(t, res.Error, id)
+		assert.Equal(t, CodeInvokeFailed, res.Error.Code, id)
+	}
+}
+
+func TestIntegration_OperatorInvokeEndsWithOperator(t *testing.T) {
+	gw, err := New(GatewayConfig{Port: 0, AuthTokens: []string{"test-token"}, AdminTokens: []string{"admin-token"}})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go gw.Run(ctx)
+	require.Eventually(t, func() bool { return gw.server.Addr() != "" }, 2*time.Second, 10*time.Millisecond)
+
+	// A node that never answers.
+	sent := make(chan NodeInvokeRequest, 1)
+	require.NoError(t, gw.registry.Register(node.NewNodeSession("iphone-1", "conn-dev", "iPhone", "ios", "1.0", nil,
+		func(event string, payload any) error {
+			sent <- payload.(NodeInvokeRequest)
+			return nil
+		})))
+
+	opWS := dialConnected(t, gw, ConnectParams{
+		MinProtocol: 3, MaxProtocol: 3,
+		Client: ClientInfo{ID: "openclaw-ios", Version: "1.0", Platform: "ios", Mode: "ui"},
+		Role:   "operator",
+		Scopes: []string{ScopeOperatorAdmin},
+		Auth:   &ConnectAuth{Token: "admin-token"},
+	})
+
+	invokeReq, _ := MarshalRequest("op-1", "node.invoke", NodeInvokeParams{NodeID: "iphone-1", Command: "camera.snap", TimeoutMs: 24 * 3600 * 1000})
+	require.NoError(t, opWS.WriteMessage(websocket.TextMessage, invokeReq))
+	select {
+	case <-sent:
+	case <-time.After(2 * time.Second):
+		t.Fatal("invoke never reached the node")
+	}
+	require.Equal(t, 1, gw.invoker.Pending())
+
+	opWS.Close()
+	assert.Eventually(t, func() bool { return gw.invoker.Pending() == 0 }, 2*time.Second, 10*time.Millisecond,
+		"invoke still pending after its operator left")
+}
+
+func TestOperatorInvokeTimeoutMs(t *testing.T) {
+	assert.Equal(t, defaultOperatorInvokeTimeoutMs, operatorInvokeTimeoutMs(0))
+	assert.Equal(t, 3000, operatorInvokeTimeoutMs(3000))
+	assert.Equal(t, maxOperatorInvokeTimeoutMs, operatorInvokeTimeoutMs(24*3600*1000))
+}
+
+func TestIntegration_OperatorRegistryGrantedScopes(t *testing.T) {
+	gw, err := New(GatewayConfig{Port: 0, AuthTokens: []string{"test-token"}})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go gw.Run(ctx)
+	require.Eventually(t, func() bool { return gw.server.Addr() != "" }, 2*time.Second, 10*time.Millisecond)
+
+	// A plain token grants no scopes, whatever the operator asks for.
+	dialConnected(t, gw, ConnectParams{
+		MinProtocol: 3, MaxProtocol: 3,
+		Client: ClientInfo{ID: "console", Version: "1.0", Platform: "macos", Mode: "ui"},
+		Role:   "operator",
+		Scopes: []string{ScopeOperatorAdmin},
+		Auth:   &ConnectAuth{Token: "test-token"},
+	})
+	ops := gw.Operators().List()
+	require.Len(t, ops, 1)
+	assert.Empty(t, ops[0].Scopes)
+	assert.Empty(t, gw.Operators().ListWithScope(ScopeOperatorAdmin))
+}
+
+func TestIntegration_OperatorRegistry(t *testing.T) {
+	gw, err := New(GatewayConfig{Port: 0, AuthTokens: []string{"test-token"}, AdminTokens: []string{"admin-token"}})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go gw.Run(ctx)
+	require.Eventually(t, func() bool { return gw.server.Addr() != "" }, 2*time.Second, 10*time.Millisecond)
+
+	opWS := dialConnected(t, gw, ConnectParams{
+		MinProtocol: 3, MaxProtocol: 3,
+		Client: ClientInfo{ID: "console", DisplayName: "Console", Version: "1.0", Platform: "macos", Mode: "ui"},
+		Role:   "operator",
+		Scopes: []string{ScopeOperatorAdmin},
+		Auth:   &ConnectAuth{Token: "admin-token"},
+	})
+	ops := gw.Operators().List()
+	require.Len(t, ops, 1)
+	assert.Equal(t, "console", ops[0].ClientID)
+	assert.Equal(t, []string{ScopeOperatorAdmin}, ops[0].Scopes)
+
+	// A node is registered as a node only, and its arrival is announced
+	// to admin operators.
+	nodeWS := dialConnected(t, gw, ConnectParams{
+		MinProtocol: 3, MaxProtocol: 3,
+		Client: ClientInfo{ID: "iphone-test", Version: "1.0", Platform: "ios", Mode: "node"},
+		Auth:   &ConnectAuth{Token: "test-token"},
+	})
+	assert.Equal(t, 1, gw.Operators().Len())
+	_, ok := gw.registry.Get("iphone-test")
+	assert.True(t, ok)
+	for _, op := range gw.Operators().List() {
+		assert.NotEqual(t, "iphone-test", op.ClientID)
+	}
+
+	readPresence := func() PresenceEvent {
+		t.Helper()
+		opWS.SetReadDeadline(time.Now().Add(3 * time.Second))
+		defer opWS.SetReadDeadline(time.Time{})
+		for {
+			_, msg, err := opWS.ReadMessage()
+			require.NoError(t, err)
+			frame, _ := ParseFrame(msg)
+			if evt, ok := frame.(*EventFrame); ok && evt.Event == "presence" {
+				var p PresenceEvent
+				require.NoError(t, json.Unmarshal(evt.Payload, &p))
+				return p
+			}
+		}
+	}
+	assert.Equal(t, PresenceEvent{Role: "node", NodeID: "iphone-test", Online: true}, readPresence())
+
+	// A second operator is announced to the first.
+	op2WS := dialConnected(t, gw, ConnectParams{
+		MinProtocol: 3, MaxProtocol: 3,
+		Client: ClientInfo{ID: "console", Version: "1.0", Platform: "ios", Mode: "ui"},
+		Role:   "operator",
+		Auth:   &ConnectAuth{Token: "test-token"},
+	})
+	p := readPresence()
+	assert.Equal(t, "operator", p.Role)
+	assert.True(t, p.Online)
+	assert.Equal(t, 2, gw.Operators().Len())
+
+	// Disconnecting cleans up.
+	op2WS.Close()
+	assert.False(t, readPresence().Online)
+	assert.Equal(t, 1, gw.Operators().Len())
+	nodeWS.Close()
+	assert.Equal(t, PresenceEvent{Role: "node", NodeID: "iphone-test"}, readPresence())
+}
+
+func TestIntegration_OperatorRequestsRequireAdminScope(t *testing.T) {
+	gw, err := New(GatewayConfig{Port: 0, AuthTokens: []string{"test-token"}})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go gw.Run(ctx)
+	require.Eventually(t, func() bool { return gw.server.Addr() != "" }, 2*time.Second, 10*time.Millisecond)
+
+	tests := []struct {
+		name   string
+		role   string
+		scopes []string
+	}{
+		{"operator without scope", "operator", []string{"operator.read"}},
+		{"node with admin scope", "node", []string{ScopeOperatorAdmin}},
+		// The shared token authenticates but grants no scopes.
+		{"token-only operator claiming admin", "operator", []string{ScopeOperatorAdmin}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws := dialConnected(t, gw, ConnectParams{
+				MinProtocol: 3, MaxProtocol: 3,
+				Client: ClientInfo{ID: "client-" + tt.role, Version: "1.0", Platform: "ios", Mode: "ui"},
+				Role:   tt.role,
+				Scopes: tt.scopes,
+				Auth:   &ConnectAuth{Token: "test-token"},
+			})
+			for _, method := range []string{"node.list", "node.invoke", "node.event.subscribe"} {
+				req, _ := MarshalRequest("r-"+method, method, NodeInvokeParams{NodeID: "x", Command: "y"})
+				require.NoError(t, ws.WriteMessage(websocket.TextMessage, req))
+				res := readResponse(t, ws, "r-"+method)
+				assert.False(t, res.OK)
+				require.NotNil(t, res.Error)
+				assert.Equal(t, "FORBIDDEN", res.Error.Code)
+			}
+		})
+	}
+}
+
+func TestIntegration_ConnectionsEndpoint(t *testing.T) {
+	gw, err := New(GatewayConfig{Port: 0, AuthTokens: []string{"test-token"}})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go gw.Run(ctx)
+	require.Eventually(t, func() bool { return gw.server.Addr() != "" }, 2*time.Second, 10*time.Millisecond)
+
+	dialConnected(t, gw, ConnectParams{
+		MinProtocol: 3, MaxProtocol: 3,
+		Client: ClientInfo{ID: "iphone-conn", DisplayName: "iPhone", Version: "1.0", Platform: "ios", Mode: "node"},
+		Auth:   &ConnectAuth{Token: "test-token"},
+	})
+
+	url := "http://" + gw.server.Addr() + "/connections"
+
+	resp, err := http.Get(url)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "token required")
+
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	req.Header.Set("Authorization", "Bearer test-token")
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var body struct {
+		Connections []ConnInfo `json:"connections"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	require.Len(t, body.Connections, 1)
+	c := body.Connections[0]
+	assert.Equal(t, "iphone-conn", c.NodeID)
+	assert.Equal(t, "node", c.Role)
+	assert.Equal(t, StateAuthenticated, c.State)
+	assert.Equal(t, "127.0.0.1", c.RemoteIP)
+	assert.NotEmpty(t, c.ConnID)
+	assert.NotZero(t, c.ConnectedAtMs)
+}
+
+func TestIntegration_ConnectionsEndpointRequiresAdminToken(t *testing.T) {
+	gw, err := New(GatewayConfig{Port: 0, AuthTokens: []string{"test-token"}, AdminTokens: []string{"admin-token"}})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go gw.Run(ctx)
+	require.Eventually(t, func() bool { return gw.server.Addr() != "" }, 2*time.Second, 10*time.Millisecond)
+
+	// Every node holds the gateway token, so it is not enough here.
+	for _, tt := range []struct {
+		token string
+		want  int
+	}{{"test-token", http.StatusUnauthorized}, {"admin-token", http.StatusOK}} {
+		for _, path := range []string{"/connections", "/recent"} {
+			req, _ := http.NewRequest(http.MethodGet, "http://"+gw.server.Addr()+path, nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, tt.want, resp.StatusCode, "%s with %s", path, tt.token)
+		}
+	}
+}
+
+func TestIntegration_RecentEndpoint(t *testing.T) {
+	gw, err := New(GatewayConfig{Port: 0, AuthTokens: []string{"test-token"}})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go gw.Run(ctx)
+	require.Eventually(t, func() bool { return gw.server.Addr() != "" }, 2*time.Second, 10*time.Millisecond)
+
+	ws := dialConnected(t, gw, ConnectParams{
+		MinProtocol: 3, MaxProtocol: 3,
+		Client: ClientInfo{ID: "iphone-recent", Version: "1.0", Platform: "ios", Mode: "node"},
+		Auth:   &ConnectAuth{Token: "test-token"},
+	})
+	ws.Close()
+	require.Eventually(t, func() bool { return len(gw.recent.Events()) == 2 }, 2*time.Second, 10*time.Millisecond)
+
+	url := "http://" + gw.server.Addr() + "/recent"
+	resp, err := http.Get(url)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "token required")
+
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	req.Header.Set("Authorization", "Bearer test-token")
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var body struct {
+		Events []RecentEvent `json:"events"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	require.Len(t, body.Events, 2)
+	assert.Equal(t, "connect", body.Events[0].Kind)
+	assert.Equal(t, "iphone-recent", body.Events[0].NodeID)
+	assert.Equal(t, "node via token auth", body.Events[0].Detail)
+	assert.Equal(t, "disconnect", body.Events[1].Kind)
+	assert.Equal(t, body.Events[0].ConnID, body.Events[1].ConnID)
+}
+
+func TestIntegration_DryRunConnect(t *testing.T) {
+	store, err := pairingPkg.NewStore(t.TempDir())
+	require.NoError(t, err)
+	gw, err := New(GatewayConfig{Port: 0, PairingSvc: pairingPkg.NewService(store)})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go gw.Run(ctx)
+	require.Eventually(t, func() bool { return gw.server.Addr() != "" }, 2*time.Second, 10*time.Millisecond)
+
+	pubKey, privKey, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	dryRun := func(query string, badNonce bool, proto int) DryRunResult {
+		ws, _, err := websocket.DefaultDialer.Dial("ws://"+gw.server.Addr()+"/ws"+query, nil)
+		require.NoError(t, err)
+		defer ws.Close()
+
+		_, msg, err := ws.ReadMessage()
+		require.NoError(t, err)
+		frame, _ := ParseFrame(msg)
+		var challenge struct{ Nonce string }
+		require.NoError(t, json.Unmarshal(frame.(*EventFrame).Payload, &challenge))
+
+		params := ConnectParams{
+			MinProtocol: proto, MaxProtocol: proto,
+			Client: ClientInfo{ID: "iphone-dry", Version: "1.0", Platform: "ios", Mode: "node"},
+			DryRun: query == "",
+		}
+		nonce := challenge.Nonce
+		if badNonce {
+			nonce = "stale-nonce"
+		}
+		params.Device = signDevicePayload(t, privKey, pubKey, nonce, params)
+		connectReq, _ := MarshalRequest("connect-1", "connect", params)
+		require.NoError(t, ws.WriteMessage(websocket.TextMessage, connectReq))
+
+		res := readResponse(t, ws, "connect-1")
+		require.True(t, res.OK, "dry-run response: %+v", res.Error)
+		var result DryRunResult
+		require.NoError(t, json.Unmarshal(res.Payload, &result))
+
+		// The gateway closes the connection after answering.
+		ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, _, err = ws.ReadMessage()
+		assert.Error(t, err)
+		return result
+	}
+
+	result := dryRun("?dryRun=1", false, 3)
+	assert.Equal(t, "dry-run", result.Type)
+	assert.True(t, result.WouldAccept, "checks: %+v", result.Checks)
+	assert.Equal(t, "auto-approve", result.PairingStatus)
+	assert.Equal(t, pairingPkg.DeriveDeviceID(base64Url.EncodeToString(pubKey)), result.DerivedDeviceID)
+	names := make([]string, 0, len(result.Checks))
+	for _, c := range result.Checks {
+		names = append(names, c.Name)
+	}
+	assert.Equal(t, []string{"protocol", "auth", "signature", "nonce", "deviceId", "pairing"}, names)
+
+	// Without a verified device identity, pairing state is not revealed.
+	result = dryRun("", true, 3)
+	assert.False(t, result.WouldAccept)
+	for _, c := range result.Checks {
+		assert.Equal(t, c.Name != "nonce" && c.Name != "pairing", c.OK, "check %s: %+v", c.Name, c)
+	}
+	assert.Empty(t, result.PairingStatus)
+	assert.Empty(t, result.RequestID)
+
+	// Without a negotiated protocol the signed payload is unknown, so the
+	// signature is not checked and pairing is not looked up.
+	result = dryRun("?dryRun=1", false, 99)
+	assert.False(t, result.WouldAccept)
+	for _, c := range result.Checks {
+		switch c.Name {
+		case "signature", "pairing":
+			assert.False(t, c.OK, "check %s: %+v", c.Name, c)
+			assert.Contains(t, c.Detail, "skipped", "check %s", c.Name)
+		case "protocol":
+			assert.False(t, c.OK, "check %s: %+v", c.Name, c)
+		}
+	}
+	assert.Empty(t, result.PairingStatus)
+
+	assert.Empty(t, gw.registry.List(), "dry run must not register a session")
+	assert.Empty(t, store.ListPaired(), "dry run must not pair the device")
+	assert.Empty(t, store.ListPending(), "dry run must not create a pending request")
+}
+
+func TestIntegration_DryRunConnectRequiresAuth(t *testing.T) {
+	gw, err := New(GatewayConfig{Port: 0, AuthTokens: []string{"test-token"}})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go gw.Run(ctx)
+	require.Eventually(t, func() bool { return gw.server.Addr() != "" }, 2*time.Second, 10*time.Millisecond)
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws://"+gw.server.Addr()+"/ws?dryRun=1", nil)
+	require.NoError(t, err)
+	defer ws.Close()
+	_, _, err = ws.ReadMessage() // challenge
+	require.NoError(t, err)
+
+	connectReq, _ := MarshalRequest("connect-1", "connect", ConnectParams{
+		MinProtocol: 3, MaxProtocol: 3,
+		Client: ClientInfo{ID: "probe", Version: "1.0", Platform: "ios", Mode: "node"},
+	})
+	require.NoError(t, ws.WriteMessage(websocket.TextMessage, connectReq))
+	res := readResponse(t, ws, "connect-1")
+	assert.False(t, res.OK)
+	require.NotNil(t, res.Error)
+	assert.Equal(t, CodeUnauthorized, res.Error.Code)
+}
+
+func TestIntegration_Compression(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		t.Run(fmt.Sprintf("enabled=%v", enabled), func(t *testing.T) {
+			gw, err := New(GatewayConfig{Port: 0, AuthTokens: []string{"test-token"}, EnableCompression: enabled})
+			require.NoError(t, err)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go gw.Run(ctx)
+			require.Eventually(t, func() bool { return gw.server.Addr() != "" }, 2*time.Second, 10*time.Millisecond)
+
+			dialer := websocket.Dialer{EnableCompression: true}
+			ws, resp, err := dialer.Dial("ws://"+gw.server.Addr()+"/ws", nil)
+			require.NoError(t, err)
+			defer ws.Close()
+			negotiated := strings.Contains(resp.Header.Get("Sec-Websocket-Extensions"), "permessage-deflate")
+			assert.Equal(t, enabled, negotiated)
+
+			_, _, err = ws.ReadMessage() // challenge
+			require.NoError(t, err)
+			connectReq, _ := MarshalRequest("connect-1", "connect", ConnectParams{
+				MinProtocol: 3, MaxProtocol: 3,
+				Client:   ClientInfo{ID: "iphone-test", Version: "1.0", Platform: "ios", Mode: "node"},
+				Commands: []string{"camera.snap"},
+				Auth:     &ConnectAuth{Token: "test-token"},
+			})
+			require.NoError(t, ws.WriteMessage(websocket.TextMessage, connectReq))
+			res := readResponse(t, ws, "connect-1")
+			require.True(t, res.OK, "handshake failed: %+v", res.Error)
+
+			// A snapshot-sized result survives the (possibly compressed) link.
+			image := strings.Repeat("QUJD", 64<<10)
+			go func() {
+				_, msg, err := ws.ReadMessage()
+				if err != nil {
+					return
+				}
+				frame, _ := ParseFrame(msg)
+				evt, ok := frame.(*EventFrame)
+				if !ok || evt.Event != "node.invoke.request" {
+					return
+				}
+				var invokeReq NodeInvokeRequest
+				json.Unmarshal(evt.Payload, &invokeReq)
+				resultReq, _ := MarshalRequest("n-1", "node.invoke.result", NodeInvokeResult{
+					ID: invokeReq.ID, NodeID: "iphone-test", OK: true,
+					PayloadJSON: ptrStr(`{"base64":"` + image + `"}`),
+				})
+				ws.WriteMessage(websocket.TextMessage, resultReq)
+			}()
+
+			result, err := gw.invoker.Invoke(ctx, InvokeRequest{
+				NodeID: "iphone-test", Command: "camera.snap", TimeoutMs: 5000,
+			})
+			require.NoError(t, err)
+			require.True(t, result.OK)
+			assert.Contains(t, *result.PayloadJSON, image)
+		})
+	}
+}
+
+func TestIntegration_MsgpackEncoding(t *testing.T) {
+	gw, err := New(GatewayConfig{Port: 0, AuthTokens: []string{"test-token"}})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go gw.Run(ctx)
+	require.Eventually(t, func() bool { return gw.server.Addr() != "" }, 2*time.Second, 10*time.Millisecond)
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws://"+gw.server.Addr()+"/ws", nil)
+	require.NoError(t, err)
+	defer ws.Close()
+
+	// The challenge is always JSON; the client has not chosen yet.
+	mt, _, err := ws.ReadMessage()
+	require.NoError(t, err)
+	assert.Equal(t, websocket.TextMessage, mt)
+
+	writeMsgpack := func(frame any) {
+		data, err := Msgpack.Encode(frame)
+		require.NoError(t, err)
+		require.NoError(t, ws.WriteMessage(websocket.BinaryMessage, data))
+	}
+	readMsgpack := func() any {
+		mt, data, err := ws.ReadMessage()
+		require.NoError(t, err)
+		require.Equal(t, websocket.BinaryMessage, mt)
+		frame, err := Msgpack.Decode(data)
+		require.NoError(t, err)
+		return frame
+	}
+
+	connect, _ := NewRequestFrame("connect-1", "connect", ConnectParams{
+		MinProtocol: 3, MaxProtocol: 3,
+		Client:   ClientInfo{ID: "iphone-test", Version: "1.0", Platform: "ios", Mode: "node"},
+		Commands: []string{"location.get"},
+		Auth:     &ConnectAuth{Token: "test-token"},
+		Encoding: "msgpack",
+	})
+	writeMsgpack(connect)
+	res := readMsgpack().(*ResponseFrame)
+	require.True(t, res.OK, "handshake failed: %+v", res.Error)
+
+	go func() {
+		evt, ok := readMsgpack().(*EventFrame)
+		if !ok || evt.Event != "node.invoke.request" {
+			return
+		}
+		var invokeReq NodeInvokeRequest
+		json.Unmarshal(evt.Payload, &invokeReq)
+		result, _ := NewRequestFrame("n-1", "node.invoke.result", NodeInvokeResult{
+			ID: invokeReq.ID, NodeID: "iphone-test", OK: true,
+			PayloadJSON: ptrStr(`{"lat":40.7128}`),
+		})
+		writeMsgpack(result)
+	}()
+
+	result, err := gw.invoker.Invoke(ctx, InvokeRequest{NodeID: "iphone-test", Command: "location.get", TimeoutMs: 5000})
+	require.NoError(t, err)
+	require.True(t, result.OK)
+	assert.Equal(t, `{"lat":40.7128}`, *result.PayloadJSON)
+}
+
+func TestIntegration_UnsupportedEncoding(t *testing.T) {
+	gw, err := New(GatewayConfig{Port: 0, AuthTokens: []string{"test-token"}})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go gw.Run(ctx)
+	require.Eventually(t, func() bool { return gw.server.Addr() != "" }, 2*time.Second, 10*time.Millisecond)
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws://"+gw.server.Addr()+"/ws", nil)
+	require.NoError(t, err)
+	defer ws.Close()
+	_, _, err = ws.ReadMessage() // challenge
+	require.NoError(t, err)
+
+	connectReq, _ := MarshalRequest("connect-1", "connect", ConnectParams{
+		MinProtocol: 3, MaxProtocol: 3,
+		Client:   ClientInfo{ID: "iphone-test", Version: "1.0", Platform: "ios", Mode: "node"},
+		Auth:     &ConnectAuth{Token: "test-token"},
+		Encoding: "cbor",
+	})
+	require.NoError(t, ws.WriteMessage(websocket.TextMessage, connectReq))
+	res := readResponse(t, ws, "connect-1")
+	assert.False(t, res.OK)
+	require.NotNil(t, res.Error)
+	assert.Equal(t, "UNSUPPORTED_ENCODING", res.Error.Code)
+}
+
+func TestIntegration_InvokeResultAckAndStale(t *testing.T) {
+	gw, err := New(GatewayConfig{Port: 0, AuthTokens: []string{"test-token"}})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go gw.Run(ctx)
+	require.Eventually(t, func() bool { return gw.server.Addr() != "" }, 2*time.Second, 10*time.Millisecond)
+
+	ws := dialConnected(t, gw, ConnectParams{
+		MinProtocol: 3, MaxProtocol: 3,
+		Client:   ClientInfo{ID: "iphone-test", Version: "1.0", Platform: "ios", Mode: "node"},
+		Commands: []string{"location.get"},
+		Auth:     &ConnectAuth{Token: "test-token"},
+	})
+	readEvent := func() *EventFrame {
+		t.Helper()
+		ws.SetReadDeadline(time.Now().Add(3 * time.Second))
+		defer ws.SetReadDeadline(time.Time{})
+		_, msg, err := ws.ReadMessage()
+		require.NoError(t, err)
+		frame, _ := ParseFrame(msg)
+		evt, ok := frame.(*EventFrame)
+		require.True(t, ok, "expected an event, got %s", msg)
+		return evt
+	}
+	sendResult := func(id string) {
+		t.Helper()
+		resultReq, _ := MarshalRequest("n-"+id, "node.invoke.result", NodeInvokeResult{ID: id, NodeID: "iphone-test", OK: true})
+		require.NoError(t, ws.WriteMessage(websocket.TextMessage, resultReq))
+	}
+
+	// A result for a live invoke is acked.
+	invoked := make(chan error, 1)
+	go func() {
+		_, err := gw.invoker.Invoke(ctx, InvokeRequest{NodeID: "iphone-test", Command: "location.get", TimeoutMs: 3000})
+		invoked <- err
+	}()
+	evt := readEvent()
+	require.Equal(t, "node.invoke.request", evt.Event)
+	var invokeReq NodeInvokeRequest
+	require.NoError(t, json.Unmarshal(evt.Payload, &invokeReq))
+	sendResult(invokeReq.ID)
+	require.NoError(t, <-invoked)
+
+	evt = readEvent()
+	assert.Equal(t, "node.invoke.ack", evt.Event)
+	var ack NodeInvokeAck
+	require.NoError(t, json.Unmarshal(evt.Payload, &ack))
+	assert.Equal(t, invokeReq.ID, ack.ID)
+	assert.Nil(t, ack.Error)
+
+	// Answering it again, or answering an unknown invoke, is stale.
+	for _, id := range []string{invokeReq.ID, "never-sent"} {
+		sendResult(id)
+		evt = readEvent()
+		assert.Equal(t, "node.invoke.stale", evt.Event)
+		var stale NodeInvokeAck
+		require.NoError(t, json.Unmarshal(evt.Payload, &stale))
+		assert.Equal(t, id, stale.ID)
+		require.NotNil(t, stale.Error)
+		assert.Equal(t, "STALE_RESULT", stale.Error.Code)
+		require.NotNil(t, stale.Error.Retryable)
+		assert.False(t, *stale.Error.Retryable)
+	}
+}
+
+func TestIntegration_InvokeResultFromOtherConn(t *testing.T) {
+	gw, err := New(GatewayConfig{Port: 0, AuthTokens: []string{"test-token"}})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go gw.Run(ctx)
+	require.Eventually(t, func() bool { return gw.server.Addr() != "" }, 2*time.Second, 10*time.Millisecond)
+
+	nodeWS := dialConnected(t, gw, ConnectParams{
+		MinProtocol: 3, MaxProtocol: 3,
+		Client:   ClientInfo{ID: "iphone-test", Version: "1.0", Platform: "ios", Mode: "node"},
+		Commands: []string{"location.get"},
+		Auth:     &ConnectAuth{Token: "test-token"},
+	})
+	opWS := dialConnected(t, gw, ConnectParams{
+		MinProtocol: 3, MaxProtocol: 3,
+		Client: ClientInfo{ID: "openclaw-ios", Version: "1.0", Platform: "ios", Mode: "ui"},
+		Role:   "operator",
+		Auth:   &ConnectAuth{Token: "test-token"},
+	})
+
+	invoked := make(chan InvokeResult, 1)
+	go func() {
+		result, _ := gw.invoker.Invoke(ctx, InvokeRequest{NodeID: "iphone-test", Command: "location.get", TimeoutMs: 3000})
+		invoked <- result
+	}()
+	nodeWS.SetReadDeadline(time.Now().Add(3 * time.Second))
+	_, msg, err := nodeWS.ReadMessage()
+	require.NoError(t, err)
+	frame, _ := ParseFrame(msg)
+	evt, ok := frame.(*EventFrame)
+	require.True(t, ok, "expected an event, got %s", msg)
+	var invokeReq NodeInvokeRequest
+	require.NoError(t, json.Unmarshal(evt.Payload, &invokeReq))
+
+	// The operator cannot answer the node's invoke, even naming the node.
+	forged, _ := MarshalRequest("op-1", "node.invoke.result", NodeInvokeResult{ID: invokeReq.ID, NodeID: "iphone-test", OK: false})
+	require.NoError(t, opWS.WriteMessage(websocket.TextMessage, forged))
+	res := readResponse(t, opWS, "op-1")
+	assert.False(t, res.OK)
+	require.NotNil(t, res.Error)
+	assert.Equal(t, "FORBIDDEN", res.Error.Code)
+
+	// Malformed params are rejected rather than treated as stale.
+	malformed := []byte(`{"type":"req","id":"n-0","method":"node.invoke.result","params":{"id":7}}`)
+	require.NoError(t, nodeWS.WriteMessage(websocket.TextMessage, malformed))
+	res = readResponse(t, nodeWS, "n-0")
+	assert.False(t, res.OK)
+	require.NotNil(t, res.Error)
+	assert.Equal(t, "INVALID_JSON", res.Error.Code)
+
+	resultReq, _ := MarshalRequest("n-1", "node.invoke.result", NodeInvokeResult{ID: invokeReq.ID, NodeID: "iphone-test", OK: true})
+	require.NoError(t, nodeWS.WriteMessage(websocket.TextMessage, resultReq))
+	assert.True(t, (<-invoked).OK)
+}
+
+func TestIntegration_DuplicateNodeIDFromOtherDevice(t *testing.T) {
+	store, err := pairingPkg.NewStore(t.TempDir())
+	require.NoError(t, err)
+	gw, err := New(GatewayConfig{Port: 0, PairingSvc: pairingPkg.NewService(store)})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go gw.Run(ctx)
+	require.Eventually(t, func() bool { return gw.server.Addr() != "" }, 2*time.Second, 10*time.Millisecond)
+
+	// connectAs completes a device-authenticated handshake as node
+	// "iphone-1" with a fresh key and returns the device ID.
+	connectAs := func() (*websocket.Conn, string) {
+		pubKey, privKey, err := ed25519.GenerateKey(nil)
+		require.NoError(t, err)
+		ws, _, err := websocket.DefaultDialer.Dial("ws://"+gw.server.Addr()+"/ws", nil)
+		require.NoError(t, err)
+		t.Cleanup(func() { ws.Close() })
+
+		_, msg, err := ws.ReadMessage()
+		require.NoError(t, err)
+		frame, _ := ParseFrame(msg)
+		var challenge struct{ Nonce string }
+		require.NoError(t, json.Unmarshal(frame.(*EventFrame).Payload, &challenge))
+
+		params := ConnectParams{
+			MinProtocol: 3, MaxProtocol: 3,
+			Client: ClientInfo{ID: "iphone-1", Version: "1.0", Platform: "ios", Mode: "node"},
+		}
+		params.Device = signDevicePayload(t, privKey, pubKey, challenge.Nonce, params)
+		connectReq, _ := MarshalRequest("connect-1", "connect", params)
+		require.NoError(t, ws.WriteMessage(websocket.TextMessage, connectReq))
+		res := readResponse(t, ws, "connect-1")
+		require.True(t, res.OK, "handshake failed: %+v", res.Error)
+		return ws, pairingPkg.DeriveDeviceID(base64Url.EncodeToString(pubKey))
+	}
+
+	ws1, deviceA := connectAs()
+	require.Eventually(t, func() bool { return gw.registry.Len() == 1 }, time.Second, 10*time.Millisecond)
+
+	ws2, _ := connectAs()
+	ws2.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		if _, _, err = ws2.ReadMessage(); err != nil {
+			break
+		}
+	}
+	var closeErr *websocket.CloseError
+	require.True(t, errors.As(err, &closeErr), "want close frame, got %v", err)
+	assert.Equal(t, websocket.ClosePolicyViolation, closeErr.Code)
+	assert.Equal(t, nodeIDConflictReason, closeErr.Text)
+
+	session, ok := gw.registry.Get("iphone-1")
+	require.True(t, ok)
+	assert.Equal(t, deviceA, session.DeviceID, "second device must not evict the first")
+	assert.Equal(t, 1, gw.registry.Len())
+
+	// The first device is still reachable.
+	ws1.SetReadDeadline(time.Now().Add(time.Second))
+	require.NoError(t, session.Send("ping", nil))
+	for {
+		_, msg, err := ws1.ReadMessage()
+		require.NoError(t, err)
+		frame, _ := ParseFrame(msg)
+		if evt, ok := frame.(*EventFrame); ok && evt.Event == "ping" {
+			break
+		}
+	}
+}
+
+func TestIntegration_ChallengeCarriesServerIdentity(t *testing.T) {
+	_, serverKey, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	readChallenge := func(config GatewayConfig) (*Gateway, ConnectChallenge) {
+		gw, err := New(config)
+		require.NoError(t, err)
+		ctx, cancel := context.WithCancel(context.Background())
+		t.Cleanup(cancel)
+		go gw.Run(ctx)
+		require.Eventually(t, func() bool { return gw.server.Addr() != "" }, 2*time.Second, 10*time.Millisecond)
+
+		ws, _, err := websocket.DefaultDialer.Dial("ws://"+gw.server.Addr()+"/ws", nil)
+		require.NoError(t, err)
+		defer ws.Close()
+		_, msg, err := ws.ReadMessage()
+		require.NoError(t, err)
+		frame, _ := ParseFrame(msg)
+		var challenge ConnectChallenge
+		require.NoError(t, json.Unmarshal(frame.(*EventFrame).Payload, &challenge))
+		return gw, challenge
+	}
+
+	gw, challenge := readChallenge(GatewayConfig{Port: 0, Build: BuildInfo{Version: "1.2.3"}, ServerKey: serverKey})
+	assert.Equal(t, "1.2.3", challenge.ServerVersion)
+	assert.Equal(t, ServerProtocol, challenge.Protocol)
+	assert.Equal(t, base64Url.EncodeToString(gw.PublicKey()), challenge.ServerKey, "advertised key should match PublicKey")
+
+	// What a client pinning gw.PublicKey() would check.
+	payload := pairingPkg.BuildChallengePayload(challenge.Nonce, challenge.Ts)
+	assert.True(t, pairingPkg.VerifySignature(challenge.ServerKey, payload, challenge.Signature))
+	assert.False(t, pairingPkg.VerifySignature(challenge.ServerKey, pairingPkg.BuildChallengePayload("other-nonce", challenge.Ts), challenge.Signature))
+	assert.False(t, pairingPkg.VerifySignature(challenge.ServerKey, pairingPkg.BuildChallengePayload(challenge.Nonce, challenge.Ts-60), challenge.Signature),
+		"signature should bind the timestamp")
+
+	gw, challenge = readChallenge(GatewayConfig{Port: 0})
+	assert.Nil(t, gw.PublicKey())
+	assert.Empty(t, challenge.ServerKey)
+	assert.Empty(t, challenge.Signature)
+	assert.NotEmpty(t, challenge.Nonce)
+}
+
+func TestIntegration_HelloSignedOverClientNonce(t *testing.T) {
+	_, serverKey, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	gw, err := New(GatewayConfig{Port: 0, AdminTokens: []string{"admin-token"}, ServerKey: serverKey})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go gw.Run(ctx)
+	require.Eventually(t, func() bool { return gw.server.Addr() != "" }, 2*time.Second, 10*time.Millisecond)
+
+	connect := func(clientNonce string) (ConnectChallenge, *ResponseFrame) {
+		ws, _, err := websocket.DefaultDialer.Dial("ws://"+gw.server.Addr()+"/ws", nil)
+		require.NoError(t, err)
+		defer ws.Close()
+		_, msg, err := ws.ReadMessage()
+		require.NoError(t, err)
+		frame, _ := ParseFrame(msg)
+		var challenge ConnectChallenge
+		require.NoError(t, json.Unmarshal(frame.(*EventFrame).Payload, &challenge))
+
+		req, _ := MarshalRequest("connect-1", "connect", ConnectParams{
+			MinProtocol: 3, MaxProtocol: 3,
+			Client:      ClientInfo{ID: "console", Version: "1.0", Platform: "macos", Mode: "ui"},
+			Role:        "operator",
+			Scopes:      []string{ScopeOperatorAdmin},
+			Auth:        &ConnectAuth{Token: "admin-token"},
+			ClientNonce: clientNonce,
+		})
+		require.NoError(t, ws.WriteMessage(websocket.TextMessage, req))
+		return challenge, readResponse(t, ws, "connect-1")
+	}
+
+	challenge, res := connect("client-nonce-1")
+	require.True(t, res.OK)
+	var hello HelloOk
+	require.NoError(t, json.Unmarshal(res.Payload, &hello))
+	params := pairingPkg.HelloPayloadParams{
+		ClientNonce: "client-nonce-1",
+		Nonce:       challenge.Nonce,
+		ConnID:      hello.Server.ConnID,
+		Role:        "operator",
+		Scopes:      []string{ScopeOperatorAdmin},
+	}
+	assert.True(t, pairingPkg.VerifySignature(challenge.ServerKey, pairingPkg.BuildHelloPayload(params), hello.Signature))
+	params.Scopes = nil
+	assert.False(t, pairingPkg.VerifySignature(challenge.ServerKey, pairingPkg.BuildHelloPayload(params), hello.Signature),
+		"signature should bind the granted scopes")
+
+	// A replayed connect request reuses its client nonce.
+	_, res = connect("client-nonce-1")
+	assert.False(t, res.OK)
+	require.NotNil(t, res.Error)
+	assert.Equal(t, CodeInvalidNonce, res.Error.Code)
+}
+
+func TestIntegration_MaxConnsPerDevice(t *testing.T) {
+	store, err := pairingPkg.NewStore(t.TempDir())
+	require.NoError(t, err)
+	gw, err := New(GatewayConfig{Port: 0, PairingSvc: pairingPkg.NewService(store), MaxConnsPerDevice: 2})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go gw.Run(ctx)
+	require.Eventually(t, func() bool { return gw.server.Addr() != "" }, 2*time.Second, 10*time.Millisecond)
+
+	// Every connection presents the same device key under its own node ID.
+	pubKey, privKey, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	connect := func(nodeID string) *websocket.Conn {
+		ws, _, err := websocket.DefaultDialer.Dial("ws://"+gw.server.Addr()+"/ws", nil)
+		require.NoError(t, err)
+		t.Cleanup(func() { ws.Close() })
+
+		_, msg, err := ws.ReadMessage()
+		require.NoError(t, err)
+		frame, _ := ParseFrame(msg)
+		var challenge struct{ Nonce string }
+		require.NoError(t, json.Unmarshal(frame.(*EventFrame).Payload, &challenge))
+
+		params := ConnectParams{
+			MinProtocol: 3, MaxProtocol: 3,
+			Client: ClientInfo{ID: nodeID, Version: "1.0", Platform: "ios", Mode: "node"},
+		}
+		params.Device = signDevicePayload(t, privKey, pubKey, challenge.Nonce, params)
+		connectReq, _ := MarshalRequest("connect-1", "connect", params)
+		require.NoError(t, ws.WriteMessage(websocket.TextMessage, connectReq))
+		res := readResponse(t, ws, "connect-1")
+		require.True(t, res.OK, "handshake failed: %+v", res.Error)
+		return ws
+	}
+
+	connect("node-1")
+	connect("node-2")
+	require.Eventually(t, func() bool { return gw.registry.Len() == 2 }, time.Second, 10*time.Millisecond)
+
+	ws3 := connect("node-3")
+	ws3.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		if _, _, err = ws3.ReadMessage(); err != nil {
+			break
+		}
+	}
+	var closeErr *websocket.CloseError
+	require.True(t, errors.As(err, &closeErr), "want close frame, got %v", err)
+	assert.Equal(t, websocket.ClosePolicyViolation, closeErr.Code)
+	assert.Equal(t, tooManyConnsReason, closeErr.Text)
+
+	_, ok := gw.registry.Get("node-3")
+	assert.False(t, ok)
+	assert.Equal(t, 2, gw.registry.Len())
+}
+
+func TestIntegration_RequestDispatch(t *testing.T) {
+	gw, err := New(GatewayConfig{Port: 0, AuthTokens: []string{"test-token"}})
+	require.NoError(t, err)
+	called := make(chan string, 1)
+	gw.Handle("test.echo", func(conn *Conn, req *RequestFrame) error {
+		called <- req.ID
+		return conn.SendResponse(req.ID, true, map[string]string{"echo": "ok"}, nil)
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go gw.Run(ctx)
+	require.Eventually(t, func() bool { return gw.server.Addr() != "" }, 2*time.Second, 10*time.Millisecond)
+
+	ws := dialConnected(t, gw, ConnectParams{
+		MinProtocol: 3, MaxProtocol: 3,
+		Client: ClientInfo{ID: "iphone-test", Version: "1.0", Platform: "ios", Mode: "node"},
+		Auth:   &ConnectAuth{Token: "test-token"},
+	})
+
+	req, _ := MarshalRequest("req-1", "test.echo", nil)
+	require.NoError(t, ws.WriteMessage(websocket.TextMessage, req))
+	res := readResponse(t, ws, "req-1")
+	assert.True(t, res.OK)
+	assert.Equal(t, "req-1", <-called)
+
+	// An unknown event is a notification and gets no reply, so the next
+	// frame is the error for the unknown request that follows it.
+	evt, _ := json.Marshal(EventFrame{Type: FrameTypeEvent, Event: "no.such.event"})
+	require.NoError(t, ws.WriteMessage(websocket.TextMessage, evt))
+	req, _ = MarshalRequest("req-2", "no.such.method", nil)
+	require.NoError(t, ws.WriteMessage(websocket.TextMessage, req))
+	ws.SetReadDeadline(time.Now().Add(3 * time.Second))
+	_, msg, err := ws.ReadMessage()
+	require.NoError(t, err)
+	frame, _ := ParseFrame(msg)
+	res, ok := frame.(*ResponseFrame)
+	require.True(t, ok, "want a response frame, got %s", msg)
+	assert.Equal(t, "req-2", res.ID)
+	assert.False(t, res.OK)
+	require.NotNil(t, res.Error)
+	assert.Equal(t, "UNKNOWN_METHOD", res.Error.Code)
+	assert.Contains(t, res.Error.Message, "no.such.method")
+}
+
+func TestIntegration_NodeEventSubscription(t *testing.T) {
+	gw, err := New(GatewayConfig{Port: 0, AuthTokens: []string{"test-token"}, AdminTokens: []string{"admin-token"}})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go gw.Run(ctx)
+	require.Eventually(t, func() bool { return gw.server.Addr() != "" }, 2*time.Second, 10*time.Millisecond)
+
+	nodeWS := dialConnected(t, gw, ConnectParams{
+		MinProtocol: 3, MaxProtocol: 3,
+		Client: ClientInfo{ID: "iphone-test", Version: "1.0", Platform: "ios", Mode: "node"},
+		Auth:   &ConnectAuth{Token: "test-token"},
+	})
+	dialOperator := func(id string) *websocket.Conn {
+		return dialConnected(t, gw, ConnectParams{
+			MinProtocol: 3, MaxProtocol: 3,
+			Client: ClientInfo{ID: id, Version: "1.0", Platform: "macos", Mode: "ui"},
+			Role:   "operator",
+			Scopes: []string{ScopeOperatorAdmin},
+			Auth:   &ConnectAuth{Token: "admin-token"},
+		})
+	}
+	subscribed, other := dialOperator("op-sub"), dialOperator("op-other")
+
+	request := func(ws *websocket.Conn, id, method string, params any) *ResponseFrame {
+		t.Helper()
+		req, _ := MarshalRequest(id, method, params)
+		require.NoError(t, ws.WriteMessage(websocket.TextMessage, req))
+		return readResponse(t, ws, id)
+	}
+	// nodeEvents pings ws and returns the node events that arrived first.
+	nodeEvents := func(ws *websocket.Conn, id string) []NodeEvent {
+		t.Helper()
+		req, _ := MarshalRequest(id, "node.list", nil)
+		require.NoError(t, ws.WriteMessage(websocket.TextMessage, req))
+		ws.SetReadDeadline(time.Now().Add(3 * time.Second))
+		defer ws.SetReadDeadline(time.Time{})
+		var events []NodeEvent
+		for {
+			_, msg, err := ws.ReadMessage()
+			require.NoError(t, err)
+			switch frame, _ := ParseFrame(msg); f := frame.(type) {
+			case *EventFrame:
+				if f.Event == "node.event" {
+					var evt NodeEvent
+					require.NoError(t, json.Unmarshal(f.Payload, &evt))
+					events = append(events, evt)
+				}
+			case *ResponseFrame:
+				if f.ID == id {
+					return events
+				}
+			}
+		}
+	}
+
+	res := request(subscribed, "sub-1", "node.event.subscribe", NodeEventSubscribeParams{NodeID: "iphone-test"})
+	require.True(t, res.OK, "subscribe failed: %+v", res.Error)
+
+	payload := `{"level":0.05}`
+	res = request(nodeWS, "evt-1", "node.event", NodeEventParams{Event: "battery.low", PayloadJSON: &payload})
+	require.True(t, res.OK, "node.event failed: %+v", res.Error)
+
+	events := nodeEvents(subscribed, "ping-1")
+	require.Len(t, events, 1)
+	assert.Equal(t, "iphone-test", events[0].NodeID)
+	assert.Equal(t, "battery.low", events[0].Event)
+	require.NotNil(t, events[0].PayloadJSON)
+	assert.JSONEq(t, payload, *events[0].PayloadJSON)
+	assert.Empty(t, nodeEvents(other, "ping-2"))
+
+	// After unsubscribing, further events are not relayed.
+	res = request(subscribed, "sub-2", "node.event.unsubscribe", NodeEventSubscribeParams{NodeID: "iphone-test"})
+	require.True(t, res.OK)
+	res = request(nodeWS, "evt-2", "node.event", NodeEventParams{Event: "battery.low"})
+	require.True(t, res.OK)
+	assert.Empty(t, nodeEvents(subscribed, "ping-3"))
+
+	// Only operators may subscribe.
+	res = request(nodeWS, "sub-3", "node.event.subscribe", nil)
+	assert.False(t, res.OK)
+	assert.Equal(t, "FORBIDDEN", res.Error.Code)
+}
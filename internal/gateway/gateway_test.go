@@ -0,0 +1,98 @@
+package gateway
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/rvald/goclaw/internal/protocol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestServerFeatures_MatchHandlers keeps the advertised methods in step
+// with the handlers the gateway registers.
+func TestServerFeatures_MatchHandlers(t *testing.T) {
+	gw, err := New(GatewayConfig{Port: 0})
+	require.NoError(t, err)
+	require.NotEmpty(t, gw.handlers, "no request handlers registered")
+
+	features := protocol.ServerFeatures()
+	for m := range gw.handlers {
+		assert.Contains(t, features.Methods, m, "%q is handled but not advertised", m)
+	}
+	for _, m := range features.Methods {
+		if m == "connect" {
+			continue
+		}
+		assert.Contains(t, gw.handlers, m, "%q is advertised but not handled", m)
+	}
+}
+
+// eventArg maps the functions that send an event to the position of the
+// event name among their arguments.
+var eventArg = map[string]int{
+	"SendEvent":          0,
+	"Send":               0,
+	"broadcast":          0,
+	"broadcastOperators": 1,
+}
+
+// emittedEvents returns the event names passed as string literals to the
+// event-sending functions in the non-test Go files of dirs.
+func emittedEvents(t *testing.T, dirs ...string) map[string]bool {
+	t.Helper()
+	events := make(map[string]bool)
+	fset := token.NewFileSet()
+	for _, dir := range dirs {
+		files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+		require.NoError(t, err)
+		for _, path := range files {
+			if strings.HasSuffix(path, "_test.go") {
+				continue
+			}
+			f, err := parser.ParseFile(fset, path, nil, 0)
+			require.NoError(t, err)
+			ast.Inspect(f, func(n ast.Node) bool {
+				call, ok := n.(*ast.CallExpr)
+				if !ok {
+					return true
+				}
+				sel, ok := call.Fun.(*ast.SelectorExpr)
+				if !ok {
+					return true
+				}
+				i, ok := eventArg[sel.Sel.Name]
+				if !ok || i >= len(call.Args) {
+					return true
+				}
+				if lit, ok := call.Args[i].(*ast.BasicLit); ok && lit.Kind == token.STRING {
+					name, err := strconv.Unquote(lit.Value)
+					require.NoError(t, err)
+					events[name] = true
+				}
+				return true
+			})
+		}
+	}
+	return events
+}
+
+// TestServerFeatures_MatchEmitters keeps the advertised events in step
+// with the events the gateway and its node sessions send.
+func TestServerFeatures_MatchEmitters(t *testing.T) {
+	emitted := emittedEvents(t, ".", filepath.Join("..", "node"))
+	require.NotEmpty(t, emitted, "no event emitters found")
+
+	features := protocol.ServerFeatures()
+	for e := range emitted {
+		assert.Contains(t, features.Events, e, "%q is emitted but not advertised", e)
+	}
+	for _, e := range features.Events {
+		assert.Contains(t, emitted, e, "%q is advertised but never emitted", e)
+	}
+}
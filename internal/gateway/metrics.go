@@ -1,66 +1,174 @@
 package gateway
 
 import (
-	"log"
+	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rvald/goclaw/internal/node"
 )
 
-var (
+// Metrics holds one gateway's Prometheus collectors. Each gateway creates
+// its own in New and registers them with its registry, so gateways in one
+// process never share counts.
+type Metrics struct {
 	// ConnectedClients tracks the number of currently connected WebSocket clients.
-	ConnectedClients = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "goclaw_connected_clients",
-		Help: "The number of currently connected WebSocket clients",
-	})
-
-	// MessagesTotal tracks the total number of messages sent and received.
-	MessagesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
-		Name: "goclaw_messages_total",
-		Help: "The total number of messages sent and received",
-	}, []string{"direction"}) // "in", "out"
+	ConnectedClients prometheus.Gauge
 
 	// ErrorsTotal tracks the total number of errors encountered.
-	ErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
-		Name: "goclaw_errors_total",
-		Help: "The total number of errors encountered",
-	}, []string{"type"}) // "auth", "protocol", "internal"
-)
+	ErrorsTotal *prometheus.CounterVec // "auth", "protocol", "internal"
+
+	// PendingInvokes tracks invokes sent to nodes and awaiting a result.
+	PendingInvokes prometheus.Gauge
+
+	// InvokeDuration tracks how long nodes take to answer invokes.
+	InvokeDuration *prometheus.HistogramVec
+
+	// InvokesTotal counts invokes that reached their node, by command
+	// ("other" for commands outside metricCommands) and outcome ("ok",
+	// "error", "timeout", "disconnected", "canceled").
+	InvokesTotal *prometheus.CounterVec
+
+	// InvokeLateResults counts results that arrived after their invoke
+	// timed out or was cancelled.
+	InvokeLateResults prometheus.Counter
+
+	// ConnectionsTotal counts authenticated connections by auth method
+	// ("none", "token") and role ("node", "operator").
+	ConnectionsTotal *prometheus.CounterVec
+
+	// ConnectionDuration tracks how long authenticated connections last.
+	ConnectionDuration *prometheus.HistogramVec
 
-// MetricsHandler returns the HTTP handler for Prometheus metrics.
-func MetricsHandler() http.Handler {
-	return promhttp.Handler()
+	// RegisteredNodes tracks the node sessions in the registry.
+	RegisteredNodes prometheus.Gauge
 }
 
-// IncConnectedClients increments the connected clients gauge.
-func IncConnectedClients() {
-	ConnectedClients.Inc()
+// NewMetrics creates a set of unregistered gateway collectors.
+func NewMetrics() *Metrics {
+	return &Metrics{
+		ConnectedClients: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "goclaw_connected_clients",
+			Help: "The number of currently connected WebSocket clients",
+		}),
+		ErrorsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "goclaw_errors_total",
+			Help: "The total number of errors encountered",
+		}, []string{"type"}),
+		PendingInvokes: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "goclaw_pending_invokes",
+			Help: "The number of node invokes awaiting a result",
+		}),
+		InvokeDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "goclaw_invoke_duration_seconds",
+			Help:    "Time from sending a node invoke to receiving its result",
+			Buckets: []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+		}, []string{"command"}),
+		InvokesTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "goclaw_invokes_total",
+			Help: "The total number of node invokes sent, by command and outcome",
+		}, []string{"command", "outcome"}),
+		InvokeLateResults: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "goclaw_invoke_late_results_total",
+			Help: "The total number of node invoke results received after the invoke stopped waiting",
+		}),
+		ConnectionsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "goclaw_connections_total",
+			Help: "The total number of authenticated connections",
+		}, []string{"auth_method", "role"}),
+		ConnectionDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "goclaw_connection_duration_seconds",
+			Help:    "Time from connecting to disconnecting, for authenticated connections",
+			Buckets: []float64{1, 10, 60, 300, 900, 3600, 4 * 3600, 12 * 3600, 24 * 3600},
+		}, []string{"auth_method", "role"}),
+		RegisteredNodes: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "goclaw_registered_nodes",
+			Help: "The number of nodes currently registered",
+		}),
+	}
 }
 
-// DecConnectedClients decrements the connected clients gauge.
-func DecConnectedClients() {
-	ConnectedClients.Dec()
+// Register registers m's collectors with reg. It fails if reg already
+// holds metrics of the same names, e.g. another gateway's.
+func (m *Metrics) Register(reg prometheus.Registerer) error {
+	for _, c := range []prometheus.Collector{
+		m.ConnectedClients, m.ErrorsTotal,
+		m.PendingInvokes, m.InvokeDuration, m.InvokesTotal, m.InvokeLateResults,
+		m.ConnectionsTotal, m.ConnectionDuration, m.RegisteredNodes,
+	} {
+		if err := reg.Register(c); err != nil {
+			return fmt.Errorf("register metrics: %w", err)
+		}
+	}
+	return nil
 }
 
-// IncMessageIn increments the incoming message counter.
-func IncMessageIn() {
-	MessagesTotal.WithLabelValues("in").Inc()
+// incError increments the error counter for errType. m may be nil, as it
+// is for a Server or Conn built without a gateway.
+func (m *Metrics) incError(errType string) {
+	if m != nil {
+		m.ErrorsTotal.WithLabelValues(errType).Inc()
+	}
 }
 
-// IncMessageOut increments the outgoing message counter.
-func IncMessageOut() {
-	MessagesTotal.WithLabelValues("out").Inc()
+// addConnectedClients adjusts the connected clients gauge by delta. m may
+// be nil.
+func (m *Metrics) addConnectedClients(delta float64) {
+	if m != nil {
+		m.ConnectedClients.Add(delta)
+	}
 }
 
-// IncError increments the error counter for the given type.
-func IncError(errType string) {
-	ErrorsTotal.WithLabelValues(errType).Inc()
+// metricCommands are the node commands given their own label on the
+// invoke metrics. Any other command is counted as "other", so a caller
+// cannot grow the label set without bound.
+var metricCommands = map[string]bool{
+	"camera.snap":   true,
+	"media.record":  true,
+	"location.get":  true,
+	"device.status": true,
+	"device.info":   true,
+	"system.notify": true,
+	"clipboard.get": true,
+	"clipboard.set": true,
 }
 
-func init() {
-	// Optional: Unregister default Go/Process metrics if we want a cleaner output,
-	// but keeping them is standard practice.
-	log.Println("Metrics initialized")
+// commandLabel returns the metric label for command.
+func commandLabel(command string) string {
+	if metricCommands[command] {
+		return command
+	}
+	return "other"
+}
+
+// metricsObserver exports the invoker's measurements to a gateway's
+// Metrics and records answered invokes in the recent-events log.
+type metricsObserver struct {
+	metrics *Metrics
+	recent  *RecentLog
+}
+
+func (o metricsObserver) ObserveInvoke(command, outcome string, took time.Duration) {
+	label := commandLabel(command)
+	o.metrics.InvokesTotal.WithLabelValues(label, outcome).Inc()
+	if outcome != node.OutcomeOK && outcome != node.OutcomeError {
+		return
+	}
+	o.metrics.InvokeDuration.WithLabelValues(label).Observe(took.Seconds())
+	o.recent.Add(RecentEvent{Kind: "invoke", Detail: fmt.Sprintf("%s answered in %s", command, took.Round(time.Millisecond))})
+}
+
+func (o metricsObserver) ObservePending(n int) { o.metrics.PendingInvokes.Set(float64(n)) }
+
+func (o metricsObserver) ObserveLateResult() { o.metrics.InvokeLateResults.Inc() }
+
+// MetricsHandler returns the HTTP handler serving the metrics in reg, or
+// in the default Prometheus registry when reg is nil.
+func MetricsHandler(reg *prometheus.Registry) http.Handler {
+	if reg == nil {
+		return promhttp.Handler()
+	}
+	return promhttp.HandlerFor(reg, promhttp.HandlerOpts{Registry: reg})
 }
@@ -2,10 +2,16 @@ package gateway
 
 import (
 	"context"
+	"io"
 	"net/http"
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/rvald/goclaw/internal/node"
+	. "github.com/rvald/goclaw/internal/protocol"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -30,3 +36,204 @@ func TestServer_MetricsEndpoint(t *testing.T) {
 	// Should be 200 OK (Will fail initially as it returns 404)
 	assert.Equal(t, http.StatusOK, resp.StatusCode, "metrics endpoint should return 200 OK")
 }
+
+func TestMetrics_RegisteredNodesGauge(t *testing.T) {
+	gw, err := New(GatewayConfig{Port: 0})
+	require.NoError(t, err)
+	send := func(string, any) error { return nil }
+
+	gw.registry.Register(node.NewNodeSession("iphone-1", "conn-1", "", "ios", "1.0", nil, send))
+	assert.Equal(t, float64(1), testutil.ToFloat64(gw.metrics.RegisteredNodes))
+	gw.registry.Register(node.NewNodeSession("iphone-2", "conn-2", "", "ios", "1.0", nil, send))
+	assert.Equal(t, float64(2), testutil.ToFloat64(gw.metrics.RegisteredNodes))
+
+	// A reconnect replaces the session without growing the count.
+	gw.registry.Register(node.NewNodeSession("iphone-1", "conn-3", "", "ios", "1.0", nil, send))
+	assert.Equal(t, float64(2), testutil.ToFloat64(gw.metrics.RegisteredNodes))
+
+	gw.registry.Unregister("conn-3")
+	assert.Equal(t, float64(1), testutil.ToFloat64(gw.metrics.RegisteredNodes))
+	gw.registry.Unregister("conn-2")
+	assert.Equal(t, float64(0), testutil.ToFloat64(gw.metrics.RegisteredNodes))
+}
+
+func TestMetrics_PendingInvokesGauge(t *testing.T) {
+	gw, err := New(GatewayConfig{Port: 0})
+	require.NoError(t, err)
+	sent := make(chan NodeInvokeRequest, 1)
+	gw.registry.Register(node.NewNodeSession("iphone-1", "conn-1", "", "ios", "1.0", nil, func(_ string, payload any) error {
+		sent <- payload.(NodeInvokeRequest)
+		return nil
+	}))
+
+	done := make(chan struct{})
+	go func() {
+		gw.invoker.Invoke(context.Background(), InvokeRequest{NodeID: "iphone-1", Command: "location.get", TimeoutMs: 5000})
+		close(done)
+	}()
+	req := <-sent
+	assert.Equal(t, float64(1), testutil.ToFloat64(gw.metrics.PendingInvokes))
+
+	gw.invoker.HandleResult(NodeInvokeResult{ID: req.ID, NodeID: "iphone-1", OK: true})
+	<-done
+	assert.Equal(t, float64(0), testutil.ToFloat64(gw.metrics.PendingInvokes))
+}
+
+func TestMetrics_InvokesByOutcome(t *testing.T) {
+	gw, err := New(GatewayConfig{Port: 0})
+	require.NoError(t, err)
+	gw.registry.Register(node.NewNodeSession("iphone-1", "conn-1", "", "ios", "1.0", nil, func(_ string, payload any) error {
+		req := payload.(NodeInvokeRequest)
+		if req.Command == "camera.snap" {
+			go gw.invoker.HandleResult(NodeInvokeResult{ID: req.ID, NodeID: "iphone-1", OK: true})
+		}
+		return nil
+	}))
+
+	ok := gw.metrics.InvokesTotal.WithLabelValues("camera.snap", node.OutcomeOK)
+	timedOut := gw.metrics.InvokesTotal.WithLabelValues("location.get", node.OutcomeTimeout)
+
+	gw.invoker.Invoke(context.Background(), InvokeRequest{NodeID: "iphone-1", Command: "camera.snap", TimeoutMs: 1000})
+	gw.invoker.Invoke(context.Background(), InvokeRequest{NodeID: "iphone-1", Command: "location.get", TimeoutMs: 10})
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(ok))
+	assert.Equal(t, float64(1), testutil.ToFloat64(timedOut))
+}
+
+func TestMetrics_UnknownCommandsShareALabel(t *testing.T) {
+	gw, err := New(GatewayConfig{Port: 0})
+	require.NoError(t, err)
+	gw.registry.Register(node.NewNodeSession("iphone-1", "conn-1", "", "ios", "1.0", nil, func(_ string, payload any) error {
+		req := payload.(NodeInvokeRequest)
+		go gw.invoker.HandleResult(NodeInvokeResult{ID: req.ID, NodeID: "iphone-1", OK: true})
+		return nil
+	}))
+
+	for _, command := range []string{"custom.one", "custom.two"} {
+		gw.invoker.Invoke(context.Background(), InvokeRequest{NodeID: "iphone-1", Command: command, TimeoutMs: 1000})
+	}
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(gw.metrics.InvokesTotal.WithLabelValues("other", node.OutcomeOK)))
+	assert.Equal(t, 1, testutil.CollectAndCount(gw.metrics.InvokesTotal))
+}
+
+// TestNew_TwoGateways builds gateways side by side, as tests and embedders
+// do: each counts only its own invokes.
+func TestNew_TwoGateways(t *testing.T) {
+	var gws []*Gateway
+	for range 2 {
+		gw, err := New(GatewayConfig{Port: 0})
+		require.NoError(t, err)
+		gws = append(gws, gw)
+	}
+	gw := gws[0]
+	sent := make(chan NodeInvokeRequest, 1)
+	gw.registry.Register(node.NewNodeSession("iphone-1", "conn-1", "", "ios", "1.0", nil, func(_ string, payload any) error {
+		sent <- payload.(NodeInvokeRequest)
+		return nil
+	}))
+
+	done := make(chan struct{})
+	go func() {
+		gw.invoker.Invoke(context.Background(), InvokeRequest{NodeID: "iphone-1", Command: "location.get", TimeoutMs: 5000})
+		close(done)
+	}()
+	req := <-sent
+	assert.Equal(t, float64(1), testutil.ToFloat64(gws[0].metrics.PendingInvokes))
+	assert.Equal(t, float64(0), testutil.ToFloat64(gws[1].metrics.PendingInvokes))
+	assert.Equal(t, float64(1), testutil.ToFloat64(gws[0].metrics.RegisteredNodes))
+	assert.Equal(t, float64(0), testutil.ToFloat64(gws[1].metrics.RegisteredNodes))
+
+	gw.invoker.HandleResult(NodeInvokeResult{ID: req.ID, NodeID: "iphone-1", OK: true})
+	<-done
+	assert.Equal(t, 1, testutil.CollectAndCount(gws[0].metrics.InvokesTotal))
+	assert.Equal(t, float64(1), testutil.ToFloat64(gws[0].metrics.InvokesTotal.WithLabelValues("location.get", node.OutcomeOK)))
+	assert.Equal(t, 0, testutil.CollectAndCount(gws[1].metrics.InvokesTotal))
+}
+
+func TestNew_DefaultMetricsRegistry(t *testing.T) {
+	// Each gateway gets a registry of its own, so building two succeeds.
+	_, err := New(GatewayConfig{Port: 0})
+	require.NoError(t, err)
+	gw, err := New(GatewayConfig{Port: 0})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = gw.server.ListenAndServe(ctx) }()
+	require.Eventually(t, func() bool { return gw.server.Addr() != "" }, 2*time.Second, 10*time.Millisecond)
+
+	resp, err := http.Get("http://" + gw.server.Addr() + "/metrics")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), "goclaw_registered_nodes")
+	assert.Contains(t, string(body), "go_goroutines")
+}
+
+func TestMetrics_Register(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	require.NoError(t, NewMetrics().Register(reg))
+	// The names are taken: a second set of metrics cannot share reg.
+	assert.Error(t, NewMetrics().Register(reg))
+}
+
+func TestNew_MetricsRegistry(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	gw, err := New(GatewayConfig{Port: 0, Metrics: reg})
+	require.NoError(t, err)
+	_, err = New(GatewayConfig{Port: 0, Metrics: reg})
+	assert.Error(t, err, "a registry holds one gateway's metrics")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = gw.server.ListenAndServe(ctx) }()
+	require.Eventually(t, func() bool { return gw.server.Addr() != "" }, 2*time.Second, 10*time.Millisecond)
+
+	resp, err := http.Get("http://" + gw.server.Addr() + "/metrics")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), "goclaw_registered_nodes")
+	// Only the gateway metrics: the custom registry has no Go runtime collector.
+	assert.NotContains(t, string(body), "go_goroutines")
+}
+
+func TestMetrics_ConnectionsByAuthMethodAndRole(t *testing.T) {
+	gw, err := New(GatewayConfig{Port: 0, AuthTokens: []string{"test-token"}})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go gw.Run(ctx)
+	require.Eventually(t, func() bool { return gw.server.Addr() != "" }, 2*time.Second, 10*time.Millisecond)
+
+	nodes := gw.metrics.ConnectionsTotal.WithLabelValues("token", "node")
+	operators := gw.metrics.ConnectionsTotal.WithLabelValues("token", "operator")
+
+	ws := dialConnected(t, gw, ConnectParams{
+		MinProtocol: 3, MaxProtocol: 3,
+		Client: ClientInfo{ID: "iphone-metrics", Version: "1.0", Platform: "ios", Mode: "node"},
+		Auth:   &ConnectAuth{Token: "test-token"},
+	})
+	assert.Equal(t, float64(1), testutil.ToFloat64(nodes))
+	assert.Equal(t, float64(0), testutil.ToFloat64(operators))
+
+	// The duration is observed once the connection goes away.
+	ws.Close()
+	require.Eventually(t, func() bool {
+		return durationCount(t, gw.metrics, "token", "node") == 1
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+// durationCount returns how many connection durations have been observed
+// for the given labels.
+func durationCount(t *testing.T, metrics *Metrics, authMethod, role string) uint64 {
+	t.Helper()
+	var m dto.Metric
+	require.NoError(t, metrics.ConnectionDuration.WithLabelValues(authMethod, role).(prometheus.Histogram).Write(&m))
+	return m.GetHistogram().GetSampleCount()
+}
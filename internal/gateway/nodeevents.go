@@ -0,0 +1,94 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/rvald/goclaw/internal/protocol"
+)
+
+// handleNodeEvent relays an unsolicited event from a node to the operators
+// subscribed to it.
+func (gw *Gateway) handleNodeEvent(conn *Conn, req *protocol.RequestFrame) error {
+	if conn.ConnectParams == nil || (conn.ConnectParams.Role != "" && conn.ConnectParams.Role != "node") {
+		conn.sendError(req.ID, protocol.CodeForbidden, "node.event requires role node")
+		return nil
+	}
+	var params protocol.NodeEventParams
+	if req.Params != nil {
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			conn.sendError(req.ID, protocol.CodeInvalidJSON, fmt.Sprintf("invalid node.event params: %v", err))
+			return nil
+		}
+	}
+	if params.Event == "" {
+		conn.sendError(req.ID, protocol.CodeMissingField, "node.event requires event")
+		return nil
+	}
+
+	evt := protocol.NodeEvent{
+		NodeID:      conn.ConnectParams.Client.ID,
+		Event:       params.Event,
+		PayloadJSON: params.PayloadJSON,
+	}
+	for _, op := range gw.subscribers(evt.NodeID) {
+		op.SendEvent("node.event", evt)
+	}
+	conn.log.Debug("node event", "event", params.Event)
+	return conn.SendResponse(req.ID, true, nil, nil)
+}
+
+// handleNodeEventSubscribe starts relaying a node's events, or every
+// node's when no node ID is given, to an operator.
+func (gw *Gateway) handleNodeEventSubscribe(conn *Conn, req *protocol.RequestFrame) error {
+	return gw.updateSubscription(conn, req, true)
+}
+
+// handleNodeEventUnsubscribe undoes a matching node.event.subscribe.
+func (gw *Gateway) handleNodeEventUnsubscribe(conn *Conn, req *protocol.RequestFrame) error {
+	return gw.updateSubscription(conn, req, false)
+}
+
+func (gw *Gateway) updateSubscription(conn *Conn, req *protocol.RequestFrame, subscribe bool) error {
+	if !isOperatorAdmin(conn) {
+		return gw.forbid(conn, req)
+	}
+	var params protocol.NodeEventSubscribeParams
+	if req.Params != nil {
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			conn.sendError(req.ID, protocol.CodeInvalidJSON, fmt.Sprintf("invalid %s params: %v", req.Method, err))
+			return nil
+		}
+	}
+
+	gw.connsMu.Lock()
+	nodes := gw.subs[conn]
+	if subscribe {
+		if nodes == nil {
+			nodes = make(map[string]bool)
+			gw.subs[conn] = nodes
+		}
+		nodes[params.NodeID] = true
+	} else {
+		delete(nodes, params.NodeID)
+		if len(nodes) == 0 {
+			delete(gw.subs, conn)
+		}
+	}
+	gw.connsMu.Unlock()
+
+	return conn.SendResponse(req.ID, true, nil, nil)
+}
+
+// subscribers returns the operator conns subscribed to nodeID's events.
+func (gw *Gateway) subscribers(nodeID string) []*Conn {
+	gw.connsMu.Lock()
+	defer gw.connsMu.Unlock()
+	var conns []*Conn
+	for c, nodes := range gw.subs {
+		if nodes[nodeID] || nodes[""] {
+			conns = append(conns, c)
+		}
+	}
+	return conns
+}
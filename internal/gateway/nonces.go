@@ -0,0 +1,47 @@
+package gateway
+
+import (
+	"sync"
+	"time"
+)
+
+// clientNonceTTL is how long a client nonce is remembered. A client
+// reusing one within it is refused; one reused later is indistinguishable
+// from a fresh nonce, so clients must never reuse them.
+const clientNonceTTL = 10 * time.Minute
+
+// nonceCache remembers recently used client nonces so a replayed connect
+// request is refused. A nil *nonceCache accepts every nonce.
+type nonceCache struct {
+	mu        sync.Mutex
+	ttl       time.Duration
+	seen      map[string]time.Time // nonce → first use
+	lastSweep time.Time
+}
+
+func newNonceCache(ttl time.Duration) *nonceCache {
+	return &nonceCache{ttl: ttl, seen: make(map[string]time.Time)}
+}
+
+// use records nonce and reports whether it was unused within the TTL.
+func (n *nonceCache) use(nonce string) bool {
+	if n == nil {
+		return true
+	}
+	now := time.Now()
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if now.Sub(n.lastSweep) >= n.ttl {
+		for k, at := range n.seen {
+			if now.Sub(at) >= n.ttl {
+				delete(n.seen, k)
+			}
+		}
+		n.lastSweep = now
+	}
+	if at, ok := n.seen[nonce]; ok && now.Sub(at) < n.ttl {
+		return false
+	}
+	n.seen[nonce] = now
+	return true
+}
@@ -0,0 +1,23 @@
+package gateway
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNonceCache(t *testing.T) {
+	n := newNonceCache(50 * time.Millisecond)
+	assert.True(t, n.use("a"))
+	assert.False(t, n.use("a"), "reuse within the TTL should be refused")
+	assert.True(t, n.use("b"))
+
+	time.Sleep(60 * time.Millisecond)
+	assert.True(t, n.use("a"), "a nonce should be forgotten after the TTL")
+	assert.Len(t, n.seen, 1, "expired nonces should be swept")
+
+	var none *nonceCache
+	assert.True(t, none.use("a"))
+	assert.True(t, none.use("a"))
+}
@@ -0,0 +1,52 @@
+package gateway
+
+import (
+	"github.com/rvald/goclaw/internal/node"
+	"github.com/rvald/goclaw/internal/protocol"
+)
+
+// registerOperator tracks an authenticated operator conn until it
+// disconnects, under the scopes the server granted it.
+func (gw *Gateway) registerOperator(conn *Conn) {
+	client := conn.ConnectParams.Client
+	session := node.NewOperatorSession(conn.ConnID, client.ID, client.DisplayName, client.Platform,
+		conn.Scopes, conn.SendEvent)
+	session.DeviceID = conn.DeviceID
+	session.ConnectedAt = conn.ConnectedAt
+	gw.operators.Register(session)
+}
+
+// watchPresence sends presence events to operator.admin operators as nodes
+// and other operators come and go.
+func (gw *Gateway) watchPresence() {
+	gw.registry.OnRegister(func(n *node.NodeSession) {
+		gw.broadcastOperators(ScopeOperatorAdmin, "presence",
+			protocol.PresenceEvent{Role: "node", NodeID: n.NodeID, DeviceID: n.DeviceID, Online: true}, "")
+	})
+	gw.registry.OnUnregister(func(nodeID string) {
+		gw.broadcastOperators(ScopeOperatorAdmin, "presence",
+			protocol.PresenceEvent{Role: "node", NodeID: nodeID}, "")
+	})
+	gw.operators.OnRegister(func(op *node.OperatorSession) {
+		gw.broadcastOperators(ScopeOperatorAdmin, "presence",
+			protocol.PresenceEvent{Role: "operator", ConnID: op.ConnID, DeviceID: op.DeviceID, Online: true}, op.ConnID)
+	})
+	gw.operators.OnUnregister(func(op *node.OperatorSession) {
+		gw.broadcastOperators(ScopeOperatorAdmin, "presence",
+			protocol.PresenceEvent{Role: "operator", ConnID: op.ConnID, DeviceID: op.DeviceID}, op.ConnID)
+	})
+}
+
+// broadcastOperators sends an event to every operator granted scope, or to
+// every operator when scope is empty, except the one on conn ID except.
+func (gw *Gateway) broadcastOperators(scope, event string, payload any, except string) {
+	ops := gw.operators.List()
+	if scope != "" {
+		ops = gw.operators.ListWithScope(scope)
+	}
+	for _, op := range ops {
+		if op.ConnID != except {
+			op.Send(event, payload)
+		}
+	}
+}
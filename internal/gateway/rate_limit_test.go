@@ -48,3 +48,29 @@ func TestServer_RateLimiting(t *testing.T) {
 	assert.Greater(t, failureCount, 0, "expected some connections to be rate limited")
 	assert.Less(t, successCount, 10, "expected successes to be rate limited")
 }
+
+func TestServer_EvictsIdleLimiters(t *testing.T) {
+	srv := NewServer(ServerConfig{Port: 0}, &MockConnHandler{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		_ = srv.ListenAndServe(ctx)
+	}()
+	require.Eventually(t, func() bool { return srv.Addr() != "" }, 2*time.Second, 10*time.Millisecond)
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws://"+srv.Addr()+"/ws", nil)
+	require.NoError(t, err)
+	ws.Close()
+
+	limiters := func() int {
+		srv.limitersMu.Lock()
+		defer srv.limitersMu.Unlock()
+		return len(srv.ipLimiters)
+	}
+	require.Equal(t, 1, limiters())
+
+	srv.evictIdleLimiters(time.Now())
+	assert.Equal(t, 1, limiters(), "a recently used limiter should be kept")
+	srv.evictIdleLimiters(time.Now().Add(limiterIdleTTL))
+	assert.Equal(t, 0, limiters(), "an idle limiter should be evicted")
+}
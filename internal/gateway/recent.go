@@ -0,0 +1,59 @@
+package gateway
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultRecentEvents is how many events the gateway keeps for /recent.
+const DefaultRecentEvents = 200
+
+// RecentEvent is one entry in the /recent activity log.
+type RecentEvent struct {
+	TimeMs int64  `json:"ts"`
+	Kind   string `json:"kind"` // "connect", "disconnect", "invoke" or "pairing"
+	ConnID string `json:"connId,omitempty"`
+	NodeID string `json:"nodeId,omitempty"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// RecentLog is a fixed-size ring of the most recent events, safe for
+// concurrent use. Add never allocates once the ring is full.
+type RecentLog struct {
+	mu   sync.Mutex
+	buf  []RecentEvent
+	next int  // slot the next Add writes
+	full bool // buf has wrapped at least once
+}
+
+// NewRecentLog returns a log holding the last size events (at least one).
+func NewRecentLog(size int) *RecentLog {
+	return &RecentLog{buf: make([]RecentEvent, max(size, 1))}
+}
+
+// Add records ev, stamping it with the current time if TimeMs is unset,
+// and evicts the oldest event when the log is full.
+func (l *RecentLog) Add(ev RecentEvent) {
+	if ev.TimeMs == 0 {
+		ev.TimeMs = time.Now().UnixMilli()
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.buf[l.next] = ev
+	l.next = (l.next + 1) % len(l.buf)
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+// Events returns a copy of the logged events, oldest first.
+func (l *RecentLog) Events() []RecentEvent {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.full {
+		return append([]RecentEvent(nil), l.buf[:l.next]...)
+	}
+	out := make([]RecentEvent, 0, len(l.buf))
+	out = append(out, l.buf[l.next:]...)
+	return append(out, l.buf[:l.next]...)
+}
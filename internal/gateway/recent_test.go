@@ -0,0 +1,48 @@
+package gateway
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecentLog_KeepsLastN(t *testing.T) {
+	log := NewRecentLog(3)
+	assert.Empty(t, log.Events())
+
+	log.Add(RecentEvent{Kind: "connect", Detail: "0"})
+	log.Add(RecentEvent{Kind: "connect", Detail: "1"})
+	events := log.Events()
+	require.Len(t, events, 2)
+	assert.Equal(t, "0", events[0].Detail)
+	assert.NotZero(t, events[0].TimeMs, "Add stamps the time")
+
+	for i := 2; i < 8; i++ {
+		log.Add(RecentEvent{Kind: "invoke", Detail: fmt.Sprint(i)})
+	}
+	var details []string
+	for _, ev := range log.Events() {
+		details = append(details, ev.Detail)
+	}
+	assert.Equal(t, []string{"5", "6", "7"}, details, "oldest first, only the last 3")
+}
+
+func TestRecentLog_ConcurrentAdd(t *testing.T) {
+	log := NewRecentLog(50)
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				log.Add(RecentEvent{Kind: "invoke"})
+				_ = log.Events()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Len(t, log.Events(), 50)
+}
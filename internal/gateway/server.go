@@ -1,29 +1,102 @@
 package gateway
 
 import (
+	"compress/flate"
 	"context"
-	"fmt"
+	"crypto/ed25519"
+	"encoding/json"
+	"log/slog"
+	"maps"
 	"net"
 	"net/http"
+	"net/url"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rvald/goclaw/internal/pairing"
 	"golang.org/x/time/rate"
 )
 
 // ServerConfig holds configuration for the gateway server.
 type ServerConfig struct {
-	Port       int
-	Bind       string // "loopback" (127.0.0.1) or "lan" (0.0.0.0)
-	Auth       AuthConfig
-	PairingSvc *pairing.Service // optional — nil disables device pairing
-	PongWait   time.Duration    // optional, default 60s
-	PingPeriod time.Duration    // optional, default (PongWait * 9) / 10
-	RateLimit  float64          // optional, default 5.0 (req/sec per IP)
-	RateBurst  int              // optional, default 10
+	Port        int
+	Bind        string // "loopback" (127.0.0.1) or "lan" (0.0.0.0)
+	Auth        AuthConfig
+	PairingSvc  *pairing.Service // optional — nil disables device pairing
+	PongWait    time.Duration    // optional, default 60s
+	PingPeriod  time.Duration    // optional, default (PongWait * 9) / 10
+	WriteWait   time.Duration    // optional, default 10s; max time per frame write
+	IdleTimeout time.Duration    // optional; close conns sending no frame (pongs aside) this long. 0 disables
+	RateLimit   float64          // optional, default 5.0 (req/sec per IP)
+	RateBurst   int              // optional, default 10
+	Build       BuildInfo        // optional, reported by /health
+
+	// BindAddr, when set, is the IP address to listen on, overriding Bind.
+	// It lets a multi-homed host serve on a single interface.
+	BindAddr string
+
+	// AllowCIDRs, when non-empty, limits connections to these networks;
+	// DenyCIDRs rejects matching addresses. Loopback is always allowed.
+	AllowCIDRs []*net.IPNet
+	DenyCIDRs  []*net.IPNet
+
+	// AllowedOrigins restricts browser WebSocket upgrades. Entries match the
+	// Origin header exactly ("https://app.example.com") or by host suffix
+	// (".example.com"). Requests without an Origin (native clients) are
+	// always allowed. Empty allows every origin.
+	AllowedOrigins []string
+
+	// EnableCompression negotiates permessage-deflate with clients that
+	// offer it. It shrinks large payloads such as camera snapshots at the
+	// cost of CPU on both ends, so it is off by default.
+	EnableCompression bool
+
+	// ServerKey, when set, signs each connect challenge, and the hello-ok
+	// of clients that send a client nonce, so clients can verify they
+	// reached this gateway. Optional.
+	ServerKey ed25519.PrivateKey
+
+	// AllowTokenlessDevices lets a device that is still paired through
+	// when no device token could be saved for it. A device removed from
+	// the store mid-handshake, e.g. by a revoke, is always refused. Off by
+	// default: such connects fail with TOKEN_ISSUE_FAILED.
+	AllowTokenlessDevices bool
+
+	// Metrics, when set, is the registry served on /metrics, e.g. one per
+	// gateway in tests. Nil serves the default Prometheus registry.
+	Metrics *prometheus.Registry
+
+	// metrics receives the server's and its connections' measurements.
+	// Set by New; nil records nothing.
+	metrics *Metrics
+
+	// clientNonces refuses reused connect client nonces. Set by
+	// NewServer.
+	clientNonces *nonceCache
+}
+
+// BuildInfo describes the running binary. Fields are usually injected
+// at build time via -ldflags.
+type BuildInfo struct {
+	Version   string `json:"version,omitempty"`
+	Commit    string `json:"commit,omitempty"`
+	BuildDate string `json:"buildDate,omitempty"`
+}
+
+// HealthResponse is the JSON body served by /health.
+type HealthResponse struct {
+	Status string `json:"status"` // "ok", or "draining" once shutdown starts
+	BuildInfo
+	GoVersion  string          `json:"goVersion"`
+	Nodes      *int            `json:"nodes,omitempty"`      // connected nodes, when known
+	Components map[string]bool `json:"components,omitempty"` // optional subsystems and whether they are active
 }
 
 // Server is an HTTP server that upgrades connections to WebSocket
@@ -33,12 +106,20 @@ type Server struct {
 	handler  ConnHandler
 	upgrader websocket.Upgrader
 	httpSrv  *http.Server
+	ln       net.Listener // set by Listen
 	addr     string
 	mu       sync.Mutex
 	conns      []*Conn
 	connsMu    sync.Mutex
-	ipLimiters map[string]*rate.Limiter
+	ipLimiters map[string]*ipLimiter
 	limitersMu sync.Mutex
+
+	// Read by /health.
+	draining     atomic.Bool
+	nodeCount    func() int // optional
+	recent       *RecentLog // optional; serves /recent
+	components   map[string]bool
+	componentsMu sync.Mutex
 }
 
 // NewServer creates a new gateway server.
@@ -49,20 +130,27 @@ func NewServer(config ServerConfig, handler ConnHandler) *Server {
 	if config.PingPeriod == 0 {
 		config.PingPeriod = (config.PongWait * 9) / 10
 	}
+	if config.WriteWait == 0 {
+		config.WriteWait = 10 * time.Second
+	}
 	if config.RateLimit == 0 {
 		config.RateLimit = 5.0
 	}
 	if config.RateBurst == 0 {
 		config.RateBurst = 10
 	}
+	config.clientNonces = newNonceCache(clientNonceTTL)
 
 	return &Server{
 		config:     config,
 		handler:    handler,
 		upgrader: websocket.Upgrader{
-			CheckOrigin: func(r *http.Request) bool { return true },
+			CheckOrigin: func(r *http.Request) bool {
+				return originAllowed(r.Header.Get("Origin"), config.AllowedOrigins)
+			},
+			EnableCompression: config.EnableCompression,
 		},
-		ipLimiters: make(map[string]*rate.Limiter),
+		ipLimiters: make(map[string]*ipLimiter),
 	}
 }
 
@@ -73,35 +161,61 @@ func (s *Server) Addr() string {
 	return s.addr
 }
 
+// Listen binds the server's port without serving it, so Addr reports the
+// bound address before ListenAndServe runs. ListenAndServe binds on its
+// own if Listen was not called.
+func (s *Server) Listen() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ln != nil {
+		return nil
+	}
+
+	host := "127.0.0.1"
+	switch {
+	case s.config.BindAddr != "":
+		host = s.config.BindAddr
+	case s.config.Bind == "lan":
+		host = "0.0.0.0"
+	}
+	ln, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(s.config.Port)))
+	if err != nil {
+		return err
+	}
+	s.ln = ln
+	s.addr = ln.Addr().String()
+	return nil
+}
+
 // ListenAndServe starts the HTTP server and blocks until the context is cancelled.
 func (s *Server) ListenAndServe(ctx context.Context) error {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/ws", s.handleWS)
 	mux.HandleFunc("/health", s.handleHealth)
-	mux.Handle("/metrics", MetricsHandler())
+	mux.HandleFunc("/connections", s.handleConnections)
+	mux.HandleFunc("/recent", s.handleRecent)
+	mux.Handle("/metrics", MetricsHandler(s.config.Metrics))
 
-	bindAddr := "127.0.0.1"
-	if s.config.Bind == "lan" {
-		bindAddr = "0.0.0.0"
-	}
-	ln, err := net.Listen("tcp", fmt.Sprintf("%s:%d", bindAddr, s.config.Port))
-	if err != nil {
+	if err := s.Listen(); err != nil {
 		return err
 	}
 
 	s.mu.Lock()
-	s.addr = ln.Addr().String()
+	ln := s.ln
 	s.httpSrv = &http.Server{Handler: mux}
 	s.mu.Unlock()
 
+	go s.sweepLimiters(ctx)
+
 	// Shut down when context is cancelled.
 	go func() {
 		<-ctx.Done()
-		s.closeAllConns()
+		s.draining.Store(true)
+		s.closeAllConns(websocket.CloseGoingAway, shutdownCloseReason)
 		s.httpSrv.Close()
 	}()
 
-	err = s.httpSrv.Serve(ln)
+	err := s.httpSrv.Serve(ln)
 	if err == http.ErrServerClosed {
 		return nil
 	}
@@ -110,7 +224,8 @@ func (s *Server) ListenAndServe(ctx context.Context) error {
 
 // Shutdown gracefully shuts down the HTTP server.
 func (s *Server) Shutdown(ctx context.Context) error {
-	s.closeAllConns()
+	s.draining.Store(true)
+	s.closeAllConns(websocket.CloseGoingAway, shutdownCloseReason)
 	s.mu.Lock()
 	srv := s.httpSrv
 	s.mu.Unlock()
@@ -120,24 +235,71 @@ func (s *Server) Shutdown(ctx context.Context) error {
 	return nil
 }
 
+// ipLimiter is the connection rate limiter of one remote IP.
+type ipLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time // last connection attempt; guarded by limitersMu
+}
+
+// limiterIdleTTL is how long an IP's limiter outlives its last connection
+// attempt. At any practical rate it has refilled by then, so a new one
+// behaves the same.
+const limiterIdleTTL = 3 * time.Minute
+
+// sweepLimiters evicts idle IP limiters every limiterIdleTTL until ctx is
+// done, so addresses seen once do not pile up.
+func (s *Server) sweepLimiters(ctx context.Context) {
+	ticker := time.NewTicker(limiterIdleTTL)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.evictIdleLimiters(now)
+		}
+	}
+}
+
+// evictIdleLimiters drops the limiters idle for limiterIdleTTL at now.
+func (s *Server) evictIdleLimiters(now time.Time) {
+	s.limitersMu.Lock()
+	defer s.limitersMu.Unlock()
+	for ip, entry := range s.ipLimiters {
+		if now.Sub(entry.lastSeen) >= limiterIdleTTL {
+			delete(s.ipLimiters, ip)
+		}
+	}
+}
+
 func (s *Server) handleWS(w http.ResponseWriter, r *http.Request) {
-	// IP Rate Limiting
 	ip, _, _ := net.SplitHostPort(r.RemoteAddr)
 	if ip == "" {
 		ip = r.RemoteAddr
 	}
-	
+
+	// IP allow/deny lists, checked before any upgrade or auth.
+	if !s.ipAllowed(ip) {
+		slog.Warn("connection rejected by CIDR policy", "remoteIP", ip)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		s.config.metrics.incError("ip_denied")
+		return
+	}
+
+	// IP Rate Limiting
 	s.limitersMu.Lock()
-	limiter, exists := s.ipLimiters[ip]
+	entry, exists := s.ipLimiters[ip]
 	if !exists {
-		limiter = rate.NewLimiter(rate.Limit(s.config.RateLimit), s.config.RateBurst)
-		s.ipLimiters[ip] = limiter
+		entry = &ipLimiter{limiter: rate.NewLimiter(rate.Limit(s.config.RateLimit), s.config.RateBurst)}
+		s.ipLimiters[ip] = entry
 	}
+	entry.lastSeen = time.Now()
+	limiter := entry.limiter
 	s.limitersMu.Unlock()
 
 	if !limiter.Allow() {
 		http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
-		IncError("rate_limit")
+		s.config.metrics.incError("rate_limit")
 		return
 	}
 
@@ -145,8 +307,14 @@ func (s *Server) handleWS(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		return
 	}
+	if s.config.EnableCompression {
+		// Favor speed: base64 payloads compress well even at the lowest level.
+		wsConn.SetCompressionLevel(flate.BestSpeed)
+	}
 
 	conn := NewConn(wsConn, s.config, s.handler)
+	conn.remoteAddr = r.RemoteAddr
+	conn.dryRun = r.URL.Query().Get("dryRun") == "1"
 
 	// Attach pairing service if configured
 	if s.config.PairingSvc != nil {
@@ -159,11 +327,11 @@ func (s *Server) handleWS(w http.ResponseWriter, r *http.Request) {
 	s.conns = append(s.conns, conn)
 	s.connsMu.Unlock()
 
-	IncConnectedClients()
+	s.config.metrics.addConnectedClients(1)
 	conn.Run(r.Context())
 
 	s.removeConn(conn)
-	DecConnectedClients()
+	s.config.metrics.addConnectedClients(-1)
 }
 
 // isLoopback checks if the remote address is a loopback address.
@@ -182,20 +350,179 @@ func isLoopback(addr string) bool {
 	return host == "localhost"
 }
 
+// ipAllowed applies AllowCIDRs/DenyCIDRs to a remote IP. Loopback is
+// always allowed; unparseable addresses are denied once any list is set.
+func (s *Server) ipAllowed(host string) bool {
+	if len(s.config.AllowCIDRs) == 0 && len(s.config.DenyCIDRs) == 0 {
+		return true
+	}
+	if isLoopback(host) {
+		return true
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, n := range s.config.DenyCIDRs {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	if len(s.config.AllowCIDRs) == 0 {
+		return true
+	}
+	for _, n := range s.config.AllowCIDRs {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// originAllowed reports whether a WebSocket upgrade from origin may proceed.
+func originAllowed(origin string, allowed []string) bool {
+	if len(allowed) == 0 || origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, a := range allowed {
+		a = strings.ToLower(strings.TrimSpace(a))
+		switch {
+		case a == "":
+			continue
+		case strings.EqualFold(origin, a):
+			return true
+		case strings.HasPrefix(a, "."):
+			if host == a[1:] || strings.HasSuffix(host, a) {
+				return true
+			}
+		case !strings.Contains(a, "://") && host == a:
+			return true
+		}
+	}
+	return false
+}
+
+// handleHealth reports readiness. It answers 503 once shutdown starts so
+// load balancers stop routing new clients here.
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	resp := HealthResponse{
+		Status:    "ok",
+		BuildInfo: s.config.Build,
+		GoVersion: runtime.Version(),
+	}
+	code := http.StatusOK
+	if s.draining.Load() {
+		resp.Status = "draining"
+		code = http.StatusServiceUnavailable
+	}
+	if s.nodeCount != nil {
+		n := s.nodeCount()
+		resp.Nodes = &n
+	}
+	s.componentsMu.Lock()
+	if len(s.components) > 0 {
+		resp.Components = maps.Clone(s.components)
+	}
+	s.componentsMu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// setComponent records whether an optional subsystem is active.
+func (s *Server) setComponent(name string, active bool) {
+	s.componentsMu.Lock()
+	defer s.componentsMu.Unlock()
+	if s.components == nil {
+		s.components = make(map[string]bool)
+	}
+	s.components[name] = active
+}
+
+// shutdownCloseReason accompanies the close frame sent on shutdown.
+const shutdownCloseReason = "gateway shutting down"
+
+// handleConnections lists open connections as JSON. It is subject to the
+// CIDR policy and the gateway token (as "Authorization: Bearer <token>");
+// without a token configured, only loopback callers are served.
+func (s *Server) handleConnections(w http.ResponseWriter, r *http.Request) {
+	if !s.authorizeAdmin(w, r) {
+		return
+	}
+
+	s.connsMu.Lock()
+	infos := make([]ConnInfo, 0, len(s.conns))
+	for _, c := range s.conns {
+		infos = append(infos, c.Info())
+	}
+	s.connsMu.Unlock()
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ConnectedAtMs < infos[j].ConnectedAtMs })
+
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(`{"status":"ok"}`))
+	json.NewEncoder(w).Encode(map[string]any{"connections": infos})
+}
+
+// handleRecent serves the recent activity log as JSON, oldest first,
+// under the same access rules as /connections.
+func (s *Server) handleRecent(w http.ResponseWriter, r *http.Request) {
+	if !s.authorizeAdmin(w, r) {
+		return
+	}
+	events := []RecentEvent{}
+	if s.recent != nil {
+		events = s.recent.Events()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"events": events})
+}
+
+// authorizeAdmin applies the access rules of the admin endpoints: the
+// CIDR policy, then an admin token when any are configured, else the
+// gateway token, or loopback-only without one. The gateway token alone is
+// not enough once admin tokens exist, as every node holds it. It writes
+// the error response and returns false when r is refused.
+func (s *Server) authorizeAdmin(w http.ResponseWriter, r *http.Request) bool {
+	ip := remoteIP(r.RemoteAddr)
+	if !s.ipAllowed(ip) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		s.config.metrics.incError("ip_denied")
+		return false
+	}
+	if len(s.config.Auth.AdminTokens) > 0 {
+		if result := AuthenticateHTTP(s.config.Auth, r); !result.OK || !result.Admin {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			s.config.metrics.incError("auth_failed")
+			return false
+		}
+	} else if s.config.Auth.Mode == "none" {
+		if !isLoopback(ip) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return false
+		}
+	} else if result := AuthenticateHTTP(s.config.Auth, r); !result.OK {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		s.config.metrics.incError("auth_failed")
+		return false
+	}
+	return true
 }
 
-func (s *Server) closeAllConns() {
+// closeAllConns closes every connection with a close frame carrying code
+// and reason, so clients see a clean close rather than a dropped socket.
+func (s *Server) closeAllConns(code int, reason string) {
 	s.connsMu.Lock()
 	conns := make([]*Conn, len(s.conns))
 	copy(conns, s.conns)
 	s.connsMu.Unlock()
 
 	for _, c := range conns {
-		c.ws.Close()
+		c.Close(code, reason)
 	}
 }
 
@@ -2,11 +2,16 @@ package gateway
 
 import (
 	"context"
+	"encoding/json"
 	"io"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"runtime"
 	"testing"
 	"time"
 
+	"github.com/rvald/goclaw/internal/netutil"
 	. "github.com/rvald/goclaw/internal/protocol"
 	"github.com/gorilla/websocket"
 	"github.com/stretchr/testify/assert"
@@ -36,6 +41,26 @@ func TestServer_AcceptConnection(t *testing.T) {
 	assert.Equal(t, "connect.challenge", evt.Event)
 }
 
+func TestServer_BindAddr(t *testing.T) {
+	srv := NewServer(ServerConfig{Port: 0, Bind: "lan", BindAddr: "127.0.0.2", Auth: AuthConfig{Mode: "none"}}, &MockConnHandler{})
+	if err := srv.Listen(); err != nil {
+		t.Skipf("loopback alias 127.0.0.2 unavailable: %v", err)
+	}
+	host, _, err := net.SplitHostPort(srv.Addr())
+	require.NoError(t, err)
+	assert.Equal(t, "127.0.0.2", host, "BindAddr overrides Bind")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go srv.ListenAndServe(ctx)
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws://"+srv.Addr()+"/ws", nil)
+	require.NoError(t, err)
+	defer ws.Close()
+	_, _, err = ws.ReadMessage()
+	require.NoError(t, err)
+}
+
 func TestServer_MultipleConnections(t *testing.T) {
 	handler := &MockConnHandler{}
 	srv := NewServer(ServerConfig{Port: 0, Auth: AuthConfig{Mode: "none"}}, handler)
@@ -99,4 +124,128 @@ func TestServer_HealthEndpoint(t *testing.T) {
 	assert.Equal(t, http.StatusOK, resp.StatusCode)
 	body, _ := io.ReadAll(resp.Body)
 	assert.Contains(t, string(body), "ok")
-}
\ No newline at end of file
+}
+
+func TestServer_HealthEndpoint_BuildInfo(t *testing.T) {
+	handler := &MockConnHandler{}
+	build := BuildInfo{Version: "1.2.3", Commit: "abc1234", BuildDate: "2026-01-02T03:04:05Z"}
+	srv := NewServer(ServerConfig{Port: 0, Auth: AuthConfig{Mode: "none"}, Build: build}, handler)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go srv.ListenAndServe(ctx)
+	require.Eventually(t, func() bool { return srv.Addr() != "" }, 2*time.Second, 10*time.Millisecond)
+	resp, err := http.Get("http://" + srv.Addr() + "/health")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	var body map[string]string
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, "ok", body["status"])
+	assert.Equal(t, "1.2.3", body["version"])
+	assert.Equal(t, "abc1234", body["commit"])
+	assert.Equal(t, "2026-01-02T03:04:05Z", body["buildDate"])
+	assert.Equal(t, runtime.Version(), body["goVersion"])
+}
+func TestOriginAllowed(t *testing.T) {
+	allowed := []string{"https://app.example.com", ".trusted.dev", "localhost"}
+	tests := []struct {
+		name    string
+		origin  string
+		allowed []string
+		want    bool
+	}{
+		{"empty list allows all", "https://evil.com", nil, true},
+		{"empty origin (native client)", "", allowed, true},
+		{"exact match", "https://app.example.com", allowed, true},
+		{"exact match is case-insensitive", "HTTPS://App.Example.com", allowed, true},
+		{"scheme must match exact entry", "http://app.example.com", allowed, false},
+		{"suffix match subdomain", "https://ui.trusted.dev", allowed, true},
+		{"suffix match apex", "https://trusted.dev", allowed, true},
+		{"suffix must be on label boundary", "https://untrusted.dev", allowed, false},
+		{"bare host entry", "http://localhost:3000", allowed, true},
+		{"denied", "https://evil.com", allowed, false},
+		{"malformed origin", "://bad", allowed, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, originAllowed(tt.origin, tt.allowed))
+		})
+	}
+}
+
+func TestServer_AllowedOriginsUpgrade(t *testing.T) {
+	srv := NewServer(ServerConfig{
+		Port:           0,
+		Auth:           AuthConfig{Mode: "none"},
+		AllowedOrigins: []string{"https://app.example.com"},
+	}, &MockConnHandler{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go srv.ListenAndServe(ctx)
+	require.Eventually(t, func() bool { return srv.Addr() != "" }, 2*time.Second, 10*time.Millisecond)
+
+	tests := []struct {
+		name   string
+		origin string
+		wantOK bool
+	}{
+		{"allowed origin", "https://app.example.com", true},
+		{"denied origin", "https://evil.com", false},
+		{"no origin", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.origin != "" {
+				header.Set("Origin", tt.origin)
+			}
+			ws, resp, err := websocket.DefaultDialer.Dial("ws://"+srv.Addr()+"/ws", header)
+			if tt.wantOK {
+				require.NoError(t, err)
+				ws.Close()
+				return
+			}
+			require.Error(t, err)
+			require.NotNil(t, resp)
+			assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+		})
+	}
+}
+
+func TestServer_CIDRPolicy(t *testing.T) {
+	allow, err := netutil.ParseCIDRs([]string{"192.168.1.0/24"})
+	require.NoError(t, err)
+	deny, err := netutil.ParseCIDRs([]string{"192.168.1.66"})
+	require.NoError(t, err)
+	srv := NewServer(ServerConfig{
+		Auth:       AuthConfig{Mode: "none"},
+		AllowCIDRs: allow,
+		DenyCIDRs:  deny,
+	}, &MockConnHandler{})
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		wantDenied bool
+	}{
+		{"allowed IP", "192.168.1.10:5555", false},
+		{"denied IP inside allow range", "192.168.1.66:5555", true},
+		{"IP outside allow list", "10.0.0.7:5555", true},
+		{"loopback always allowed", "127.0.0.1:5555", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/ws", nil)
+			req.RemoteAddr = tt.remoteAddr
+			rec := httptest.NewRecorder()
+			srv.handleWS(rec, req)
+			if tt.wantDenied {
+				assert.Equal(t, http.StatusForbidden, rec.Code)
+			} else {
+				// Not a real upgrade request, so the upgrader rejects it —
+				// but not with the CIDR policy's 403.
+				assert.NotEqual(t, http.StatusForbidden, rec.Code)
+			}
+		})
+	}
+}
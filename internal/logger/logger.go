@@ -2,10 +2,14 @@ package logger
 
 import (
 	"context"
+	"fmt"
+	"io"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"strings"
 
+	"golang.org/x/term"
 	"gopkg.in/natefinch/lumberjack.v2"
 )
 
@@ -52,39 +56,143 @@ func (h *MultiHandler) WithGroup(name string) slog.Handler {
 	return &MultiHandler{handlers: handlers}
 }
 
+// level is shared by every handler Setup installs, so SetLevel takes
+// effect immediately without rebuilding the logger.
+var level = new(slog.LevelVar)
+
+// ParseLevel parses a level name ("debug", "info", "warn", "error",
+// case-insensitive, optionally with an offset such as "info+2").
+func ParseLevel(s string) (slog.Level, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(s)); err != nil {
+		return 0, fmt.Errorf("invalid log level %q (want debug, info, warn or error)", s)
+	}
+	return l, nil
+}
+
+// SetLevel changes the minimum level of the installed handlers at runtime.
+func SetLevel(l slog.Level) {
+	level.Set(l)
+}
+
+// Console log formats accepted by ParseFormat. FormatAuto picks per
+// ConsoleFormat.
+const (
+	FormatAuto = ""
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// ParseFormat parses a console log format name ("text", "json", or "auto"
+// or empty for FormatAuto), case-insensitive.
+func ParseFormat(s string) (string, error) {
+	switch f := strings.ToLower(strings.TrimSpace(s)); f {
+	case "", "auto":
+		return FormatAuto, nil
+	case FormatText, FormatJSON:
+		return f, nil
+	}
+	return "", fmt.Errorf("invalid log format %q (want text or json)", s)
+}
+
+// ConsoleFormat resolves format for console: FormatAuto becomes text on a
+// terminal and JSON otherwise, e.g. under a container runtime collecting
+// stdout.
+func ConsoleFormat(format string, console io.Writer) string {
+	if format != FormatAuto {
+		return format
+	}
+	if isTerminal(console) {
+		return FormatText
+	}
+	return FormatJSON
+}
+
+// isTerminal reports whether w is a terminal.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	return ok && term.IsTerminal(int(f.Fd()))
+}
+
+// LogConfig configures Setup.
+type LogConfig struct {
+	Level  slog.Level
+	Format string // console format; see ConsoleFormat
+
+	// Rotation of <stateDir>/logs/goclaw.log.
+	MaxSizeMB  int  // rotate once the file reaches this size; 0 means 100
+	MaxBackups int  // rotated files to keep; 0 keeps all
+	MaxAgeDays int  // days to keep rotated files; 0 keeps them regardless of age
+	Compress   bool // gzip rotated files
+}
+
+// DefaultLogConfig is the rotation the server uses unless told otherwise.
+var DefaultLogConfig = LogConfig{
+	Level:      slog.LevelInfo,
+	MaxSizeMB:  10,
+	MaxBackups: 3,
+	MaxAgeDays: 28,
+	Compress:   true,
+}
+
 // Setup configures the default slog logger to write:
-// 1. JSON logs to a rotating file in <stateDir>/logs/goclaw.log
-// 2. Text (pretty) logs to os.Stdout
-func Setup(stateDir string) {
+// 1. JSON logs to a file in <stateDir>/logs/goclaw.log, rotated per cfg
+// 2. Logs to os.Stdout in cfg.Format, resolved by ConsoleFormat
+// Both handlers drop records below cfg.Level.
+func Setup(stateDir string, cfg LogConfig) {
 	logDir := filepath.Join(stateDir, "logs")
 	if err := os.MkdirAll(logDir, 0755); err != nil {
 		// Fallback to stderr if we can't create log dir
 		slog.Error("failed to create log directory", "error", err)
 	}
 
-	// 1. File Handler (JSON, Rotating)
-	fileLogger := &lumberjack.Logger{
+	level.Set(cfg.Level)
+	slog.SetDefault(slog.New(newHandler(newFileLogger(logDir, cfg), os.Stdout, level, ConsoleFormat(cfg.Format, os.Stdout))))
+}
+
+// newFileLogger returns the rotating writer for goclaw.log in logDir.
+func newFileLogger(logDir string, cfg LogConfig) *lumberjack.Logger {
+	return &lumberjack.Logger{
 		Filename:   filepath.Join(logDir, "goclaw.log"),
-		MaxSize:    10,   // megabytes
-		MaxBackups: 3,    // files
-		MaxAge:     28,   // days
-		Compress:   true, // disabled by default
+		MaxSize:    cfg.MaxSizeMB,
+		MaxBackups: cfg.MaxBackups,
+		MaxAge:     cfg.MaxAgeDays,
+		Compress:   cfg.Compress,
+	}
+}
+
+// newHandler builds the file (JSON) + console (text or JSON, per format)
+// fan-out used by Setup. Both sides redact RedactKeys.
+func newHandler(file, console io.Writer, lvl slog.Leveler, format string) slog.Handler {
+	opts := &slog.HandlerOptions{Level: lvl, ReplaceAttr: Redactor(RedactKeys...)}
+	jsonHandler := slog.NewJSONHandler(file, opts)
+	if format == FormatJSON {
+		return NewMultiHandler(jsonHandler, slog.NewJSONHandler(console, opts))
 	}
+	// TextHandler is good enough for dev; colors would need a custom handler.
+	consoleHandler := slog.NewTextHandler(console, opts)
+	return NewMultiHandler(jsonHandler, consoleHandler)
+}
+
+// Redacted replaces the value of sensitive attributes.
+const Redacted = "***"
 
-	jsonHandler := slog.NewJSONHandler(fileLogger, &slog.HandlerOptions{
-		Level: slog.LevelInfo,
-	})
-
-	// 2. Console Handler (Text, Pretty)
-	// We use TextHandler for now. For "pretty" colors, typically need a custom handler,
-	// but standard TextHandler is good enough for dev.
-	consoleHandler := slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
-		Level: slog.LevelDebug, // Show debug in console during dev? Or Info? Let's use Info for now to match.
-		// Actually, usually console is for Devs, so Debug might be nice if we had a flag.
-		// For now default to Info.
-	})
-
-	// Combine
-	multi := NewMultiHandler(jsonHandler, consoleHandler)
-	slog.SetDefault(slog.New(multi))
+// RedactKeys are the attribute keys Setup redacts. Change it before
+// calling Setup to extend the set.
+var RedactKeys = []string{"token", "deviceToken", "privateKey", "signature"}
+
+// Redactor returns a slog ReplaceAttr function that replaces the value of
+// any attribute whose key matches one of keys (case-insensitive) with
+// Redacted. slog applies it inside groups as well.
+func Redactor(keys ...string) func(groups []string, a slog.Attr) slog.Attr {
+	set := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		set[strings.ToLower(k)] = true
+	}
+	return func(groups []string, a slog.Attr) slog.Attr {
+		if set[strings.ToLower(a.Key)] {
+			return slog.String(a.Key, Redacted)
+		}
+		return a
+	}
 }
@@ -0,0 +1,143 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    slog.Level
+		wantErr bool
+	}{
+		{in: "debug", want: slog.LevelDebug},
+		{in: "INFO", want: slog.LevelInfo},
+		{in: "warn", want: slog.LevelWarn},
+		{in: "error", want: slog.LevelError},
+		{in: "verbose", wantErr: true},
+		{in: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseLevel(tt.in)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestHandler_LevelFiltering(t *testing.T) {
+	var file, console bytes.Buffer
+	lvl := new(slog.LevelVar)
+	lvl.Set(slog.LevelWarn)
+	log := slog.New(newHandler(&file, &console, lvl, FormatText))
+
+	log.Info("dropped-info")
+	log.Warn("kept-warn")
+
+	for name, buf := range map[string]*bytes.Buffer{"file": &file, "console": &console} {
+		assert.NotContains(t, buf.String(), "dropped-info", name)
+		assert.Contains(t, buf.String(), "kept-warn", name)
+	}
+
+	// Lowering the level at runtime takes effect without rebuilding.
+	lvl.Set(slog.LevelDebug)
+	log.Debug("now-visible")
+	assert.Equal(t, 1, strings.Count(console.String(), "now-visible"))
+}
+
+func TestHandler_RedactsSensitiveKeys(t *testing.T) {
+	var file, console bytes.Buffer
+	lvl := new(slog.LevelVar)
+	log := slog.New(newHandler(&file, &console, lvl, FormatText))
+
+	log.Info("connect",
+		"token", "secret-gateway-token",
+		slog.Group("auth", slog.String("deviceToken", "secret-device-token")),
+		"clientId", "ios-app",
+	)
+	log.WithGroup("device").With("privateKey", "secret-private-key").
+		Info("signed", slog.Group("proof", slog.Group("inner", "Signature", "secret-signature")))
+
+	for name, buf := range map[string]*bytes.Buffer{"file": &file, "console": &console} {
+		out := buf.String()
+		for _, secret := range []string{"secret-gateway-token", "secret-device-token", "secret-private-key", "secret-signature"} {
+			assert.NotContains(t, out, secret, name)
+		}
+		assert.Contains(t, out, Redacted, name)
+		assert.Contains(t, out, "ios-app", name, "non-sensitive attributes must survive")
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for in, want := range map[string]string{"": FormatAuto, "auto": FormatAuto, "JSON": FormatJSON, " text ": FormatText} {
+		got, err := ParseFormat(in)
+		require.NoError(t, err, in)
+		assert.Equal(t, want, got, in)
+	}
+	_, err := ParseFormat("logfmt")
+	assert.Error(t, err)
+}
+
+func TestConsoleFormat(t *testing.T) {
+	var buf bytes.Buffer
+	assert.Equal(t, FormatJSON, ConsoleFormat(FormatAuto, &buf), "a non-terminal writer gets JSON")
+	assert.Equal(t, FormatText, ConsoleFormat(FormatText, &buf), "an explicit format wins")
+
+	// A regular file is not a terminal either.
+	f, err := os.CreateTemp(t.TempDir(), "stdout")
+	require.NoError(t, err)
+	defer f.Close()
+	assert.Equal(t, FormatJSON, ConsoleFormat(FormatAuto, f))
+}
+
+func TestHandler_JSONConsole(t *testing.T) {
+	var file, console bytes.Buffer
+	log := slog.New(newHandler(&file, &console, new(slog.LevelVar), FormatJSON))
+	log.Info("hello", "token", "secret-gateway-token", "nodeId", "iphone-1")
+
+	var rec map[string]any
+	require.NoError(t, json.Unmarshal(console.Bytes(), &rec), "console output: %s", console.String())
+	assert.Equal(t, "hello", rec["msg"])
+	assert.Equal(t, "iphone-1", rec["nodeId"])
+	assert.Equal(t, Redacted, rec["token"])
+}
+
+func TestNewFileLogger_AppliesRotation(t *testing.T) {
+	dir := t.TempDir()
+	l := newFileLogger(dir, LogConfig{MaxSizeMB: 50, MaxBackups: 7, MaxAgeDays: 90})
+	assert.Equal(t, filepath.Join(dir, "goclaw.log"), l.Filename)
+	assert.Equal(t, 50, l.MaxSize)
+	assert.Equal(t, 7, l.MaxBackups)
+	assert.Equal(t, 90, l.MaxAge)
+	assert.False(t, l.Compress)
+
+	l = newFileLogger(dir, DefaultLogConfig)
+	assert.Equal(t, 10, l.MaxSize)
+	assert.Equal(t, 3, l.MaxBackups)
+	assert.Equal(t, 28, l.MaxAge)
+	assert.True(t, l.Compress)
+}
+
+func TestRedactor_CustomKeys(t *testing.T) {
+	var buf bytes.Buffer
+	log := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{ReplaceAttr: Redactor("apiKey")}))
+
+	log.Info("call", "apiKey", "k-123", "token", "t-456")
+	assert.NotContains(t, buf.String(), "k-123")
+	assert.Contains(t, buf.String(), "t-456", "only configured keys are redacted")
+}
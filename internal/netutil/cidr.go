@@ -0,0 +1,39 @@
+// Package netutil holds network helpers shared by the gateway and the
+// pairing service.
+package netutil
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// ParseCIDRs parses CIDR strings. A bare IP is treated as a single-host
+// network; blank entries are skipped.
+func ParseCIDRs(specs []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		if !strings.Contains(spec, "/") {
+			ip := net.ParseIP(spec)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid CIDR %q: not an IP or CIDR", spec)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %w", spec, err)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
@@ -0,0 +1,25 @@
+package netutil
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCIDRs(t *testing.T) {
+	nets, err := ParseCIDRs([]string{"10.0.0.0/8", " 192.168.1.5 ", "fd00::/8", ""})
+	require.NoError(t, err)
+	require.Len(t, nets, 3)
+	assert.Equal(t, "10.0.0.0/8", nets[0].String())
+	assert.Equal(t, "192.168.1.5/32", nets[1].String())
+	assert.Equal(t, "fd00::/8", nets[2].String())
+
+	for _, bad := range []string{"10.0.0.0/33", "not-an-ip", "10.0.0/8"} {
+		_, err := ParseCIDRs([]string{bad})
+		assert.Error(t, err, bad)
+		if err != nil {
+			assert.Contains(t, err.Error(), bad)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
@@ -20,23 +21,42 @@ type NodeInvokeResult = protocol.NodeInvokeResult
 
 // InvokeRequest is the input to Invoker.Invoke.
 type InvokeRequest struct {
-	NodeID    string
-	Command   string
-	TimeoutMs int
+	NodeID     string
+	Command    string
+	ParamsJSON string // optional JSON-encoded command params
+	TimeoutMs  int
 }
 
-// InvokeResult is the output of Invoker.Invoke.
+// InvokeResult is the output of Invoker.Invoke. ID is the invoke ID sent
+// to the node, set even when Invoke fails, so callers can correlate the
+// invoke with gateway and node logs.
 type InvokeResult struct {
+	ID          string
 	OK          bool
 	PayloadJSON *string
 	Error       *protocol.ErrorShape
+	DurationMs  int64 // from sending the request until the result, timeout or cancellation
 }
 
+// ErrInvokerClosed is returned by Invoke once Close has been called.
+var ErrInvokerClosed = errors.New("invoker closed: gateway shutting down")
+
+// lateResultWindow is how long the ID of an invoke that gave up waiting
+// is remembered, so a result arriving afterwards is reported as late
+// rather than unknown.
+const lateResultWindow = 5 * time.Minute
+
 // pendingInvoke tracks a single in-flight invocation.
 type pendingInvoke struct {
-	result chan protocol.NodeInvokeResult
-	cancel chan struct{}
-	nodeID string
+	result   chan protocol.NodeInvokeResult
+	cancel   chan struct{}
+	nodeID   string
+	deviceID string                     // session's device; a reconnect from it adopts the invoke
+	req      protocol.NodeInvokeRequest // re-sent to the session that adopts the invoke
+
+	// Guarded by Invoker.mu.
+	orphaned bool // node disconnected; waiting out the reconnect grace
+	canceled bool // cancel is closed
 }
 
 // Invoker manages the request/response lifecycle for node invocations.
@@ -44,100 +64,416 @@ type Invoker struct {
 	reg     *Registry
 	pending map[string]*pendingInvoke
 	mu      sync.Mutex
+
+	maxInFlight int                      // per node; 0 = unlimited
+	slots       map[string]chan struct{} // nodeID → semaphore
+
+	closed bool
+	idle   chan struct{} // closed when pending empties; nil until WaitIdle needs it
+
+	obs Observer // see WithObserver
+
+	grace       time.Duration                    // see WithReconnectGrace
+	graceTimers map[*time.Timer][]*pendingInvoke // running grace windows → the invokes they hold
+
+	expired  map[string]time.Time // invoke ID → when Invoke gave up on it
+	lastReap time.Time
 }
 
 // NewInvoker creates a new invoker backed by the given registry.
 func NewInvoker(reg *Registry) *Invoker {
 	return &Invoker{
-		reg:     reg,
-		pending: make(map[string]*pendingInvoke),
+		reg:         reg,
+		pending:     make(map[string]*pendingInvoke),
+		expired:     make(map[string]time.Time),
+		graceTimers: make(map[*time.Timer][]*pendingInvoke),
+		obs:         NoopObserver{},
+	}
+}
+
+// WithMaxInFlightPerNode limits how many invokes may be outstanding on a
+// single node; excess invokes queue until a slot frees. n <= 0 removes the
+// limit. Call before the invoker is in use.
+func (inv *Invoker) WithMaxInFlightPerNode(n int) {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	inv.maxInFlight = max(n, 0)
+	inv.slots = make(map[string]chan struct{})
+}
+
+// WithObserver sends the invoker's measurements to obs; nil restores
+// NoopObserver. Call before the invoker is in use.
+func (inv *Invoker) WithObserver(obs Observer) {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	if obs == nil {
+		obs = NoopObserver{}
+	}
+	inv.obs = obs
+}
+
+// WithReconnectGrace keeps a node's pending invokes alive for d after it
+// disconnects. If a session for the same device ID registers within d, it
+// adopts them: each request is sent again to the new session, whose result
+// completes the original Invoke. Nodes should therefore treat a repeated
+// invoke ID as a retry. Sessions without a device ID are cancelled at
+// once, as are all sessions when d is 0. Call before the invoker is in use.
+func (inv *Invoker) WithReconnectGrace(d time.Duration) {
+	inv.mu.Lock()
+	inv.grace = max(d, 0)
+	inv.mu.Unlock()
+	if d > 0 {
+		inv.reg.OnRegister(inv.adopt)
+	}
+}
+
+// Pending returns the number of invokes awaiting a result.
+func (inv *Invoker) Pending() int {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	return len(inv.pending)
+}
+
+// slot returns nodeID's semaphore, or nil when invokes are unlimited.
+func (inv *Invoker) slot(nodeID string) chan struct{} {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	if inv.maxInFlight == 0 {
+		return nil
+	}
+	sem, ok := inv.slots[nodeID]
+	if !ok {
+		sem = make(chan struct{}, inv.maxInFlight)
+		inv.slots[nodeID] = sem
+	}
+	return sem
+}
+
+// release frees a slot taken from sem, nodeID's semaphore, dropping the
+// semaphore once nodeID is gone and nothing holds it.
+func (inv *Invoker) release(nodeID string, sem chan struct{}) {
+	<-sem
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	if _, ok := inv.reg.Get(nodeID); !ok {
+		inv.pruneSlotLocked(nodeID)
+	}
+}
+
+// pruneSlotLocked deletes nodeID's semaphore if nothing holds it. A
+// later invoke for the node starts a fresh one. Callers hold inv.mu.
+func (inv *Invoker) pruneSlotLocked(nodeID string) {
+	if sem, ok := inv.slots[nodeID]; ok && len(sem) == 0 {
+		delete(inv.slots, nodeID)
 	}
 }
 
-// Invoke sends a command to a node and waits for the result.
+// Invoke sends a command to a node and waits for the result. With a
+// per-node limit set, it first waits for a free slot; the timeout and ctx
+// cover that wait too.
 func (inv *Invoker) Invoke(ctx context.Context, req InvokeRequest) (InvokeResult, error) {
+	id := generateInvokeID()
+
+	inv.mu.Lock()
+	closed := inv.closed
+	inv.mu.Unlock()
+	if closed {
+		return InvokeResult{ID: id, OK: false}, ErrInvokerClosed
+	}
+	if _, ok := inv.reg.Get(req.NodeID); !ok {
+		return InvokeResult{ID: id, OK: false}, fmt.Errorf("node %q not connected", req.NodeID)
+	}
+
+	timer := time.NewTimer(time.Duration(req.TimeoutMs) * time.Millisecond)
+	defer timer.Stop()
+
+	if sem := inv.slot(req.NodeID); sem != nil {
+		select {
+		case sem <- struct{}{}:
+			defer inv.release(req.NodeID, sem)
+		case <-timer.C:
+			return InvokeResult{ID: id, OK: false}, fmt.Errorf("invoke timeout after %dms (queued behind other invokes)", req.TimeoutMs)
+		case <-ctx.Done():
+			return InvokeResult{ID: id, OK: false}, ctx.Err()
+		}
+	}
+
+	// Look the session up again: the node may have reconnected or gone
+	// away while this invoke was queued.
 	session, ok := inv.reg.Get(req.NodeID)
 	if !ok {
-		return InvokeResult{OK: false}, fmt.Errorf("node %q not connected", req.NodeID)
+		return InvokeResult{ID: id, OK: false}, fmt.Errorf("node %q not connected", req.NodeID)
 	}
 
-	id := generateInvokeID()
+	invokeReq := protocol.NodeInvokeRequest{
+		ID:         id,
+		NodeID:     req.NodeID,
+		Command:    req.Command,
+		ParamsJSON: req.ParamsJSON,
+	}
 	pi := &pendingInvoke{
-		result: make(chan protocol.NodeInvokeResult, 1),
-		cancel: make(chan struct{}),
-		nodeID: req.NodeID,
+		result:   make(chan protocol.NodeInvokeResult, 1),
+		cancel:   make(chan struct{}),
+		nodeID:   req.NodeID,
+		deviceID: session.DeviceID,
+		req:      invokeReq,
 	}
 
 	inv.mu.Lock()
+	if inv.closed {
+		inv.mu.Unlock()
+		return InvokeResult{ID: id, OK: false}, ErrInvokerClosed
+	}
 	inv.pending[id] = pi
+	inv.pendingChanged()
 	inv.mu.Unlock()
 
+	// awaiting is set once the node has the request, answered once its
+	// result is taken.
+	var awaiting, answered bool
 	defer func() {
 		inv.mu.Lock()
 		delete(inv.pending, id)
+		inv.pendingChanged()
+		if awaiting && !answered {
+			// A result delivered between giving up and here is late too.
+			select {
+			case <-pi.result:
+				inv.lateResult()
+			default:
+			}
+			now := time.Now()
+			inv.expired[id] = now
+			inv.reapLocked(now)
+		}
+		if len(inv.pending) == 0 && inv.idle != nil {
+			close(inv.idle)
+			inv.idle = nil
+		}
 		inv.mu.Unlock()
 	}()
 
-	invokeReq := protocol.NodeInvokeRequest{
-		ID:      id,
-		NodeID:  req.NodeID,
-		Command: req.Command,
-	}
-
 	if err := session.Send("node.invoke.request", invokeReq); err != nil {
-		return InvokeResult{OK: false}, fmt.Errorf("send failed: %w", err)
+		return InvokeResult{ID: id, OK: false}, fmt.Errorf("send failed: %w", err)
 	}
 
-	timeout := time.Duration(req.TimeoutMs) * time.Millisecond
-
+	awaiting = true
+	sent := time.Now()
+	res := InvokeResult{ID: id, OK: false}
+	var err error
+	outcome := OutcomeOK
 	select {
 	case result := <-pi.result:
-		return InvokeResult{
-			OK:          result.OK,
-			PayloadJSON: result.PayloadJSON,
-			Error:       result.Error,
-		}, nil
+		answered = true
+		res.OK, res.PayloadJSON, res.Error = result.OK, result.PayloadJSON, result.Error
+		if !result.OK {
+			outcome = OutcomeError
+		}
 	case <-pi.cancel:
-		return InvokeResult{OK: false}, fmt.Errorf("node disconnected")
-	case <-time.After(timeout):
-		return InvokeResult{OK: false}, fmt.Errorf("invoke timeout after %dms", req.TimeoutMs)
+		err = fmt.Errorf("node disconnected")
+		outcome = OutcomeDisconnected
+	case <-timer.C:
+		err = fmt.Errorf("invoke timeout after %dms", req.TimeoutMs)
+		outcome = OutcomeTimeout
 	case <-ctx.Done():
-		return InvokeResult{OK: false}, ctx.Err()
+		err = ctx.Err()
+		outcome = OutcomeCanceled
 	}
+	took := time.Since(sent)
+	res.DurationMs = took.Milliseconds()
+
+	inv.mu.Lock()
+	obs := inv.obs
+	inv.mu.Unlock()
+	obs.ObserveInvoke(req.Command, outcome, took)
+	return res, err
+}
+
+// pendingChanged reports the pending count to the observer. Callers hold
+// inv.mu.
+func (inv *Invoker) pendingChanged() {
+	inv.obs.ObservePending(len(inv.pending))
 }
 
 // HandleResult delivers a result from a node to the waiting Invoke call.
-// Returns true if a matching pending invoke was found, false otherwise.
+// Returns true if a matching pending invoke was found, false otherwise. A
+// result whose NodeID is not the node the invoke was sent to never
+// matches.
+//
+// Delivery happens under the lock so that Invoke, when it gives up, can
+// tell whether a result slipped in after its wait ended.
 func (inv *Invoker) HandleResult(result protocol.NodeInvokeResult) bool {
 	inv.mu.Lock()
-	pi, ok := inv.pending[result.ID]
-	inv.mu.Unlock()
+	defer inv.mu.Unlock()
 
+	pi, ok := inv.pending[result.ID]
 	if !ok {
+		if _, late := inv.expired[result.ID]; late {
+			inv.lateResult()
+		}
 		return false
 	}
+	if pi.nodeID != result.NodeID {
+		return false
+	}
+
+	select {
+	case pi.result <- result:
+		return true
+	default:
+		return false // a result for this invoke was already delivered
+	}
+}
+
+// lateResult reports a late result to the observer. Callers hold inv.mu.
+func (inv *Invoker) lateResult() {
+	inv.obs.ObserveLateResult()
+}
 
-	pi.result <- result
-	return true
+// reapLocked forgets invoke IDs that gave up more than lateResultWindow
+// ago, scanning at most once per window. Callers hold inv.mu.
+func (inv *Invoker) reapLocked(now time.Time) {
+	if now.Sub(inv.lastReap) < lateResultWindow {
+		return
+	}
+	inv.lastReap = now
+	for id, at := range inv.expired {
+		if now.Sub(at) > lateResultWindow {
+			delete(inv.expired, id)
+		}
+	}
 }
 
 // CancelPendingForNode cancels all pending invocations targeting the given node.
-// This should be called when a node disconnects.
 func (inv *Invoker) CancelPendingForNode(nodeID string) {
 	inv.mu.Lock()
-	var toCancel []*pendingInvoke
+	defer inv.mu.Unlock()
 	for _, pi := range inv.pending {
 		if pi.nodeID == nodeID {
-			toCancel = append(toCancel, pi)
+			inv.cancelLocked(pi)
+		}
+	}
+}
+
+// NodeDisconnected handles nodeID's session going away. Its pending
+// invokes are cancelled, or with a reconnect grace set, held for the
+// grace window and cancelled only if no session adopts them by then. Its
+// semaphore is dropped once no invoke holds a slot.
+func (inv *Invoker) NodeDisconnected(nodeID string) {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	inv.pruneSlotLocked(nodeID)
+	var held []*pendingInvoke
+	for _, pi := range inv.pending {
+		if pi.nodeID != nodeID {
+			continue
+		}
+		if inv.grace == 0 || pi.deviceID == "" {
+			inv.cancelLocked(pi)
+			continue
+		}
+		pi.orphaned = true
+		held = append(held, pi)
+	}
+	if len(held) == 0 {
+		return
+	}
+	// The timer cannot fire before it is recorded: its func needs inv.mu.
+	var timer *time.Timer
+	timer = time.AfterFunc(inv.grace, func() {
+		inv.mu.Lock()
+		defer inv.mu.Unlock()
+		delete(inv.graceTimers, timer)
+		inv.cancelOrphanedLocked(held)
+	})
+	inv.graceTimers[timer] = held
+}
+
+// cancelOrphanedLocked cancels those of held that no session adopted.
+// Callers hold inv.mu.
+func (inv *Invoker) cancelOrphanedLocked(held []*pendingInvoke) {
+	for _, pi := range held {
+		if pi.orphaned {
+			inv.cancelLocked(pi)
+		}
+	}
+}
+
+// adopt hands the invokes orphaned by session's device over to session,
+// re-sending their requests. It runs as a registry OnRegister hook.
+func (inv *Invoker) adopt(session *NodeSession) {
+	if session.DeviceID == "" {
+		return
+	}
+	inv.mu.Lock()
+	var adopted []*pendingInvoke
+	for _, pi := range inv.pending {
+		if pi.orphaned && pi.deviceID == session.DeviceID {
+			pi.orphaned = false
+			pi.nodeID = session.NodeID
+			pi.req.NodeID = session.NodeID
+			adopted = append(adopted, pi)
 		}
 	}
 	inv.mu.Unlock()
 
-	for _, pi := range toCancel {
+	for _, pi := range adopted {
+		if err := session.Send("node.invoke.request", pi.req); err != nil {
+			inv.mu.Lock()
+			inv.cancelLocked(pi)
+			inv.mu.Unlock()
+		}
+	}
+}
+
+// cancelLocked fails pi with "node disconnected". Callers hold inv.mu.
+func (inv *Invoker) cancelLocked(pi *pendingInvoke) {
+	pi.orphaned = false
+	if !pi.canceled {
+		pi.canceled = true
 		close(pi.cancel)
 	}
 }
 
+// Close stops the invoker accepting new invokes; they fail with
+// ErrInvokerClosed. Invokes already sent still receive their results,
+// except those of disconnected nodes waiting out the reconnect grace,
+// which are cancelled at once.
+func (inv *Invoker) Close() {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	inv.closed = true
+	for timer, held := range inv.graceTimers {
+		if timer.Stop() {
+			inv.cancelOrphanedLocked(held)
+		}
+	}
+	clear(inv.graceTimers)
+}
+
+// WaitIdle blocks until no invoke is awaiting a result or ctx is done,
+// returning ctx.Err() in the latter case. Call Close first, or new
+// invokes may keep it waiting.
+func (inv *Invoker) WaitIdle(ctx context.Context) error {
+	inv.mu.Lock()
+	if len(inv.pending) == 0 {
+		inv.mu.Unlock()
+		return nil
+	}
+	if inv.idle == nil {
+		inv.idle = make(chan struct{})
+	}
+	idle := inv.idle
+	inv.mu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 func generateInvokeID() string {
 	b := make([]byte, 16)
 	rand.Read(b)
@@ -0,0 +1,34 @@
+package node
+
+import "time"
+
+// Invoke outcomes reported to Observer.ObserveInvoke.
+const (
+	OutcomeOK           = "ok"           // the node answered with OK
+	OutcomeError        = "error"        // the node answered with an error
+	OutcomeTimeout      = "timeout"      // the node did not answer in time
+	OutcomeDisconnected = "disconnected" // the node went away before answering
+	OutcomeCanceled     = "canceled"     // the caller's context ended first
+)
+
+// Observer receives the invoker's measurements, e.g. to export them as
+// metrics. Its methods may run with the invoker locked and must not block
+// or call back into the invoker.
+type Observer interface {
+	// ObserveInvoke reports an invoke that reached its node: how it
+	// ended and how long it waited after sending.
+	ObserveInvoke(command, outcome string, took time.Duration)
+	// ObservePending reports the number of invokes awaiting a result
+	// each time it changes.
+	ObservePending(n int)
+	// ObserveLateResult reports a result that arrived after its Invoke
+	// stopped waiting, within lateResultWindow.
+	ObserveLateResult()
+}
+
+// NoopObserver discards every measurement. It is the invoker's default.
+type NoopObserver struct{}
+
+func (NoopObserver) ObserveInvoke(command, outcome string, took time.Duration) {}
+func (NoopObserver) ObservePending(n int)                                      {}
+func (NoopObserver) ObserveLateResult()                                        {}
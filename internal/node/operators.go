@@ -0,0 +1,157 @@
+package node
+
+import (
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// OperatorSession represents a connected operator client (e.g. a control
+// app). Operators never receive node commands; they call node.list and
+// node.invoke and subscribe to node events.
+type OperatorSession struct {
+	ConnID      string
+	ClientID    string
+	DisplayName string
+	Platform    string
+	Scopes      []string
+	DeviceID    string // paired device behind the session; empty without device auth
+	ConnectedAt time.Time
+
+	sendFunc func(event string, payload any) error
+}
+
+// NewOperatorSession creates an OperatorSession with the given send function.
+func NewOperatorSession(connID, clientID, displayName, platform string, scopes []string, send func(string, any) error) *OperatorSession {
+	return &OperatorSession{
+		ConnID:      connID,
+		ClientID:    clientID,
+		DisplayName: displayName,
+		Platform:    platform,
+		Scopes:      scopes,
+		ConnectedAt: time.Now(),
+		sendFunc:    send,
+	}
+}
+
+// Send dispatches an event to this operator's underlying connection.
+func (s *OperatorSession) Send(event string, payload any) error {
+	return s.sendFunc(event, payload)
+}
+
+// HasScope reports whether the operator was granted scope.
+func (s *OperatorSession) HasScope(scope string) bool {
+	return slices.Contains(s.Scopes, scope)
+}
+
+// OperatorRegistry is a thread-safe store of connected operator sessions,
+// keyed by connection ID since operators need not have unique client IDs.
+type OperatorRegistry struct {
+	byConnID map[string]*OperatorSession
+	mu       sync.RWMutex
+
+	hooksMu      sync.Mutex
+	onRegister   []func(*OperatorSession)
+	onUnregister []func(*OperatorSession)
+}
+
+// NewOperatorRegistry creates an empty operator registry.
+func NewOperatorRegistry() *OperatorRegistry {
+	return &OperatorRegistry{byConnID: make(map[string]*OperatorSession)}
+}
+
+// OnRegister registers fn to be called after an operator session is
+// registered. fn runs on the connection's goroutine and must not block.
+func (r *OperatorRegistry) OnRegister(fn func(*OperatorSession)) {
+	r.hooksMu.Lock()
+	defer r.hooksMu.Unlock()
+	r.onRegister = append(r.onRegister, fn)
+}
+
+// OnUnregister registers fn to be called after an operator session is
+// removed. fn runs on the connection's goroutine and must not block.
+func (r *OperatorRegistry) OnUnregister(fn func(*OperatorSession)) {
+	r.hooksMu.Lock()
+	defer r.hooksMu.Unlock()
+	r.onUnregister = append(r.onUnregister, fn)
+}
+
+// Register adds an operator session, replacing any with the same ConnID.
+func (r *OperatorRegistry) Register(session *OperatorSession) {
+	r.mu.Lock()
+	r.byConnID[session.ConnID] = session
+	r.mu.Unlock()
+
+	r.hooksMu.Lock()
+	hooks := slices.Clone(r.onRegister)
+	r.hooksMu.Unlock()
+	for _, fn := range hooks {
+		fn(session)
+	}
+}
+
+// Unregister removes the operator session on connID. Returns the session
+// and true if found.
+func (r *OperatorRegistry) Unregister(connID string) (*OperatorSession, bool) {
+	r.mu.Lock()
+	session, ok := r.byConnID[connID]
+	delete(r.byConnID, connID)
+	r.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+
+	r.hooksMu.Lock()
+	hooks := slices.Clone(r.onUnregister)
+	r.hooksMu.Unlock()
+	for _, fn := range hooks {
+		fn(session)
+	}
+	return session, true
+}
+
+// Get retrieves an operator session by connID.
+func (r *OperatorRegistry) Get(connID string) (*OperatorSession, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	s, ok := r.byConnID[connID]
+	return s, ok
+}
+
+// List returns a snapshot of all operator sessions, oldest first.
+func (r *OperatorRegistry) List() []*OperatorSession {
+	return r.listWhere(func(*OperatorSession) bool { return true })
+}
+
+// ListWithScope returns a snapshot of the operator sessions granted scope,
+// oldest first.
+func (r *OperatorRegistry) ListWithScope(scope string) []*OperatorSession {
+	return r.listWhere(func(s *OperatorSession) bool { return s.HasScope(scope) })
+}
+
+func (r *OperatorRegistry) listWhere(match func(*OperatorSession) bool) []*OperatorSession {
+	r.mu.RLock()
+	out := make([]*OperatorSession, 0, len(r.byConnID))
+	for _, s := range r.byConnID {
+		if match(s) {
+			out = append(out, s)
+		}
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].ConnectedAt.Equal(out[j].ConnectedAt) {
+			return out[i].ConnectedAt.Before(out[j].ConnectedAt)
+		}
+		return out[i].ConnID < out[j].ConnID
+	})
+	return out
+}
+
+// Len returns the number of connected operator sessions.
+func (r *OperatorRegistry) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.byConnID)
+}
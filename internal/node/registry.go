@@ -1,9 +1,17 @@
 package node
 
 import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
 	"sync"
 )
 
+// ErrNodeIDConflict is returned by Register when a different device
+// already holds the node ID.
+var ErrNodeIDConflict = errors.New("node ID in use by another device")
+
 // NodeSession represents a connected node (e.g. an iPhone).
 type NodeSession struct {
 	NodeID      string
@@ -12,7 +20,15 @@ type NodeSession struct {
 	Platform    string
 	Version     string
 	Commands    []string
-	sendFunc    func(event string, payload any) error
+	DeviceID    string // paired device behind the session; empty without device auth
+
+	// ModelIdentifier and DeviceFamily are reported by the client at
+	// connect, e.g. "iPhone15,2" and "iPhone".
+	ModelIdentifier string
+	DeviceFamily    string
+
+	sendFunc   func(event string, payload any) error
+	registered uint64 // registration order, for the device index fallback
 }
 
 // Send dispatches an event to this node's underlying connection.
@@ -35,34 +51,98 @@ func NewNodeSession(nodeID, connID, displayName, platform, version string, comma
 
 // Registry is a thread-safe store of connected node sessions.
 type Registry struct {
-	byNodeID map[string]*NodeSession
-	byConnID map[string]string // connID → nodeID
-	mu       sync.RWMutex
+	byNodeID   map[string]*NodeSession
+	byConnID   map[string]string // connID → nodeID
+	byDeviceID map[string]string // deviceID → nodeID; only sessions with a DeviceID
+	seq        uint64            // last NodeSession.registered handed out
+	mu         sync.RWMutex
+
+	hooksMu      sync.Mutex
+	onRegister   []func(*NodeSession)
+	onUnregister []func(nodeID string)
+}
+
+// OnRegister registers fn to be called after a node session is registered.
+// fn runs on the connection's goroutine and must not block.
+func (r *Registry) OnRegister(fn func(*NodeSession)) {
+	r.hooksMu.Lock()
+	defer r.hooksMu.Unlock()
+	r.onRegister = append(r.onRegister, fn)
+}
+
+// OnUnregister registers fn to be called after a node session is removed.
+// fn runs on the connection's goroutine and must not block.
+func (r *Registry) OnUnregister(fn func(nodeID string)) {
+	r.hooksMu.Lock()
+	defer r.hooksMu.Unlock()
+	r.onUnregister = append(r.onUnregister, fn)
 }
 
 // NewRegistry creates an empty registry.
 func NewRegistry() *Registry {
 	return &Registry{
-		byNodeID: make(map[string]*NodeSession),
-		byConnID: make(map[string]string),
+		byNodeID:   make(map[string]*NodeSession),
+		byConnID:   make(map[string]string),
+		byDeviceID: make(map[string]string),
 	}
 }
 
-// Register adds or replaces a node session.
+// Register adds a node session, replacing any session with the same
+// NodeID: a reconnecting node takes over from its stale connection. A
+// session of a verified device is only replaced by another of the same
+// device; otherwise, including for a session without a device ID, the
+// existing session is kept and Register returns an error wrapping
+// ErrNodeIDConflict.
 func (r *Registry) Register(session *NodeSession) error {
 	r.mu.Lock()
-	defer r.mu.Unlock()
-
-	// If this nodeID already exists, clean up the old connID mapping.
+	// If this nodeID already exists, clean up the old session's mappings.
 	if old, exists := r.byNodeID[session.NodeID]; exists {
-		delete(r.byConnID, old.ConnID)
+		if old.DeviceID != "" && old.DeviceID != session.DeviceID {
+			r.mu.Unlock()
+			return fmt.Errorf("%w: %q is held by device %s", ErrNodeIDConflict, session.NodeID, old.DeviceID)
+		}
+		r.removeLocked(old)
 	}
 
+	r.seq++
+	session.registered = r.seq
 	r.byNodeID[session.NodeID] = session
 	r.byConnID[session.ConnID] = session.NodeID
+	if session.DeviceID != "" {
+		r.byDeviceID[session.DeviceID] = session.NodeID
+	}
+	r.mu.Unlock()
+
+	r.hooksMu.Lock()
+	hooks := slices.Clone(r.onRegister)
+	r.hooksMu.Unlock()
+	for _, fn := range hooks {
+		fn(session)
+	}
 	return nil
 }
 
+// removeLocked drops session from every index. If it was its device's
+// indexed session, the device's most recently registered remaining
+// session, if any, takes its place. r.mu must be held.
+func (r *Registry) removeLocked(session *NodeSession) {
+	delete(r.byNodeID, session.NodeID)
+	delete(r.byConnID, session.ConnID)
+	if session.DeviceID == "" || r.byDeviceID[session.DeviceID] != session.NodeID {
+		return
+	}
+	delete(r.byDeviceID, session.DeviceID)
+	var newest *NodeSession
+	for _, s := range r.byNodeID {
+		if s.DeviceID == session.DeviceID && (newest == nil || s.registered > newest.registered) {
+			newest = s
+		}
+	}
+	if newest != nil {
+		r.byDeviceID[newest.DeviceID] = newest.NodeID
+	}
+}
+
 // Get retrieves a node session by nodeID.
 func (r *Registry) Get(nodeID string) (*NodeSession, bool) {
 	r.mu.RLock()
@@ -71,19 +151,40 @@ func (r *Registry) Get(nodeID string) (*NodeSession, bool) {
 	return s, ok
 }
 
+// GetByDeviceID retrieves the node session of the paired device deviceID,
+// the most recently registered one if the device has several. Unlike the
+// client-chosen node ID, the device ID is verified against the device's
+// key at connect, so a reconnect under a new node ID is found here at once
+// while its stale session lingers until its connection closes.
+func (r *Registry) GetByDeviceID(deviceID string) (*NodeSession, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	nodeID, ok := r.byDeviceID[deviceID]
+	if !ok || deviceID == "" {
+		return nil, false
+	}
+	return r.byNodeID[nodeID], true
+}
+
 // Unregister removes a node session by connID. Returns the nodeID and true
 // if found, or empty string and false if not.
 func (r *Registry) Unregister(connID string) (string, bool) {
 	r.mu.Lock()
-	defer r.mu.Unlock()
-
 	nodeID, ok := r.byConnID[connID]
 	if !ok {
+		r.mu.Unlock()
 		return "", false
 	}
 
-	delete(r.byNodeID, nodeID)
-	delete(r.byConnID, connID)
+	r.removeLocked(r.byNodeID[nodeID])
+	r.mu.Unlock()
+
+	r.hooksMu.Lock()
+	hooks := slices.Clone(r.onUnregister)
+	r.hooksMu.Unlock()
+	for _, fn := range hooks {
+		fn(nodeID)
+	}
 	return nodeID, true
 }
 
@@ -98,3 +199,38 @@ func (r *Registry) List() []*NodeSession {
 	}
 	return out
 }
+
+// ListByPlatform returns a snapshot of the sessions whose Platform matches
+// platform, ignoring case.
+func (r *Registry) ListByPlatform(platform string) []*NodeSession {
+	return r.listWhere(func(s *NodeSession) bool {
+		return strings.EqualFold(s.Platform, platform)
+	})
+}
+
+// ListByCommand returns a snapshot of the sessions that advertise command.
+func (r *Registry) ListByCommand(command string) []*NodeSession {
+	return r.listWhere(func(s *NodeSession) bool {
+		return slices.Contains(s.Commands, command)
+	})
+}
+
+func (r *Registry) listWhere(match func(*NodeSession) bool) []*NodeSession {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var out []*NodeSession
+	for _, s := range r.byNodeID {
+		if match(s) {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// Len returns the number of connected node sessions.
+func (r *Registry) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.byNodeID)
+}
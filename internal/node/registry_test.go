@@ -3,7 +3,9 @@ package node
 import (
 	"context"
 	"fmt"
+	"runtime"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -67,6 +69,30 @@ func TestRegistry_List(t *testing.T) {
     assert.Contains(t, ids, "ipad-2")
 }
 
+func TestRegistry_ListFilters(t *testing.T) {
+    reg := NewRegistry()
+    noop := func(event string, payload any) error { return nil }
+    reg.Register(&NodeSession{NodeID: "iphone-1", ConnID: "conn-1", Platform: "ios", Commands: []string{"camera.snap", "location.get"}, sendFunc: noop})
+    reg.Register(&NodeSession{NodeID: "ipad-2", ConnID: "conn-2", Platform: "iOS", Commands: []string{"camera.snap"}, sendFunc: noop})
+    reg.Register(&NodeSession{NodeID: "pixel-3", ConnID: "conn-3", Platform: "android", Commands: []string{"location.get"}, sendFunc: noop})
+
+    ids := func(sessions []*NodeSession) []string {
+        out := make([]string, len(sessions))
+        for i, s := range sessions {
+            out[i] = s.NodeID
+        }
+        return out
+    }
+
+    assert.ElementsMatch(t, []string{"iphone-1", "ipad-2"}, ids(reg.ListByPlatform("ios")))
+    assert.ElementsMatch(t, []string{"pixel-3"}, ids(reg.ListByPlatform("android")))
+    assert.Empty(t, reg.ListByPlatform("macos"))
+
+    assert.ElementsMatch(t, []string{"iphone-1", "ipad-2"}, ids(reg.ListByCommand("camera.snap")))
+    assert.ElementsMatch(t, []string{"iphone-1", "pixel-3"}, ids(reg.ListByCommand("location.get")))
+    assert.Empty(t, reg.ListByCommand("camera"), "commands match exactly")
+}
+
 func TestRegistry_DuplicateReplaces(t *testing.T) {
     reg := NewRegistry()
     noop := func(event string, payload any) error { return nil }
@@ -79,6 +105,104 @@ func TestRegistry_DuplicateReplaces(t *testing.T) {
     assert.Len(t, nodes, 1) // not 2
 }
 
+func TestRegistry_DuplicateFromOtherDeviceRejected(t *testing.T) {
+    reg := NewRegistry()
+    noop := func(event string, payload any) error { return nil }
+    require.NoError(t, reg.Register(&NodeSession{NodeID: "iphone-1", ConnID: "conn-a", DeviceID: "dev-a", sendFunc: noop}))
+
+    err := reg.Register(&NodeSession{NodeID: "iphone-1", ConnID: "conn-b", DeviceID: "dev-b", sendFunc: noop})
+    assert.ErrorIs(t, err, ErrNodeIDConflict)
+    got, ok := reg.Get("iphone-1")
+    require.True(t, ok)
+    assert.Equal(t, "dev-a", got.DeviceID, "first device should keep the node ID")
+    _, ok = reg.Unregister("conn-b")
+    assert.False(t, ok, "rejected session must not be tracked")
+
+    // Nor can a session without device auth take it over.
+    assert.ErrorIs(t, reg.Register(&NodeSession{NodeID: "iphone-1", ConnID: "conn-t", sendFunc: noop}), ErrNodeIDConflict)
+    got, _ = reg.Get("iphone-1")
+    assert.Equal(t, "conn-a", got.ConnID)
+
+    // The same device reconnecting still replaces its old session.
+    require.NoError(t, reg.Register(&NodeSession{NodeID: "iphone-1", ConnID: "conn-a2", DeviceID: "dev-a", sendFunc: noop}))
+    got, _ = reg.Get("iphone-1")
+    assert.Equal(t, "conn-a2", got.ConnID)
+}
+
+func TestRegistry_GetByDeviceID(t *testing.T) {
+    reg := NewRegistry()
+    noop := func(event string, payload any) error { return nil }
+    require.NoError(t, reg.Register(&NodeSession{NodeID: "iphone-1", ConnID: "conn-a", DeviceID: "dev-a", sendFunc: noop}))
+    require.NoError(t, reg.Register(&NodeSession{NodeID: "legacy", ConnID: "conn-l", sendFunc: noop}))
+
+    got, ok := reg.GetByDeviceID("dev-a")
+    require.True(t, ok)
+    assert.Equal(t, "iphone-1", got.NodeID)
+    _, ok = reg.GetByDeviceID("dev-b")
+    assert.False(t, ok)
+    _, ok = reg.GetByDeviceID("")
+    assert.False(t, ok, "sessions without device auth are not indexed")
+
+    _, ok = reg.Unregister("conn-a")
+    require.True(t, ok)
+    _, ok = reg.GetByDeviceID("dev-a")
+    assert.False(t, ok)
+}
+
+func TestRegistry_DeviceReconnectsUnderNewNodeID(t *testing.T) {
+    reg := NewRegistry()
+    noop := func(event string, payload any) error { return nil }
+    require.NoError(t, reg.Register(&NodeSession{NodeID: "iphone-1", ConnID: "conn-a", DeviceID: "dev-a", sendFunc: noop}))
+    require.NoError(t, reg.Register(&NodeSession{NodeID: "kitchen-phone", ConnID: "conn-a2", DeviceID: "dev-a", sendFunc: noop}))
+
+    // The device ID resolves to the new session at once.
+    got, ok := reg.GetByDeviceID("dev-a")
+    require.True(t, ok)
+    assert.Equal(t, "kitchen-phone", got.NodeID)
+
+    // The stale connection closing must not evict the new session.
+    nodeID, ok := reg.Unregister("conn-a")
+    require.True(t, ok)
+    assert.Equal(t, "iphone-1", nodeID)
+    got, ok = reg.GetByDeviceID("dev-a")
+    require.True(t, ok)
+    assert.Equal(t, "conn-a2", got.ConnID)
+
+    // Another device can take the freed node ID but not the live one.
+    require.NoError(t, reg.Register(&NodeSession{NodeID: "iphone-1", ConnID: "conn-b", DeviceID: "dev-b", sendFunc: noop}))
+    assert.ErrorIs(t, reg.Register(&NodeSession{NodeID: "kitchen-phone", ConnID: "conn-b2", DeviceID: "dev-b", sendFunc: noop}), ErrNodeIDConflict)
+    got, _ = reg.GetByDeviceID("dev-b")
+    assert.Equal(t, "iphone-1", got.NodeID)
+}
+
+func TestRegistry_DeviceIndexFallsBack(t *testing.T) {
+    reg := NewRegistry()
+    noop := func(event string, payload any) error { return nil }
+    require.NoError(t, reg.Register(&NodeSession{NodeID: "node-1", ConnID: "conn-1", DeviceID: "dev-a", sendFunc: noop}))
+    require.NoError(t, reg.Register(&NodeSession{NodeID: "node-2", ConnID: "conn-2", DeviceID: "dev-a", sendFunc: noop}))
+
+    // Dropping the newest session falls back to the device's other one.
+    _, ok := reg.Unregister("conn-2")
+    require.True(t, ok)
+    got, ok := reg.GetByDeviceID("dev-a")
+    require.True(t, ok)
+    assert.Equal(t, "node-1", got.NodeID)
+
+    _, ok = reg.Unregister("conn-1")
+    require.True(t, ok)
+    _, ok = reg.GetByDeviceID("dev-a")
+    assert.False(t, ok)
+
+    // With several left, the most recently registered one takes over.
+    for i := 1; i <= 5; i++ {
+        require.NoError(t, reg.Register(&NodeSession{NodeID: fmt.Sprintf("node-%d", i), ConnID: fmt.Sprintf("conn-%d", i), DeviceID: "dev-a", sendFunc: noop}))
+    }
+    _, ok = reg.Unregister("conn-5")
+    require.True(t, ok)
+    got, _ = reg.GetByDeviceID("dev-a")
+    assert.Equal(t, "node-4", got.NodeID)
+}
+
 func TestRegistry_ConcurrentAccess(t *testing.T) {
     reg := NewRegistry()
     noop := func(event string, payload any) error { return nil }
@@ -129,10 +253,110 @@ func TestInvoke_HappyPath(t *testing.T) {
     assert.True(t, result.OK)
     assert.Equal(t, `{"lat":40.7}`, *result.PayloadJSON)
     assert.Equal(t, "location.get", captured.Command)
+    assert.NotEmpty(t, result.ID)
+    assert.Equal(t, captured.ID, result.ID, "result should carry the ID sent to the node")
 }
 
 func ptrStr(s string) *string { return &s }
 
+// recordingObserver records what the invoker observes.
+type recordingObserver struct {
+    mu      sync.Mutex
+    invokes []string // "command outcome"
+    took    []time.Duration
+    pending []int
+    late    atomic.Int64
+}
+
+func (o *recordingObserver) ObserveInvoke(command, outcome string, took time.Duration) {
+    o.mu.Lock()
+    defer o.mu.Unlock()
+    o.invokes = append(o.invokes, command+" "+outcome)
+    o.took = append(o.took, took)
+}
+
+func (o *recordingObserver) ObservePending(n int) {
+    o.mu.Lock()
+    defer o.mu.Unlock()
+    o.pending = append(o.pending, n)
+}
+
+func (o *recordingObserver) ObserveLateResult() { o.late.Add(1) }
+
+func TestInvoke_ReportsDuration(t *testing.T) {
+    const delay = 50 * time.Millisecond
+    reg := NewRegistry()
+    inv := NewInvoker(reg)
+    obs := &recordingObserver{}
+    inv.WithObserver(obs)
+    reg.Register(&NodeSession{
+        NodeID: "iphone-1", ConnID: "conn-1",
+        sendFunc: func(event string, payload any) error {
+            req := payload.(NodeInvokeRequest)
+            go func() {
+                time.Sleep(delay)
+                inv.HandleResult(NodeInvokeResult{ID: req.ID, NodeID: "iphone-1", OK: true})
+            }()
+            return nil
+        },
+    })
+
+    result, err := inv.Invoke(context.Background(), InvokeRequest{
+        NodeID:    "iphone-1",
+        Command:   "camera.snap",
+        TimeoutMs: 5000,
+    })
+    require.NoError(t, err)
+    assert.GreaterOrEqual(t, result.DurationMs, delay.Milliseconds())
+    assert.Less(t, result.DurationMs, int64(1000), "duration should track the node's delay")
+    assert.Equal(t, []string{"camera.snap ok"}, obs.invokes)
+    assert.Equal(t, result.DurationMs, obs.took[0].Milliseconds())
+    assert.Equal(t, []int{1, 0}, obs.pending)
+}
+
+func TestInvoke_ObservesOutcomes(t *testing.T) {
+    reg := NewRegistry()
+    inv := NewInvoker(reg)
+    obs := &recordingObserver{}
+    inv.WithObserver(obs)
+    reg.Register(&NodeSession{
+        NodeID: "iphone-1", ConnID: "conn-1",
+        sendFunc: func(event string, payload any) error {
+            req := payload.(NodeInvokeRequest)
+            if req.Command != "slow" {
+                go inv.HandleResult(NodeInvokeResult{ID: req.ID, NodeID: "iphone-1", OK: req.Command == "good"})
+            }
+            return nil
+        },
+    })
+
+    ctx, cancel := context.WithCancel(context.Background())
+    cancel()
+    inv.Invoke(context.Background(), InvokeRequest{NodeID: "iphone-1", Command: "good", TimeoutMs: 1000})
+    inv.Invoke(context.Background(), InvokeRequest{NodeID: "iphone-1", Command: "bad", TimeoutMs: 1000})
+    inv.Invoke(context.Background(), InvokeRequest{NodeID: "iphone-1", Command: "slow", TimeoutMs: 10})
+    inv.Invoke(ctx, InvokeRequest{NodeID: "iphone-1", Command: "slow", TimeoutMs: 1000})
+    // Never sent: not observed.
+    inv.Invoke(context.Background(), InvokeRequest{NodeID: "ipad-2", Command: "good", TimeoutMs: 1000})
+
+    assert.Equal(t, []string{"good ok", "bad error", "slow timeout", "slow canceled"}, obs.invokes)
+}
+
+func TestInvoker_NilObserverIsNoop(t *testing.T) {
+    reg := NewRegistry()
+    inv := NewInvoker(reg)
+    inv.WithObserver(nil)
+    reg.Register(&NodeSession{
+        NodeID: "iphone-1", ConnID: "conn-1",
+        sendFunc: func(event string, payload any) error {
+            go inv.HandleResult(NodeInvokeResult{ID: payload.(NodeInvokeRequest).ID, NodeID: "iphone-1", OK: true})
+            return nil
+        },
+    })
+    _, err := inv.Invoke(context.Background(), InvokeRequest{NodeID: "iphone-1", Command: "good", TimeoutMs: 1000})
+    assert.NoError(t, err)
+}
+
 func TestInvoke_Timeout(t *testing.T) {
     reg := NewRegistry()
     inv := NewInvoker(reg)
@@ -152,6 +376,7 @@ func TestInvoke_Timeout(t *testing.T) {
     assert.Error(t, err)
     assert.Contains(t, err.Error(), "timeout")
     assert.False(t, result.OK)
+    assert.NotEmpty(t, result.ID, "failed invokes still report their ID")
 }
 
 func TestInvoke_NodeNotConnected(t *testing.T) {
@@ -193,6 +418,121 @@ func TestInvoke_NodeDisconnects(t *testing.T) {
     assert.False(t, result.OK)
 }
 
+func TestInvoke_ReconnectWithinGraceCompletes(t *testing.T) {
+    reg := NewRegistry()
+    inv := NewInvoker(reg)
+    inv.WithReconnectGrace(time.Second)
+
+    // The first session drops right after receiving the command.
+    reg.Register(&NodeSession{
+        NodeID: "iphone-1", ConnID: "conn-1", DeviceID: "dev-1",
+        sendFunc: func(event string, payload any) error {
+            go func() {
+                time.Sleep(20 * time.Millisecond)
+                reg.Unregister("conn-1")
+                inv.NodeDisconnected("iphone-1")
+            }()
+            return nil
+        },
+    })
+
+    // The reconnected session receives the same invoke and answers it.
+    redelivered := make(chan NodeInvokeRequest, 1)
+    go func() {
+        time.Sleep(100 * time.Millisecond)
+        reg.Register(&NodeSession{
+            NodeID: "iphone-1", ConnID: "conn-2", DeviceID: "dev-1",
+            sendFunc: func(event string, payload any) error {
+                req := payload.(NodeInvokeRequest)
+                redelivered <- req
+                go inv.HandleResult(NodeInvokeResult{ID: req.ID, NodeID: req.NodeID, OK: true})
+                return nil
+            },
+        })
+    }()
+
+    result, err := inv.Invoke(context.Background(), InvokeRequest{
+        NodeID:    "iphone-1",
+        Command:   "camera.snap",
+        TimeoutMs: 5000,
+    })
+    require.NoError(t, err)
+    assert.True(t, result.OK)
+    req := <-redelivered
+    assert.Equal(t, result.ID, req.ID)
+    assert.Equal(t, "camera.snap", req.Command)
+}
+
+func TestInvoke_GraceExpiresWithoutReconnect(t *testing.T) {
+    reg := NewRegistry()
+    inv := NewInvoker(reg)
+    inv.WithReconnectGrace(100 * time.Millisecond)
+
+    reg.Register(&NodeSession{
+        NodeID: "iphone-1", ConnID: "conn-1", DeviceID: "dev-1",
+        sendFunc: func(event string, payload any) error {
+            go func() {
+                reg.Unregister("conn-1")
+                inv.NodeDisconnected("iphone-1")
+            }()
+            return nil
+        },
+    })
+
+    start := time.Now()
+    _, err := inv.Invoke(context.Background(), InvokeRequest{
+        NodeID:    "iphone-1",
+        Command:   "camera.snap",
+        TimeoutMs: 5000,
+    })
+    require.Error(t, err)
+    assert.Contains(t, err.Error(), "disconnected")
+    assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+    assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestInvoke_CloseStopsGraceTimers(t *testing.T) {
+    reg := NewRegistry()
+    inv := NewInvoker(reg)
+    inv.WithReconnectGrace(time.Minute)
+
+    disconnected := make(chan struct{})
+    reg.Register(&NodeSession{
+        NodeID: "iphone-1", ConnID: "conn-1", DeviceID: "dev-1",
+        sendFunc: func(event string, payload any) error {
+            go func() {
+                reg.Unregister("conn-1")
+                inv.NodeDisconnected("iphone-1")
+                close(disconnected)
+            }()
+            return nil
+        },
+    })
+
+    done := make(chan error, 1)
+    go func() {
+        _, err := inv.Invoke(context.Background(), InvokeRequest{
+            NodeID:    "iphone-1",
+            Command:   "camera.snap",
+            TimeoutMs: 60000,
+        })
+        done <- err
+    }()
+
+    <-disconnected
+    inv.Close()
+
+    select {
+    case err := <-done:
+        assert.Error(t, err)
+    case <-time.After(time.Second):
+        t.Fatal("Invoke still waiting on the grace period after Close")
+    }
+    inv.mu.Lock()
+    assert.Empty(t, inv.graceTimers)
+    inv.mu.Unlock()
+}
+
 func TestInvoke_ContextCancelled(t *testing.T) {
     reg := NewRegistry()
     inv := NewInvoker(reg)
@@ -258,4 +598,262 @@ func TestHandleResult_UnknownID(t *testing.T) {
         ID: "nonexistent", NodeID: "iphone-1", OK: true,
     })
     assert.False(t, ok) // no pending invoke with that ID
-}
\ No newline at end of file
+}
+
+func TestHandleResult_WrongNode(t *testing.T) {
+    reg := NewRegistry()
+    inv := NewInvoker(reg)
+    session := &NodeSession{
+        NodeID: "iphone-1", ConnID: "conn-1",
+        sendFunc: func(event string, payload any) error {
+            req := payload.(NodeInvokeRequest)
+            go func() {
+                // Another node answering is dropped; the invoked one's
+                // result still gets through.
+                assert.False(t, inv.HandleResult(NodeInvokeResult{ID: req.ID, NodeID: "ipad-1", OK: false}))
+                inv.HandleResult(NodeInvokeResult{ID: req.ID, NodeID: "iphone-1", OK: true})
+            }()
+            return nil
+        },
+    }
+    reg.Register(session)
+    result, err := inv.Invoke(context.Background(), InvokeRequest{
+        NodeID: "iphone-1", Command: "camera.snap", TimeoutMs: 5000,
+    })
+    require.NoError(t, err)
+    assert.True(t, result.OK)
+}
+
+func TestHandleResult_LateResultsFlood(t *testing.T) {
+    reg := NewRegistry()
+    inv := NewInvoker(reg)
+    obs := &recordingObserver{}
+    inv.WithObserver(obs)
+    late := &obs.late
+
+    ids := make(chan string, 100)
+    reg.Register(&NodeSession{
+        NodeID: "iphone-1", ConnID: "conn-1",
+        sendFunc: func(event string, payload any) error {
+            ids <- payload.(NodeInvokeRequest).ID
+            return nil
+        },
+    })
+    baseline := runtime.NumGoroutine()
+
+    // Every invoke times out without an answer.
+    const n = 50
+    var wg sync.WaitGroup
+    for i := 0; i < n; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            _, err := inv.Invoke(context.Background(), InvokeRequest{
+                NodeID: "iphone-1", Command: "camera.snap", TimeoutMs: 20,
+            })
+            assert.Error(t, err)
+        }()
+    }
+    wg.Wait()
+    close(ids)
+
+    // Then the node answers each one, twice, all at once.
+    for id := range ids {
+        for range 2 {
+            wg.Add(1)
+            go func() {
+                defer wg.Done()
+                assert.False(t, inv.HandleResult(NodeInvokeResult{ID: id, NodeID: "iphone-1", OK: true}))
+            }()
+        }
+    }
+    wg.Wait()
+
+    assert.Equal(t, int64(2*n), late.Load())
+    assert.Equal(t, 0, inv.Pending())
+    deadline := time.Now().Add(time.Second)
+    for runtime.NumGoroutine() > baseline && time.Now().Before(deadline) {
+        time.Sleep(10 * time.Millisecond)
+    }
+    assert.LessOrEqual(t, runtime.NumGoroutine(), baseline, "goroutines leaked")
+
+    // A result for an ID that was never sent is not late.
+    inv.HandleResult(NodeInvokeResult{ID: "nonexistent", NodeID: "iphone-1", OK: true})
+    assert.Equal(t, int64(2*n), late.Load())
+}
+
+func TestInvoker_ReapsExpiredIDs(t *testing.T) {
+    inv := NewInvoker(NewRegistry())
+    now := time.Now()
+    inv.expired["old"] = now.Add(-lateResultWindow - time.Second)
+    inv.expired["new"] = now.Add(-time.Second)
+
+    inv.mu.Lock()
+    inv.reapLocked(now)
+    inv.mu.Unlock()
+
+    assert.NotContains(t, inv.expired, "old")
+    assert.Contains(t, inv.expired, "new")
+}
+
+func TestRegistry_LifecycleHooks(t *testing.T) {
+    reg := NewRegistry()
+    var registered, unregistered []string
+    reg.OnRegister(func(s *NodeSession) {
+        registered = append(registered, s.NodeID)
+        // Hooks run outside the registry lock.
+        _, ok := reg.Get(s.NodeID)
+        assert.True(t, ok)
+    })
+    reg.OnUnregister(func(nodeID string) { unregistered = append(unregistered, nodeID) })
+
+    noop := func(event string, payload any) error { return nil }
+    reg.Register(&NodeSession{NodeID: "iphone-1", ConnID: "conn-1", sendFunc: noop})
+    reg.Unregister("conn-1")
+    reg.Unregister("conn-1") // unknown conn: no hook
+
+    assert.Equal(t, []string{"iphone-1"}, registered)
+    assert.Equal(t, []string{"iphone-1"}, unregistered)
+}
+
+func TestInvoke_MaxInFlightSerializes(t *testing.T) {
+    reg := NewRegistry()
+    inv := NewInvoker(reg)
+    inv.WithMaxInFlightPerNode(1)
+
+    var mu sync.Mutex
+    inFlight, peak := 0, 0
+    session := &NodeSession{
+        NodeID: "iphone-1", ConnID: "conn-1",
+        sendFunc: func(event string, payload any) error {
+            req := payload.(NodeInvokeRequest)
+            mu.Lock()
+            inFlight++
+            peak = max(peak, inFlight)
+            mu.Unlock()
+            go func() {
+                time.Sleep(30 * time.Millisecond)
+                mu.Lock()
+                inFlight--
+                mu.Unlock()
+                inv.HandleResult(NodeInvokeResult{ID: req.ID, NodeID: "iphone-1", OK: true})
+            }()
+            return nil
+        },
+    }
+    reg.Register(session)
+
+    var wg sync.WaitGroup
+    errs := make([]error, 2)
+    for i := range errs {
+        wg.Add(1)
+        go func(idx int) {
+            defer wg.Done()
+            _, errs[idx] = inv.Invoke(context.Background(), InvokeRequest{
+                NodeID: "iphone-1", Command: "camera.snap", TimeoutMs: 5000,
+            })
+        }(i)
+    }
+    wg.Wait()
+
+    require.NoError(t, errs[0])
+    require.NoError(t, errs[1])
+    assert.Equal(t, 1, peak, "invokes should not overlap on the device")
+}
+
+func TestInvoke_QueuedInvokeTimesOut(t *testing.T) {
+    reg := NewRegistry()
+    inv := NewInvoker(reg)
+    inv.WithMaxInFlightPerNode(1)
+    var sent atomic.Int32
+    session := &NodeSession{
+        NodeID: "iphone-1", ConnID: "conn-1",
+        sendFunc: func(event string, payload any) error { sent.Add(1); return nil }, // never answers
+    }
+    reg.Register(session)
+
+    go inv.Invoke(context.Background(), InvokeRequest{NodeID: "iphone-1", Command: "camera.snap", TimeoutMs: 1000})
+    time.Sleep(20 * time.Millisecond)
+
+    _, err := inv.Invoke(context.Background(), InvokeRequest{NodeID: "iphone-1", Command: "camera.snap", TimeoutMs: 50})
+    require.Error(t, err)
+    assert.Contains(t, err.Error(), "queued")
+    assert.Equal(t, int32(1), sent.Load(), "queued invoke must not reach the device")
+}
+
+func TestInvoke_SlotsPrunedWhenNodeLeaves(t *testing.T) {
+    reg := NewRegistry()
+    inv := NewInvoker(reg)
+    inv.WithMaxInFlightPerNode(1)
+    reg.OnUnregister(inv.NodeDisconnected)
+    slots := func() int {
+        inv.mu.Lock()
+        defer inv.mu.Unlock()
+        return len(inv.slots)
+    }
+
+    // Nothing in flight: the slot goes with the session.
+    answer := func(event string, payload any) error {
+        req := payload.(NodeInvokeRequest)
+        go inv.HandleResult(NodeInvokeResult{ID: req.ID, NodeID: req.NodeID, OK: true})
+        return nil
+    }
+    reg.Register(&NodeSession{NodeID: "iphone-1", ConnID: "conn-1", sendFunc: answer})
+    _, err := inv.Invoke(context.Background(), InvokeRequest{NodeID: "iphone-1", Command: "camera.snap", TimeoutMs: 1000})
+    require.NoError(t, err)
+    assert.Equal(t, 1, slots())
+    reg.Unregister("conn-1")
+    assert.Equal(t, 0, slots())
+
+    // In flight: the slot goes once the cancelled invoke releases it.
+    sent := make(chan struct{})
+    reg.Register(&NodeSession{NodeID: "iphone-2", ConnID: "conn-2", sendFunc: func(string, any) error {
+        close(sent)
+        return nil
+    }})
+    done := make(chan error)
+    go func() {
+        _, err := inv.Invoke(context.Background(), InvokeRequest{NodeID: "iphone-2", Command: "camera.snap", TimeoutMs: 5000})
+        done <- err
+    }()
+    <-sent
+    reg.Unregister("conn-2")
+    require.Error(t, <-done)
+    assert.Equal(t, 0, slots())
+}
+
+func TestOperatorRegistry(t *testing.T) {
+    reg := NewOperatorRegistry()
+    noop := func(event string, payload any) error { return nil }
+    var gone []string
+    reg.OnUnregister(func(s *OperatorSession) { gone = append(gone, s.ConnID) })
+
+    admin := NewOperatorSession("conn-1", "console", "Console", "macos", []string{"operator.admin"}, noop)
+    admin.DeviceID = "dev-a"
+    reg.Register(admin)
+    viewer := NewOperatorSession("conn-2", "console", "Viewer", "ios", []string{"operator.read"}, noop)
+    viewer.ConnectedAt = admin.ConnectedAt.Add(time.Second)
+    reg.Register(viewer)
+
+    got, ok := reg.Get("conn-1")
+    require.True(t, ok)
+    assert.Equal(t, "dev-a", got.DeviceID)
+    assert.Equal(t, 2, reg.Len())
+
+    list := reg.List()
+    require.Len(t, list, 2)
+    assert.Equal(t, "conn-1", list[0].ConnID, "oldest first")
+    assert.Equal(t, "conn-2", list[1].ConnID)
+
+    admins := reg.ListWithScope("operator.admin")
+    require.Len(t, admins, 1)
+    assert.Equal(t, "Console", admins[0].DisplayName)
+
+    removed, ok := reg.Unregister("conn-1")
+    require.True(t, ok)
+    assert.Same(t, admin, removed)
+    _, ok = reg.Unregister("conn-1")
+    assert.False(t, ok)
+    assert.Equal(t, []string{"conn-1"}, gone)
+    assert.Equal(t, 1, reg.Len())
+}
@@ -0,0 +1,116 @@
+package pairing
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/rvald/goclaw/internal/netutil"
+)
+
+// AutoApprovePolicy decides which unpaired devices CheckPairingStatus
+// approves without an operator. A key change for a paired device ID is
+// never auto-approved. The zero value is loopback-only.
+type AutoApprovePolicy struct {
+	mode string // "loopback-only", "none", "tofu" or "cidr"
+	nets []*net.IPNet
+}
+
+// ParseAutoApprovePolicy parses "loopback-only" (or ""), "none", "tofu",
+// or "cidr:<list>" with a comma-separated list of CIDRs or bare IPs, e.g.
+// "cidr:192.168.1.0/24,10.0.0.5". A cidr policy matches only the listed
+// ranges; include 127.0.0.0/8 to keep approving loopback.
+//
+// tofu (trust on first use) approves loopback like loopback-only, and also
+// the first device seen from each remote IP: a device ID that was never
+// paired, from an IP no paired device came from. Later devices from that
+// IP, and key changes, need an operator. Anyone on the network can win
+// the first connect, so tofu is never a default.
+//
+// Off loopback, tofu and cidr approve only new node devices, never a key
+// change, and grant them the node default scopes (see WithRoleDefaultScopes) whatever they ask.
+// Their requests still count against the pending limits (see Limits).
+func ParseAutoApprovePolicy(spec string) (AutoApprovePolicy, error) {
+	switch spec {
+	case "", "loopback-only":
+		return AutoApprovePolicy{mode: "loopback-only"}, nil
+	case "none", "tofu":
+		return AutoApprovePolicy{mode: spec}, nil
+	}
+	list, ok := strings.CutPrefix(spec, "cidr:")
+	if !ok {
+		return AutoApprovePolicy{}, fmt.Errorf("unknown auto-approve policy %q (want loopback-only, none, tofu or cidr:<list>)", spec)
+	}
+	nets, err := netutil.ParseCIDRs(strings.Split(list, ","))
+	if err != nil {
+		return AutoApprovePolicy{}, fmt.Errorf("invalid auto-approve policy: %w", err)
+	}
+	p := AutoApprovePolicy{mode: "cidr", nets: nets}
+	if len(p.nets) == 0 {
+		return AutoApprovePolicy{}, fmt.Errorf("auto-approve policy %q lists no CIDRs", spec)
+	}
+	return p, nil
+}
+
+// String returns the policy in the form ParseAutoApprovePolicy accepts.
+func (p AutoApprovePolicy) String() string {
+	if p.mode != "cidr" {
+		if p.mode == "" {
+			return "loopback-only"
+		}
+		return p.mode
+	}
+	specs := make([]string, len(p.nets))
+	for i, n := range p.nets {
+		specs[i] = n.String()
+	}
+	return "cidr:" + strings.Join(specs, ",")
+}
+
+// IsTOFU reports whether p is the tofu policy.
+func (p AutoApprovePolicy) IsTOFU() bool {
+	return p.mode == "tofu"
+}
+
+// allows reports whether the device described by params is auto-approved.
+// Off loopback only the node role is approved, and never a key change for
+// a paired device ID: any key may claim a paired ID, so that would hand
+// the device to whoever asks. An operator device always needs an operator.
+func (p AutoApprovePolicy) allows(params CheckPairingParams, store *Store) bool {
+	if !params.IsLocal && params.Role != "node" {
+		return false
+	}
+	switch p.mode {
+	case "none":
+		return false
+	case "tofu":
+		if params.IsLocal {
+			return true
+		}
+		if params.RemoteIP == "" || store.GetPairedDevice(params.DeviceID) != nil {
+			return false
+		}
+		for _, d := range store.ListPaired() {
+			if d.RemoteIP == params.RemoteIP {
+				return false
+			}
+		}
+		return true
+	case "cidr":
+		ip := net.ParseIP(params.RemoteIP)
+		if ip == nil {
+			return false
+		}
+		if !params.IsLocal && store.GetPairedDevice(params.DeviceID) != nil {
+			return false
+		}
+		for _, n := range p.nets {
+			if n.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	default:
+		return params.IsLocal
+	}
+}
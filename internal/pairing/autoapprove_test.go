@@ -0,0 +1,265 @@
+package pairing
+
+import (
+	"slices"
+	"sync"
+	"testing"
+)
+
+func TestParseAutoApprovePolicy(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    string // String() of the parsed policy
+		wantErr bool
+	}{
+		{spec: "", want: "loopback-only"},
+		{spec: "loopback-only", want: "loopback-only"},
+		{spec: "none", want: "none"},
+		{spec: "tofu", want: "tofu"},
+		{spec: "cidr:192.168.1.0/24", want: "cidr:192.168.1.0/24"},
+		{spec: "cidr:10.0.0.0/8, 192.168.1.5", want: "cidr:10.0.0.0/8,192.168.1.5/32"},
+		{spec: "cidr:", wantErr: true},
+		{spec: "cidr:10.0.0.0/33", wantErr: true},
+		{spec: "cidr:not-an-ip", wantErr: true},
+		{spec: "always", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			p, err := ParseAutoApprovePolicy(tt.spec)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseAutoApprovePolicy(%q) = %v, want error", tt.spec, p)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseAutoApprovePolicy(%q): %v", tt.spec, err)
+			}
+			if got := p.String(); got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckPairingStatus_AutoApprovePolicy(t *testing.T) {
+	loopback := CheckPairingParams{RemoteIP: "127.0.0.1", IsLocal: true}
+	lan := CheckPairingParams{RemoteIP: "192.168.1.20"}
+	remote := CheckPairingParams{RemoteIP: "203.0.113.7"}
+
+	tests := []struct {
+		name   string
+		policy string
+		params CheckPairingParams
+		want   string // expected Status
+	}{
+		{name: "default approves loopback", policy: "", params: loopback, want: "auto-approved"},
+		{name: "loopback-only approves loopback", policy: "loopback-only", params: loopback, want: "auto-approved"},
+		{name: "loopback-only requires pairing for lan", policy: "loopback-only", params: lan, want: "pairing-required"},
+		{name: "none requires pairing for loopback", policy: "none", params: loopback, want: "pairing-required"},
+		{name: "cidr approves listed range", policy: "cidr:192.168.1.0/24", params: lan, want: "auto-approved"},
+		{name: "cidr requires pairing outside range", policy: "cidr:192.168.1.0/24", params: remote, want: "pairing-required"},
+		{name: "cidr without loopback requires pairing for loopback", policy: "cidr:192.168.1.0/24", params: loopback, want: "pairing-required"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, store := newTestService(t)
+			policy, err := ParseAutoApprovePolicy(tt.policy)
+			if err != nil {
+				t.Fatalf("ParseAutoApprovePolicy(%q): %v", tt.policy, err)
+			}
+			svc.WithAutoApprovePolicy(policy)
+
+			params := tt.params
+			params.PublicKey, params.DeviceID = makeTestKeypair(t)
+			params.Role = "node"
+
+			action := svc.CheckPairingStatus(params)
+			if action.Status != tt.want {
+				t.Errorf("Status = %q, want %q", action.Status, tt.want)
+			}
+			paired := store.GetPairedDevice(params.DeviceID) != nil
+			if paired != (tt.want == "auto-approved") {
+				t.Errorf("device paired = %v after %q", paired, action.Status)
+			}
+		})
+	}
+}
+
+func TestCheckPairingStatus_CIDRAutoApproveIsRateLimited(t *testing.T) {
+	svc, store := newTestService(t)
+	policy, err := ParseAutoApprovePolicy("cidr:192.168.1.0/24")
+	if err != nil {
+		t.Fatalf("ParseAutoApprovePolicy: %v", err)
+	}
+	svc.WithAutoApprovePolicy(policy)
+	svc.WithLimits(Limits{PerIPPerMinute: 1, PerIPBurst: 1})
+
+	var statuses []string
+	for range 2 {
+		pub, id := makeTestKeypair(t)
+		statuses = append(statuses, svc.CheckPairingStatus(CheckPairingParams{
+			DeviceID: id, PublicKey: pub, Role: "node", RemoteIP: "192.168.1.20",
+		}).Status)
+	}
+	if statuses[0] != "auto-approved" || statuses[1] != "rate-limited" {
+		t.Errorf("statuses = %v, want [auto-approved rate-limited]", statuses)
+	}
+	if got := len(store.ListPaired()); got != 1 {
+		t.Errorf("paired devices = %d, want 1", got)
+	}
+}
+
+func TestCheckPairingStatus_CIDRKeyChangeRequiresPairing(t *testing.T) {
+	svc, store := newTestService(t)
+	policy, err := ParseAutoApprovePolicy("cidr:192.168.1.0/24")
+	if err != nil {
+		t.Fatalf("ParseAutoApprovePolicy: %v", err)
+	}
+	svc.WithAutoApprovePolicy(policy)
+
+	pub, id := makeTestKeypair(t)
+	if action := svc.CheckPairingStatus(CheckPairingParams{
+		DeviceID: id, PublicKey: pub, Role: "node", RemoteIP: "192.168.1.20",
+	}); action.Status != "auto-approved" || action.IsRepair {
+		t.Fatalf("first connect: Status = %q IsRepair = %v, want auto-approved", action.Status, action.IsRepair)
+	}
+
+	// Another host in the range claims the paired ID with its own key.
+	attackerPub, _ := makeTestKeypair(t)
+	action := svc.CheckPairingStatus(CheckPairingParams{
+		DeviceID: id, PublicKey: attackerPub, Role: "node", RemoteIP: "192.168.1.66",
+	})
+	if action.Status != "pairing-required" || !action.IsRepair {
+		t.Errorf("key change: Status = %q IsRepair = %v, want pairing-required repair", action.Status, action.IsRepair)
+	}
+	if d := store.GetPairedDevice(id); d.PublicKey != pub || d.HasPublicKey(attackerPub) {
+		t.Errorf("paired device took the new key: %+v", d)
+	}
+}
+
+func TestCheckPairingStatus_TOFU(t *testing.T) {
+	svc, store := newTestService(t)
+	policy, err := ParseAutoApprovePolicy("tofu")
+	if err != nil {
+		t.Fatalf("ParseAutoApprovePolicy: %v", err)
+	}
+	svc.WithAutoApprovePolicy(policy)
+
+	check := func(pub, id, ip string) PairingAction {
+		t.Helper()
+		return svc.CheckPairingStatus(CheckPairingParams{
+			DeviceID: id, PublicKey: pub, Role: "node", RemoteIP: ip,
+		})
+	}
+
+	// The first device from an IP is approved and pinned to its key.
+	pub, id := makeTestKeypair(t)
+	if action := check(pub, id, "192.168.1.20"); action.Status != "auto-approved" {
+		t.Fatalf("first connect: Status = %q, want auto-approved", action.Status)
+	}
+	if d := store.GetPairedDevice(id); d == nil || d.PublicKey != pub || d.RemoteIP != "192.168.1.20" {
+		t.Fatalf("first connect: paired device = %+v", d)
+	}
+	if action := check(pub, id, "192.168.1.20"); action.Status != "paired" {
+		t.Errorf("reconnect: Status = %q, want paired", action.Status)
+	}
+
+	// A key change needs an operator, even from the same IP.
+	newPub, _ := makeTestKeypair(t)
+	if action := check(newPub, id, "192.168.1.20"); action.Status != "pairing-required" || !action.IsRepair {
+		t.Errorf("key change: Status = %q IsRepair = %v, want pairing-required repair", action.Status, action.IsRepair)
+	}
+
+	// So does a second device from the same IP.
+	otherPub, otherID := makeTestKeypair(t)
+	if action := check(otherPub, otherID, "192.168.1.20"); action.Status != "pairing-required" {
+		t.Errorf("second device on IP: Status = %q, want pairing-required", action.Status)
+	}
+
+	// A device from a new IP gets its own first connect.
+	lastPub, lastID := makeTestKeypair(t)
+	if action := check(lastPub, lastID, "192.168.1.21"); action.Status != "auto-approved" {
+		t.Errorf("first device on new IP: Status = %q, want auto-approved", action.Status)
+	}
+}
+
+func TestCheckPairingStatus_TOFUGrantsNoOperatorScopes(t *testing.T) {
+	svc, store := newTestService(t)
+	policy, err := ParseAutoApprovePolicy("tofu")
+	if err != nil {
+		t.Fatalf("ParseAutoApprovePolicy: %v", err)
+	}
+	svc.WithAutoApprovePolicy(policy)
+	svc.WithRoleDefaultScopes(map[string][]string{"node": {"camera"}})
+
+	// An operator asking for admin from the LAN needs an operator.
+	pub, id := makeTestKeypair(t)
+	action := svc.CheckPairingStatus(CheckPairingParams{
+		DeviceID: id, PublicKey: pub, Role: "operator", Scopes: []string{"operator.admin"}, RemoteIP: "192.168.1.20",
+	})
+	if action.Status != "pairing-required" {
+		t.Fatalf("operator connect: Status = %q, want pairing-required", action.Status)
+	}
+	if store.GetPairedDevice(id) != nil {
+		t.Fatal("operator device was paired without approval")
+	}
+
+	// A node asking for admin is approved with the node defaults only.
+	pub, id = makeTestKeypair(t)
+	action = svc.CheckPairingStatus(CheckPairingParams{
+		DeviceID: id, PublicKey: pub, Role: "node", Scopes: []string{"operator.admin", "camera"}, RemoteIP: "192.168.1.21",
+	})
+	if action.Status != "auto-approved" {
+		t.Fatalf("node connect: Status = %q, want auto-approved", action.Status)
+	}
+	if got := action.Device.GrantedScopes("node", []string{"operator.admin", "camera"}); !slices.Equal(got, []string{"camera"}) {
+		t.Errorf("granted scopes = %q, want [camera]", got)
+	}
+	tok := svc.EnsureDeviceToken(id, "node", []string{"operator.admin"})
+	if tok == nil || slices.Contains(tok.Scopes, "operator.admin") {
+		t.Errorf("device token = %+v, want no operator.admin", tok)
+	}
+}
+
+func TestCheckPairingStatus_TOFUConcurrentFirstConnects(t *testing.T) {
+	svc, store := newTestService(t)
+	policy, err := ParseAutoApprovePolicy("tofu")
+	if err != nil {
+		t.Fatalf("ParseAutoApprovePolicy: %v", err)
+	}
+	svc.WithAutoApprovePolicy(policy)
+
+	const n = 8
+	statuses := make([]string, n)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := range n {
+		pub, id := makeTestKeypair(t)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			statuses[i] = svc.CheckPairingStatus(CheckPairingParams{
+				DeviceID: id, PublicKey: pub, Role: "node", RemoteIP: "192.168.1.20",
+			}).Status
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	approved := 0
+	for _, s := range statuses {
+		if s == "auto-approved" {
+			approved++
+		}
+	}
+	if approved != 1 {
+		t.Errorf("auto-approved %d of %d concurrent first connects from one IP, want 1 (statuses %v)", approved, n, statuses)
+	}
+	if got := len(store.ListPaired()); got != 1 {
+		t.Errorf("paired devices = %d, want 1", got)
+	}
+}
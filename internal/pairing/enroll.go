@@ -0,0 +1,120 @@
+package pairing
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// EnrollmentScheme and EnrollmentHost form the prefix of every
+	// enrollment payload: openclaw://pair?v=1&url=...&token=...&exp=...
+	EnrollmentScheme = "openclaw"
+	EnrollmentHost   = "pair"
+
+	// EnrollmentVersion is bumped whenever the payload fields change.
+	EnrollmentVersion = 1
+
+	// EnrollmentTTL is how long a generated payload stays valid.
+	EnrollmentTTL = 10 * time.Minute
+)
+
+// Enrollment is the decoded content of an enrollment QR payload.
+type Enrollment struct {
+	Version    int
+	GatewayURL string // ws:// or wss:// URL of the gateway endpoint
+	Token      string // optional gateway auth token
+	ExpiresAt  time.Time
+}
+
+// BuildEnrollmentQR builds a versioned enrollment payload suitable for QR
+// encoding. gatewayAddr is either a ws(s):// URL or a bare host:port, in
+// which case ws://host:port/ws is assumed. authToken may be empty.
+func BuildEnrollmentQR(gatewayAddr, authToken string) (string, error) {
+	gatewayURL, err := normalizeGatewayURL(gatewayAddr)
+	if err != nil {
+		return "", err
+	}
+
+	q := url.Values{}
+	q.Set("v", strconv.Itoa(EnrollmentVersion))
+	q.Set("url", gatewayURL)
+	if authToken != "" {
+		q.Set("token", authToken)
+	}
+	q.Set("exp", strconv.FormatInt(time.Now().Add(EnrollmentTTL).Unix(), 10))
+
+	u := url.URL{Scheme: EnrollmentScheme, Host: EnrollmentHost, RawQuery: q.Encode()}
+	return u.String(), nil
+}
+
+// ParseEnrollmentQR decodes a payload produced by BuildEnrollmentQR.
+// It rejects malformed, unsupported-version and expired payloads.
+func ParseEnrollmentQR(payload string) (*Enrollment, error) {
+	u, err := url.Parse(strings.TrimSpace(payload))
+	if err != nil {
+		return nil, fmt.Errorf("malformed enrollment payload: %w", err)
+	}
+	if u.Scheme != EnrollmentScheme || u.Host != EnrollmentHost {
+		return nil, fmt.Errorf("malformed enrollment payload: expected %s://%s", EnrollmentScheme, EnrollmentHost)
+	}
+
+	q := u.Query()
+	version, err := strconv.Atoi(q.Get("v"))
+	if err != nil {
+		return nil, fmt.Errorf("malformed enrollment payload: missing version")
+	}
+	if version != EnrollmentVersion {
+		return nil, fmt.Errorf("unsupported enrollment version %d", version)
+	}
+
+	gatewayURL, err := normalizeGatewayURL(q.Get("url"))
+	if err != nil {
+		return nil, err
+	}
+
+	exp, err := strconv.ParseInt(q.Get("exp"), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("malformed enrollment payload: missing expiry")
+	}
+	expiresAt := time.Unix(exp, 0)
+	if time.Now().After(expiresAt) {
+		return nil, fmt.Errorf("enrollment payload expired at %s", expiresAt.Format(time.RFC3339))
+	}
+
+	return &Enrollment{
+		Version:    version,
+		GatewayURL: gatewayURL,
+		Token:      q.Get("token"),
+		ExpiresAt:  expiresAt,
+	}, nil
+}
+
+// normalizeGatewayURL turns host:port into ws://host:port/ws and validates
+// explicit ws(s):// URLs.
+func normalizeGatewayURL(addr string) (string, error) {
+	if addr == "" {
+		return "", fmt.Errorf("gateway address is required")
+	}
+	if !strings.Contains(addr, "://") {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return "", fmt.Errorf("invalid gateway address %q: %w", addr, err)
+		}
+		return "ws://" + addr + "/ws", nil
+	}
+
+	u, err := url.Parse(addr)
+	if err != nil {
+		return "", fmt.Errorf("invalid gateway URL %q: %w", addr, err)
+	}
+	if u.Scheme != "ws" && u.Scheme != "wss" {
+		return "", fmt.Errorf("invalid gateway URL %q: scheme must be ws or wss", addr)
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("invalid gateway URL %q: missing host", addr)
+	}
+	return u.String(), nil
+}
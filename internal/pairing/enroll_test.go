@@ -0,0 +1,105 @@
+package pairing
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEnrollmentQRRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		addr    string
+		token   string
+		wantURL string
+	}{
+		{
+			name:    "host:port with token",
+			addr:    "192.168.1.20:18789",
+			token:   "tok_abc",
+			wantURL: "ws://192.168.1.20:18789/ws",
+		},
+		{
+			name:    "explicit wss URL without token",
+			addr:    "wss://gw.example.com/ws",
+			wantURL: "wss://gw.example.com/ws",
+		},
+		{
+			name:    "ipv6 host",
+			addr:    "[fe80::1]:18789",
+			wantURL: "ws://[fe80::1]:18789/ws",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, err := BuildEnrollmentQR(tt.addr, tt.token)
+			if err != nil {
+				t.Fatalf("BuildEnrollmentQR: %v", err)
+			}
+			if !strings.HasPrefix(payload, "openclaw://pair?") {
+				t.Errorf("payload %q missing openclaw://pair prefix", payload)
+			}
+
+			got, err := ParseEnrollmentQR(payload)
+			if err != nil {
+				t.Fatalf("ParseEnrollmentQR: %v", err)
+			}
+			if got.Version != EnrollmentVersion {
+				t.Errorf("Version = %d, want %d", got.Version, EnrollmentVersion)
+			}
+			if got.GatewayURL != tt.wantURL {
+				t.Errorf("GatewayURL = %q, want %q", got.GatewayURL, tt.wantURL)
+			}
+			if got.Token != tt.token {
+				t.Errorf("Token = %q, want %q", got.Token, tt.token)
+			}
+			if time.Until(got.ExpiresAt) <= 0 || time.Until(got.ExpiresAt) > EnrollmentTTL {
+				t.Errorf("ExpiresAt = %v, want within %v", got.ExpiresAt, EnrollmentTTL)
+			}
+		})
+	}
+}
+
+func TestBuildEnrollmentQR_InvalidAddr(t *testing.T) {
+	for _, addr := range []string{"", "no-port", "http://gw.example.com/ws", "ws://"} {
+		if _, err := BuildEnrollmentQR(addr, ""); err == nil {
+			t.Errorf("BuildEnrollmentQR(%q) expected error", addr)
+		}
+	}
+}
+
+func TestParseEnrollmentQR_Rejects(t *testing.T) {
+	future := strconv.FormatInt(time.Now().Add(time.Minute).Unix(), 10)
+	past := strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10)
+	gw := url.QueryEscape("ws://10.0.0.1:18789/ws")
+
+	tests := []struct {
+		name    string
+		payload string
+		wantErr string
+	}{
+		{name: "empty", payload: "", wantErr: "malformed"},
+		{name: "garbage", payload: "%%%not a url", wantErr: "malformed"},
+		{name: "wrong scheme", payload: "https://pair?v=1&url=" + gw + "&exp=" + future, wantErr: "malformed"},
+		{name: "missing version", payload: "openclaw://pair?url=" + gw + "&exp=" + future, wantErr: "missing version"},
+		{name: "future version", payload: "openclaw://pair?v=2&url=" + gw + "&exp=" + future, wantErr: "unsupported"},
+		{name: "missing url", payload: "openclaw://pair?v=1&exp=" + future, wantErr: "gateway address"},
+		{name: "missing expiry", payload: "openclaw://pair?v=1&url=" + gw, wantErr: "missing expiry"},
+		{name: "expired", payload: "openclaw://pair?v=1&url=" + gw + "&exp=" + past, wantErr: "expired"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseEnrollmentQR(tt.payload)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error %q does not contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package pairing
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ExportVersion is the envelope version written by Export. Import refuses
+// any other version.
+const ExportVersion = 1
+
+// ErrExportVersion is returned by Import for an envelope it cannot read.
+var ErrExportVersion = errors.New("unsupported export version")
+
+// ExportEnvelope wraps the pairing state for moving it between gateways.
+type ExportEnvelope struct {
+	Version      int          `json:"version"`
+	ExportedAtMs int64        `json:"exportedAtMs"`
+	State        PairingState `json:"state"`
+}
+
+// Export serializes the full pairing state (pending requests, paired
+// devices and their tokens) as an ExportEnvelope.
+func (s *Store) Export() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Marshal under the lock: token maps are shared with the live state.
+	data, err := json.MarshalIndent(ExportEnvelope{
+		Version:      ExportVersion,
+		ExportedAtMs: time.Now().UnixMilli(),
+		State:        s.state,
+	}, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("marshal export: %w", err)
+	}
+	return data, nil
+}
+
+// Import loads an envelope produced by Export and persists it. With merge
+// the imported entries are added to the current state, replacing devices
+// and requests with the same ID; otherwise the current state is replaced.
+// Every imported device ID must derive from one of the device's approved
+// keys, and every pending request's from its own key or, for a repair,
+// from its paired device's keys. The in-memory state only changes once
+// both files are saved.
+func (s *Store) Import(data []byte, merge bool) error {
+	var env ExportEnvelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return fmt.Errorf("unmarshal export: %w", err)
+	}
+	if env.Version != ExportVersion {
+		return fmt.Errorf("%w: %d (want %d)", ErrExportVersion, env.Version, ExportVersion)
+	}
+
+	pending := make(map[string]PendingRequest)
+	paired := make(map[string]PairedDevice)
+	for id, req := range env.State.PendingByID {
+		if req.RequestID != id {
+			return fmt.Errorf("pending request %q: requestId %q does not match key", id, req.RequestID)
+		}
+		pending[id] = req
+	}
+	for id, dev := range env.State.PairedByDevice {
+		if dev.DeviceID != id {
+			return fmt.Errorf("paired device %q: deviceId %q does not match key", id, dev.DeviceID)
+		}
+		if !dev.OwnsDeviceID() {
+			return fmt.Errorf("paired device %q: deviceId does not match public key", id)
+		}
+		if dev.Tokens == nil {
+			dev.Tokens = make(map[string]DeviceAuthToken)
+		}
+		paired[id] = dev
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if merge {
+		for id, req := range s.state.PendingByID {
+			if _, ok := pending[id]; !ok {
+				pending[id] = req
+			}
+		}
+		for id, dev := range s.state.PairedByDevice {
+			if _, ok := paired[id]; !ok {
+				paired[id] = dev
+			}
+		}
+	}
+	// Checked against the merged devices: a repair request may be for a
+	// device that is only paired locally.
+	for id, req := range env.State.PendingByID {
+		if DeriveDeviceID(req.PublicKey) == req.DeviceID {
+			continue
+		}
+		if dev, ok := paired[req.DeviceID]; !ok || !dev.OwnsDeviceID() {
+			return fmt.Errorf("pending request %q: deviceId %q does not match public key", id, req.DeviceID)
+		}
+	}
+
+	if err := s.saveJSON("pending.json", pending); err != nil {
+		return err
+	}
+	if err := s.saveJSON("paired.json", paired); err != nil {
+		// Put back the pending requests that match the unchanged state.
+		if restoreErr := s.savePending(); restoreErr != nil {
+			return errors.Join(err, restoreErr)
+		}
+		return err
+	}
+	s.state.PendingByID = pending
+	s.state.PairedByDevice = paired
+	return nil
+}
@@ -0,0 +1,215 @@
+package pairing
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// seedExportStore returns a store with three paired devices and one
+// pending request, and the paired device IDs.
+func seedExportStore(t *testing.T) (*Store, []string) {
+	t.Helper()
+	s := newTestStore(t)
+	var ids []string
+	for i := range 3 {
+		pub, id := makeTestKeypair(t)
+		ids = append(ids, id)
+		dev := PairedDevice{
+			DeviceID:     id,
+			PublicKey:    pub,
+			DisplayName:  "Phone " + id,
+			Role:         "node",
+			Scopes:       []string{"camera.snap"},
+			CreatedAtMs:  1000,
+			ApprovedAtMs: int64(2000 + i), // distinct, so ListPaired order is stable
+			Tokens: map[string]DeviceAuthToken{
+				"node":     {Token: "tok-node-" + id, Role: "node", Scopes: []string{"camera.snap"}, CreatedAtMs: 2000},
+				"operator": {Token: "tok-op-" + id, Role: "operator", CreatedAtMs: 2000, RevokedAtMs: 3000},
+			},
+		}
+		if err := s.SetPaired(dev); err != nil {
+			t.Fatalf("SetPaired: %v", err)
+		}
+	}
+	pub, id := makeTestKeypair(t)
+	req := makePending("req-1", id, 4000)
+	req.PublicKey = pub
+	if err := s.AddPending(req); err != nil {
+		t.Fatalf("AddPending: %v", err)
+	}
+	return s, ids
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	src, ids := seedExportStore(t)
+
+	// A rotated device keeps the ID of its first key, and a pending
+	// repair carries the next key under that same ID.
+	oldPub, rotatedID := makeTestKeypair(t)
+	newPub, _ := makeTestKeypair(t)
+	nextPub, _ := makeTestKeypair(t)
+	if err := src.SetPaired(PairedDevice{
+		DeviceID:     rotatedID,
+		PublicKey:    newPub,
+		PublicKeys:   []string{oldPub, newPub},
+		Role:         "node",
+		ApprovedAtMs: 5000,
+		Tokens: map[string]DeviceAuthToken{
+			"node": {Token: "tok-node-rotated", Role: "node", CreatedAtMs: 5000},
+		},
+	}); err != nil {
+		t.Fatalf("SetPaired: %v", err)
+	}
+	repair := makePending("req-repair", rotatedID, 6000)
+	repair.PublicKey = nextPub
+	repair.IsRepair = true
+	if err := src.AddPending(repair); err != nil {
+		t.Fatalf("AddPending: %v", err)
+	}
+
+	data, err := src.Export()
+	if err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+
+	dst := newTestStore(t)
+	if err := dst.AddPending(makePending("req-stale", "dev-x", 1)); err != nil {
+		t.Fatalf("AddPending: %v", err)
+	}
+	if err := dst.Import(data, false); err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+
+	// Reopen to check what was persisted, not just the in-memory state.
+	reopened, err := NewStore(dst.stateDir)
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	if !reflect.DeepEqual(reopened.ListPaired(), src.ListPaired()) {
+		t.Errorf("paired mismatch:\n got %+v\nwant %+v", reopened.ListPaired(), src.ListPaired())
+	}
+	if !reflect.DeepEqual(reopened.ListPending(), src.ListPending()) {
+		t.Errorf("pending mismatch:\n got %+v\nwant %+v", reopened.ListPending(), src.ListPending())
+	}
+	if tok := reopened.GetPairedDevice(ids[1]).Tokens["operator"]; tok.RevokedAtMs != 3000 {
+		t.Errorf("operator token RevokedAtMs = %d, want 3000", tok.RevokedAtMs)
+	}
+}
+
+func TestImportMerge(t *testing.T) {
+	src, ids := seedExportStore(t)
+	data, err := src.Export()
+	if err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+
+	dst := newTestStore(t)
+	if err := dst.SetPaired(PairedDevice{DeviceID: "dev-local", PublicKey: "key-local"}); err != nil {
+		t.Fatalf("SetPaired: %v", err)
+	}
+	if err := dst.SetPaired(PairedDevice{DeviceID: ids[0], PublicKey: "old-key"}); err != nil {
+		t.Fatalf("SetPaired: %v", err)
+	}
+	if err := dst.Import(data, true); err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+
+	if got := len(dst.ListPaired()); got != 4 {
+		t.Errorf("paired = %d, want 4", got)
+	}
+	if dst.GetPairedDevice("dev-local") == nil {
+		t.Error("merge dropped existing device")
+	}
+	if got, want := dst.GetPairedDevice(ids[0]).PublicKey, src.GetPairedDevice(ids[0]).PublicKey; got != want {
+		t.Errorf("PublicKey = %q, want imported key %q", got, want)
+	}
+}
+
+func TestImportRejectsBadEnvelope(t *testing.T) {
+	pub, _ := makeTestKeypair(t)
+	tests := []struct {
+		name    string
+		data    string
+		wantErr error
+		wantMsg string
+	}{
+		{name: "future version", data: `{"version":2,"state":{}}`, wantErr: ErrExportVersion},
+		{name: "missing version", data: `{"state":{}}`, wantErr: ErrExportVersion},
+		{name: "not json", data: `pending`, wantMsg: "unmarshal export"},
+		{
+			name:    "device ID mismatch",
+			data:    `{"version":1,"state":{"pairedByDeviceId":{"dev-a":{"deviceId":"dev-b"}}}}`,
+			wantMsg: "does not match key",
+		},
+		{
+			name:    "device ID not derived from key",
+			data:    fmt.Sprintf(`{"version":1,"state":{"pairedByDeviceId":{"dev-a":{"deviceId":"dev-a","publicKey":%q}}}}`, pub),
+			wantMsg: "does not match public key",
+		},
+		{
+			name:    "pending device ID not derived from key",
+			data:    fmt.Sprintf(`{"version":1,"state":{"pendingById":{"req-1":{"requestId":"req-1","deviceId":"dev-a","publicKey":%q}}}}`, pub),
+			wantMsg: "does not match public key",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := seedExportStore(t)
+			err := s.Import([]byte(tt.data), false)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantMsg != "" && !strings.Contains(err.Error(), tt.wantMsg) {
+				t.Errorf("err = %v, want it to contain %q", err, tt.wantMsg)
+			}
+			if got := len(s.ListPaired()); got != 3 {
+				t.Errorf("paired = %d after failed import, want 3", got)
+			}
+		})
+	}
+}
+
+func TestImportSaveFailureKeepsState(t *testing.T) {
+	src, _ := seedExportStore(t)
+	data, err := src.Export()
+	if err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+
+	dst, ids := seedExportStore(t)
+	wantPaired, wantPending := dst.ListPaired(), dst.ListPending()
+	// A directory in the way of the temp file makes saving paired.json fail
+	// after pending.json was written.
+	if err := os.Mkdir(filepath.Join(dst.stateDir, "paired.json.tmp"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := dst.Import(data, false); err == nil {
+		t.Fatal("expected error")
+	}
+
+	if !reflect.DeepEqual(dst.ListPaired(), wantPaired) {
+		t.Errorf("paired changed after failed import: %+v", dst.ListPaired())
+	}
+	if !reflect.DeepEqual(dst.ListPending(), wantPending) {
+		t.Errorf("pending changed after failed import: %+v", dst.ListPending())
+	}
+	reopened, err := NewStore(dst.stateDir)
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	if !reflect.DeepEqual(reopened.ListPending(), wantPending) {
+		t.Errorf("pending.json not restored: %+v", reopened.ListPending())
+	}
+	if reopened.GetPairedDevice(ids[0]) == nil {
+		t.Error("paired.json lost a device")
+	}
+}
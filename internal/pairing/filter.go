@@ -0,0 +1,67 @@
+package pairing
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strings"
+	"time"
+)
+
+// PendingFilter selects pending requests for bulk approval. Zero fields
+// match every request.
+type PendingFilter struct {
+	Platform string        // case-insensitive match on PendingRequest.Platform
+	Since    time.Duration // only requests received within this long of now
+}
+
+// Matches reports whether req passes f at now. Repair requests never
+// match: a changed key may be a stolen device ID, so each one needs an
+// operator's individual approval. Nor do requests for a role other than
+// node or for operator scopes, which would grant control over every node.
+func (f PendingFilter) Matches(req PendingRequest, now time.Time) bool {
+	if req.IsRepair {
+		return false
+	}
+	if req.Role != "" && req.Role != "node" {
+		return false
+	}
+	for _, scope := range req.Scopes {
+		if strings.HasPrefix(scope, "operator.") {
+			return false
+		}
+	}
+	if f.Platform != "" && !strings.EqualFold(req.Platform, f.Platform) {
+		return false
+	}
+	if f.Since > 0 && now.Sub(time.UnixMilli(req.Timestamp)) > f.Since {
+		return false
+	}
+	return true
+}
+
+// Select returns the requests in pending that match f at now, oldest
+// first.
+func (f PendingFilter) Select(pending []PendingRequest, now time.Time) []PendingRequest {
+	var out []PendingRequest
+	for _, req := range pending {
+		if f.Matches(req, now) {
+			out = append(out, req)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Timestamp < out[j].Timestamp })
+	return out
+}
+
+// BatchCode returns a short code identifying the set of requests, in any
+// order. A bulk approval previewed in one step and confirmed in another
+// quotes it, so that only the previewed requests are approved.
+func BatchCode(reqs []PendingRequest) string {
+	ids := make([]string, 0, len(reqs))
+	for _, req := range reqs {
+		ids = append(ids, req.RequestID)
+	}
+	sort.Strings(ids)
+	sum := sha256.Sum256([]byte(strings.Join(ids, "\n")))
+	return hex.EncodeToString(sum[:4])
+}
@@ -0,0 +1,51 @@
+package pairing
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPendingFilter_Matches(t *testing.T) {
+	now := time.Now()
+	recent := PendingRequest{Platform: "ios", Timestamp: now.Add(-time.Minute).UnixMilli()}
+	old := PendingRequest{Platform: "ios", Timestamp: now.Add(-2 * time.Hour).UnixMilli()}
+	repair := PendingRequest{Platform: "ios", Timestamp: recent.Timestamp, IsRepair: true}
+
+	tests := []struct {
+		name   string
+		filter PendingFilter
+		req    PendingRequest
+		want   bool
+	}{
+		{name: "zero filter matches", req: old, want: true},
+		{name: "platform ignores case", filter: PendingFilter{Platform: "iOS"}, req: recent, want: true},
+		{name: "other platform", filter: PendingFilter{Platform: "android"}, req: recent, want: false},
+		{name: "within since", filter: PendingFilter{Since: time.Hour}, req: recent, want: true},
+		{name: "older than since", filter: PendingFilter{Since: time.Hour}, req: old, want: false},
+		{name: "repair never matches", req: repair, want: false},
+		{name: "node role matches", req: PendingRequest{Role: "node", Timestamp: recent.Timestamp}, want: true},
+		{name: "operator role never matches", req: PendingRequest{Role: "operator", Timestamp: recent.Timestamp}, want: false},
+		{name: "operator scopes never match", req: PendingRequest{Role: "node", Scopes: []string{"operator.admin"}, Timestamp: recent.Timestamp}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Matches(tt.req, now); got != tt.want {
+				t.Errorf("Matches = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBatchCode(t *testing.T) {
+	a := []PendingRequest{{RequestID: "req-1"}, {RequestID: "req-2"}}
+	b := []PendingRequest{{RequestID: "req-2"}, {RequestID: "req-1"}}
+	if BatchCode(a) != BatchCode(b) {
+		t.Error("BatchCode depends on order")
+	}
+	if BatchCode(a) == BatchCode(append(a, PendingRequest{RequestID: "req-3"})) {
+		t.Error("BatchCode ignores an added request")
+	}
+	if len(BatchCode(a)) != 8 {
+		t.Errorf("BatchCode = %q, want 8 hex digits", BatchCode(a))
+	}
+}
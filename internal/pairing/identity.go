@@ -6,6 +6,7 @@ import (
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"strings"
 )
@@ -16,15 +17,32 @@ const (
 
 	// SignatureSkewMs is the maximum clock skew allowed for signedAt (60 seconds).
 	SignatureSkewMs = 60_000
+
+	// AlgEd25519 is the device signature algorithm used when a client
+	// names none.
+	AlgEd25519 = "ed25519"
 )
 
+// ErrUnsupportedAlgorithm is returned for a device signature algorithm
+// the gateway does not implement.
+var ErrUnsupportedAlgorithm = errors.New("unsupported signature algorithm")
+
+// signatureAlgorithms maps an algorithm name to its verifier, which takes
+// the base64url public key and signature. Register an algorithm here to
+// accept it; BuildAuthPayload binds every name but AlgEd25519 into the
+// payload.
+var signatureAlgorithms = map[string]func(publicKey string, payload []byte, signature string) bool{
+	AlgEd25519: verifyEd25519,
+}
+
 // DeviceConnectIdentity is sent by the client in the connect params.
 type DeviceConnectIdentity struct {
 	ID        string `json:"id"`
-	PublicKey string `json:"publicKey"` // base64url-encoded raw 32-byte Ed25519 public key
-	Signature string `json:"signature"` // base64url-encoded Ed25519 signature
-	SignedAt  int64  `json:"signedAt"`  // milliseconds since epoch
-	Nonce     string `json:"nonce"`     // server-issued challenge nonce
+	PublicKey string `json:"publicKey"`     // base64url-encoded raw 32-byte Ed25519 public key
+	Signature string `json:"signature"`     // base64url-encoded Ed25519 signature
+	SignedAt  int64  `json:"signedAt"`      // milliseconds since epoch
+	Nonce     string `json:"nonce"`         // server-issued challenge nonce
+	Algorithm string `json:"alg,omitempty"` // signature algorithm; empty means AlgEd25519
 }
 
 // AuthPayloadParams holds the fields used to construct the signing payload.
@@ -37,6 +55,15 @@ type AuthPayloadParams struct {
 	SignedAtMs int64
 	Token      string // gateway auth token (may be empty)
 	Nonce      string // challenge nonce
+	Protocol   int    // negotiated protocol version; selects the payload prefix
+	Algorithm  string // signature algorithm; empty means AlgEd25519
+}
+
+// authPayloadVersions maps a protocol version to its signing payload prefix.
+// Protocols not listed (including 0) use "v2".
+var authPayloadVersions = map[int]string{
+	3: "v2",
+	4: "v3",
 }
 
 // DeriveDeviceID returns SHA-256 hex digest of the raw 32-byte public key.
@@ -51,21 +78,99 @@ func DeriveDeviceID(publicKeyBase64Url string) string {
 	return hex.EncodeToString(hash[:])
 }
 
+// KeyFingerprintLen is how many bytes of the key's SHA-256 digest
+// KeyFingerprint shows.
+const KeyFingerprintLen = 8
+
+// KeyFingerprint returns a short fingerprint of a base64url public key for
+// operators to compare out of band: the first KeyFingerprintLen bytes of
+// its SHA-256 digest as colon-separated hex, e.g. "66:68:7a:ad:f8:62:bd:77".
+// Returns "" if publicKey is invalid.
+func KeyFingerprint(publicKeyBase64Url string) string {
+	raw, err := decodePublicKey(publicKeyBase64Url)
+	if err != nil {
+		return ""
+	}
+	hash := sha256.Sum256(raw)
+	groups := make([]string, KeyFingerprintLen)
+	for i, b := range hash[:KeyFingerprintLen] {
+		groups[i] = hex.EncodeToString([]byte{b})
+	}
+	return strings.Join(groups, ":")
+}
+
 // BuildAuthPayload constructs the pipe-delimited signing payload.
 // Format: "v2|deviceId|clientId|clientMode|role|scopes|signedAtMs|token|nonce"
-// scopes is comma-joined. token defaults to "" if empty.
+// scopes is comma-joined. token defaults to "" if empty. The prefix
+// follows p.Protocol ("v3" for protocol 4); algorithms other than Ed25519
+// append their name to it ("v3+alg") so a signature under one algorithm
+// never verifies as another.
 func BuildAuthPayload(p AuthPayloadParams) string {
+	prefix, ok := authPayloadVersions[p.Protocol]
+	if !ok {
+		prefix = "v2"
+	}
+	if p.Algorithm != "" && p.Algorithm != AlgEd25519 {
+		prefix += "+" + p.Algorithm
+	}
 	scopes := strings.Join(p.Scopes, ",")
-	return fmt.Sprintf("v2|%s|%s|%s|%s|%s|%d|%s|%s",
+	return fmt.Sprintf("%s|%s|%s|%s|%s|%s|%d|%s|%s", prefix,
 		p.DeviceID, p.ClientID, p.ClientMode, p.Role,
 		scopes, p.SignedAtMs, p.Token, p.Nonce)
 }
 
+// BuildChallengePayload returns what the gateway signs in a
+// connect.challenge: "challenge|nonce|ts", ts in seconds since epoch so a
+// client can refuse a stale challenge. The prefix keeps the signature
+// from being replayed as a device auth payload.
+func BuildChallengePayload(nonce string, ts int64) string {
+	return fmt.Sprintf("challenge|%s|%d", nonce, ts)
+}
+
+// HelloPayloadParams holds the fields the gateway signs in hello-ok.
+type HelloPayloadParams struct {
+	ClientNonce string // chosen by the client in the connect request
+	Nonce       string // challenge nonce
+	ConnID      string
+	Role        string
+	Scopes      []string // granted scopes
+}
+
+// BuildHelloPayload returns what the gateway signs in hello-ok for a
+// client that sent a client nonce:
+// "hello|clientNonce|nonce|connId|role|scopes", scopes comma-joined. It
+// proves the reply is fresh and binds the role and scopes the gateway
+// granted.
+func BuildHelloPayload(p HelloPayloadParams) string {
+	return fmt.Sprintf("hello|%s|%s|%s|%s|%s",
+		p.ClientNonce, p.Nonce, p.ConnID, p.Role, strings.Join(p.Scopes, ","))
+}
+
 // VerifySignature verifies an Ed25519 signature against a payload.
 // publicKey is base64url-encoded raw 32-byte Ed25519 key.
 // signature is base64url-encoded.
 // Returns false on any error (bad key, bad sig, wrong length).
 func VerifySignature(publicKeyBase64Url string, payload string, signatureBase64Url string) bool {
+	ok, _ := VerifySignatureAlg(AlgEd25519, publicKeyBase64Url, payload, signatureBase64Url)
+	return ok
+}
+
+// VerifySignatureAlg verifies a signature made with algorithm alg (empty
+// means AlgEd25519). It returns ErrUnsupportedAlgorithm for an algorithm
+// with no verifier, and otherwise whether the signature is valid.
+func VerifySignatureAlg(alg, publicKeyBase64Url, payload, signatureBase64Url string) (bool, error) {
+	if alg == "" {
+		alg = AlgEd25519
+	}
+	verify, ok := signatureAlgorithms[alg]
+	if !ok {
+		return false, fmt.Errorf("%w: %q", ErrUnsupportedAlgorithm, alg)
+	}
+	return verify(publicKeyBase64Url, []byte(payload), signatureBase64Url), nil
+}
+
+// verifyEd25519 verifies a base64url Ed25519 signature.
+func verifyEd25519(publicKeyBase64Url string, payload []byte, signatureBase64Url string) bool {
 	pubRaw, err := decodePublicKey(publicKeyBase64Url)
 	if err != nil {
 		return false
@@ -76,7 +181,7 @@ func VerifySignature(publicKeyBase64Url string, payload string, signatureBase64U
 		return false
 	}
 
-	return ed25519.Verify(ed25519.PublicKey(pubRaw), []byte(payload), sig)
+	return ed25519.Verify(ed25519.PublicKey(pubRaw), payload, sig)
 }
 
 // GenerateNonce returns a random UUID v4 string for the connect challenge.
@@ -4,6 +4,7 @@ import (
 	"crypto/ed25519"
 	"crypto/rand"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"strings"
 	"testing"
@@ -130,6 +131,34 @@ func TestBuildAuthPayload(t *testing.T) {
 			},
 			want: "v2|abc123|openclaw-ios|ui|operator||1700000000000||n",
 		},
+		{
+			name: "protocol 3 keeps v2 prefix",
+			params: AuthPayloadParams{
+				DeviceID: "abc123", Role: "node", SignedAtMs: 1, Nonce: "n", Protocol: 3,
+			},
+			want: "v2|abc123|||node||1||n",
+		},
+		{
+			name: "protocol 4 uses v3 prefix",
+			params: AuthPayloadParams{
+				DeviceID: "abc123", Role: "node", SignedAtMs: 1, Nonce: "n", Protocol: 4,
+			},
+			want: "v3|abc123|||node||1||n",
+		},
+		{
+			name: "explicit ed25519 is unchanged",
+			params: AuthPayloadParams{
+				DeviceID: "abc123", Role: "node", SignedAtMs: 1, Nonce: "n", Protocol: 4, Algorithm: AlgEd25519,
+			},
+			want: "v3|abc123|||node||1||n",
+		},
+		{
+			name: "other algorithms are bound into the prefix",
+			params: AuthPayloadParams{
+				DeviceID: "abc123", Role: "node", SignedAtMs: 1, Nonce: "n", Protocol: 4, Algorithm: "p256",
+			},
+			want: "v3+p256|abc123|||node||1||n",
+		},
 	}
 
 	for _, tt := range tests {
@@ -216,6 +245,28 @@ func TestVerifySignature(t *testing.T) {
 	}
 }
 
+func TestVerifySignatureAlg(t *testing.T) {
+	kp := newTestKeypair(t)
+	payload := "v3|abc123|openclaw-ios|ui|node|scope1|1700000000000|tok|nonce"
+	sig := signPayload(t, kp.privateKey, payload)
+
+	for _, alg := range []string{"", AlgEd25519} {
+		ok, err := VerifySignatureAlg(alg, kp.pubB64, payload, sig)
+		if err != nil || !ok {
+			t.Errorf("VerifySignatureAlg(%q) = %v, %v; want true, nil", alg, ok, err)
+		}
+		ok, err = VerifySignatureAlg(alg, kp.pubB64, "tampered", sig)
+		if err != nil || ok {
+			t.Errorf("VerifySignatureAlg(%q, tampered) = %v, %v; want false, nil", alg, ok, err)
+		}
+	}
+
+	ok, err := VerifySignatureAlg("rsa", kp.pubB64, payload, sig)
+	if !errors.Is(err, ErrUnsupportedAlgorithm) || ok {
+		t.Errorf("VerifySignatureAlg(rsa) = %v, %v; want false, ErrUnsupportedAlgorithm", ok, err)
+	}
+}
+
 // --- GenerateNonce ---
 
 func TestGenerateNonce(t *testing.T) {
@@ -336,3 +387,29 @@ func TestDeriveDeviceID_MatchesPublicKey(t *testing.T) {
 	// Suppress unused import warning
 	_ = fmt.Sprintf
 }
+
+func TestKeyFingerprint(t *testing.T) {
+	// SHA-256 of 32 zero bytes.
+	zero := base64.RawURLEncoding.EncodeToString(make([]byte, 32))
+	if got, want := KeyFingerprint(zero), "66:68:7a:ad:f8:62:bd:77"; got != want {
+		t.Errorf("KeyFingerprint(zero key) = %q, want %q", got, want)
+	}
+	for _, invalid := range []string{"", "not-valid-base64!!!", base64.RawURLEncoding.EncodeToString(make([]byte, 16))} {
+		if got := KeyFingerprint(invalid); got != "" {
+			t.Errorf("KeyFingerprint(%q) = %q, want empty", invalid, got)
+		}
+	}
+
+	kp1, kp2 := newTestKeypair(t), newTestKeypair(t)
+	if KeyFingerprint(kp1.pubB64) != KeyFingerprint(kp1.pubB64) {
+		t.Error("KeyFingerprint is not deterministic")
+	}
+	if KeyFingerprint(kp1.pubB64) == KeyFingerprint(kp2.pubB64) {
+		t.Error("different keys have the same fingerprint")
+	}
+	// Padded and unpadded encodings of a key are the same key.
+	padded := base64.URLEncoding.EncodeToString(kp1.publicKey)
+	if KeyFingerprint(padded) != KeyFingerprint(kp1.pubB64) {
+		t.Error("padded encoding changes the fingerprint")
+	}
+}
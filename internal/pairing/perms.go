@@ -0,0 +1,51 @@
+package pairing
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// ErrInsecurePerms is returned by NewStrictStore when the state directory
+// or a state file is accessible to group or others.
+var ErrInsecurePerms = errors.New("insecure permissions")
+
+// checkPerms makes sure stateDir is 0700 and the state files in it are
+// 0600 at most. Looser modes are tightened in place, or rejected with
+// ErrInsecurePerms when strict is set. Missing files are skipped.
+func checkPerms(stateDir string, strict bool) error {
+	if err := checkPerm(stateDir, 0700, strict); err != nil {
+		return err
+	}
+	for _, name := range []string{"pending.json", "paired.json"} {
+		if err := checkPerm(filepath.Join(stateDir, name), 0600, strict); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkPerm(path string, want fs.FileMode, strict bool) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("stat %s: %w", path, err)
+	}
+	mode := info.Mode().Perm()
+	if mode&0077 == 0 {
+		return nil
+	}
+	if strict {
+		return fmt.Errorf("%w on %s: mode %04o, want %04o (chmod %o %s)", ErrInsecurePerms, path, mode, want, want, path)
+	}
+	if err := os.Chmod(path, want); err != nil {
+		return fmt.Errorf("chmod %s: %w", path, err)
+	}
+	slog.Warn("tightened state permissions", "path", path, "was", fmt.Sprintf("%04o", mode), "now", fmt.Sprintf("%04o", want))
+	return nil
+}
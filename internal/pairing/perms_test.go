@@ -0,0 +1,80 @@
+package pairing
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeLooseState(t *testing.T) (dir, file string) {
+	t.Helper()
+	dir = t.TempDir()
+	file = filepath.Join(dir, "paired.json")
+	if err := os.WriteFile(file, []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(file, 0644); err != nil { // umask may have masked it
+		t.Fatal(err)
+	}
+	return dir, file
+}
+
+func fileMode(t *testing.T, path string) os.FileMode {
+	t.Helper()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.Mode().Perm()
+}
+
+func TestNewStore_TightensLooseFile(t *testing.T) {
+	dir, file := writeLooseState(t)
+
+	if _, err := NewStore(dir); err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	if got := fileMode(t, file); got != 0600 {
+		t.Errorf("paired.json mode = %04o, want 0600", got)
+	}
+}
+
+func TestNewStrictStore_RejectsLooseFile(t *testing.T) {
+	dir, file := writeLooseState(t)
+
+	_, err := NewStrictStore(dir)
+	if !errors.Is(err, ErrInsecurePerms) {
+		t.Fatalf("NewStrictStore error = %v, want ErrInsecurePerms", err)
+	}
+	if got := fileMode(t, file); got != 0644 {
+		t.Errorf("strict mode changed paired.json to %04o", got)
+	}
+}
+
+func TestNewStore_TightensLooseDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Chmod(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewStrictStore(dir); !errors.Is(err, ErrInsecurePerms) {
+		t.Fatalf("NewStrictStore error = %v, want ErrInsecurePerms", err)
+	}
+	if _, err := NewStore(dir); err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	if got := fileMode(t, dir); got != 0700 {
+		t.Errorf("state dir mode = %04o, want 0700", got)
+	}
+}
+
+func TestNewStrictStore_AcceptsTightState(t *testing.T) {
+	s := newTestStore(t)
+	if err := s.savePaired(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewStrictStore(s.stateDir); err != nil {
+		t.Fatalf("NewStrictStore: %v", err)
+	}
+}
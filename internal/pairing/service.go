@@ -1,18 +1,159 @@
 package pairing
 
 import (
+	"errors"
 	"fmt"
+	"slices"
+	"strings"
+	"sync"
 	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/time/rate"
+)
+
+var (
+	// ErrPairingRateLimited is returned when a remote IP creates pending
+	// requests faster than Limits.PerIPPerMinute allows, or a device
+	// replaces its pending request more often than Limits.RepairsPerDevice.
+	ErrPairingRateLimited = errors.New("pairing rate limited")
+	// ErrTooManyPending is returned when the pending queue is full.
+	ErrTooManyPending = errors.New("too many pending pairing requests")
+	// ErrDeviceNotFound is returned when a paired device does not exist.
+	ErrDeviceNotFound = errors.New("device not found")
+	// ErrDeviceIDMismatch is returned when a device ID is not derived from
+	// the public key presented with it.
+	ErrDeviceIDMismatch = errors.New("device ID does not match public key")
 )
 
+// MaxDisplayNameLen is the longest display name RenameDevice accepts, in
+// runes. Client-supplied names and platforms are clamped to it.
+const MaxDisplayNameLen = 64
+
+// clientText strips control characters from text a client supplied, such
+// as its display name, and clamps it to MaxDisplayNameLen runes.
+func clientText(s string) string {
+	s = strings.TrimSpace(strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, s))
+	if utf8.RuneCountInString(s) > MaxDisplayNameLen {
+		s = string([]rune(s)[:MaxDisplayNameLen])
+	}
+	return s
+}
+
+// Limits caps how quickly remote devices can create pending requests.
+// Loopback requests are exempt.
+type Limits struct {
+	PerIPPerMinute int // new pending requests per remote IP per minute
+	PerIPBurst     int
+	MaxPending     int // hard cap on the global pending queue
+
+	// RepairsPerDevice caps how many times one device may replace its
+	// pending request with a new key within PendingTTLMs.
+	RepairsPerDevice int
+}
+
+// DefaultLimits is applied by NewService.
+var DefaultLimits = Limits{
+	PerIPPerMinute:   5,
+	PerIPBurst:       5,
+	MaxPending:       100,
+	RepairsPerDevice: 3,
+}
+
 // Service orchestrates pairing: request/approve/reject/revoke/verify.
 type Service struct {
 	store *Store
+
+	limits         Limits
+	ipLimiters     map[string]*idleLimiter
+	deviceLimiters map[string]*idleLimiter
+	limitersMu     sync.Mutex
+	lastSweep      time.Time // of deviceLimiters; guarded by limitersMu
+	lastIPSweep    time.Time // of ipLimiters; guarded by limitersMu
+
+	listeners   []func(PendingRequest)
+	listenersMu sync.Mutex
+
+	roleDefaultScopes map[string][]string // see WithRoleDefaultScopes
+	autoApprove       AutoApprovePolicy   // see WithAutoApprovePolicy
+
+	// autoApproveMu serializes the auto-approve decision with the approval
+	// it leads to, so concurrent first connects from one IP cannot all
+	// pass the tofu check before any of them is paired.
+	autoApproveMu sync.Mutex
 }
 
 // NewService creates a new pairing service wrapping the given store.
 func NewService(store *Store) *Service {
-	return &Service{store: store}
+	return &Service{
+		store:          store,
+		limits:         DefaultLimits,
+		ipLimiters:     make(map[string]*idleLimiter),
+		deviceLimiters: make(map[string]*idleLimiter),
+	}
+}
+
+// WithLimits replaces the pending-request limits. Zero fields disable
+// the corresponding limit.
+func (s *Service) WithLimits(limits Limits) {
+	s.limitersMu.Lock()
+	defer s.limitersMu.Unlock()
+	s.limits = limits
+	s.ipLimiters = make(map[string]*idleLimiter)
+	s.deviceLimiters = make(map[string]*idleLimiter)
+}
+
+// WithRoleDefaultScopes sets the scopes granted to a role when a device
+// requests none, keyed by role (e.g. "node"). Approve and
+// EnsureDeviceToken apply them; explicit scopes are never widened. Call
+// before the service is in use.
+func (s *Service) WithRoleDefaultScopes(defaults map[string][]string) {
+	s.roleDefaultScopes = defaults
+}
+
+// WithAutoApprovePolicy sets which unpaired devices CheckPairingStatus
+// approves without an operator. The default is loopback-only. Call before
+// the service is in use.
+func (s *Service) WithAutoApprovePolicy(p AutoApprovePolicy) {
+	s.autoApprove = p
+}
+
+// scopesOrDefault returns scopes, or the role's default scopes when
+// scopes is empty.
+func (s *Service) scopesOrDefault(role string, scopes []string) []string {
+	if len(scopes) > 0 {
+		return scopes
+	}
+	if defaults, ok := s.roleDefaultScopes[role]; ok {
+		return slices.Clone(defaults)
+	}
+	return scopes
+}
+
+// OnPending registers fn to be called whenever a new non-silent pending
+// request is created. fn runs on the handshake path and must not block.
+func (s *Service) OnPending(fn func(PendingRequest)) {
+	s.listenersMu.Lock()
+	defer s.listenersMu.Unlock()
+	s.listeners = append(s.listeners, fn)
+}
+
+// notifyPending fans a new pending request out to OnPending listeners.
+func (s *Service) notifyPending(req PendingRequest) {
+	s.listenersMu.Lock()
+	listeners := make([]func(PendingRequest), len(s.listeners))
+	copy(listeners, s.listeners)
+	s.listenersMu.Unlock()
+
+	for _, fn := range listeners {
+		fn(req)
+	}
 }
 
 // PairingRequestInput holds fields for requesting device pairing.
@@ -26,7 +167,8 @@ type PairingRequestInput struct {
 	Role        string
 	Scopes      []string
 	RemoteIP    string
-	IsLocal     bool // true → silent auto-approve
+	IsLocal     bool // true → silent, and exempt from the pending limits
+	Silent      bool // true → OnPending listeners are not told
 }
 
 // VerifyTokenParams holds fields for token verification.
@@ -46,57 +188,102 @@ type VerifyTokenResult struct {
 
 // CheckPairingParams holds fields for checking pairing status during handshake.
 type CheckPairingParams struct {
-	DeviceID  string
-	PublicKey string
-	Role      string
-	Scopes    []string
-	IsLocal   bool
+	DeviceID    string
+	PublicKey   string
+	DisplayName string
+	Platform    string
+	ClientID    string
+	ClientMode  string
+	Role        string
+	Scopes      []string
+	RemoteIP    string
+	IsLocal     bool
 }
 
+// Causes reported in PairingAction.Cause when a device is not paired.
+const (
+	CauseNewDevice   = "new-device"   // no paired device with this ID
+	CauseKeyChanged  = "key-changed"  // paired, but not with this key
+	CauseRateLimited = "rate-limited" // no pairing request could be created
+)
+
 // PairingAction is the result of a pairing status check.
 type PairingAction struct {
-	Status    string // "paired", "pairing-required", "auto-approved"
+	Status    string // "paired", "pairing-required", "auto-approved", "rate-limited", "error"
 	RequestID string // set when Status == "pairing-required"
+	Reason    string // set when Status == "rate-limited" or "error"
 	Device    *PairedDevice
+
+	// Cause is set when Status is "pairing-required", "rate-limited" or
+	// "error", and IsRepair also when it is "auto-approved". IsRepair means
+	// the device ID is already paired, so approval re-pairs it under the
+	// new key.
+	Cause    string
+	IsRepair bool
 }
 
 // RequestPairing checks if a device needs pairing and creates a pending request.
-// If already paired with matching public key, returns (nil, nil) — no action needed.
+// If already paired with any approved public key, returns (nil, nil) — no action needed.
 // If pending request already exists for this device, returns existing request.
 // For new requests, returns the created PendingRequest.
 func (s *Service) RequestPairing(req PairingRequestInput) (*PendingRequest, error) {
 	if req.DeviceID == "" {
 		return nil, fmt.Errorf("deviceID is required")
 	}
+	if err := s.checkDeviceID(req.DeviceID, req.PublicKey); err != nil {
+		return nil, err
+	}
 
-	// Check if already paired with same key
+	// Check if already paired with a known key
 	existing := s.store.GetPairedDevice(req.DeviceID)
-	if existing != nil && existing.PublicKey == req.PublicKey {
+	if existing != nil && existing.HasPublicKey(req.PublicKey) {
 		return nil, nil // already paired, no action
 	}
 
-	// Check if there's already a pending request for this device
+	// A device has at most one pending request. Reconnecting with the same
+	// key returns it; a new key replaces it so approval applies to the key
+	// the device holds now.
+	var stale []string
 	for _, pending := range s.store.ListPending() {
-		if pending.DeviceID == req.DeviceID {
+		if pending.DeviceID != req.DeviceID {
+			continue
+		}
+		if pending.PublicKey == req.PublicKey {
 			return &pending, nil
 		}
+		stale = append(stale, pending.RequestID)
+	}
+	// Every limit is checked before the stale requests are removed, so a
+	// refused request leaves the device's pending one in place.
+	if !req.IsLocal {
+		if err := s.checkLimits(req.RemoteIP, len(stale)); err != nil {
+			return nil, err
+		}
+	}
+	if len(stale) > 0 {
+		if err := s.checkRepairLimit(req.DeviceID); err != nil {
+			return nil, err
+		}
+		for _, id := range stale {
+			s.store.RemovePending(id)
+		}
 	}
 
 	// Create new pending request
-	isRepair := existing != nil && existing.PublicKey != req.PublicKey
+	isRepair := existing != nil
 
 	pending := PendingRequest{
 		RequestID:   GenerateNonce(),
 		DeviceID:    req.DeviceID,
 		PublicKey:   req.PublicKey,
-		DisplayName: req.DisplayName,
-		Platform:    req.Platform,
+		DisplayName: clientText(req.DisplayName),
+		Platform:    clientText(req.Platform),
 		ClientID:    req.ClientID,
 		ClientMode:  req.ClientMode,
 		Role:        req.Role,
 		Scopes:      req.Scopes,
 		RemoteIP:    req.RemoteIP,
-		Silent:      req.IsLocal,
+		Silent:      req.IsLocal || req.Silent,
 		IsRepair:    isRepair,
 		Timestamp:   time.Now().UnixMilli(),
 	}
@@ -105,14 +292,36 @@ func (s *Service) RequestPairing(req PairingRequestInput) (*PendingRequest, erro
 		return nil, fmt.Errorf("add pending: %w", err)
 	}
 
+	if !pending.Silent {
+		s.notifyPending(pending)
+	}
+
 	return &pending, nil
 }
 
-// Approve approves a pending pairing request.
+// Approve approves a pending pairing request with the scopes the device
+// asked for. See ApproveWithScopes.
+func (s *Service) Approve(requestID string) (*PairedDevice, error) {
+	return s.ApproveWithScopes(requestID, nil)
+}
+
+// ApproveWithScopes approves a pending pairing request.
 // Generates a pairing token for the requested role.
 // Moves the device from pending to paired.
+// A non-nil scopes overrides the requested scopes and caps what later
+// token rotations may grant. With neither, the role's default scopes
+// apply (see WithRoleDefaultScopes), within the device's existing
+// ScopeLimit when re-pairing.
 // Returns the PairedDevice with token, or nil if requestID not found.
-func (s *Service) Approve(requestID string) (*PairedDevice, error) {
+func (s *Service) ApproveWithScopes(requestID string, scopes []string) (*PairedDevice, error) {
+	pending := s.store.GetPendingRequest(requestID)
+	if pending == nil {
+		return nil, nil
+	}
+	if err := s.checkDeviceID(pending.DeviceID, pending.PublicKey); err != nil {
+		return nil, fmt.Errorf("pending request %s: %w", requestID, err)
+	}
+
 	removed := s.store.RemovePending(requestID)
 	if removed == nil {
 		return nil, nil
@@ -120,13 +329,18 @@ func (s *Service) Approve(requestID string) (*PairedDevice, error) {
 
 	now := time.Now().UnixMilli()
 
+	granted := s.scopesOrDefault(removed.Role, removed.Scopes)
+	if scopes != nil {
+		granted = scopes
+	}
+
 	// Check if device already exists (merge)
 	existing := s.store.GetPairedDevice(removed.DeviceID)
 	var device PairedDevice
 	if existing != nil {
 		device = *existing
-		// Update metadata from the request
-		device.PublicKey = removed.PublicKey
+		// Update metadata from the request; prior keys stay valid
+		device.addPublicKey(removed.PublicKey)
 		if removed.DisplayName != "" {
 			device.DisplayName = removed.DisplayName
 		}
@@ -146,12 +360,13 @@ func (s *Service) Approve(requestID string) (*PairedDevice, error) {
 		device = PairedDevice{
 			DeviceID:     removed.DeviceID,
 			PublicKey:    removed.PublicKey,
+			PublicKeys:   []string{removed.PublicKey},
 			DisplayName:  removed.DisplayName,
 			Platform:     removed.Platform,
 			ClientID:     removed.ClientID,
 			ClientMode:   removed.ClientMode,
 			Role:         removed.Role,
-			Scopes:       removed.Scopes,
+			Scopes:       granted,
 			RemoteIP:     removed.RemoteIP,
 			CreatedAtMs:  now,
 			ApprovedAtMs: now,
@@ -160,6 +375,14 @@ func (s *Service) Approve(requestID string) (*PairedDevice, error) {
 	}
 
 	device.ApprovedAtMs = now
+	if scopes != nil {
+		device.Scopes = scopes
+		device.ScopeLimit = scopes
+	}
+	// A re-pair keeps the limit an operator set earlier.
+	if device.ScopeLimit != nil {
+		granted = intersectScopes(granted, device.ScopeLimit)
+	}
 
 	if err := s.store.SetPaired(device); err != nil {
 		return nil, fmt.Errorf("set paired: %w", err)
@@ -170,7 +393,7 @@ func (s *Service) Approve(requestID string) (*PairedDevice, error) {
 		token := DeviceAuthToken{
 			Token:       GeneratePairingToken(),
 			Role:        removed.Role,
-			Scopes:      removed.Scopes,
+			Scopes:      granted,
 			CreatedAtMs: now,
 		}
 		if err := s.store.SetDeviceToken(removed.DeviceID, removed.Role, token); err != nil {
@@ -183,6 +406,27 @@ func (s *Service) Approve(requestID string) (*PairedDevice, error) {
 	return result, nil
 }
 
+// VerifyDeviceID reports whether a device may present publicKey under
+// deviceID: the ID must derive from the key, except after a key rotation,
+// when the device keeps the ID of its paired record (see checkDeviceID).
+// It returns ErrDeviceIDMismatch otherwise.
+func (s *Service) VerifyDeviceID(deviceID, publicKey string) error {
+	return s.checkDeviceID(deviceID, publicKey)
+}
+
+// checkDeviceID verifies that deviceID is derived from publicKey. A key
+// rotation is the one exception: the new key may be presented under the ID
+// of an already-paired device whose ID derives from a key it had approved.
+func (s *Service) checkDeviceID(deviceID, publicKey string) error {
+	if DeriveDeviceID(publicKey) == deviceID {
+		return nil
+	}
+	if dev := s.store.GetPairedDevice(deviceID); dev != nil && dev.OwnsDeviceID() {
+		return nil
+	}
+	return ErrDeviceIDMismatch
+}
+
 // Reject removes a pending pairing request without approving.
 // Returns the rejected request, or nil if not found.
 func (s *Service) Reject(requestID string) (*PendingRequest, error) {
@@ -190,8 +434,30 @@ func (s *Service) Reject(requestID string) (*PendingRequest, error) {
 	return removed, nil
 }
 
+// RenameDevice sets the display name of a paired device. The name is
+// trimmed and must be 1–MaxDisplayNameLen characters.
+func (s *Service) RenameDevice(deviceID, name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return fmt.Errorf("display name is required")
+	}
+	if n := utf8.RuneCountInString(name); n > MaxDisplayNameLen {
+		return fmt.Errorf("display name too long (%d > %d characters)", n, MaxDisplayNameLen)
+	}
+	if s.store.GetPairedDevice(deviceID) == nil {
+		return fmt.Errorf("%w: %s", ErrDeviceNotFound, deviceID)
+	}
+	return s.store.UpdateDeviceMetadata(deviceID, DeviceMetadataPatch{DisplayName: &name})
+}
+
+// SetDeviceTags replaces the tags of a paired device; see NormalizeTags for
+// what a tag may contain. An empty list clears them.
+func (s *Service) SetDeviceTags(deviceID string, tags []string) error {
+	return s.store.SetDeviceTags(deviceID, tags)
+}
+
 // VerifyDeviceToken validates a device token for a given role + scopes.
-// Updates lastUsedMs on success.
+// Updates lastUsedMs and useCount on success.
 func (s *Service) VerifyDeviceToken(params VerifyTokenParams) VerifyTokenResult {
 	device := s.store.GetPairedDevice(params.DeviceID)
 	if device == nil {
@@ -216,27 +482,44 @@ func (s *Service) VerifyDeviceToken(params VerifyTokenParams) VerifyTokenResult
 		return VerifyTokenResult{OK: false, Reason: "scope-mismatch"}
 	}
 
-	// Update lastUsedMs
 	tok.LastUsedMs = time.Now().UnixMilli()
+	tok.UseCount++
 	s.store.SetDeviceToken(params.DeviceID, params.Role, tok)
 
 	return VerifyTokenResult{OK: true}
 }
 
+// IsPaired reports whether deviceID is in the paired store.
+func (s *Service) IsPaired(deviceID string) bool {
+	return s.store.GetPairedDevice(deviceID) != nil
+}
+
 // EnsureDeviceToken returns or creates a token for a paired device + role.
 // If an existing non-revoked token with sufficient scopes exists, returns it.
 // Otherwise generates a new one (rotating if previous existed).
+// Requested scopes are capped to the device's ScopeLimit, if set.
+// It is called as the device connects, so the token is recorded as used.
+// Returns nil if the device is not paired or a new token cannot be saved.
 func (s *Service) EnsureDeviceToken(deviceID, role string, scopes []string) *DeviceAuthToken {
 	device := s.store.GetPairedDevice(deviceID)
 	if device == nil {
 		return nil
 	}
 
+	scopes = s.scopesOrDefault(role, scopes)
+	if device.ScopeLimit != nil {
+		scopes = intersectScopes(scopes, device.ScopeLimit)
+	}
+
 	now := time.Now().UnixMilli()
 
 	tok, exists := device.Tokens[role]
 	if exists && tok.RevokedAtMs == 0 && scopesContainAll(tok.Scopes, scopes) {
-		// Existing valid token with sufficient scopes
+		// Existing valid token with sufficient scopes. Failing to record
+		// the use does not make it any less valid.
+		tok.LastUsedMs = now
+		tok.UseCount++
+		s.store.SetDeviceToken(deviceID, role, tok)
 		return &tok
 	}
 
@@ -246,13 +529,17 @@ func (s *Service) EnsureDeviceToken(deviceID, role string, scopes []string) *Dev
 		Role:        role,
 		Scopes:      scopes,
 		CreatedAtMs: now,
+		LastUsedMs:  now,
+		UseCount:    1,
 	}
 
 	if exists {
 		newTok.RotatedAtMs = now
 	}
 
-	s.store.SetDeviceToken(deviceID, role, newTok)
+	if err := s.store.SetDeviceToken(deviceID, role, newTok); err != nil {
+		return nil
+	}
 	return &newTok
 }
 
@@ -282,8 +569,8 @@ func (s *Service) CheckPairingStatus(params CheckPairingParams) PairingAction {
 
 	device := s.store.GetPairedDevice(params.DeviceID)
 
-	// Already paired with matching key
-	if device != nil && device.PublicKey == params.PublicKey {
+	// Already paired with the current or a previously approved key
+	if device != nil && device.HasPublicKey(params.PublicKey) {
 		return PairingAction{
 			Status: "paired",
 			Device: device,
@@ -291,51 +578,243 @@ func (s *Service) CheckPairingStatus(params CheckPairingParams) PairingAction {
 	}
 
 	// Not paired or key mismatch — needs pairing
-	if params.IsLocal {
-		// Auto-approve for loopback
+	isRepair := device != nil
+	cause := CauseNewDevice
+	if isRepair {
+		cause = CauseKeyChanged
+	}
+
+	// A key change always needs an operator, even on loopback: any key
+	// may claim a paired device's ID (see checkDeviceID), so approving it
+	// unseen would let any local process take the device over.
+	s.autoApproveMu.Lock()
+	if !isRepair && s.autoApprove.allows(params, s.store) {
+		defer s.autoApproveMu.Unlock()
+		// Off loopback the requested scopes are ignored: the device gets
+		// the node defaults, which also cap its later tokens.
+		var scopeLimit []string
+		if !params.IsLocal {
+			scopeLimit = slices.Clone(s.roleDefaultScopes["node"])
+			if scopeLimit == nil {
+				scopeLimit = []string{}
+			}
+			params.Scopes = scopeLimit
+		}
 		req := PairingRequestInput{
-			DeviceID:  params.DeviceID,
-			PublicKey: params.PublicKey,
-			Role:      params.Role,
-			Scopes:    params.Scopes,
-			IsLocal:   true,
+			DeviceID:    params.DeviceID,
+			PublicKey:   params.PublicKey,
+			DisplayName: params.DisplayName,
+			Platform:    params.Platform,
+			ClientID:    params.ClientID,
+			ClientMode:  params.ClientMode,
+			Role:        params.Role,
+			Scopes:      params.Scopes,
+			RemoteIP:    params.RemoteIP,
+			IsLocal:     params.IsLocal,
+			Silent:      true, // approved below
 		}
 
 		pending, err := s.RequestPairing(req)
-		if err != nil || pending == nil {
-			return PairingAction{Status: "paired", Device: device}
+		if errors.Is(err, ErrPairingRateLimited) || errors.Is(err, ErrTooManyPending) {
+			return PairingAction{Status: "rate-limited", Reason: err.Error(), Cause: CauseRateLimited, IsRepair: isRepair}
+		}
+		if err != nil {
+			return PairingAction{Status: "error", Reason: err.Error(), Cause: cause, IsRepair: isRepair}
+		}
+		if pending == nil {
+			// Paired with this key since the lookup above.
+			if device = s.store.GetPairedDevice(params.DeviceID); device != nil {
+				return PairingAction{Status: "paired", Device: device}
+			}
+			return PairingAction{Status: "error", Reason: "device left the store during pairing", Cause: cause, IsRepair: isRepair}
 		}
 
-		approved, err := s.Approve(pending.RequestID)
+		// The request is silent, so no operator would hear of it: report
+		// the failure rather than leave the device waiting on it.
+		approved, err := s.ApproveWithScopes(pending.RequestID, scopeLimit)
 		if err != nil {
-			return PairingAction{Status: "pairing-required", RequestID: pending.RequestID}
+			return PairingAction{Status: "error", Reason: err.Error(), Cause: cause, IsRepair: isRepair}
 		}
 
 		return PairingAction{
-			Status: "auto-approved",
-			Device: approved,
+			Status:   "auto-approved",
+			Device:   approved,
+			IsRepair: isRepair,
 		}
 	}
 
+	s.autoApproveMu.Unlock()
+
 	// Remote — create pending request
 	req := PairingRequestInput{
-		DeviceID:  params.DeviceID,
-		PublicKey: params.PublicKey,
-		Role:      params.Role,
-		Scopes:    params.Scopes,
-		IsLocal:   false,
+		DeviceID:    params.DeviceID,
+		PublicKey:   params.PublicKey,
+		DisplayName: params.DisplayName,
+		Platform:    params.Platform,
+		ClientID:    params.ClientID,
+		ClientMode:  params.ClientMode,
+		Role:        params.Role,
+		Scopes:      params.Scopes,
+		RemoteIP:    params.RemoteIP,
+		IsLocal:     false,
 	}
 
-	pending, _ := s.RequestPairing(req)
-	requestID := ""
-	if pending != nil {
-		requestID = pending.RequestID
+	pending, err := s.RequestPairing(req)
+	if errors.Is(err, ErrPairingRateLimited) || errors.Is(err, ErrTooManyPending) {
+		return PairingAction{
+			Status:   "rate-limited",
+			Reason:   err.Error(),
+			Cause:    CauseRateLimited,
+			IsRepair: isRepair,
+		}
+	}
+	if err != nil {
+		return PairingAction{Status: "error", Reason: err.Error(), Cause: cause, IsRepair: isRepair}
+	}
+	if pending == nil {
+		// Paired with this key since the lookup above.
+		if device = s.store.GetPairedDevice(params.DeviceID); device != nil {
+			return PairingAction{Status: "paired", Device: device}
+		}
+		return PairingAction{Status: "error", Reason: "device left the store during pairing", Cause: cause, IsRepair: isRepair}
 	}
 
 	return PairingAction{
 		Status:    "pairing-required",
-		RequestID: requestID,
+		RequestID: pending.RequestID,
+		Cause:     cause,
+		IsRepair:  isRepair,
+	}
+}
+
+// PeekPairingStatus reports what CheckPairingStatus would do for params
+// without creating, approving or mutating anything. Status is one of
+// "paired", "pending" (RequestID set), "auto-approve" or "pairing-required".
+func (s *Service) PeekPairingStatus(params CheckPairingParams) PairingAction {
+	if device := s.store.GetPairedDevice(params.DeviceID); device != nil && device.HasPublicKey(params.PublicKey) {
+		return PairingAction{Status: "paired", Device: device}
+	}
+	if err := s.checkDeviceID(params.DeviceID, params.PublicKey); err != nil {
+		return PairingAction{Status: "pairing-required", Reason: err.Error()}
+	}
+	if s.autoApprove.allows(params, s.store) {
+		return PairingAction{Status: "auto-approve"}
+	}
+	for _, pending := range s.store.ListPending() {
+		if pending.DeviceID == params.DeviceID && pending.PublicKey == params.PublicKey {
+			return PairingAction{Status: "pending", RequestID: pending.RequestID}
+		}
+	}
+	return PairingAction{Status: "pairing-required"}
+}
+
+// checkLimits enforces the global pending cap and the per-IP request rate.
+// replacing is the number of pending requests the new one will replace,
+// which do not count against the cap.
+func (s *Service) checkLimits(remoteIP string, replacing int) error {
+	s.limitersMu.Lock()
+	defer s.limitersMu.Unlock()
+
+	if s.limits.MaxPending > 0 && len(s.store.ListPending())-replacing >= s.limits.MaxPending {
+		return ErrTooManyPending
+	}
+
+	if s.limits.PerIPPerMinute <= 0 || remoteIP == "" {
+		return nil
+	}
+	burst := s.limits.PerIPBurst
+	if burst <= 0 {
+		burst = s.limits.PerIPPerMinute
+	}
+	every := time.Minute / time.Duration(s.limits.PerIPPerMinute)
+	now := time.Now()
+	s.evictIdleIPLimiters(now, every*time.Duration(burst))
+	entry, ok := s.ipLimiters[remoteIP]
+	if !ok {
+		entry = &idleLimiter{limiter: rate.NewLimiter(rate.Every(every), burst)}
+		s.ipLimiters[remoteIP] = entry
+	}
+	entry.lastSeen = now
+	if !entry.limiter.Allow() {
+		return ErrPairingRateLimited
+	}
+	return nil
+}
+
+// evictIdleIPLimiters drops, at most once per idle, the per-IP limiters
+// unused for idle, the time one takes to refill: a new one behaves the
+// same. s.limitersMu must be held.
+func (s *Service) evictIdleIPLimiters(now time.Time, idle time.Duration) {
+	if now.Sub(s.lastIPSweep) < idle {
+		return
+	}
+	s.lastIPSweep = now
+	for ip, entry := range s.ipLimiters {
+		if now.Sub(entry.lastSeen) >= idle {
+			delete(s.ipLimiters, ip)
+		}
+	}
+}
+
+// idleLimiter is the rate limiter of one IP or device, with when it was
+// last used so idle ones can be evicted.
+type idleLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// checkRepairLimit enforces Limits.RepairsPerDevice for a device replacing
+// its pending request. Only a key that does not derive the device ID can
+// replace one (see checkDeviceID), and any such key may claim the ID, so
+// the budget is per device: per key, fresh keys could evict the device's
+// own re-pair without limit.
+func (s *Service) checkRepairLimit(deviceID string) error {
+	s.limitersMu.Lock()
+	defer s.limitersMu.Unlock()
+
+	if s.limits.RepairsPerDevice <= 0 {
+		return nil
+	}
+	now := time.Now()
+	s.evictIdleDeviceLimiters(now)
+	entry, ok := s.deviceLimiters[deviceID]
+	if !ok {
+		every := time.Duration(PendingTTLMs) * time.Millisecond / time.Duration(s.limits.RepairsPerDevice)
+		entry = &idleLimiter{limiter: rate.NewLimiter(rate.Every(every), s.limits.RepairsPerDevice)}
+		s.deviceLimiters[deviceID] = entry
+	}
+	entry.lastSeen = now
+	if !entry.limiter.Allow() {
+		return ErrPairingRateLimited
+	}
+	return nil
+}
+
+// evictIdleDeviceLimiters drops, at most once per PendingTTLMs, the
+// device limiters unused for PendingTTLMs: they have refilled by then, so
+// a new one behaves the same. s.limitersMu must be held.
+func (s *Service) evictIdleDeviceLimiters(now time.Time) {
+	idle := time.Duration(PendingTTLMs) * time.Millisecond
+	if now.Sub(s.lastSweep) < idle {
+		return
+	}
+	s.lastSweep = now
+	for id, entry := range s.deviceLimiters {
+		if now.Sub(entry.lastSeen) >= idle {
+			delete(s.deviceLimiters, id)
+		}
+	}
+}
+
+// intersectScopes returns the scopes in want that are also in allowed.
+func intersectScopes(want, allowed []string) []string {
+	out := make([]string, 0, len(want))
+	for _, s := range want {
+		if scopesContainAll(allowed, []string{s}) {
+			out = append(out, s)
+		}
 	}
+	return out
 }
 
 // scopesContainAll checks if 'have' contains all scopes in 'need'.
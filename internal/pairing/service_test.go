@@ -4,6 +4,10 @@ import (
 	"crypto/ed25519"
 	"crypto/rand"
 	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -428,6 +432,44 @@ func TestVerifyDeviceToken(t *testing.T) {
 
 // --- EnsureDeviceToken ---
 
+func TestVerifyDeviceToken_TracksUsage(t *testing.T) {
+	svc, store := newTestService(t)
+	pub, id := makeTestKeypair(t)
+	pairDeviceWithToken(t, store, id, pub, "node", "tok", nil)
+
+	params := VerifyTokenParams{DeviceID: id, Token: "tok", Role: "node"}
+	start := time.Now().UnixMilli()
+	for i := 0; i < 3; i++ {
+		if res := svc.VerifyDeviceToken(params); !res.OK {
+			t.Fatalf("verify %d: %s", i, res.Reason)
+		}
+	}
+	// A failed verification is not a use.
+	svc.VerifyDeviceToken(VerifyTokenParams{DeviceID: id, Token: "wrong", Role: "node"})
+
+	tok := store.GetPairedDevice(id).Tokens["node"]
+	if tok.UseCount != 3 {
+		t.Errorf("UseCount = %d, want 3", tok.UseCount)
+	}
+	if tok.LastUsedMs < start {
+		t.Errorf("LastUsedMs = %d, want >= %d", tok.LastUsedMs, start)
+	}
+}
+
+func TestPairedDevice_UsageSummary(t *testing.T) {
+	now := time.Now()
+	dev := PairedDevice{Tokens: map[string]DeviceAuthToken{}}
+	if got := dev.UsageSummary(now); got != "never used" {
+		t.Errorf("UsageSummary = %q, want %q", got, "never used")
+	}
+
+	dev.Tokens["node"] = DeviceAuthToken{LastUsedMs: now.Add(-3 * time.Minute).UnixMilli(), UseCount: 40}
+	dev.Tokens["operator"] = DeviceAuthToken{LastUsedMs: now.Add(-2 * time.Hour).UnixMilli(), UseCount: 2}
+	if got, want := dev.UsageSummary(now), "last used 3m ago, 42 uses"; got != want {
+		t.Errorf("UsageSummary = %q, want %q", got, want)
+	}
+}
+
 func TestEnsureDeviceToken(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -649,6 +691,72 @@ func TestCheckPairingStatus(t *testing.T) {
 			},
 			want: "pairing-required",
 		},
+		{
+			name: "unknown key on loopback requires re-pair",
+			setup: func(t *testing.T, store *Store) (string, string) {
+				oldPub, id := makeTestKeypair(t)
+				pairDevice(t, store, id, oldPub, "node", nil)
+				newPub, _ := makeTestKeypair(t)
+				return newPub, id
+			},
+			params: func(pubB64, deviceID string) CheckPairingParams {
+				return CheckPairingParams{
+					DeviceID: deviceID, PublicKey: pubB64,
+					Role: "node", IsLocal: true,
+				}
+			},
+			want: "pairing-required",
+		},
+		{
+			name: "failed auto-approve reports error",
+			setup: func(t *testing.T, store *Store) (string, string) {
+				// Block the pending write.
+				if err := os.Mkdir(filepath.Join(store.stateDir, "pending.json.tmp"), 0700); err != nil {
+					t.Fatal(err)
+				}
+				return makeTestKeypair(t)
+			},
+			params: func(pubB64, deviceID string) CheckPairingParams {
+				return CheckPairingParams{
+					DeviceID: deviceID, PublicKey: pubB64,
+					Role: "node", IsLocal: true,
+				}
+			},
+			want: "error",
+		},
+		{
+			name: "failed auto-approval reports error",
+			setup: func(t *testing.T, store *Store) (string, string) {
+				// The silent request is saved, but approving it is not.
+				if err := os.Mkdir(filepath.Join(store.stateDir, "paired.json.tmp"), 0700); err != nil {
+					t.Fatal(err)
+				}
+				return makeTestKeypair(t)
+			},
+			params: func(pubB64, deviceID string) CheckPairingParams {
+				return CheckPairingParams{
+					DeviceID: deviceID, PublicKey: pubB64,
+					Role: "node", IsLocal: true,
+				}
+			},
+			want: "error",
+		},
+		{
+			name: "failed remote request reports error",
+			setup: func(t *testing.T, store *Store) (string, string) {
+				if err := os.Mkdir(filepath.Join(store.stateDir, "pending.json.tmp"), 0700); err != nil {
+					t.Fatal(err)
+				}
+				return makeTestKeypair(t)
+			},
+			params: func(pubB64, deviceID string) CheckPairingParams {
+				return CheckPairingParams{
+					DeviceID: deviceID, PublicKey: pubB64,
+					Role: "node", IsLocal: false,
+				}
+			},
+			want: "error",
+		},
 	}
 
 	for _, tt := range tests {
@@ -664,3 +772,561 @@ func TestCheckPairingStatus(t *testing.T) {
 		})
 	}
 }
+
+func TestCheckPairingStatus_KeyHistory(t *testing.T) {
+	svc, store := newTestService(t)
+
+	oldPub, id := makeTestKeypair(t)
+	pairDevice(t, store, id, oldPub, "node", nil)
+
+	// Device rotates its keypair; operator approves the re-pair.
+	newPub, _ := makeTestKeypair(t)
+	pending, err := svc.RequestPairing(PairingRequestInput{DeviceID: id, PublicKey: newPub, Role: "node"})
+	if err != nil || pending == nil {
+		t.Fatalf("RequestPairing: pending=%v err=%v", pending, err)
+	}
+	if !pending.IsRepair {
+		t.Error("expected IsRepair for rotated key")
+	}
+	device, err := svc.Approve(pending.RequestID)
+	if err != nil || device == nil {
+		t.Fatalf("Approve: device=%v err=%v", device, err)
+	}
+	if device.PublicKey != newPub {
+		t.Errorf("PublicKey = %q, want rotated key", device.PublicKey)
+	}
+	if len(device.PublicKeys) != 2 {
+		t.Errorf("PublicKeys has %d entries, want 2", len(device.PublicKeys))
+	}
+
+	unknownPub, _ := makeTestKeypair(t)
+
+	tests := []struct {
+		name      string
+		publicKey string
+		want      string
+	}{
+		{name: "current key", publicKey: newPub, want: "paired"},
+		{name: "prior key", publicKey: oldPub, want: "paired"},
+		{name: "unknown key", publicKey: unknownPub, want: "pairing-required"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action := svc.CheckPairingStatus(CheckPairingParams{
+				DeviceID: id, PublicKey: tt.publicKey, Role: "node",
+			})
+			if action.Status != tt.want {
+				t.Errorf("Status = %q, want %q", action.Status, tt.want)
+			}
+		})
+	}
+}
+
+// --- Limits ---
+
+func TestRequestPairing_Limits(t *testing.T) {
+	tests := []struct {
+		name    string
+		limits  Limits
+		inputs  []PairingRequestInput // device IDs/keys are filled in per input
+		wantErr []error
+	}{
+		{
+			name:   "per-IP limit rejects after burst",
+			limits: Limits{PerIPPerMinute: 2, PerIPBurst: 2},
+			inputs: []PairingRequestInput{
+				{RemoteIP: "10.0.0.5"}, {RemoteIP: "10.0.0.5"}, {RemoteIP: "10.0.0.5"},
+			},
+			wantErr: []error{nil, nil, ErrPairingRateLimited},
+		},
+		{
+			name:   "limit is tracked per IP",
+			limits: Limits{PerIPPerMinute: 1, PerIPBurst: 1},
+			inputs: []PairingRequestInput{
+				{RemoteIP: "10.0.0.5"}, {RemoteIP: "10.0.0.6"}, {RemoteIP: "10.0.0.5"},
+			},
+			wantErr: []error{nil, nil, ErrPairingRateLimited},
+		},
+		{
+			name:   "loopback is exempt",
+			limits: Limits{PerIPPerMinute: 1, PerIPBurst: 1, MaxPending: 1},
+			inputs: []PairingRequestInput{
+				{RemoteIP: "127.0.0.1", IsLocal: true},
+				{RemoteIP: "127.0.0.1", IsLocal: true},
+				{RemoteIP: "127.0.0.1", IsLocal: true},
+			},
+			wantErr: []error{nil, nil, nil},
+		},
+		{
+			name:   "max pending caps the global queue",
+			limits: Limits{MaxPending: 2},
+			inputs: []PairingRequestInput{
+				{RemoteIP: "10.0.0.1"}, {RemoteIP: "10.0.0.2"}, {RemoteIP: "10.0.0.3"},
+			},
+			wantErr: []error{nil, nil, ErrTooManyPending},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, _ := newTestService(t)
+			svc.WithLimits(tt.limits)
+
+			for i, in := range tt.inputs {
+				in.PublicKey, in.DeviceID = makeTestKeypair(t)
+				_, err := svc.RequestPairing(in)
+				if !errors.Is(err, tt.wantErr[i]) {
+					t.Errorf("request %d: err = %v, want %v", i, err, tt.wantErr[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRequestPairing_ExistingPendingNotLimited(t *testing.T) {
+	svc, _ := newTestService(t)
+	svc.WithLimits(Limits{PerIPPerMinute: 1, PerIPBurst: 1})
+
+	pub, id := makeTestKeypair(t)
+	in := PairingRequestInput{DeviceID: id, PublicKey: pub, RemoteIP: "10.0.0.5"}
+	first, err := svc.RequestPairing(in)
+	if err != nil {
+		t.Fatalf("first request: %v", err)
+	}
+
+	// Reconnecting with the same device returns the existing request
+	// without spending the IP's budget.
+	again, err := svc.RequestPairing(in)
+	if err != nil {
+		t.Fatalf("repeat request: %v", err)
+	}
+	if again.RequestID != first.RequestID {
+		t.Errorf("RequestID = %q, want %q", again.RequestID, first.RequestID)
+	}
+}
+
+func TestCheckPairingStatus_RateLimited(t *testing.T) {
+	svc, _ := newTestService(t)
+	svc.WithLimits(Limits{MaxPending: 1})
+
+	for i, want := range []string{"pairing-required", "rate-limited"} {
+		pub, id := makeTestKeypair(t)
+		action := svc.CheckPairingStatus(CheckPairingParams{
+			DeviceID: id, PublicKey: pub, Role: "node", RemoteIP: "10.0.0.5",
+		})
+		if action.Status != want {
+			t.Errorf("check %d: Status = %q, want %q", i, action.Status, want)
+		}
+	}
+}
+
+func TestApproveWithScopes(t *testing.T) {
+	svc, store := newTestService(t)
+	pub, id := makeTestKeypair(t)
+	store.AddPending(PendingRequest{
+		RequestID: "req-1", DeviceID: id, PublicKey: pub,
+		Role: "node", Scopes: []string{"location.get", "camera.snap"},
+		Timestamp: time.Now().UnixMilli(),
+	})
+
+	device, err := svc.ApproveWithScopes("req-1", []string{"location.get"})
+	if err != nil {
+		t.Fatalf("ApproveWithScopes: %v", err)
+	}
+	if device == nil {
+		t.Fatal("expected non-nil device")
+	}
+
+	tok, ok := device.Tokens["node"]
+	if !ok {
+		t.Fatal("token for role 'node' not found")
+	}
+	if len(tok.Scopes) != 1 || tok.Scopes[0] != "location.get" {
+		t.Errorf("token scopes = %v, want [location.get]", tok.Scopes)
+	}
+
+	// Reconnecting with the originally requested scopes must not widen the grant.
+	ensured := svc.EnsureDeviceToken(id, "node", []string{"location.get", "camera.snap"})
+	if ensured == nil {
+		t.Fatal("expected non-nil token")
+	}
+	if ensured.Token != tok.Token {
+		t.Error("token rotated; want existing narrowed token reused")
+	}
+	if scopesContainAll(ensured.Scopes, []string{"camera.snap"}) {
+		t.Errorf("token scopes = %v, must not include camera.snap", ensured.Scopes)
+	}
+}
+
+func TestApproveWithScopes_EmptyLimitSurvivesReload(t *testing.T) {
+	dir := t.TempDir()
+	server, err := NewStore(dir)
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+
+	// Another process (the CLI) approves the device with no scopes at all.
+	cli, err := NewStore(dir)
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	pub, id := makeTestKeypair(t)
+	cli.AddPending(PendingRequest{
+		RequestID: "req-1", DeviceID: id, PublicKey: pub,
+		Role: "node", Scopes: []string{"location.get"},
+		Timestamp: time.Now().UnixMilli(),
+	})
+	if _, err := NewService(cli).ApproveWithScopes("req-1", []string{}); err != nil {
+		t.Fatalf("ApproveWithScopes: %v", err)
+	}
+
+	if err := server.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	device := server.GetPairedDevice(id)
+	if device == nil {
+		t.Fatal("device not visible after Reload")
+	}
+	if device.ScopeLimit == nil {
+		t.Fatal("empty ScopeLimit came back as nil (no cap) after Reload")
+	}
+	tok := NewService(server).EnsureDeviceToken(id, "node", []string{"location.get"})
+	if tok == nil || len(tok.Scopes) != 0 {
+		t.Errorf("token = %+v, want no scopes", tok)
+	}
+}
+
+func TestApprove_RepairKeepsScopeLimit(t *testing.T) {
+	svc, store := newTestService(t)
+	pub, id := makeTestKeypair(t)
+	store.AddPending(PendingRequest{
+		RequestID: "req-1", DeviceID: id, PublicKey: pub,
+		Role: "node", Scopes: []string{"location.get", "camera.snap"},
+		Timestamp: time.Now().UnixMilli(),
+	})
+	if _, err := svc.ApproveWithScopes("req-1", []string{"location.get"}); err != nil {
+		t.Fatalf("ApproveWithScopes: %v", err)
+	}
+
+	// The device re-pairs under a new key, asking for the wider grant again.
+	newPub, _ := makeTestKeypair(t)
+	pending, err := svc.RequestPairing(PairingRequestInput{
+		DeviceID: id, PublicKey: newPub, Role: "node", Scopes: []string{"location.get", "camera.snap"},
+	})
+	if err != nil || pending == nil {
+		t.Fatalf("RequestPairing: pending=%v err=%v", pending, err)
+	}
+	device, err := svc.Approve(pending.RequestID)
+	if err != nil || device == nil {
+		t.Fatalf("Approve: device=%v err=%v", device, err)
+	}
+	if tok := device.Tokens["node"]; len(tok.Scopes) != 1 || tok.Scopes[0] != "location.get" {
+		t.Errorf("token scopes = %v, want [location.get]", tok.Scopes)
+	}
+}
+
+func TestApprove_RoleDefaultScopes(t *testing.T) {
+	svc, store := newTestService(t)
+	svc.WithRoleDefaultScopes(map[string][]string{"node": {"camera.snap", "location.get"}})
+
+	pub, id := makeTestKeypair(t)
+	store.AddPending(PendingRequest{
+		RequestID: "req-1", DeviceID: id, PublicKey: pub,
+		Role: "node", Timestamp: time.Now().UnixMilli(),
+	})
+	device, err := svc.Approve("req-1")
+	if err != nil || device == nil {
+		t.Fatalf("Approve: %v, %v", device, err)
+	}
+	tok := device.Tokens["node"]
+	if !scopesContainAll(tok.Scopes, []string{"camera.snap", "location.get"}) {
+		t.Errorf("token scopes = %v, want the node defaults", tok.Scopes)
+	}
+
+	// A reconnect asking for no scopes keeps the default grant.
+	ensured := svc.EnsureDeviceToken(id, "node", nil)
+	if ensured == nil || ensured.Token != tok.Token {
+		t.Errorf("EnsureDeviceToken rotated the default-scoped token: %+v", ensured)
+	}
+
+	// Explicitly requested scopes are not widened to the defaults.
+	pub2, id2 := makeTestKeypair(t)
+	store.AddPending(PendingRequest{
+		RequestID: "req-2", DeviceID: id2, PublicKey: pub2,
+		Role: "node", Scopes: []string{"location.get"}, Timestamp: time.Now().UnixMilli(),
+	})
+	device, _ = svc.Approve("req-2")
+	if got := device.Tokens["node"].Scopes; len(got) != 1 || got[0] != "location.get" {
+		t.Errorf("token scopes = %v, want [location.get]", got)
+	}
+
+	// Roles without defaults are unchanged.
+	pub3, id3 := makeTestKeypair(t)
+	pairDevice(t, store, id3, pub3, "operator", nil)
+	if tok := svc.EnsureDeviceToken(id3, "operator", nil); tok == nil || len(tok.Scopes) != 0 {
+		t.Errorf("operator token = %+v, want no scopes", tok)
+	}
+}
+
+func TestApprove_DeviceIDMismatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		spoof   bool
+		wantErr error
+	}{
+		{name: "matching device ID", spoof: false, wantErr: nil},
+		{name: "mismatched device ID", spoof: true, wantErr: ErrDeviceIDMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, store := newTestService(t)
+			pub, id := makeTestKeypair(t)
+			if tt.spoof {
+				_, id = makeTestKeypair(t) // ID of some other key
+			}
+			store.AddPending(PendingRequest{
+				RequestID: "req-1", DeviceID: id, PublicKey: pub, Role: "node",
+				Timestamp: time.Now().UnixMilli(),
+			})
+
+			device, err := svc.Approve("req-1")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Approve err = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if device != nil || store.GetPairedDevice(id) != nil {
+					t.Error("mismatched request must not become a paired device")
+				}
+				if store.GetPendingRequest("req-1") == nil {
+					t.Error("rejected approval should leave the pending request for inspection")
+				}
+				return
+			}
+			if device == nil || device.DeviceID != id {
+				t.Fatalf("device = %+v, want paired %s", device, id)
+			}
+		})
+	}
+}
+
+func TestRequestPairing_DeviceIDMismatch(t *testing.T) {
+	svc, store := newTestService(t)
+	pub, _ := makeTestKeypair(t)
+	_, otherID := makeTestKeypair(t)
+
+	pending, err := svc.RequestPairing(PairingRequestInput{DeviceID: otherID, PublicKey: pub, Role: "node"})
+	if !errors.Is(err, ErrDeviceIDMismatch) {
+		t.Fatalf("RequestPairing err = %v, want ErrDeviceIDMismatch", err)
+	}
+	if pending != nil || len(store.ListPending()) != 0 {
+		t.Error("mismatched request must not be stored")
+	}
+
+	// A paired device may still present a rotated key under its ID.
+	oldPub, id := makeTestKeypair(t)
+	pairDevice(t, store, id, oldPub, "node", nil)
+	newPub, _ := makeTestKeypair(t)
+	if _, err := svc.RequestPairing(PairingRequestInput{DeviceID: id, PublicKey: newPub, Role: "node"}); err != nil {
+		t.Errorf("key rotation rejected: %v", err)
+	}
+}
+
+func TestRequestPairing_CleansClientText(t *testing.T) {
+	svc, _ := newTestService(t)
+	pub, id := makeTestKeypair(t)
+
+	pending, err := svc.RequestPairing(PairingRequestInput{
+		DeviceID:    id,
+		PublicKey:   pub,
+		DisplayName: "Phone\x1b]0;owned\x07\n" + strings.Repeat("é", MaxDisplayNameLen),
+		Platform:    "\x1b[2Jios",
+		Role:        "node",
+	})
+	if err != nil {
+		t.Fatalf("RequestPairing: %v", err)
+	}
+	if want := "Phone]0;owned" + strings.Repeat("é", MaxDisplayNameLen-len("Phone]0;owned")); pending.DisplayName != want {
+		t.Errorf("DisplayName = %q, want %q", pending.DisplayName, want)
+	}
+	if pending.Platform != "[2Jios" {
+		t.Errorf("Platform = %q, want control characters stripped", pending.Platform)
+	}
+}
+
+func TestRequestPairing_ReplacesPendingForDevice(t *testing.T) {
+	svc, store := newTestService(t)
+	oldPub, id := makeTestKeypair(t)
+	pairDevice(t, store, id, oldPub, "node", nil)
+
+	var last *PendingRequest
+	for i := 0; i < 3; i++ {
+		pub, _ := makeTestKeypair(t)
+		pending, err := svc.RequestPairing(PairingRequestInput{DeviceID: id, PublicKey: pub, Role: "node"})
+		if err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+		last = pending
+	}
+
+	var forDevice []PendingRequest
+	for _, p := range store.ListPending() {
+		if p.DeviceID == id {
+			forDevice = append(forDevice, p)
+		}
+	}
+	if len(forDevice) != 1 {
+		t.Fatalf("pending for device = %d, want 1", len(forDevice))
+	}
+	if forDevice[0].RequestID != last.RequestID || forDevice[0].PublicKey != last.PublicKey {
+		t.Error("remaining pending request is not the latest one")
+	}
+}
+
+func TestRequestPairing_RepairLimit(t *testing.T) {
+	svc, store := newTestService(t)
+	svc.WithLimits(Limits{RepairsPerDevice: 1})
+	oldPub, id := makeTestKeypair(t)
+	pairDevice(t, store, id, oldPub, "node", nil)
+
+	// The first request is not a replacement; the second spends the
+	// device's only repair.
+	for i, want := range []error{nil, nil, ErrPairingRateLimited} {
+		pub, _ := makeTestKeypair(t)
+		_, err := svc.RequestPairing(PairingRequestInput{DeviceID: id, PublicKey: pub, Role: "node"})
+		if !errors.Is(err, want) {
+			t.Errorf("request %d: err = %v, want %v", i, err, want)
+		}
+	}
+	if n := len(store.ListPending()); n != 1 {
+		t.Errorf("pending = %d, want 1", n)
+	}
+}
+
+func TestRequestPairing_RateLimitedKeepsPending(t *testing.T) {
+	svc, store := newTestService(t)
+	svc.WithLimits(Limits{PerIPPerMinute: 1, PerIPBurst: 1, RepairsPerDevice: 3})
+	oldPub, id := makeTestKeypair(t)
+	pairDevice(t, store, id, oldPub, "node", nil)
+
+	firstPub, _ := makeTestKeypair(t)
+	first, err := svc.RequestPairing(PairingRequestInput{DeviceID: id, PublicKey: firstPub, Role: "node", RemoteIP: "192.168.1.20"})
+	if err != nil {
+		t.Fatalf("RequestPairing: %v", err)
+	}
+
+	// The IP has no requests left, so the re-request is refused and the
+	// first one stays.
+	secondPub, _ := makeTestKeypair(t)
+	if _, err := svc.RequestPairing(PairingRequestInput{DeviceID: id, PublicKey: secondPub, Role: "node", RemoteIP: "192.168.1.20"}); !errors.Is(err, ErrPairingRateLimited) {
+		t.Fatalf("err = %v, want ErrPairingRateLimited", err)
+	}
+	if got := store.GetPendingRequest(first.RequestID); got == nil || got.PublicKey != firstPub {
+		t.Errorf("pending request after a refused re-request = %+v, want the first one", got)
+	}
+}
+
+func TestRequestPairing_ReplacementAtPendingCap(t *testing.T) {
+	svc, store := newTestService(t)
+	svc.WithLimits(Limits{MaxPending: 1, RepairsPerDevice: 3})
+	oldPub, id := makeTestKeypair(t)
+	pairDevice(t, store, id, oldPub, "node", nil)
+
+	// Replacing the only pending request does not grow the queue.
+	for i := range 2 {
+		pub, _ := makeTestKeypair(t)
+		if _, err := svc.RequestPairing(PairingRequestInput{DeviceID: id, PublicKey: pub, Role: "node", RemoteIP: "192.168.1.20"}); err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+	}
+	if n := len(store.ListPending()); n != 1 {
+		t.Errorf("pending = %d, want 1", n)
+	}
+}
+
+func TestRepairLimiters_EvictedWhenIdle(t *testing.T) {
+	svc, _ := newTestService(t)
+	svc.WithLimits(Limits{RepairsPerDevice: 1})
+	for _, id := range []string{"dev-0", "dev-1", "dev-2"} {
+		if err := svc.checkRepairLimit(id); err != nil {
+			t.Fatalf("checkRepairLimit: %v", err)
+		}
+	}
+
+	svc.limitersMu.Lock()
+	defer svc.limitersMu.Unlock()
+	idle := time.Duration(PendingTTLMs) * time.Millisecond
+	svc.deviceLimiters["dev-0"].lastSeen = time.Now().Add(-idle)
+	svc.lastSweep = time.Time{} // make the next sweep due
+	svc.evictIdleDeviceLimiters(time.Now())
+	if _, ok := svc.deviceLimiters["dev-0"]; ok {
+		t.Error("idle limiter was kept")
+	}
+	if n := len(svc.deviceLimiters); n != 2 {
+		t.Errorf("limiters = %d, want the 2 recently used", n)
+	}
+}
+
+func TestIPLimiters_EvictedWhenIdle(t *testing.T) {
+	svc, _ := newTestService(t)
+	svc.WithLimits(Limits{PerIPPerMinute: 5, PerIPBurst: 5})
+	for _, ip := range []string{"192.168.1.10", "192.168.1.11", "192.168.1.12"} {
+		if err := svc.checkLimits(ip, 0); err != nil {
+			t.Fatalf("checkLimits: %v", err)
+		}
+	}
+
+	svc.limitersMu.Lock()
+	defer svc.limitersMu.Unlock()
+	svc.ipLimiters["192.168.1.10"].lastSeen = time.Now().Add(-time.Minute)
+	svc.lastIPSweep = time.Time{} // make the next sweep due
+	svc.evictIdleIPLimiters(time.Now(), time.Minute)
+	if _, ok := svc.ipLimiters["192.168.1.10"]; ok {
+		t.Error("idle limiter was kept")
+	}
+	if n := len(svc.ipLimiters); n != 2 {
+		t.Errorf("limiters = %d, want the 2 recently used", n)
+	}
+}
+
+func TestRenameDevice(t *testing.T) {
+	svc, store := newTestService(t)
+	pub, id := makeTestKeypair(t)
+	pairDevice(t, store, id, pub, "node", nil)
+
+	if err := svc.RenameDevice(id, "  Kitchen iPad  "); err != nil {
+		t.Fatalf("RenameDevice: %v", err)
+	}
+	dev := store.GetPairedDevice(id)
+	if dev == nil {
+		t.Fatal("device disappeared after rename")
+	}
+	if dev.DisplayName != "Kitchen iPad" {
+		t.Errorf("DisplayName = %q, want %q", dev.DisplayName, "Kitchen iPad")
+	}
+
+	tests := []struct {
+		name     string
+		deviceID string
+		newName  string
+	}{
+		{"empty name", id, "   "},
+		{"name too long", id, strings.Repeat("x", MaxDisplayNameLen+1)},
+		{"unknown device", "no-such-device", "Phone"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := svc.RenameDevice(tt.deviceID, tt.newName); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+
+	if err := svc.RenameDevice("no-such-device", "Phone"); !errors.Is(err, ErrDeviceNotFound) {
+		t.Errorf("err = %v, want ErrDeviceNotFound", err)
+	}
+	if got := store.GetPairedDevice(id).DisplayName; got != "Kitchen iPad" {
+		t.Errorf("DisplayName changed by failed rename: %q", got)
+	}
+}
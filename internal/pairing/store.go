@@ -3,10 +3,12 @@ package pairing
 import (
 	"encoding/json"
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
 	"sort"
 	"sync"
+	"time"
 )
 
 const PendingTTLMs = 5 * 60 * 1000 // 5 minutes
@@ -37,12 +39,14 @@ type DeviceAuthToken struct {
 	RotatedAtMs int64    `json:"rotatedAtMs,omitempty"`
 	RevokedAtMs int64    `json:"revokedAtMs,omitempty"`
 	LastUsedMs  int64    `json:"lastUsedAtMs,omitempty"`
+	UseCount    int64    `json:"useCount,omitempty"` // connects and verifications; resets on rotation
 }
 
 // PairedDevice represents a fully paired device.
 type PairedDevice struct {
 	DeviceID     string                     `json:"deviceId"`
-	PublicKey    string                     `json:"publicKey"`
+	PublicKey    string                     `json:"publicKey"`            // current key
+	PublicKeys   []string                   `json:"publicKeys,omitempty"` // all approved keys, oldest first
 	DisplayName  string                     `json:"displayName,omitempty"`
 	Platform     string                     `json:"platform,omitempty"`
 	ClientID     string                     `json:"clientId,omitempty"`
@@ -50,11 +54,120 @@ type PairedDevice struct {
 	Role         string                     `json:"role,omitempty"`
 	Scopes       []string                   `json:"scopes,omitempty"`
 	RemoteIP     string                     `json:"remoteIP,omitempty"`
+	ScopeLimit   []string                   `json:"scopeLimit"`       // operator-narrowed grant; caps token scopes. Empty caps to none, null to no cap
+	Tags         []string                   `json:"tags,omitempty"`   // operator-assigned, normalized by NormalizeTags
 	Tokens       map[string]DeviceAuthToken `json:"tokens,omitempty"` // keyed by role
 	CreatedAtMs  int64                      `json:"createdAtMs"`
 	ApprovedAtMs int64                      `json:"approvedAtMs"`
 }
 
+// HasPublicKey reports whether key is the current or any previously
+// approved public key for this device.
+func (d *PairedDevice) HasPublicKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	if d.PublicKey == key {
+		return true
+	}
+	for _, k := range d.PublicKeys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// OwnsDeviceID reports whether the device's ID derives from its current
+// or any previously approved public key. A rotated device keeps the ID
+// of its first key, so the current key alone is not enough.
+func (d *PairedDevice) OwnsDeviceID() bool {
+	keys := d.PublicKeys
+	if len(keys) == 0 {
+		keys = []string{d.PublicKey}
+	}
+	for _, k := range keys {
+		if DeriveDeviceID(k) == d.DeviceID {
+			return true
+		}
+	}
+	return false
+}
+
+// GrantedScopes returns the scopes in requested that the device was
+// approved for, or nil when role is not the role it was approved as.
+// Scopes a client claims in its connect request are never trusted beyond
+// this.
+func (d *PairedDevice) GrantedScopes(role string, requested []string) []string {
+	if d.Role != role {
+		return nil
+	}
+	granted := d.Scopes
+	if d.ScopeLimit != nil {
+		granted = intersectScopes(granted, d.ScopeLimit)
+	}
+	return intersectScopes(requested, granted)
+}
+
+// Usage returns when any of the device's tokens was last used and how
+// many times they have been used in total.
+func (d *PairedDevice) Usage() (lastUsedMs, useCount int64) {
+	for _, tok := range d.Tokens {
+		lastUsedMs = max(lastUsedMs, tok.LastUsedMs)
+		useCount += tok.UseCount
+	}
+	return lastUsedMs, useCount
+}
+
+// UsageSummary describes Usage for listings, e.g. "last used 3m ago,
+// 42 uses", or "never used".
+func (d *PairedDevice) UsageSummary(now time.Time) string {
+	lastUsedMs, useCount := d.Usage()
+	if lastUsedMs == 0 {
+		return "never used"
+	}
+	uses := "uses"
+	if useCount == 1 {
+		uses = "use"
+	}
+	return fmt.Sprintf("last used %s, %d %s", ago(now.Sub(time.UnixMilli(lastUsedMs))), useCount, uses)
+}
+
+// ago renders d coarsely, to the largest whole unit.
+func ago(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d/time.Minute))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh ago", int(d/time.Hour))
+	default:
+		return fmt.Sprintf("%dd ago", int(d/(24*time.Hour)))
+	}
+}
+
+// ClientLabel joins a client ID and mode as "id (mode)", or just the ID
+// when mode is empty.
+func ClientLabel(id, mode string) string {
+	if mode == "" {
+		return id
+	}
+	return fmt.Sprintf("%s (%s)", id, mode)
+}
+
+// addPublicKey records key as the current key, keeping prior keys in the
+// history. Legacy records without a history get their existing key seeded.
+func (d *PairedDevice) addPublicKey(key string) {
+	if len(d.PublicKeys) == 0 && d.PublicKey != "" {
+		d.PublicKeys = []string{d.PublicKey}
+	}
+	if !d.HasPublicKey(key) {
+		d.PublicKeys = append(d.PublicKeys, key)
+	}
+	d.PublicKey = key
+}
+
 // PairingState is the root state serialized to disk.
 type PairingState struct {
 	PendingByID    map[string]PendingRequest `json:"pendingById"`
@@ -79,16 +192,50 @@ type Store struct {
 	mu       sync.Mutex
 	state    PairingState
 	stateDir string
+
+	// stamps records each state file as last read or written, so Reload
+	// can skip files no other process has touched since.
+	stamps map[string]fileStamp
+}
+
+// fileStamp identifies a version of a state file by modification time and
+// size. The zero value stands for a missing file.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// unknownStamp matches no file, so Reload reads a file stamped with it.
+var unknownStamp = fileStamp{size: -1}
+
+func (f fileStamp) equal(g fileStamp) bool {
+	return f.modTime.Equal(g.modTime) && f.size == g.size
 }
 
 // NewStore loads existing state from disk or initializes empty state.
+// A state directory or file readable by group or others is chmodded to
+// 0700 or 0600 first.
 func NewStore(stateDir string) (*Store, error) {
+	return newStore(stateDir, false)
+}
+
+// NewStrictStore is like NewStore but refuses to open state with loose
+// permissions, returning an error wrapping ErrInsecurePerms instead.
+func NewStrictStore(stateDir string) (*Store, error) {
+	return newStore(stateDir, true)
+}
+
+func newStore(stateDir string, strictPerms bool) (*Store, error) {
 	if err := os.MkdirAll(stateDir, 0700); err != nil {
 		return nil, fmt.Errorf("create state dir: %w", err)
 	}
+	if err := checkPerms(stateDir, strictPerms); err != nil {
+		return nil, err
+	}
 
 	s := &Store{
 		stateDir: stateDir,
+		stamps:   make(map[string]fileStamp),
 		state: PairingState{
 			PendingByID:    make(map[string]PendingRequest),
 			PairedByDevice: make(map[string]PairedDevice),
@@ -96,39 +243,71 @@ func NewStore(stateDir string) (*Store, error) {
 	}
 
 	// Load pending
-	if err := s.loadJSON("pending.json", &s.state.PendingByID); err != nil {
+	stamp, err := s.loadJSON("pending.json", &s.state.PendingByID)
+	if err != nil {
 		return nil, err
 	}
+	s.stamps["pending.json"] = stamp
 
 	// Load paired
-	if err := s.loadJSON("paired.json", &s.state.PairedByDevice); err != nil {
+	stamp, err = s.loadJSON("paired.json", &s.state.PairedByDevice)
+	if err != nil {
 		return nil, err
 	}
+	s.stamps["paired.json"] = stamp
 
 	return s, nil
 }
 
 // Reload re-reads pairing state from disk.
 // Useful when another process (e.g., CLI) updates the store.
+// Both files are parsed into fresh maps that replace the current ones
+// under the lock, so readers never see a partial state; on error the
+// current state is kept. A file whose modification time and size are
+// unchanged since it was last read or written is not read again, so
+// calling Reload on every handshake costs two stats when nothing changed.
 func (s *Store) Reload() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	pending := make(map[string]PendingRequest)
-	paired := make(map[string]PairedDevice)
+	pending := s.state.PendingByID
+	paired := s.state.PairedByDevice
+	stamps := make(map[string]fileStamp, 2)
 
-	if err := s.loadJSON("pending.json", &pending); err != nil {
-		return err
+	if s.changed("pending.json") {
+		pending = make(map[string]PendingRequest)
+		stamp, err := s.loadJSON("pending.json", &pending)
+		if err != nil {
+			return err
+		}
+		stamps["pending.json"] = stamp
 	}
-	if err := s.loadJSON("paired.json", &paired); err != nil {
-		return err
+	if s.changed("paired.json") {
+		paired = make(map[string]PairedDevice)
+		stamp, err := s.loadJSON("paired.json", &paired)
+		if err != nil {
+			return err
+		}
+		stamps["paired.json"] = stamp
 	}
 
 	s.state.PendingByID = pending
 	s.state.PairedByDevice = paired
+	maps.Copy(s.stamps, stamps)
 	return nil
 }
 
+// changed stats a state file and reports whether it differs from the
+// version last read or written. A file that cannot be stat'ed counts as
+// changed, leaving the error to loadJSON.
+func (s *Store) changed(filename string) bool {
+	stamp, err := statFile(filepath.Join(s.stateDir, filename))
+	if err != nil {
+		return true
+	}
+	return !stamp.equal(s.stamps[filename])
+}
+
 // --- Read operations ---
 
 // GetPendingRequest returns a pending request by ID, or nil if not found.
@@ -189,6 +368,18 @@ func (s *Store) ListPaired() []PairedDevice {
 	return result
 }
 
+// GetByTag returns the paired devices carrying tag, ignoring case, sorted
+// like ListPaired.
+func (s *Store) GetByTag(tag string) []PairedDevice {
+	var result []PairedDevice
+	for _, dev := range s.ListPaired() {
+		if dev.HasTag(tag) {
+			result = append(result, dev)
+		}
+	}
+	return result
+}
+
 // --- Write operations ---
 
 // AddPending adds or overwrites a pending request and persists to disk.
@@ -264,6 +455,26 @@ func (s *Store) UpdateDeviceMetadata(deviceID string, patch DeviceMetadataPatch)
 	return s.savePaired()
 }
 
+// SetDeviceTags replaces a paired device's tags with the NormalizeTags form
+// of tags. An empty list clears them.
+func (s *Store) SetDeviceTags(deviceID string, tags []string) error {
+	tags, err := NormalizeTags(tags)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dev, ok := s.state.PairedByDevice[deviceID]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrDeviceNotFound, deviceID)
+	}
+	dev.Tags = tags
+	s.state.PairedByDevice[deviceID] = dev
+	return s.savePaired()
+}
+
 // SetDeviceToken sets a device's token for a given role.
 func (s *Store) SetDeviceToken(deviceID, role string, token DeviceAuthToken) error {
 	s.mu.Lock()
@@ -303,6 +514,42 @@ func (s *Store) PruneExpiredPending(now int64) int {
 	return pruned
 }
 
+// PruneDeadTokens deletes tokens revoked before olderThanMs (Unix ms) from
+// every paired device. Tokens carry no expiry, so revoked tokens are the
+// only dead ones. With keepLatest, each device keeps its most recently
+// revoked token for audit. paired.json is written once, if anything was
+// pruned. Returns the number of tokens pruned.
+func (s *Store) PruneDeadTokens(olderThanMs int64, keepLatest bool) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pruned := 0
+	for id, dev := range s.state.PairedByDevice {
+		latest := ""
+		if keepLatest {
+			var latestMs int64
+			for role, tok := range dev.Tokens {
+				if tok.RevokedAtMs > latestMs {
+					latest, latestMs = role, tok.RevokedAtMs
+				}
+			}
+		}
+		for role, tok := range dev.Tokens {
+			if tok.RevokedAtMs == 0 || tok.RevokedAtMs >= olderThanMs || role == latest {
+				continue
+			}
+			delete(dev.Tokens, role)
+			pruned++
+		}
+		s.state.PairedByDevice[id] = dev
+	}
+
+	if pruned > 0 {
+		s.savePaired()
+	}
+	return pruned
+}
+
 // --- Persistence helpers ---
 
 func (s *Store) savePending() error {
@@ -323,32 +570,65 @@ func (s *Store) saveJSON(filename string, data interface{}) error {
 		return fmt.Errorf("marshal %s: %w", filename, err)
 	}
 
+	// Until the file is known to hold the in-memory state, the next
+	// Reload must read it again.
+	s.stamps[filename] = unknownStamp
+
 	if err := os.WriteFile(tmp, bytes, 0600); err != nil {
 		return fmt.Errorf("write %s: %w", tmp, err)
 	}
 
+	// Stamp the temp file: the rename keeps its modification time and
+	// size, and statting the target afterwards could pick up another
+	// process's write instead of ours.
+	stamp, statErr := statFile(tmp)
+
 	if err := os.Rename(tmp, target); err != nil {
 		os.Remove(tmp)
 		return fmt.Errorf("rename %s: %w", filename, err)
 	}
 
+	// Our own write needs no Reload.
+	if statErr == nil {
+		s.stamps[filename] = stamp
+	}
 	return nil
 }
 
-// loadJSON loads JSON from a file into target. Missing files are ignored.
-func (s *Store) loadJSON(filename string, target interface{}) error {
+// loadJSON loads JSON from a file into target and returns the stamp of the
+// version read. Missing files are ignored.
+func (s *Store) loadJSON(filename string, target interface{}) (fileStamp, error) {
 	path := filepath.Join(s.stateDir, filename)
+	// Stat before reading: if the file is replaced in between, the older
+	// stamp only makes the next Reload read it again.
+	stamp, err := statFile(path)
+	if err != nil {
+		return fileStamp{}, fmt.Errorf("stat %s: %w", filename, err)
+	}
 	data, err := os.ReadFile(path)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return nil // fresh state
+			return fileStamp{}, nil // fresh state
 		}
-		return fmt.Errorf("read %s: %w", filename, err)
+		return fileStamp{}, fmt.Errorf("read %s: %w", filename, err)
 	}
 
 	if err := json.Unmarshal(data, target); err != nil {
-		return fmt.Errorf("unmarshal %s: %w", filename, err)
+		return fileStamp{}, fmt.Errorf("unmarshal %s: %w", filename, err)
 	}
 
-	return nil
+	return stamp, nil
+}
+
+// statFile returns the stamp of the file at path, or the zero stamp if it
+// does not exist.
+func statFile(path string) (fileStamp, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fileStamp{}, nil
+		}
+		return fileStamp{}, err
+	}
+	return fileStamp{modTime: info.ModTime(), size: info.Size()}, nil
 }
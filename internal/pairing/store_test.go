@@ -1,6 +1,9 @@
 package pairing
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"sync"
@@ -249,6 +252,77 @@ func TestStorePruneExpiredPending(t *testing.T) {
 	})
 }
 
+// --- PruneDeadTokens ---
+
+func TestStorePruneDeadTokens(t *testing.T) {
+	now := int64(10_000_000_000)
+	day := int64(24 * 60 * 60 * 1000)
+
+	setup := func(t *testing.T) *Store {
+		t.Helper()
+		s := newTestStore(t)
+		dev := makePaired("dev-1", 1000)
+		dev.Tokens = map[string]DeviceAuthToken{
+			"node":     {Token: "live", Role: "node", CreatedAtMs: now - 90*day},
+			"operator": {Token: "old", Role: "operator", RevokedAtMs: now - 60*day},
+			"admin":    {Token: "older", Role: "admin", RevokedAtMs: now - 90*day},
+			"viewer":   {Token: "recent", Role: "viewer", RevokedAtMs: now - day},
+		}
+		if err := s.SetPaired(dev); err != nil {
+			t.Fatalf("SetPaired: %v", err)
+		}
+		return s
+	}
+	roles := func(s *Store) map[string]bool {
+		out := make(map[string]bool)
+		for role := range s.GetPairedDevice("dev-1").Tokens {
+			out[role] = true
+		}
+		return out
+	}
+
+	t.Run("prunes old revoked tokens", func(t *testing.T) {
+		s := setup(t)
+		if pruned := s.PruneDeadTokens(now-30*day, false); pruned != 2 {
+			t.Errorf("pruned %d, want 2", pruned)
+		}
+		got := roles(s)
+		if !got["node"] || !got["viewer"] || got["operator"] || got["admin"] {
+			t.Errorf("remaining roles = %v, want node and viewer", got)
+		}
+
+		// The pruned state is what was persisted.
+		reloaded, err := NewStore(s.stateDir)
+		if err != nil {
+			t.Fatalf("NewStore reload: %v", err)
+		}
+		if n := len(reloaded.GetPairedDevice("dev-1").Tokens); n != 2 {
+			t.Errorf("reloaded %d tokens, want 2", n)
+		}
+	})
+
+	t.Run("keepLatest keeps the most recent revoked token", func(t *testing.T) {
+		s := setup(t)
+		if pruned := s.PruneDeadTokens(now, true); pruned != 2 {
+			t.Errorf("pruned %d, want 2", pruned)
+		}
+		got := roles(s)
+		if !got["node"] || !got["viewer"] || len(got) != 2 {
+			t.Errorf("remaining roles = %v, want node and viewer", got)
+		}
+	})
+
+	t.Run("nothing to prune", func(t *testing.T) {
+		s := setup(t)
+		if pruned := s.PruneDeadTokens(now-100*day, false); pruned != 0 {
+			t.Errorf("pruned %d, want 0", pruned)
+		}
+		if n := len(roles(s)); n != 4 {
+			t.Errorf("remaining %d tokens, want 4", n)
+		}
+	})
+}
+
 // --- Persistence ---
 
 func TestStorePersistence(t *testing.T) {
@@ -361,6 +435,61 @@ func TestStoreSetDeviceToken(t *testing.T) {
 	}
 }
 
+// --- Tags ---
+
+func TestStoreSetDeviceTags(t *testing.T) {
+	s := newTestStore(t)
+	s.SetPaired(makePaired("dev-1", 1000))
+	s.SetPaired(makePaired("dev-2", 2000))
+	s.SetPaired(makePaired("dev-3", 3000))
+
+	if err := s.SetDeviceTags("dev-1", []string{" Lobby", "warehouse-3", "lobby", ""}); err != nil {
+		t.Fatalf("SetDeviceTags: %v", err)
+	}
+	if err := s.SetDeviceTags("dev-3", []string{"lobby"}); err != nil {
+		t.Fatalf("SetDeviceTags: %v", err)
+	}
+
+	if got := fmt.Sprint(s.GetPairedDevice("dev-1").Tags); got != "[lobby warehouse-3]" {
+		t.Errorf("dev-1 tags = %s, want [lobby warehouse-3]", got)
+	}
+
+	lobby := s.GetByTag("LOBBY")
+	if len(lobby) != 2 || lobby[0].DeviceID != "dev-3" || lobby[1].DeviceID != "dev-1" {
+		t.Errorf("GetByTag(lobby) = %v, want dev-3, dev-1", lobby)
+	}
+	if got := s.GetByTag("warehouse-3"); len(got) != 1 || got[0].DeviceID != "dev-1" {
+		t.Errorf("GetByTag(warehouse-3) = %v, want dev-1", got)
+	}
+	if got := s.GetByTag("dock"); len(got) != 0 {
+		t.Errorf("GetByTag(dock) = %v, want none", got)
+	}
+
+	// Tags persist.
+	s2, err := NewStore(s.stateDir)
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	if got := s2.GetByTag("lobby"); len(got) != 2 {
+		t.Errorf("after reload GetByTag(lobby) = %d devices, want 2", len(got))
+	}
+
+	// An empty list clears.
+	if err := s.SetDeviceTags("dev-1", nil); err != nil {
+		t.Fatalf("SetDeviceTags(nil): %v", err)
+	}
+	if tags := s.GetPairedDevice("dev-1").Tags; len(tags) != 0 {
+		t.Errorf("tags after clear = %v, want none", tags)
+	}
+
+	if err := s.SetDeviceTags("dev-2", []string{"no spaces"}); err == nil {
+		t.Error("expected error for invalid tag")
+	}
+	if err := s.SetDeviceTags("missing", []string{"lobby"}); !errors.Is(err, ErrDeviceNotFound) {
+		t.Errorf("SetDeviceTags(missing) = %v, want ErrDeviceNotFound", err)
+	}
+}
+
 // --- Concurrency ---
 
 func TestStoreConcurrency(t *testing.T) {
@@ -414,3 +543,162 @@ func TestStoreUpdateDeviceMetadata(t *testing.T) {
 		t.Error("expected error for non-existent device")
 	}
 }
+
+// --- Reload ---
+
+func TestStoreReload(t *testing.T) {
+	dir := t.TempDir()
+	server, err := NewStore(dir)
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	server.SetPaired(makePaired("dev-1", 1000))
+
+	// Another process (the CLI) approves a device.
+	cli, err := NewStore(dir)
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	cli.SetPaired(makePaired("dev-2", 2000))
+
+	if server.GetPairedDevice("dev-2") != nil {
+		t.Fatal("dev-2 visible before Reload")
+	}
+	if err := server.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if server.GetPairedDevice("dev-2") == nil {
+		t.Fatal("dev-2 not visible after Reload")
+	}
+	if server.GetPairedDevice("dev-1") == nil {
+		t.Fatal("dev-1 lost after Reload")
+	}
+}
+
+func TestStoreReloadCorruptFileKeepsState(t *testing.T) {
+	s := newTestStore(t)
+	s.SetPaired(makePaired("dev-1", 1000))
+
+	if err := os.WriteFile(filepath.Join(s.stateDir, "paired.json"), []byte("{not json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Reload(); err == nil {
+		t.Fatal("Reload of corrupt file should fail")
+	}
+	if s.GetPairedDevice("dev-1") == nil {
+		t.Fatal("failed Reload should keep previous state")
+	}
+}
+
+func TestStoreReloadSkipsUnchangedFiles(t *testing.T) {
+	s := newTestStore(t)
+	s.SetPaired(makePaired("dev-1", 1000))
+	path := filepath.Join(s.stateDir, "paired.json")
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Corrupt the file but keep its size and mtime: Reload must not
+	// notice, which shows it did not read the file.
+	garbage := bytes.Repeat([]byte("x"), int(info.Size()))
+	if err := os.WriteFile(path, garbage, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Reload(); err != nil {
+		t.Fatalf("Reload of unchanged file: %v", err)
+	}
+	if s.GetPairedDevice("dev-1") == nil {
+		t.Fatal("dev-1 lost after no-op Reload")
+	}
+
+	// Touching the file makes Reload read it again.
+	later := info.ModTime().Add(time.Second)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Reload(); err == nil {
+		t.Fatal("Reload of touched file should re-read and fail on the corrupt content")
+	}
+}
+
+func TestStoreReloadAfterFailedSave(t *testing.T) {
+	s := newTestStore(t)
+	if err := s.SetPaired(makePaired("dev-1", 1000)); err != nil {
+		t.Fatal(err)
+	}
+
+	// A directory in the way of the temp file makes the save fail, leaving
+	// dev-2 in memory only.
+	tmp := filepath.Join(s.stateDir, "paired.json.tmp")
+	if err := os.Mkdir(tmp, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetPaired(makePaired("dev-2", 2000)); err == nil {
+		t.Fatal("expected save error")
+	}
+	if err := os.Remove(tmp); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if s.GetPairedDevice("dev-2") != nil {
+		t.Error("Reload kept a device that was never saved")
+	}
+	if s.GetPairedDevice("dev-1") == nil {
+		t.Error("Reload lost the saved device")
+	}
+}
+
+func TestStoreReloadConcurrentReads(t *testing.T) {
+	s := newTestStore(t)
+	for i := 0; i < 20; i++ {
+		s.SetPaired(makePaired(fmt.Sprintf("dev-%d", i), int64(i)))
+	}
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if n := len(s.ListPaired()); n != 20 {
+				t.Errorf("reader saw %d devices mid-reload, want 20", n)
+				return
+			}
+		}
+	}()
+	for i := 0; i < 50; i++ {
+		if err := s.Reload(); err != nil {
+			t.Fatalf("Reload: %v", err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+}
+func TestPairedDeviceGrantedScopes(t *testing.T) {
+	dev := PairedDevice{Role: "operator", Scopes: []string{"operator.admin", "operator.read"}}
+
+	got := dev.GrantedScopes("operator", []string{"operator.admin", "operator.write"})
+	if len(got) != 1 || got[0] != "operator.admin" {
+		t.Errorf("GrantedScopes = %v, want [operator.admin]", got)
+	}
+	if got := dev.GrantedScopes("node", []string{"operator.admin"}); got != nil {
+		t.Errorf("GrantedScopes for another role = %v, want nil", got)
+	}
+
+	dev.ScopeLimit = []string{"operator.read"}
+	if got := dev.GrantedScopes("operator", []string{"operator.admin", "operator.read"}); len(got) != 1 || got[0] != "operator.read" {
+		t.Errorf("GrantedScopes with ScopeLimit = %v, want [operator.read]", got)
+	}
+}
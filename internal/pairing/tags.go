@@ -0,0 +1,47 @@
+package pairing
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Limits on device tags accepted by NormalizeTags.
+const (
+	MaxTags   = 16
+	MaxTagLen = 32
+)
+
+// NormalizeTags lowercases, trims and de-duplicates tags and returns them
+// sorted. A tag may contain letters, digits, '-', '_' and '.'; empty
+// entries are dropped, so a nil or blank list clears a device's tags.
+func NormalizeTags(tags []string) ([]string, error) {
+	var out []string
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" {
+			continue
+		}
+		if len(tag) > MaxTagLen {
+			return nil, fmt.Errorf("tag %q too long (%d > %d characters)", tag, len(tag), MaxTagLen)
+		}
+		for _, r := range tag {
+			if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.') {
+				return nil, fmt.Errorf("tag %q: invalid character %q", tag, r)
+			}
+		}
+		if !slices.Contains(out, tag) {
+			out = append(out, tag)
+		}
+	}
+	if len(out) > MaxTags {
+		return nil, fmt.Errorf("too many tags (%d > %d)", len(out), MaxTags)
+	}
+	slices.Sort(out)
+	return out, nil
+}
+
+// HasTag reports whether the device carries tag, ignoring case.
+func (d *PairedDevice) HasTag(tag string) bool {
+	return slices.ContainsFunc(d.Tags, func(t string) bool { return strings.EqualFold(t, tag) })
+}
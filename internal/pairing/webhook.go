@@ -0,0 +1,55 @@
+package pairing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// WebhookTimeout bounds each outbound pending-request notification.
+const WebhookTimeout = 5 * time.Second
+
+// WebhookNotifier returns an OnPending listener that POSTs each pending
+// request as JSON to url. Delivery runs in its own goroutine so the
+// handshake is never blocked; failures are logged and dropped.
+func WebhookNotifier(url string) func(PendingRequest) {
+	client := &http.Client{Timeout: WebhookTimeout}
+	return func(req PendingRequest) {
+		go func() {
+			if err := postPending(client, url, req); err != nil {
+				slog.Warn("pairing webhook failed", "requestId", req.RequestID, "error", err)
+			}
+		}()
+	}
+}
+
+func postPending(client *http.Client, url string, req PendingRequest) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), WebhookTimeout)
+	defer cancel()
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
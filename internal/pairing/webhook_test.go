@@ -0,0 +1,99 @@
+package pairing
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWebhookNotifier(t *testing.T) {
+	received := make(chan PendingRequest, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("method = %s, want POST", r.Method)
+		}
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Content-Type = %q, want application/json", ct)
+		}
+		var req PendingRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("decode body: %v", err)
+		}
+		received <- req
+	}))
+	defer srv.Close()
+
+	svc, _ := newTestService(t)
+	svc.OnPending(WebhookNotifier(srv.URL))
+
+	pub, id := makeTestKeypair(t)
+	pending, err := svc.RequestPairing(PairingRequestInput{
+		DeviceID: id, PublicKey: pub, DisplayName: "Kitchen iPhone", Role: "node",
+	})
+	if err != nil {
+		t.Fatalf("RequestPairing: %v", err)
+	}
+
+	select {
+	case got := <-received:
+		if got.RequestID != pending.RequestID {
+			t.Errorf("RequestID = %q, want %q", got.RequestID, pending.RequestID)
+		}
+		if got.DisplayName != "Kitchen iPhone" {
+			t.Errorf("DisplayName = %q, want 'Kitchen iPhone'", got.DisplayName)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for webhook delivery")
+	}
+}
+
+func TestOnPending(t *testing.T) {
+	tests := []struct {
+		name      string
+		isLocal   bool
+		repeat    bool
+		wantCalls int
+	}{
+		{name: "new remote request fires", wantCalls: 1},
+		{name: "silent local request does not fire", isLocal: true, wantCalls: 0},
+		{name: "existing pending does not fire again", repeat: true, wantCalls: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, _ := newTestService(t)
+			calls := 0
+			svc.OnPending(func(PendingRequest) { calls++ })
+
+			pub, id := makeTestKeypair(t)
+			in := PairingRequestInput{DeviceID: id, PublicKey: pub, IsLocal: tt.isLocal}
+			svc.RequestPairing(in)
+			if tt.repeat {
+				svc.RequestPairing(in)
+			}
+
+			if calls != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestWebhookNotifier_DoesNotBlock(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	notify := WebhookNotifier(srv.URL)
+
+	start := time.Now()
+	notify(PendingRequest{RequestID: "req-1"})
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("notifier blocked for %v", elapsed)
+	}
+}
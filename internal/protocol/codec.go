@@ -0,0 +1,79 @@
+package protocol
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Codec encodes frames for the wire and decodes them back. Frames carry
+// params and payloads as JSON internally whatever the codec, so handlers
+// never see the wire format.
+type Codec interface {
+	// Name is the value clients send in ConnectParams.Encoding.
+	Name() string
+	// Binary reports whether frames travel as binary WebSocket messages.
+	Binary() bool
+	// Encode serializes a *RequestFrame, *ResponseFrame or *EventFrame.
+	Encode(frame any) ([]byte, error)
+	// Decode parses data into a frame, like ParseFrame.
+	Decode(data []byte) (any, error)
+}
+
+var (
+	// JSON is the default codec: JSON text messages.
+	JSON Codec = jsonCodec{}
+	// Msgpack sends the same frames as MessagePack binary messages.
+	Msgpack Codec = msgpackCodec{}
+)
+
+// CodecByName returns the codec a client asked for in its connect
+// params. An empty name selects JSON.
+func CodecByName(name string) (Codec, error) {
+	switch name {
+	case "", JSON.Name():
+		return JSON, nil
+	case Msgpack.Name():
+		return Msgpack, nil
+	}
+	return nil, &FrameError{
+		Code:    CodeUnsupportedEncoding,
+		Field:   "encoding",
+		Message: fmt.Sprintf("unsupported encoding %q (want %q or %q)", name, JSON.Name(), Msgpack.Name()),
+	}
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string { return "json" }
+func (jsonCodec) Binary() bool { return false }
+
+func (jsonCodec) Encode(frame any) ([]byte, error) {
+	return json.Marshal(frame)
+}
+
+func (jsonCodec) Decode(data []byte) (any, error) {
+	return ParseFrame(data)
+}
+
+// msgpackCodec encodes frames straight from their structs. Params and
+// payloads, held as JSON, are transcoded onto the JSON data model, so a
+// frame decodes to the same value it would have as JSON. Object keys keep
+// their order.
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string { return "msgpack" }
+func (msgpackCodec) Binary() bool { return true }
+
+func (msgpackCodec) Encode(frame any) ([]byte, error) {
+	return appendMsgpackFrame(nil, frame)
+}
+
+func (msgpackCodec) Decode(data []byte) (any, error) {
+	frame, err := unmarshalMsgpackFrame(data)
+	var fe *FrameError
+	if err != nil && !errors.As(err, &fe) {
+		return nil, &FrameError{Code: CodeInvalidMsgpack, Message: fmt.Sprintf("invalid frame msgpack: %v", err)}
+	}
+	return frame, err
+}
@@ -0,0 +1,185 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func codecTestFrames(t *testing.T) []any {
+	t.Helper()
+	retryable := true
+	seq := 7
+
+	req, err := NewRequestFrame("req-1", "node.invoke.result", map[string]any{
+		"id":          "inv-1",
+		"ok":          true,
+		"payloadJSON": `{"lat":40.7128}`,
+		"nested":      map[string]any{"list": []any{1, -1, -200, 70000, 1.5, "x", nil, false}},
+		"big":         uint64(math.MaxUint64),
+		"long":        strings.Repeat("a", 300),
+		"escaped":     "line\n\"quoted\" \\ caf\u00e9 <b>&\u2028\x01",
+		"float":       1e-9,
+	})
+	require.NoError(t, err)
+
+	res, err := NewResponseFrame("req-2", false, nil, &ErrorShape{Code: "UNAVAILABLE", Message: "later", Retryable: &retryable})
+	require.NoError(t, err)
+
+	evt, err := NewEventFrame("tick", map[string]any{"ts": int64(1700000000000)})
+	require.NoError(t, err)
+	evt.Seq = &seq
+
+	return []any{req, res, evt}
+}
+
+// normalize re-decodes any RawMessage fields so frames can be compared
+// regardless of key order or whitespace.
+func normalize(t *testing.T, frame any) map[string]any {
+	t.Helper()
+	data, err := json.Marshal(frame)
+	require.NoError(t, err)
+	var m map[string]any
+	require.NoError(t, json.Unmarshal(data, &m))
+	return m
+}
+
+func TestCodec_RoundTripMatchesJSON(t *testing.T) {
+	for _, frame := range codecTestFrames(t) {
+		jsonData, err := JSON.Encode(frame)
+		require.NoError(t, err)
+		viaJSON, err := JSON.Decode(jsonData)
+		require.NoError(t, err)
+
+		packed, err := Msgpack.Encode(frame)
+		require.NoError(t, err)
+		viaMsgpack, err := Msgpack.Decode(packed)
+		require.NoError(t, err)
+
+		assert.IsType(t, viaJSON, viaMsgpack)
+		assert.Equal(t, normalize(t, viaJSON), normalize(t, viaMsgpack))
+		assert.Less(t, len(packed), len(jsonData), "msgpack should be more compact")
+	}
+}
+
+func TestMsgpack_WireFormat(t *testing.T) {
+	frame, err := NewEventFrame("tick", map[string]any{"n": -33})
+	require.NoError(t, err)
+	packed, err := Msgpack.Encode(frame)
+	require.NoError(t, err)
+
+	want := []byte{
+		0x83, // map of 3: event, payload, type
+		0xa5, 'e', 'v', 'e', 'n', 't', 0xa4, 't', 'i', 'c', 'k',
+		0xa7, 'p', 'a', 'y', 'l', 'o', 'a', 'd', 0x81, 0xa1, 'n', 0xd0, 0xdf,
+		0xa4, 't', 'y', 'p', 'e', 0xa5, 'e', 'v', 'e', 'n', 't',
+	}
+	assert.Equal(t, want, packed)
+}
+
+func TestMsgpack_DecodeRejectsMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"truncated string", []byte{0xa5, 'a'}},
+		{"trailing bytes", []byte{0xc0, 0xc0}},
+		{"non-string key", []byte{0x81, 0x01, 0x01}},
+		{"extension type", []byte{0xd4, 0x01, 0x00}},
+		{"binary type", []byte{0xc4, 0x01, 0x00}},
+		{"forged array length", []byte{0xdd, 0xff, 0xff, 0xff, 0xff}},
+		{"too deep", []byte(strings.Repeat("\x91", maxMsgpackDepth+2) + "\xc0")},
+		{"not a frame", []byte{0x80}},
+		{"not a map", []byte{0x91, 0xc0}},
+		{"id not a string", []byte{0x82, 0xa4, 't', 'y', 'p', 'e', 0xa3, 'r', 'e', 'q', 0xa2, 'i', 'd', 0x01}},
+		{"payload not JSON", []byte{0x83, 0xa4, 't', 'y', 'p', 'e', 0xa5, 'e', 'v', 'e', 'n', 't', 0xa5, 'e', 'v', 'e', 'n', 't', 0xa1, 'x',
+			0xa7, 'p', 'a', 'y', 'l', 'o', 'a', 'd', 0xcb, 0x7f, 0xf8, 0, 0, 0, 0, 0, 0}}, // NaN
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Msgpack.Decode(tt.data)
+			require.Error(t, err)
+			assert.IsType(t, &FrameError{}, err)
+		})
+	}
+}
+
+func TestMsgpack_DecodeValidatesLikeJSON(t *testing.T) {
+	// Unknown keys are skipped; a request without a method keeps its ID.
+	packed := []byte{0x83,
+		0xa4, 't', 'y', 'p', 'e', 0xa3, 'r', 'e', 'q',
+		0xa2, 'i', 'd', 0xa5, 'r', 'e', 'q', '-', '9',
+		0xa5, 'e', 'x', 't', 'r', 'a', 0x90,
+	}
+	_, err := Msgpack.Decode(packed)
+	require.Error(t, err)
+	fe := err.(*FrameError)
+	assert.Equal(t, CodeMissingField, fe.Code)
+	assert.Equal(t, "method", fe.Field)
+	assert.Equal(t, "req-9", fe.ID)
+}
+
+func BenchmarkCodec_Encode(b *testing.B) {
+	frame, err := NewResponseFrame("req-1", true, benchPayload(), nil)
+	require.NoError(b, err)
+	for _, codec := range []Codec{JSON, Msgpack} {
+		b.Run(codec.Name(), func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, err := codec.Encode(frame); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkCodec_Decode(b *testing.B) {
+	frame, err := NewResponseFrame("req-1", true, benchPayload(), nil)
+	require.NoError(b, err)
+	for _, codec := range []Codec{JSON, Msgpack} {
+		data, err := codec.Encode(frame)
+		require.NoError(b, err)
+		b.Run(codec.Name(), func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, err := codec.Decode(data); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// benchPayload resembles a node list response.
+func benchPayload() map[string]any {
+	nodes := make([]any, 20)
+	for i := range nodes {
+		nodes[i] = map[string]any{
+			"nodeId":      fmt.Sprintf("iphone-%d", i),
+			"displayName": "Kitchen iPhone",
+			"platform":    "ios",
+			"commands":    []any{"camera.snap", "location.get", "screen.record"},
+			"connectedAt": int64(1700000000000 + i),
+		}
+	}
+	return map[string]any{"nodes": nodes}
+}
+
+func TestCodecByName(t *testing.T) {
+	for name, want := range map[string]Codec{"": JSON, "json": JSON, "msgpack": Msgpack} {
+		got, err := CodecByName(name)
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+
+	_, err := CodecByName("cbor")
+	require.Error(t, err)
+	assert.Equal(t, "UNSUPPORTED_ENCODING", err.(*FrameError).Code)
+}
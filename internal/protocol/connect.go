@@ -1,9 +1,16 @@
 package protocol
 
-import "fmt"
+import (
+	"fmt"
+	"slices"
+)
 
-// ServerProtocol is the protocol version this server speaks.
-const ServerProtocol = 3
+// ServerProtocol is the newest protocol version this server speaks.
+const ServerProtocol = 4
+
+// SupportedProtocols lists every protocol version the server can speak,
+// oldest first. NegotiateProtocol picks the highest one the client accepts.
+var SupportedProtocols = []int{3, ServerProtocol}
 
 // ---------- connect request params ----------
 
@@ -18,15 +25,50 @@ type ConnectParams struct {
 	Permissions map[string]bool  `json:"permissions,omitempty"`
 	Auth        *ConnectAuth     `json:"auth,omitempty"`
 	Device      *DeviceConnectPayload `json:"device,omitempty"`
+	DryRun      bool             `json:"dryRun,omitempty"` // validate the handshake without connecting
+	Encoding    string           `json:"encoding,omitempty"` // frame codec after connect: "json" (default) or "msgpack"
+	WantTicks   *bool            `json:"wantTicks,omitempty"` // nil or true: receive tick events
+
+	// ClientNonce, when set, must be fresh for each connect; the gateway
+	// refuses a reused one. A gateway with a server key then signs
+	// hello-ok over it (see pairing.BuildHelloPayload).
+	ClientNonce string `json:"clientNonce,omitempty"`
 }
 
 // DeviceConnectPayload carries cryptographic device identity in the connect request.
 type DeviceConnectPayload struct {
 	ID        string `json:"id"`
-	PublicKey string `json:"publicKey"` // base64url-encoded raw 32-byte Ed25519 public key
-	Signature string `json:"signature"` // base64url-encoded Ed25519 signature
-	SignedAt  int64  `json:"signedAt"`  // milliseconds since epoch
-	Nonce     string `json:"nonce"`     // server-issued challenge nonce
+	PublicKey string `json:"publicKey"`     // base64url-encoded raw 32-byte Ed25519 public key
+	Signature string `json:"signature"`     // base64url-encoded Ed25519 signature
+	SignedAt  int64  `json:"signedAt"`      // milliseconds since epoch
+	Nonce     string `json:"nonce"`         // server-issued challenge nonce
+	Algorithm string `json:"alg,omitempty"` // signature algorithm; empty means "ed25519"
+}
+
+// ConnectChallenge is the connect.challenge event payload. Clients that
+// predate the server identity fields ignore them.
+type ConnectChallenge struct {
+	Nonce     string `json:"nonce"`
+	Ts        int64  `json:"ts"`        // seconds since epoch
+	Protocols []int  `json:"protocols"` // see SupportedProtocols
+
+	ServerVersion string `json:"serverVersion,omitempty"`
+	Protocol      int    `json:"protocol"` // ServerProtocol
+
+	// ServerKey and Signature are set when the gateway has a server key:
+	// the base64url Ed25519 public key, and its signature over the nonce
+	// and Ts (see pairing.BuildChallengePayload), so a client can pin the
+	// gateway and refuse a stale challenge.
+	ServerKey string `json:"serverKey,omitempty"`
+	Signature string `json:"signature,omitempty"`
+}
+
+// ShutdownEvent is the shutdown event payload, sent to every connection
+// before the gateway closes it.
+type ShutdownEvent struct {
+	Reason       string `json:"reason"`                 // e.g. "signal"
+	Reconnect    bool   `json:"reconnect"`              // the gateway expects to come back
+	RetryAfterMs int64  `json:"retryAfterMs,omitempty"` // suggested wait before reconnecting
 }
 
 // HelloAuthInfo carries auth tokens in the hello-ok response.
@@ -48,16 +90,26 @@ type ConnectAuth struct {
 	Token string `json:"token"`
 }
 
-// ValidateConnect checks that the server's protocol version falls within
-// the client's advertised [MinProtocol, MaxProtocol] range.
-func ValidateConnect(params ConnectParams) error {
-	if ServerProtocol < params.MinProtocol || ServerProtocol > params.MaxProtocol {
-		return &FrameError{
-			Code:    "PROTOCOL_MISMATCH",
-			Message: fmt.Sprintf("server protocol %d not in client range [%d, %d]", ServerProtocol, params.MinProtocol, params.MaxProtocol),
+// NegotiateProtocol returns the highest version in SupportedProtocols that
+// falls within the client's advertised [MinProtocol, MaxProtocol] range.
+func NegotiateProtocol(params ConnectParams) (int, error) {
+	for i := len(SupportedProtocols) - 1; i >= 0; i-- {
+		if v := SupportedProtocols[i]; v >= params.MinProtocol && v <= params.MaxProtocol {
+			return v, nil
 		}
 	}
-	return nil
+	return 0, &FrameError{
+		Code: CodeProtocolMismatch,
+		Message: fmt.Sprintf("no common protocol: client range [%d, %d], server supports %v",
+			params.MinProtocol, params.MaxProtocol, SupportedProtocols),
+	}
+}
+
+// ValidateConnect checks that the client's advertised protocol range
+// includes a version the server supports.
+func ValidateConnect(params ConnectParams) error {
+	_, err := NegotiateProtocol(params)
+	return err
 }
 
 // ---------- hello-ok response ----------
@@ -69,6 +121,11 @@ type HelloOk struct {
 	Features Features   `json:"features"`
 	Snapshot Snapshot   `json:"snapshot"`
 	Policy   Policy     `json:"policy"`
+
+	// Signature is set when the gateway has a server key and the connect
+	// request carried a ClientNonce: the base64url signature over
+	// pairing.BuildHelloPayload.
+	Signature string `json:"signature,omitempty"`
 }
 
 type ServerInfo struct {
@@ -81,6 +138,42 @@ type Features struct {
 	Events  []string `json:"events"`
 }
 
+// serverMethods are the request methods the gateway handles: connect
+// during the handshake, the rest by handlers the gateway registers. Add a
+// method here when registering its handler; a gateway test checks the two
+// agree.
+var serverMethods = []string{
+	"connect",
+	"node.invoke.result",
+	"node.list",
+	"node.invoke",
+	"node.event",
+	"node.event.subscribe",
+	"node.event.unsubscribe",
+}
+
+// serverEvents are the events the gateway emits. Add an event here when
+// adding its emitter; a gateway test checks the two agree.
+var serverEvents = []string{
+	"connect.challenge",
+	"node.invoke.request",
+	"node.invoke.ack",
+	"node.invoke.stale",
+	"node.event",
+	"presence",
+	"tick",
+	"shutdown",
+}
+
+// ServerFeatures returns the methods and events this server supports, as
+// advertised in hello-ok.
+func ServerFeatures() Features {
+	return Features{
+		Methods: slices.Clone(serverMethods),
+		Events:  slices.Clone(serverEvents),
+	}
+}
+
 type Snapshot struct{}
 
 type Policy struct {
@@ -105,3 +198,71 @@ type NodeInvokeResult struct {
 	PayloadJSON *string     `json:"payloadJSON,omitempty"`
 	Error       *ErrorShape `json:"error,omitempty"`
 }
+
+// NodeInvokeAck answers a node.invoke.result. It is sent as node.invoke.ack
+// when the result reached its invoke, and as node.invoke.stale with Error
+// set when no invoke was waiting (timed out, cancelled or already
+// answered), so the node can stop retrying.
+type NodeInvokeAck struct {
+	ID     string      `json:"id"`
+	NodeID string      `json:"nodeId,omitempty"`
+	Error  *ErrorShape `json:"error,omitempty"`
+}
+
+// ---------- operator requests ----------
+
+// NodeInfo describes a connected node in a node.list response.
+type NodeInfo struct {
+	NodeID      string   `json:"nodeId"`
+	DeviceID    string   `json:"deviceId,omitempty"` // verified at connect; empty without device auth
+	DisplayName string   `json:"displayName,omitempty"`
+	Platform    string   `json:"platform,omitempty"`
+	Version     string   `json:"version,omitempty"`
+	Commands    []string `json:"commands,omitempty"`
+}
+
+// NodeListResult is the payload of a node.list response.
+type NodeListResult struct {
+	Nodes []NodeInfo `json:"nodes"`
+}
+
+// NodeInvokeParams are the params of an operator node.invoke request. The
+// target is NodeID or, to address a node by its verified identity rather
+// than its client-chosen ID, DeviceID; when both are set they must agree.
+type NodeInvokeParams struct {
+	NodeID     string `json:"nodeId,omitempty"`
+	DeviceID   string `json:"deviceId,omitempty"`
+	Command    string `json:"command"`
+	ParamsJSON string `json:"paramsJSON,omitempty"`
+	TimeoutMs  int    `json:"timeoutMs,omitempty"`
+}
+
+// NodeEventParams are the params of a node's node.event request, which
+// pushes an unsolicited event such as a low-battery alert.
+type NodeEventParams struct {
+	Event       string  `json:"event"`
+	PayloadJSON *string `json:"payloadJSON,omitempty"`
+}
+
+// PresenceEvent is the presence payload sent to operator.admin operators
+// when a node or another operator connects or disconnects.
+type PresenceEvent struct {
+	Role     string `json:"role"`             // "node" or "operator"
+	NodeID   string `json:"nodeId,omitempty"` // nodes only
+	ConnID   string `json:"connId,omitempty"` // operators only; their client IDs need not be unique
+	DeviceID string `json:"deviceId,omitempty"`
+	Online   bool   `json:"online"`
+}
+
+// NodeEvent is the node.event payload relayed to subscribed operators.
+type NodeEvent struct {
+	NodeID      string  `json:"nodeId"`
+	Event       string  `json:"event"`
+	PayloadJSON *string `json:"payloadJSON,omitempty"`
+}
+
+// NodeEventSubscribeParams are the params of an operator's
+// node.event.subscribe and node.event.unsubscribe requests.
+type NodeEventSubscribeParams struct {
+	NodeID string `json:"nodeId,omitempty"` // empty: every node
+}
@@ -79,6 +79,26 @@ func TestValidateConnect_ProtocolTooHigh(t *testing.T) {
     assert.Error(t, err)
 }
 
+func TestNegotiateProtocol_SelectsHighestCommon(t *testing.T) {
+    v, err := NegotiateProtocol(ConnectParams{MinProtocol: 3, MaxProtocol: 4})
+    require.NoError(t, err)
+    assert.Equal(t, 4, v)
+
+    v, err = NegotiateProtocol(ConnectParams{MinProtocol: 3, MaxProtocol: 3})
+    require.NoError(t, err)
+    assert.Equal(t, 3, v)
+}
+
+func TestNegotiateProtocol_NoCommonVersion(t *testing.T) {
+    _, err := NegotiateProtocol(ConnectParams{MinProtocol: 2, MaxProtocol: 2})
+    require.Error(t, err)
+    fe, ok := err.(*FrameError)
+    require.True(t, ok)
+    assert.Equal(t, "PROTOCOL_MISMATCH", fe.Code)
+    assert.Contains(t, fe.Message, "client range [2, 2]")
+    assert.Contains(t, fe.Message, "server supports [3 4]")
+}
+
 func TestHelloOk_Encode(t *testing.T) {
     hello := HelloOk{
         Type:     "hello-ok",
@@ -0,0 +1,65 @@
+package protocol
+
+import "slices"
+
+// Error codes carried in ErrorShape.Code, FrameError.Code and WebSocket
+// close reasons. Clients match on them, so a code is never renamed once
+// shipped; add new ones here and to errorCodes.
+const (
+	// Frame decoding.
+	CodeInvalidJSON         = "INVALID_JSON"
+	CodeInvalidMsgpack      = "INVALID_MSGPACK"
+	CodeInvalidFrame        = "INVALID_FRAME"
+	CodeMissingField        = "MISSING_FIELD"
+	CodeUnknownType         = "UNKNOWN_TYPE"
+	CodeUnsupportedEncoding = "UNSUPPORTED_ENCODING"
+
+	// Connect handshake.
+	CodeInvalidMethod      = "INVALID_METHOD" // first request was not connect
+	CodeProtocolMismatch   = "PROTOCOL_MISMATCH"
+	CodeUnauthorized       = "UNAUTHORIZED"
+	CodeUnsupportedAlg     = "UNSUPPORTED_ALGORITHM"
+	CodeInvalidSignature   = "INVALID_SIGNATURE"
+	CodeInvalidNonce       = "INVALID_NONCE"
+	CodeInvalidDeviceID    = "INVALID_DEVICE_ID"
+	CodeNotPaired          = "NOT_PAIRED"
+	CodePairingRateLimited = "PAIRING_RATE_LIMITED"
+	CodePairingError       = "PAIRING_ERROR"
+	CodeTokenIssueFailed   = "TOKEN_ISSUE_FAILED"
+
+	// Requests after connect.
+	CodeUnknownMethod = "UNKNOWN_METHOD"
+	CodeForbidden     = "FORBIDDEN"
+	CodeInvokeFailed  = "INVOKE_FAILED"
+	CodeStaleResult   = "STALE_RESULT"
+
+	// Close reasons.
+	CodeIdleTimeout        = "IDLE_TIMEOUT"
+	CodeNodeIDConflict     = "NODE_ID_CONFLICT"
+	CodeTooManyConnections = "TOO_MANY_CONNECTIONS"
+)
+
+var errorCodes = []string{
+	CodeInvalidJSON, CodeInvalidMsgpack, CodeInvalidFrame, CodeMissingField,
+	CodeUnknownType, CodeUnsupportedEncoding,
+	CodeInvalidMethod, CodeProtocolMismatch, CodeUnauthorized, CodeUnsupportedAlg,
+	CodeInvalidSignature, CodeInvalidNonce, CodeInvalidDeviceID, CodeNotPaired,
+	CodePairingRateLimited, CodePairingError, CodeTokenIssueFailed,
+	CodeUnknownMethod, CodeForbidden, CodeInvokeFailed, CodeStaleResult,
+	CodeIdleTimeout, CodeNodeIDConflict, CodeTooManyConnections,
+}
+
+// ErrorCodes returns every error code the gateway sends, sorted.
+func ErrorCodes() []string {
+	return slices.Sorted(slices.Values(errorCodes))
+}
+
+// IsErrorCode reports whether code is one of ErrorCodes.
+func IsErrorCode(code string) bool {
+	return slices.Contains(errorCodes, code)
+}
+
+// NewError returns an ErrorShape with the given code and message.
+func NewError(code, message string) *ErrorShape {
+	return &ErrorShape{Code: code, Message: message}
+}
@@ -0,0 +1,83 @@
+package protocol
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestErrorCodes_RegistryComplete checks that every Code* constant is
+// listed in ErrorCodes.
+func TestErrorCodes_RegistryComplete(t *testing.T) {
+	f, err := parser.ParseFile(token.NewFileSet(), "errcode.go", nil, 0)
+	require.NoError(t, err)
+
+	declared := 0
+	for _, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.CONST {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			vs := spec.(*ast.ValueSpec)
+			for i, name := range vs.Names {
+				if !strings.HasPrefix(name.Name, "Code") {
+					continue
+				}
+				code, err := strconv.Unquote(vs.Values[i].(*ast.BasicLit).Value)
+				require.NoError(t, err)
+				assert.True(t, IsErrorCode(code), "%s (%s) missing from errorCodes", name.Name, code)
+				declared++
+			}
+		}
+	}
+	assert.Len(t, ErrorCodes(), declared, "errorCodes lists a code twice or one with no constant")
+}
+
+// TestErrorCodes_NoStrayLiterals fails when gateway or protocol code sends
+// an error code as a string literal that ErrorCodes does not know, so new
+// codes get a constant and stay enumerable for clients.
+func TestErrorCodes_NoStrayLiterals(t *testing.T) {
+	codeLike := regexp.MustCompile(`^[A-Z][A-Z0-9_]{3,}$`)
+	files, err := filepath.Glob("*.go")
+	require.NoError(t, err)
+	gateway, err := filepath.Glob("../gateway/*.go")
+	require.NoError(t, err)
+	files = append(files, gateway...)
+
+	fset := token.NewFileSet()
+	for _, path := range files {
+		if strings.HasSuffix(path, "_test.go") || path == "errcode.go" {
+			continue
+		}
+		f, err := parser.ParseFile(fset, path, nil, 0)
+		require.NoError(t, err)
+		ast.Inspect(f, func(n ast.Node) bool {
+			lit, ok := n.(*ast.BasicLit)
+			if !ok || lit.Kind != token.STRING {
+				return true
+			}
+			s, err := strconv.Unquote(lit.Value)
+			if err == nil && codeLike.MatchString(s) {
+				assert.True(t, IsErrorCode(s), "%s: error code %q is not in ErrorCodes; add a constant to errcode.go",
+					fset.Position(lit.Pos()), s)
+			}
+			return true
+		})
+	}
+}
+
+func TestNewError(t *testing.T) {
+	e := NewError(CodeNotPaired, "pair first")
+	assert.Equal(t, "NOT_PAIRED", e.Code)
+	assert.Equal(t, "pair first", e.Message)
+	assert.Nil(t, e.Retryable)
+}
@@ -8,9 +8,10 @@ import (
 
 // FrameError carries structured context for observability.
 type FrameError struct {
-	Code    string // e.g. "INVALID_JSON", "MISSING_FIELD", "UNKNOWN_TYPE"
+	Code    string // e.g. CodeInvalidJSON, CodeMissingField, CodeUnknownType
 	Field   string // which field was the problem, if applicable
 	Message string // human-readable detail
+	ID      string // ID of the offending request, when it could be recovered
 }
 
 func (e *FrameError) Error() string {
@@ -66,11 +67,11 @@ func ParseFrame(data []byte) (any, error) {
 
 	var raw RawFrame
 	if err := json.Unmarshal(data, &raw); err != nil {
-		return nil, &FrameError{Code: "INVALID_JSON", Message: fmt.Sprintf("invalid frame JSON: %v", err)}
+		return nil, &FrameError{Code: CodeInvalidJSON, Message: fmt.Sprintf("invalid frame JSON: %v", err)}
 	}
 
 	if raw.Type == "" {
-		return nil, &FrameError{Code: "MISSING_FIELD", Field: "type", Message: "frame missing required \"type\" field"}
+		return nil, &FrameError{Code: CodeMissingField, Field: "type", Message: "frame missing required \"type\" field", ID: frameID(data)}
 	}
 
 	switch raw.Type {
@@ -78,44 +79,79 @@ func ParseFrame(data []byte) (any, error) {
 	case FrameTypeReq:
 		var req RequestFrame
 		if err := json.Unmarshal(data, &req); err != nil {
-			return nil, &FrameError{Code: "INVALID_JSON", Message: fmt.Sprintf("invalid request frame JSON: %v", err)}
+			return nil, &FrameError{Code: CodeInvalidJSON, Message: fmt.Sprintf("invalid request frame JSON: %v", err), ID: frameID(data)}
 		}
 
-		if req.ID == "" {
-			return nil, &FrameError{Code: "MISSING_FIELD", Field: "id", Message: "request frame missing required \"id\" field"}
-		}
-		if req.Method == "" {
-			return nil, &FrameError{Code: "MISSING_FIELD", Field: "method", Message: "request frame missing required \"method\" field"}
-		}
-		if bytes.Equal(req.Params, []byte("null")) {
-			req.Params = nil
+		if err := req.check(); err != nil {
+			return nil, err
 		}
 		return &req, nil
 
 	case FrameTypeRes:
 		var res ResponseFrame
 		if err := json.Unmarshal(data, &res); err != nil {
-			return nil, &FrameError{Code: "INVALID_JSON", Message: fmt.Sprintf("invalid response frame JSON: %v", err)}
+			return nil, &FrameError{Code: CodeInvalidJSON, Message: fmt.Sprintf("invalid response frame JSON: %v", err)}
 		}
 
-		if res.ID == "" {
-			return nil, &FrameError{Code: "MISSING_FIELD", Field: "id", Message: "response frame missing required \"id\" field"}
+		if err := res.check(); err != nil {
+			return nil, err
 		}
-
 		return &res, nil
 
 	case FrameTypeEvent:
 		var evt EventFrame
 		if err := json.Unmarshal(data, &evt); err != nil {
-			return nil, &FrameError{Code: "INVALID_JSON", Message: fmt.Sprintf("invalid event frame JSON: %v", err)}
+			return nil, &FrameError{Code: CodeInvalidJSON, Message: fmt.Sprintf("invalid event frame JSON: %v", err)}
 		}
 
-		if evt.Event == "" {
-			return nil, &FrameError{Code: "MISSING_FIELD", Field: "event", Message: "event frame missing required \"event\" field"}
+		if err := evt.check(); err != nil {
+			return nil, err
 		}
 		return &evt, nil
 
 	default:
-		return nil, &FrameError{Code: "UNKNOWN_TYPE", Message: fmt.Sprintf("unknown frame type: %q", raw.Type)}
+		return nil, &FrameError{Code: CodeUnknownType, Message: fmt.Sprintf("unknown frame type: %q", raw.Type), ID: frameID(data)}
+	}
+}
+
+// check validates a decoded request frame's required fields and drops a
+// null Params. It is shared by every codec.
+func (req *RequestFrame) check() error {
+	if req.ID == "" {
+		return &FrameError{Code: CodeMissingField, Field: "id", Message: "request frame missing required \"id\" field"}
+	}
+	if req.Method == "" {
+		return &FrameError{Code: CodeMissingField, Field: "method", Message: "request frame missing required \"method\" field", ID: req.ID}
+	}
+	if bytes.Equal(req.Params, []byte("null")) {
+		req.Params = nil
+	}
+	return nil
+}
+
+// check validates a decoded response frame's required fields.
+func (res *ResponseFrame) check() error {
+	if res.ID == "" {
+		return &FrameError{Code: CodeMissingField, Field: "id", Message: "response frame missing required \"id\" field"}
+	}
+	return nil
+}
+
+// check validates a decoded event frame's required fields.
+func (evt *EventFrame) check() error {
+	if evt.Event == "" {
+		return &FrameError{Code: CodeMissingField, Field: "event", Message: "event frame missing required \"event\" field"}
+	}
+	return nil
+}
+
+// frameID returns the string "id" of a JSON object that failed to parse
+// as a frame, or "" if it has none.
+func frameID(data []byte) string {
+	var probe struct {
+		ID any `json:"id"`
 	}
+	json.Unmarshal(data, &probe)
+	id, _ := probe.ID.(string)
+	return id
 }
\ No newline at end of file
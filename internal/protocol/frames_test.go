@@ -76,6 +76,20 @@ func TestParseFrame(t *testing.T) {
 		assert.Contains(t, err.Error(), "field=type")
 	})
 
+	t.Run("should recover the request id from a malformed request", func(t *testing.T) {
+		for input, id := range map[string]string{
+			`{"id":"abc","method":"connect"}`:      "abc",
+			`{"type":"req","id":"abc"}`:            "abc",
+			`{"type":"req","id":"abc","method":1}`: "abc",
+			`{"type":"req","id":7,"method":1}`:     "",
+		} {
+			_, err := ParseFrame([]byte(input))
+			fe, ok := err.(*FrameError)
+			require.True(t, ok, input)
+			assert.Equal(t, id, fe.ID, input)
+		}
+	})
+
 	t.Run("should return error for json without id key", func(t *testing.T) {
 		input := []byte(`{"type":"req","method":"connect"}`)
 		frame, err := ParseFrame(input)
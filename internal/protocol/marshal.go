@@ -7,11 +7,20 @@ import (
 
 // MarshalRequest builds a JSON-encoded request frame.
 func MarshalRequest(id, method string, params any) ([]byte, error) {
+	frame, err := NewRequestFrame(id, method, params)
+	if err != nil {
+		return nil, err
+	}
+	return JSON.Encode(frame)
+}
+
+// NewRequestFrame builds a request frame for any Codec to encode.
+func NewRequestFrame(id, method string, params any) (*RequestFrame, error) {
 	if id == "" {
-		return nil, &FrameError{Code: "MISSING_FIELD", Field: "id", Message: "request frame missing required \"id\" field"}
+		return nil, &FrameError{Code: CodeMissingField, Field: "id", Message: "request frame missing required \"id\" field"}
 	}
 	if method == "" {
-		return nil, &FrameError{Code: "MISSING_FIELD", Field: "method", Message: "request frame missing required \"method\" field"}
+		return nil, &FrameError{Code: CodeMissingField, Field: "method", Message: "request frame missing required \"method\" field"}
 	}
 
 	frame := RequestFrame{
@@ -23,18 +32,27 @@ func MarshalRequest(id, method string, params any) ([]byte, error) {
 	if params != nil {
 		raw, err := json.Marshal(params)
 		if err != nil {
-			return nil, &FrameError{Code: "INVALID_JSON", Message: fmt.Sprintf("failed to marshal request params: %v", err)}
+			return nil, &FrameError{Code: CodeInvalidJSON, Message: fmt.Sprintf("failed to marshal request params: %v", err)}
 		}
 		frame.Params = raw
 	}
 
-	return json.Marshal(frame)
+	return &frame, nil
 }
 
 // MarshalResponse builds a JSON-encoded response frame.
 func MarshalResponse(id string, ok bool, payload any, errShape *ErrorShape) ([]byte, error) {
+	frame, err := NewResponseFrame(id, ok, payload, errShape)
+	if err != nil {
+		return nil, err
+	}
+	return JSON.Encode(frame)
+}
+
+// NewResponseFrame builds a response frame for any Codec to encode.
+func NewResponseFrame(id string, ok bool, payload any, errShape *ErrorShape) (*ResponseFrame, error) {
 	if id == "" {
-		return nil, &FrameError{Code: "MISSING_FIELD", Field: "id", Message: "response frame missing required \"id\" field"}
+		return nil, &FrameError{Code: CodeMissingField, Field: "id", Message: "response frame missing required \"id\" field"}
 	}
 
 	frame := ResponseFrame{
@@ -47,18 +65,27 @@ func MarshalResponse(id string, ok bool, payload any, errShape *ErrorShape) ([]b
 	if payload != nil {
 		raw, err := json.Marshal(payload)
 		if err != nil {
-			return nil, &FrameError{Code: "INVALID_JSON", Message: fmt.Sprintf("failed to marshal response payload: %v", err)}
+			return nil, &FrameError{Code: CodeInvalidJSON, Message: fmt.Sprintf("failed to marshal response payload: %v", err)}
 		}
 		frame.Payload = raw
 	}
 
-	return json.Marshal(frame)
+	return &frame, nil
 }
 
 // MarshalEvent builds a JSON-encoded event frame.
 func MarshalEvent(event string, payload any) ([]byte, error) {
+	frame, err := NewEventFrame(event, payload)
+	if err != nil {
+		return nil, err
+	}
+	return JSON.Encode(frame)
+}
+
+// NewEventFrame builds an event frame for any Codec to encode.
+func NewEventFrame(event string, payload any) (*EventFrame, error) {
 	if event == "" {
-		return nil, &FrameError{Code: "MISSING_FIELD", Field: "event", Message: "event frame missing required \"event\" field"}
+		return nil, &FrameError{Code: CodeMissingField, Field: "event", Message: "event frame missing required \"event\" field"}
 	}
 
 	frame := EventFrame{
@@ -69,10 +96,10 @@ func MarshalEvent(event string, payload any) ([]byte, error) {
 	if payload != nil {
 		raw, err := json.Marshal(payload)
 		if err != nil {
-			return nil, &FrameError{Code: "INVALID_JSON", Message: fmt.Sprintf("failed to marshal event payload: %v", err)}
+			return nil, &FrameError{Code: CodeInvalidJSON, Message: fmt.Sprintf("failed to marshal event payload: %v", err)}
 		}
 		frame.Payload = raw
 	}
 
-	return json.Marshal(frame)
+	return &frame, nil
 }
@@ -0,0 +1,871 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"unicode/utf8"
+)
+
+// This file implements the subset of MessagePack that carries the JSON
+// data model: nil, booleans, integers, floats, strings, arrays and maps
+// with string keys. Binary and extension types are rejected.
+//
+// Frames are encoded and decoded straight from their structs. Params and
+// Payload, held as JSON, are transcoded token by token in both directions
+// without an intermediate value.
+
+// maxMsgpackDepth bounds nesting so a hostile frame cannot exhaust the stack.
+const maxMsgpackDepth = 64
+
+var (
+	errMsgpackTruncated = errors.New("unexpected end of data")
+	errJSONTruncated    = errors.New("unexpected end of JSON")
+)
+
+// appendMsgpackFrame encodes a frame. Keys are the frame's JSON field
+// names in sorted order, and fields the JSON encoding omits when empty are
+// omitted here too.
+func appendMsgpackFrame(b []byte, frame any) ([]byte, error) {
+	var err error
+	switch f := frame.(type) {
+	case *RequestFrame:
+		b = appendMsgpackMapHeader(b, 3+boolInt(len(f.Params) > 0))
+		b = appendMsgpackString(appendMsgpackString(b, "id"), f.ID)
+		b = appendMsgpackString(appendMsgpackString(b, "method"), f.Method)
+		if len(f.Params) > 0 {
+			if b, err = appendMsgpackJSON(appendMsgpackString(b, "params"), f.Params); err != nil {
+				return nil, fmt.Errorf("msgpack: params: %w", err)
+			}
+		}
+		b = appendMsgpackString(appendMsgpackString(b, "type"), string(f.Type))
+	case *ResponseFrame:
+		b = appendMsgpackMapHeader(b, 3+boolInt(f.Error != nil)+boolInt(len(f.Payload) > 0))
+		if f.Error != nil {
+			b = appendMsgpackErrorShape(appendMsgpackString(b, "error"), f.Error)
+		}
+		b = appendMsgpackString(appendMsgpackString(b, "id"), f.ID)
+		b = appendMsgpackBool(appendMsgpackString(b, "ok"), f.OK)
+		if len(f.Payload) > 0 {
+			if b, err = appendMsgpackJSON(appendMsgpackString(b, "payload"), f.Payload); err != nil {
+				return nil, fmt.Errorf("msgpack: payload: %w", err)
+			}
+		}
+		b = appendMsgpackString(appendMsgpackString(b, "type"), string(f.Type))
+	case *EventFrame:
+		b = appendMsgpackMapHeader(b, 2+boolInt(len(f.Payload) > 0)+boolInt(f.Seq != nil))
+		b = appendMsgpackString(appendMsgpackString(b, "event"), f.Event)
+		if len(f.Payload) > 0 {
+			if b, err = appendMsgpackJSON(appendMsgpackString(b, "payload"), f.Payload); err != nil {
+				return nil, fmt.Errorf("msgpack: payload: %w", err)
+			}
+		}
+		if f.Seq != nil {
+			b = appendMsgpackInt(appendMsgpackString(b, "seq"), int64(*f.Seq))
+		}
+		b = appendMsgpackString(appendMsgpackString(b, "type"), string(f.Type))
+	default:
+		return nil, fmt.Errorf("msgpack: unsupported frame type %T", frame)
+	}
+	return b, nil
+}
+
+func appendMsgpackErrorShape(b []byte, e *ErrorShape) []byte {
+	b = appendMsgpackMapHeader(b, 2+boolInt(e.Retryable != nil))
+	b = appendMsgpackString(appendMsgpackString(b, "code"), e.Code)
+	b = appendMsgpackString(appendMsgpackString(b, "message"), e.Message)
+	if e.Retryable != nil {
+		b = appendMsgpackBool(appendMsgpackString(b, "retryable"), *e.Retryable)
+	}
+	return b
+}
+
+func boolInt(v bool) int {
+	if v {
+		return 1
+	}
+	return 0
+}
+
+// appendMsgpackJSON appends the encoding of the JSON value raw. Object
+// keys keep their JSON order.
+func appendMsgpackJSON(b []byte, raw json.RawMessage) ([]byte, error) {
+	t := jsonTranscoder{data: raw}
+	b, err := t.value(b, 0)
+	if err != nil {
+		return nil, err
+	}
+	if t.skipSpace(); t.pos != len(t.data) {
+		return nil, fmt.Errorf("invalid JSON: trailing data at offset %d", t.pos)
+	}
+	return b, nil
+}
+
+// jsonTranscoder reads JSON and writes the equivalent MessagePack.
+type jsonTranscoder struct {
+	data []byte
+	pos  int
+}
+
+func (t *jsonTranscoder) skipSpace() {
+	for t.pos < len(t.data) {
+		switch t.data[t.pos] {
+		case ' ', '\t', '\n', '\r':
+			t.pos++
+		default:
+			return
+		}
+	}
+}
+
+// peek returns the next non-space byte without consuming it, or 0 at the
+// end of the data.
+func (t *jsonTranscoder) peek() byte {
+	t.skipSpace()
+	if t.pos == len(t.data) {
+		return 0
+	}
+	return t.data[t.pos]
+}
+
+func (t *jsonTranscoder) value(b []byte, depth int) ([]byte, error) {
+	if depth > maxMsgpackDepth {
+		return nil, fmt.Errorf("nesting deeper than %d", maxMsgpackDepth)
+	}
+	switch c := t.peek(); c {
+	case 0:
+		return nil, errJSONTruncated
+	case '{':
+		return t.object(b, depth)
+	case '[':
+		return t.array(b, depth)
+	case '"':
+		s, err := t.string()
+		if err != nil {
+			return nil, err
+		}
+		return append(appendMsgpackStringHeader(b, len(s)), s...), nil
+	case 't':
+		return t.literal(b, "true", 0xc3)
+	case 'f':
+		return t.literal(b, "false", 0xc2)
+	case 'n':
+		return t.literal(b, "null", 0xc0)
+	default:
+		return t.number(b)
+	}
+}
+
+func (t *jsonTranscoder) object(b []byte, depth int) ([]byte, error) {
+	t.pos++ // '{'
+	start, n := len(b), 0
+	if t.peek() == '}' {
+		t.pos++
+		return appendMsgpackMapHeader(b, 0), nil
+	}
+	for {
+		if t.peek() != '"' {
+			return nil, fmt.Errorf("invalid JSON: want object key at offset %d", t.pos)
+		}
+		k, err := t.string()
+		if err != nil {
+			return nil, err
+		}
+		b = append(appendMsgpackStringHeader(b, len(k)), k...)
+		if t.peek() != ':' {
+			return nil, fmt.Errorf("invalid JSON: want ':' at offset %d", t.pos)
+		}
+		t.pos++
+		if b, err = t.value(b, depth+1); err != nil {
+			return nil, err
+		}
+		n++
+		switch t.peek() {
+		case ',':
+			t.pos++
+		case '}':
+			t.pos++
+			var hdr [5]byte
+			return insertHeader(b, start, appendMsgpackMapHeader(hdr[:0], n)), nil
+		default:
+			return nil, fmt.Errorf("invalid JSON: want ',' or '}' at offset %d", t.pos)
+		}
+	}
+}
+
+func (t *jsonTranscoder) array(b []byte, depth int) ([]byte, error) {
+	t.pos++ // '['
+	start, n := len(b), 0
+	if t.peek() == ']' {
+		t.pos++
+		return appendMsgpackArrayHeader(b, 0), nil
+	}
+	for {
+		var err error
+		if b, err = t.value(b, depth+1); err != nil {
+			return nil, err
+		}
+		n++
+		switch t.peek() {
+		case ',':
+			t.pos++
+		case ']':
+			t.pos++
+			var hdr [5]byte
+			return insertHeader(b, start, appendMsgpackArrayHeader(hdr[:0], n)), nil
+		default:
+			return nil, fmt.Errorf("invalid JSON: want ',' or ']' at offset %d", t.pos)
+		}
+	}
+}
+
+// insertHeader inserts hdr at b[start:], ahead of the elements it counts.
+func insertHeader(b []byte, start int, hdr []byte) []byte {
+	b = append(b, hdr...)
+	copy(b[start+len(hdr):], b[start:len(b)-len(hdr)])
+	copy(b[start:], hdr)
+	return b
+}
+
+// string reads a JSON string, unescaping it only when it has escapes.
+// Unless it does, the result aliases the input.
+func (t *jsonTranscoder) string() ([]byte, error) {
+	start := t.pos
+	t.pos++ // opening quote
+	escaped := false
+	for t.pos < len(t.data) {
+		switch t.data[t.pos] {
+		case '\\':
+			escaped = true
+			t.pos += 2
+			continue
+		case '"':
+			t.pos++
+			if !escaped {
+				return t.data[start+1 : t.pos-1], nil
+			}
+			var s string
+			if err := json.Unmarshal(t.data[start:t.pos], &s); err != nil {
+				return nil, err
+			}
+			return []byte(s), nil
+		}
+		t.pos++
+	}
+	return nil, errJSONTruncated
+}
+
+func (t *jsonTranscoder) literal(b []byte, lit string, tag byte) ([]byte, error) {
+	if len(t.data)-t.pos < len(lit) || string(t.data[t.pos:t.pos+len(lit)]) != lit {
+		return nil, fmt.Errorf("invalid JSON: bad literal at offset %d", t.pos)
+	}
+	t.pos += len(lit)
+	return append(b, tag), nil
+}
+
+// number encodes integers that fit as integers and anything else as a
+// float64.
+func (t *jsonTranscoder) number(b []byte) ([]byte, error) {
+	start := t.pos
+	for t.pos < len(t.data) {
+		c := t.data[t.pos]
+		if (c < '0' || c > '9') && c != '-' && c != '+' && c != '.' && c != 'e' && c != 'E' {
+			break
+		}
+		t.pos++
+	}
+	num := string(t.data[start:t.pos])
+	if num == "" {
+		return nil, fmt.Errorf("invalid JSON: unexpected %q at offset %d", t.data[start], start)
+	}
+	if i, err := strconv.ParseInt(num, 10, 64); err == nil {
+		return appendMsgpackInt(b, i), nil
+	}
+	if u, err := strconv.ParseUint(num, 10, 64); err == nil {
+		return appendMsgpackUint(b, u), nil
+	}
+	f, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return nil, fmt.Errorf("number %s: %w", num, err)
+	}
+	b = append(b, 0xcb)
+	return binary.BigEndian.AppendUint64(b, math.Float64bits(f)), nil
+}
+
+func appendMsgpackInt(b []byte, i int64) []byte {
+	switch {
+	case i >= 0:
+		return appendMsgpackUint(b, uint64(i))
+	case i >= -32:
+		return append(b, byte(i)) // negative fixint
+	case i >= math.MinInt8:
+		return append(b, 0xd0, byte(i))
+	case i >= math.MinInt16:
+		return binary.BigEndian.AppendUint16(append(b, 0xd1), uint16(i))
+	case i >= math.MinInt32:
+		return binary.BigEndian.AppendUint32(append(b, 0xd2), uint32(i))
+	default:
+		return binary.BigEndian.AppendUint64(append(b, 0xd3), uint64(i))
+	}
+}
+
+func appendMsgpackUint(b []byte, u uint64) []byte {
+	switch {
+	case u < 0x80:
+		return append(b, byte(u)) // positive fixint
+	case u <= math.MaxUint8:
+		return append(b, 0xcc, byte(u))
+	case u <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 0xcd), uint16(u))
+	case u <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(b, 0xce), uint32(u))
+	default:
+		return binary.BigEndian.AppendUint64(append(b, 0xcf), u)
+	}
+}
+
+func appendMsgpackBool(b []byte, v bool) []byte {
+	if v {
+		return append(b, 0xc3)
+	}
+	return append(b, 0xc2)
+}
+
+func appendMsgpackString(b []byte, s string) []byte {
+	return append(appendMsgpackStringHeader(b, len(s)), s...)
+}
+
+// appendMsgpackStringHeader writes the header of an n-byte string.
+func appendMsgpackStringHeader(b []byte, n int) []byte {
+	switch {
+	case n < 32:
+		return append(b, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		return append(b, 0xd9, byte(n))
+	default:
+		return appendMsgpackHeader(b, n, 0, 0, 0xda, 0xdb)
+	}
+}
+
+func appendMsgpackMapHeader(b []byte, n int) []byte {
+	return appendMsgpackHeader(b, n, 0x80, 16, 0xde, 0xdf)
+}
+
+func appendMsgpackArrayHeader(b []byte, n int) []byte {
+	return appendMsgpackHeader(b, n, 0x90, 16, 0xdc, 0xdd)
+}
+
+// appendMsgpackHeader writes a length header: the fix form (fix|n) when
+// n < fixMax, else the 16- or 32-bit form.
+func appendMsgpackHeader(b []byte, n int, fix byte, fixMax int, tag16, tag32 byte) []byte {
+	switch {
+	case n < fixMax:
+		return append(b, fix|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, tag16), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(b, tag32), uint32(n))
+	}
+}
+
+// unmarshalMsgpackFrame decodes a frame map into its struct and validates
+// it as ParseFrame does. Unknown keys are skipped. Errors other than a
+// *FrameError mean the data is not valid MessagePack for a frame.
+func unmarshalMsgpackFrame(data []byte) (any, error) {
+	d := msgpackDecoder{data: data}
+	n, err := d.mapHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		typ, id, method, event string
+		ok                     bool
+		params, payload        json.RawMessage
+		errShape               *ErrorShape
+		seq                    *int
+	)
+	for range n {
+		k, err := d.key()
+		if err != nil {
+			return nil, err
+		}
+		switch k {
+		case "params":
+			params, err = d.appendJSON(nil, 1)
+		case "payload":
+			payload, err = d.appendJSON(nil, 1)
+		default:
+			var v any
+			if v, err = d.value(1); err != nil {
+				return nil, err
+			}
+			switch k {
+			case "type":
+				typ, err = msgpackField[string](k, v)
+			case "id":
+				id, err = msgpackField[string](k, v)
+			case "method":
+				method, err = msgpackField[string](k, v)
+			case "event":
+				event, err = msgpackField[string](k, v)
+			case "ok":
+				ok, err = msgpackField[bool](k, v)
+			case "error":
+				errShape, err = msgpackErrorShape(v)
+			case "seq":
+				seq, err = msgpackSeq(v)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if d.pos != len(d.data) {
+		return nil, fmt.Errorf("%d trailing bytes", len(d.data)-d.pos)
+	}
+
+	switch FrameType(typ) {
+	case "":
+		return nil, &FrameError{Code: CodeMissingField, Field: "type", Message: "frame missing required \"type\" field", ID: id}
+	case FrameTypeReq:
+		req := &RequestFrame{Type: FrameTypeReq, ID: id, Method: method, Params: params}
+		if err := req.check(); err != nil {
+			return nil, err
+		}
+		return req, nil
+	case FrameTypeRes:
+		res := &ResponseFrame{Type: FrameTypeRes, ID: id, OK: ok, Payload: payload, Error: errShape}
+		if err := res.check(); err != nil {
+			return nil, err
+		}
+		return res, nil
+	case FrameTypeEvent:
+		evt := &EventFrame{Type: FrameTypeEvent, Event: event, Payload: payload, Seq: seq}
+		if err := evt.check(); err != nil {
+			return nil, err
+		}
+		return evt, nil
+	}
+	return nil, &FrameError{Code: CodeUnknownType, Message: fmt.Sprintf("unknown frame type: %q", typ), ID: id}
+}
+
+// msgpackField asserts that the decoded value of key has type T.
+func msgpackField[T any](key string, v any) (T, error) {
+	t, ok := v.(T)
+	if !ok {
+		return t, fmt.Errorf("field %q is %T, want %T", key, v, t)
+	}
+	return t, nil
+}
+
+func msgpackErrorShape(v any) (*ErrorShape, error) {
+	if v == nil {
+		return nil, nil
+	}
+	m, err := msgpackField[map[string]any]("error", v)
+	if err != nil {
+		return nil, err
+	}
+	var e ErrorShape
+	if c, ok := m["code"]; ok {
+		if e.Code, err = msgpackField[string]("error.code", c); err != nil {
+			return nil, err
+		}
+	}
+	if msg, ok := m["message"]; ok {
+		if e.Message, err = msgpackField[string]("error.message", msg); err != nil {
+			return nil, err
+		}
+	}
+	if r, ok := m["retryable"]; ok && r != nil {
+		retryable, err := msgpackField[bool]("error.retryable", r)
+		if err != nil {
+			return nil, err
+		}
+		e.Retryable = &retryable
+	}
+	return &e, nil
+}
+
+func msgpackSeq(v any) (*int, error) {
+	if v == nil {
+		return nil, nil
+	}
+	i, err := msgpackField[int64]("seq", v)
+	if err != nil {
+		return nil, err
+	}
+	seq := int(i)
+	return &seq, nil
+}
+
+type msgpackDecoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *msgpackDecoder) next(n int) ([]byte, error) {
+	if n < 0 || n > len(d.data)-d.pos {
+		return nil, errMsgpackTruncated
+	}
+	p := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return p, nil
+}
+
+// uint reads an n-byte big-endian unsigned integer.
+func (d *msgpackDecoder) uint(n int) (uint64, error) {
+	p, err := d.next(n)
+	if err != nil {
+		return 0, err
+	}
+	var u uint64
+	for _, c := range p {
+		u = u<<8 | uint64(c)
+	}
+	return u, nil
+}
+
+// mapHeader reads a map header and returns its length.
+func (d *msgpackDecoder) mapHeader() (int, error) {
+	p, err := d.next(1)
+	if err != nil {
+		return 0, err
+	}
+	switch tag := p[0]; {
+	case tag&0xf0 == 0x80:
+		return int(tag & 0x0f), nil
+	case tag == 0xde || tag == 0xdf:
+		n, err := d.uint(2 << (tag - 0xde))
+		return int(n), err
+	default:
+		return 0, fmt.Errorf("frame is type 0x%02x, want a map", tag)
+	}
+}
+
+// key reads a map key, which must be a string.
+func (d *msgpackDecoder) key() (string, error) {
+	k, err := d.keyBytes()
+	return string(k), err
+}
+
+// keyBytes is key without the copy: the result aliases the data.
+func (d *msgpackDecoder) keyBytes() ([]byte, error) {
+	p, err := d.next(1)
+	if err != nil {
+		return nil, err
+	}
+	switch tag := p[0]; {
+	case tag&0xe0 == 0xa0:
+		return d.next(int(tag & 0x1f))
+	case tag >= 0xd9 && tag <= 0xdb:
+		n, err := d.uint(1 << (tag - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return d.next(int(n))
+	default:
+		return nil, fmt.Errorf("map key is type 0x%02x, want string", tag)
+	}
+}
+
+// value decodes a single value into the types encoding/json produces
+// (float64 aside, integers stay int64 or uint64).
+func (d *msgpackDecoder) value(depth int) (any, error) {
+	if depth > maxMsgpackDepth {
+		return nil, fmt.Errorf("nesting deeper than %d", maxMsgpackDepth)
+	}
+	p, err := d.next(1)
+	if err != nil {
+		return nil, err
+	}
+	tag := p[0]
+
+	switch {
+	case tag <= 0x7f:
+		return int64(tag), nil
+	case tag >= 0xe0:
+		return int64(int8(tag)), nil
+	case tag&0xf0 == 0x80:
+		return d.mapOf(int(tag&0x0f), depth)
+	case tag&0xf0 == 0x90:
+		return d.arrayOf(int(tag&0x0f), depth)
+	case tag&0xe0 == 0xa0:
+		return d.string(int(tag & 0x1f))
+	}
+
+	switch tag {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xca:
+		u, err := d.uint(4)
+		return float64(math.Float32frombits(uint32(u))), err
+	case 0xcb:
+		u, err := d.uint(8)
+		return math.Float64frombits(u), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		u, err := d.uint(1 << (tag - 0xcc))
+		if err != nil || u > math.MaxInt64 {
+			return u, err
+		}
+		return int64(u), nil
+	case 0xd0:
+		u, err := d.uint(1)
+		return int64(int8(u)), err
+	case 0xd1:
+		u, err := d.uint(2)
+		return int64(int16(u)), err
+	case 0xd2:
+		u, err := d.uint(4)
+		return int64(int32(u)), err
+	case 0xd3:
+		u, err := d.uint(8)
+		return int64(u), err
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.uint(1 << (tag - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return d.string(int(n))
+	case 0xdc, 0xdd:
+		n, err := d.uint(2 << (tag - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.arrayOf(int(n), depth)
+	case 0xde, 0xdf:
+		n, err := d.uint(2 << (tag - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.mapOf(int(n), depth)
+	}
+	return nil, fmt.Errorf("unsupported type 0x%02x at offset %d", tag, d.pos-1)
+}
+
+func (d *msgpackDecoder) string(n int) (string, error) {
+	p, err := d.next(n)
+	return string(p), err
+}
+
+func (d *msgpackDecoder) arrayOf(n int, depth int) ([]any, error) {
+	// Every element takes at least one byte; checking first stops a
+	// forged length from allocating more than the frame could hold.
+	if n > len(d.data)-d.pos {
+		return nil, errMsgpackTruncated
+	}
+	arr := make([]any, n)
+	for i := range arr {
+		v, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		arr[i] = v
+	}
+	return arr, nil
+}
+
+func (d *msgpackDecoder) mapOf(n int, depth int) (map[string]any, error) {
+	if n > (len(d.data)-d.pos)/2 {
+		return nil, errMsgpackTruncated
+	}
+	m := make(map[string]any, n)
+	for range n {
+		key, err := d.key()
+		if err != nil {
+			return nil, err
+		}
+		v, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		m[key] = v
+	}
+	return m, nil
+}
+
+// appendJSON transcodes a single value to JSON, appending it to b. Map
+// keys keep their wire order.
+func (d *msgpackDecoder) appendJSON(b []byte, depth int) ([]byte, error) {
+	if depth > maxMsgpackDepth {
+		return nil, fmt.Errorf("nesting deeper than %d", maxMsgpackDepth)
+	}
+	p, err := d.next(1)
+	if err != nil {
+		return nil, err
+	}
+	tag := p[0]
+
+	switch {
+	case tag <= 0x7f:
+		return strconv.AppendInt(b, int64(tag), 10), nil
+	case tag >= 0xe0:
+		return strconv.AppendInt(b, int64(int8(tag)), 10), nil
+	case tag&0xf0 == 0x80:
+		return d.appendJSONMap(b, int(tag&0x0f), depth)
+	case tag&0xf0 == 0x90:
+		return d.appendJSONArray(b, int(tag&0x0f), depth)
+	case tag&0xe0 == 0xa0:
+		s, err := d.next(int(tag & 0x1f))
+		return appendJSONString(b, s), err
+	}
+
+	switch tag {
+	case 0xc0:
+		return append(b, "null"...), nil
+	case 0xc2:
+		return append(b, "false"...), nil
+	case 0xc3:
+		return append(b, "true"...), nil
+	case 0xca:
+		u, err := d.uint(4)
+		if err != nil {
+			return nil, err
+		}
+		return appendJSONFloat(b, float64(math.Float32frombits(uint32(u))))
+	case 0xcb:
+		u, err := d.uint(8)
+		if err != nil {
+			return nil, err
+		}
+		return appendJSONFloat(b, math.Float64frombits(u))
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		u, err := d.uint(1 << (tag - 0xcc))
+		return strconv.AppendUint(b, u, 10), err
+	case 0xd0:
+		u, err := d.uint(1)
+		return strconv.AppendInt(b, int64(int8(u)), 10), err
+	case 0xd1:
+		u, err := d.uint(2)
+		return strconv.AppendInt(b, int64(int16(u)), 10), err
+	case 0xd2:
+		u, err := d.uint(4)
+		return strconv.AppendInt(b, int64(int32(u)), 10), err
+	case 0xd3:
+		u, err := d.uint(8)
+		return strconv.AppendInt(b, int64(u), 10), err
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.uint(1 << (tag - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		s, err := d.next(int(n))
+		return appendJSONString(b, s), err
+	case 0xdc, 0xdd:
+		n, err := d.uint(2 << (tag - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.appendJSONArray(b, int(n), depth)
+	case 0xde, 0xdf:
+		n, err := d.uint(2 << (tag - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.appendJSONMap(b, int(n), depth)
+	}
+	return nil, fmt.Errorf("unsupported type 0x%02x at offset %d", tag, d.pos-1)
+}
+
+func (d *msgpackDecoder) appendJSONArray(b []byte, n int, depth int) ([]byte, error) {
+	if n > len(d.data)-d.pos {
+		return nil, errMsgpackTruncated
+	}
+	b = append(b, '[')
+	for i := range n {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		var err error
+		if b, err = d.appendJSON(b, depth+1); err != nil {
+			return nil, err
+		}
+	}
+	return append(b, ']'), nil
+}
+
+func (d *msgpackDecoder) appendJSONMap(b []byte, n int, depth int) ([]byte, error) {
+	if n > (len(d.data)-d.pos)/2 {
+		return nil, errMsgpackTruncated
+	}
+	b = append(b, '{')
+	for i := range n {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		key, err := d.keyBytes()
+		if err != nil {
+			return nil, err
+		}
+		b = append(appendJSONString(b, key), ':')
+		if b, err = d.appendJSON(b, depth+1); err != nil {
+			return nil, err
+		}
+	}
+	return append(b, '}'), nil
+}
+
+// appendJSONFloat formats f as encoding/json does. NaN and infinities
+// have no JSON form.
+func appendJSONFloat(b []byte, f float64) ([]byte, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil, fmt.Errorf("%v is not representable as JSON", f)
+	}
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		format = 'e'
+	}
+	b = strconv.AppendFloat(b, f, format, -1, 64)
+	if format == 'e' {
+		// Clean up e-09 to e-9, as encoding/json does.
+		if n := len(b); n >= 4 && b[n-4] == 'e' && b[n-3] == '-' && b[n-2] == '0' {
+			b[n-2] = b[n-1]
+			b = b[:n-1]
+		}
+	}
+	return b, nil
+}
+
+// appendJSONString appends s as a quoted JSON string, replacing invalid
+// UTF-8 with U+FFFD as encoding/json does.
+func appendJSONString(b []byte, s []byte) []byte {
+	const hex = "0123456789abcdef"
+	b = append(b, '"')
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			switch {
+			case c == '"' || c == '\\':
+				b = append(b, '\\', c)
+			case c == '\n':
+				b = append(b, '\\', 'n')
+			case c == '\r':
+				b = append(b, '\\', 'r')
+			case c == '\t':
+				b = append(b, '\\', 't')
+			case c < 0x20:
+				b = append(b, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xf])
+			default:
+				b = append(b, c)
+			}
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRune(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			b = append(b, `�`...)
+		} else {
+			b = append(b, s[i:i+size]...)
+		}
+		i += size
+	}
+	return append(b, '"')
+}
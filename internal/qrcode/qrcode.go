@@ -0,0 +1,462 @@
+// Package qrcode is a small QR Code encoder (byte mode, error correction
+// level L, versions 1–10) for rendering enrollment payloads in a terminal.
+package qrcode
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MaxBytes is the largest payload Encode accepts (version 10-L).
+const MaxBytes = 271
+
+// Code is an encoded QR symbol. Modules[y][x] is true for dark modules.
+type Code struct {
+	Version int
+	Size    int
+	Modules [][]bool
+}
+
+// versionInfo holds the level-L block structure for one version.
+type versionInfo struct {
+	ecPerBlock int
+	blocks     []int // data codewords per block
+	align      []int // alignment pattern centers
+}
+
+var versions = [...]versionInfo{
+	1:  {7, []int{19}, nil},
+	2:  {10, []int{34}, []int{6, 18}},
+	3:  {15, []int{55}, []int{6, 22}},
+	4:  {20, []int{80}, []int{6, 26}},
+	5:  {26, []int{108}, []int{6, 30}},
+	6:  {18, []int{68, 68}, []int{6, 34}},
+	7:  {20, []int{78, 78}, []int{6, 22, 38}},
+	8:  {24, []int{97, 97}, []int{6, 24, 42}},
+	9:  {30, []int{116, 116}, []int{6, 26, 46}},
+	10: {18, []int{68, 68, 69, 69}, []int{6, 28, 50}},
+}
+
+func (v versionInfo) dataCodewords() int {
+	n := 0
+	for _, b := range v.blocks {
+		n += b
+	}
+	return n
+}
+
+// Encode returns the smallest QR symbol holding data.
+func Encode(data []byte) (*Code, error) {
+	for ver := 1; ver < len(versions); ver++ {
+		countBits := 8
+		if ver >= 10 {
+			countBits = 16
+		}
+		if 4+countBits+8*len(data) <= 8*versions[ver].dataCodewords() {
+			return encode(ver, countBits, data), nil
+		}
+	}
+	return nil, fmt.Errorf("qrcode: payload of %d bytes exceeds %d", len(data), MaxBytes)
+}
+
+func encode(ver, countBits int, data []byte) *Code {
+	info := versions[ver]
+
+	// Bit stream: byte mode indicator, length, payload, terminator, padding.
+	var bb bitBuffer
+	bb.append(0x4, 4)
+	bb.append(uint32(len(data)), countBits)
+	for _, b := range data {
+		bb.append(uint32(b), 8)
+	}
+	capBits := 8 * info.dataCodewords()
+	bb.append(0, min(4, capBits-len(bb)))
+	bb.append(0, (8-len(bb)%8)%8)
+	for pad := uint32(0xEC); len(bb) < capBits; pad ^= 0xEC ^ 0x11 {
+		bb.append(pad, 8)
+	}
+
+	codewords := interleave(info, bb.bytes())
+
+	c := newCode(ver)
+	c.drawCodewords(codewords)
+	c.applyBestMask()
+	return &c.Code
+}
+
+// interleave splits data into blocks, appends Reed-Solomon error
+// correction to each and interleaves the result.
+func interleave(info versionInfo, data []byte) []byte {
+	var blocks, ecBlocks [][]byte
+	maxLen := 0
+	for _, n := range info.blocks {
+		block := data[:n]
+		data = data[n:]
+		blocks = append(blocks, block)
+		ecBlocks = append(ecBlocks, reedSolomon(block, info.ecPerBlock))
+		maxLen = max(maxLen, n)
+	}
+
+	var out []byte
+	for i := 0; i < maxLen; i++ {
+		for _, b := range blocks {
+			if i < len(b) {
+				out = append(out, b[i])
+			}
+		}
+	}
+	for i := 0; i < info.ecPerBlock; i++ {
+		for _, b := range ecBlocks {
+			out = append(out, b[i])
+		}
+	}
+	return out
+}
+
+// String renders the code with Unicode half blocks, two module rows per
+// line, drawing light modules so it scans on dark terminal backgrounds.
+func (c *Code) String() string {
+	const quiet = 2
+	light := func(x, y int) bool {
+		if x < 0 || y < 0 || x >= c.Size || y >= c.Size {
+			return true
+		}
+		return !c.Modules[y][x]
+	}
+
+	var sb strings.Builder
+	for y := -quiet; y < c.Size+quiet; y += 2 {
+		for x := -quiet; x < c.Size+quiet; x++ {
+			top, bottom := light(x, y), light(x, y+1)
+			switch {
+			case top && bottom:
+				sb.WriteString("█")
+			case top:
+				sb.WriteString("▀")
+			case bottom:
+				sb.WriteString("▄")
+			default:
+				sb.WriteString(" ")
+			}
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// --- symbol construction ---
+
+type builder struct {
+	Code
+	function [][]bool
+}
+
+func newCode(ver int) *builder {
+	size := 17 + 4*ver
+	c := &builder{Code: Code{Version: ver, Size: size}}
+	c.Modules = make([][]bool, size)
+	c.function = make([][]bool, size)
+	for i := range c.Modules {
+		c.Modules[i] = make([]bool, size)
+		c.function[i] = make([]bool, size)
+	}
+
+	// Timing patterns
+	for i := 0; i < size; i++ {
+		c.set(6, i, i%2 == 0)
+		c.set(i, 6, i%2 == 0)
+	}
+
+	// Finder patterns with separators
+	c.drawFinder(3, 3)
+	c.drawFinder(size-4, 3)
+	c.drawFinder(3, size-4)
+
+	// Alignment patterns, skipping the three finder corners
+	align := versions[ver].align
+	last := len(align) - 1
+	for i, ax := range align {
+		for j, ay := range align {
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					c.set(ax+dx, ay+dy, max(abs(dx), abs(dy)) != 1)
+				}
+			}
+		}
+	}
+
+	// Reserve format areas (real bits drawn with the mask) and version info.
+	c.drawFormat(0)
+	if ver >= 7 {
+		rem := ver
+		for i := 0; i < 12; i++ {
+			rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+		}
+		bits := ver<<12 | rem
+		for i := 0; i < 18; i++ {
+			dark := (bits>>i)&1 != 0
+			a, b := size-11+i%3, i/3
+			c.set(a, b, dark)
+			c.set(b, a, dark)
+		}
+	}
+	return c
+}
+
+// set draws a function module at column x, row y.
+func (c *builder) set(x, y int, dark bool) {
+	c.Modules[y][x] = dark
+	c.function[y][x] = true
+}
+
+func (c *builder) drawFinder(cx, cy int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			x, y := cx+dx, cy+dy
+			if x < 0 || y < 0 || x >= c.Size || y >= c.Size {
+				continue
+			}
+			d := max(abs(dx), abs(dy))
+			c.set(x, y, d != 2 && d != 4)
+		}
+	}
+}
+
+// drawFormat writes both copies of the format information for level L.
+func (c *builder) drawFormat(mask int) {
+	data := 1<<3 | mask // level L = 01
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return (bits>>i)&1 != 0 }
+
+	for i := 0; i <= 5; i++ {
+		c.set(8, i, bit(i))
+	}
+	c.set(8, 7, bit(6))
+	c.set(8, 8, bit(7))
+	c.set(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		c.set(14-i, 8, bit(i))
+	}
+
+	for i := 0; i < 8; i++ {
+		c.set(c.Size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		c.set(8, c.Size-15+i, bit(i))
+	}
+	c.set(8, c.Size-8, true) // dark module
+}
+
+// drawCodewords places data bits in the two-column zigzag.
+func (c *builder) drawCodewords(data []byte) {
+	i := 0
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < c.Size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = c.Size - 1 - vert
+				}
+				if !c.function[y][x] && i < len(data)*8 {
+					c.Modules[y][x] = (data[i>>3]>>(7-i&7))&1 != 0
+					i++
+				}
+			}
+		}
+	}
+}
+
+func maskBit(mask, x, y int) bool {
+	switch mask {
+	case 0:
+		return (x+y)%2 == 0
+	case 1:
+		return y%2 == 0
+	case 2:
+		return x%3 == 0
+	case 3:
+		return (x+y)%3 == 0
+	case 4:
+		return (x/3+y/2)%2 == 0
+	case 5:
+		return x*y%2+x*y%3 == 0
+	case 6:
+		return (x*y%2+x*y%3)%2 == 0
+	default:
+		return ((x+y)%2+x*y%3)%2 == 0
+	}
+}
+
+func (c *builder) applyMask(mask int) {
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if !c.function[y][x] && maskBit(mask, x, y) {
+				c.Modules[y][x] = !c.Modules[y][x]
+			}
+		}
+	}
+}
+
+func (c *builder) applyBestMask() {
+	best, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		c.applyMask(mask)
+		c.drawFormat(mask)
+		if p := c.penalty(); bestPenalty < 0 || p < bestPenalty {
+			best, bestPenalty = mask, p
+		}
+		c.applyMask(mask) // XOR undoes it
+	}
+	c.applyMask(best)
+	c.drawFormat(best)
+}
+
+// penalty scores the symbol with the four standard mask evaluation rules.
+func (c *builder) penalty() int {
+	n := c.Size
+	p := 0
+	at := func(x, y int, vertical bool) bool {
+		if vertical {
+			return c.Modules[x][y]
+		}
+		return c.Modules[y][x]
+	}
+
+	for _, vertical := range []bool{false, true} {
+		for y := 0; y < n; y++ {
+			run := 1
+			for x := 1; x <= n; x++ {
+				if x < n && at(x, y, vertical) == at(x-1, y, vertical) {
+					run++
+					continue
+				}
+				if run >= 5 {
+					p += run - 2
+				}
+				run = 1
+			}
+			// Finder-like 1:1:3:1:1 with four light modules on one side.
+			for x := 0; x+10 < n; x++ {
+				var pattern [11]bool
+				for k := range pattern {
+					pattern[k] = at(x+k, y, vertical)
+				}
+				if pattern == [11]bool{true, false, true, true, true, false, true, false, false, false, false} ||
+					pattern == [11]bool{false, false, false, false, true, false, true, true, true, false, true} {
+					p += 40
+				}
+			}
+		}
+	}
+
+	dark := 0
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			if c.Modules[y][x] {
+				dark++
+			}
+			if x+1 < n && y+1 < n {
+				v := c.Modules[y][x]
+				if c.Modules[y][x+1] == v && c.Modules[y+1][x] == v && c.Modules[y+1][x+1] == v {
+					p += 3
+				}
+			}
+		}
+	}
+	p += abs(dark*20-n*n*10) / (n * n) * 10
+	return p
+}
+
+// --- Reed-Solomon over GF(256), polynomial 0x11D ---
+
+var gfExp, gfLog [256]int
+
+func init() {
+	x := 1
+	for i := 0; i < 255; i++ {
+		gfExp[i] = x
+		gfLog[x] = i
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11D
+		}
+	}
+}
+
+func gfMul(a, b int) int {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[(gfLog[a]+gfLog[b])%255]
+}
+
+// reedSolomon returns n error correction codewords for data.
+func reedSolomon(data []byte, n int) []byte {
+	// Generator polynomial coefficients, highest degree first (implicit 1).
+	gen := make([]int, n)
+	gen[n-1] = 1
+	root := 1
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			gen[j] = gfMul(gen[j], root)
+			if j+1 < n {
+				gen[j] ^= gen[j+1]
+			}
+		}
+		root = gfMul(root, 2)
+	}
+
+	rem := make([]int, n)
+	for _, b := range data {
+		factor := int(b) ^ rem[0]
+		copy(rem, rem[1:])
+		rem[n-1] = 0
+		for i := range rem {
+			rem[i] ^= gfMul(gen[i], factor)
+		}
+	}
+
+	out := make([]byte, n)
+	for i, v := range rem {
+		out[i] = byte(v)
+	}
+	return out
+}
+
+// --- helpers ---
+
+type bitBuffer []bool
+
+func (b *bitBuffer) append(val uint32, n int) {
+	for i := n - 1; i >= 0; i-- {
+		*b = append(*b, (val>>i)&1 != 0)
+	}
+}
+
+func (b bitBuffer) bytes() []byte {
+	out := make([]byte, len(b)/8)
+	for i, bit := range b {
+		if bit {
+			out[i>>3] |= 1 << (7 - i&7)
+		}
+	}
+	return out
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,379 @@
+package qrcode
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestReedSolomon(t *testing.T) {
+	// "HELLO WORLD" as version 1-M from the QR specification walkthrough.
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+
+	got := reedSolomon(data, len(want))
+	if !bytes.Equal(got, want) {
+		t.Errorf("reedSolomon = %v, want %v", got, want)
+	}
+}
+
+func TestEncode_Version(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    int
+		version int
+		wantErr bool
+	}{
+		{name: "tiny fits version 1", size: 10, version: 1},
+		{name: "version 1 boundary", size: 17, version: 1},
+		{name: "spills to version 2", size: 18, version: 2},
+		{name: "version 7 with version info", size: 150, version: 7},
+		{name: "max capacity", size: MaxBytes, version: 10},
+		{name: "too large", size: MaxBytes + 1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := Encode(bytes.Repeat([]byte("a"), tt.size))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Encode: %v", err)
+			}
+			if code.Version != tt.version {
+				t.Errorf("Version = %d, want %d", code.Version, tt.version)
+			}
+			if code.Size != 17+4*tt.version {
+				t.Errorf("Size = %d, want %d", code.Size, 17+4*tt.version)
+			}
+		})
+	}
+}
+
+func TestEncode_RoundTrip(t *testing.T) {
+	payloads := []string{
+		"x",
+		"openclaw://pair?v=1&url=ws%3A%2F%2F192.168.1.20%3A18789%2Fws",
+		strings.Repeat("0123456789abcdef", 16),
+	}
+
+	for _, p := range payloads {
+		code, err := Encode([]byte(p))
+		if err != nil {
+			t.Fatalf("Encode(%d bytes): %v", len(p), err)
+		}
+		got := readBack(t, code)
+		if string(got) != p {
+			t.Errorf("version %d round trip = %q, want %q", code.Version, got, p)
+		}
+	}
+}
+
+func TestCode_String(t *testing.T) {
+	code, err := Encode([]byte("hello"))
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(code.String(), "\n"), "\n")
+	wantLines := (code.Size + 4 + 1) / 2
+	if len(lines) != wantLines {
+		t.Errorf("got %d lines, want %d", len(lines), wantLines)
+	}
+	for i, line := range lines {
+		if n := len([]rune(line)); n != code.Size+4 {
+			t.Errorf("line %d has %d columns, want %d", i, n, code.Size+4)
+		}
+	}
+}
+
+// The tables below are transcribed from the QR Code specification
+// (ISO/IEC 18004) rather than shared with the encoder, so readBack checks
+// Encode against the standard instead of against itself.
+
+// specFormatL is the 15-bit format information for level L and masks
+// 0–7, most significant bit first.
+var specFormatL = [8]string{
+	"111011111000100", "111001011110011", "111110110101010", "111100010011101",
+	"110011000101111", "110001100011000", "110110001000001", "110100101110110",
+}
+
+// specVersionInfo is the 18-bit version information for versions 7–10.
+var specVersionInfo = map[int]int{7: 0x07C94, 8: 0x085BC, 9: 0x09A99, 10: 0x0A4D3}
+
+// specAlignment lists the alignment pattern row/column centers.
+var specAlignment = map[int][]int{
+	2: {6, 18}, 3: {6, 22}, 4: {6, 26}, 5: {6, 30}, 6: {6, 34},
+	7: {6, 22, 38}, 8: {6, 24, 42}, 9: {6, 26, 46}, 10: {6, 28, 50},
+}
+
+// specBlocksL describes the level-L error correction blocks of each
+// version as groups of (count, total codewords, data codewords).
+var specBlocksL = map[int][][3]int{
+	1: {{1, 26, 19}}, 2: {{1, 44, 34}}, 3: {{1, 70, 55}}, 4: {{1, 100, 80}},
+	5: {{1, 134, 108}}, 6: {{2, 86, 68}}, 7: {{2, 98, 78}}, 8: {{2, 121, 97}},
+	9: {{2, 146, 116}}, 10: {{2, 86, 68}, {2, 87, 69}},
+}
+
+// readBack decodes a symbol produced by Encode: it checks the format and
+// version information, unmasks, walks the zigzag, de-interleaves, checks
+// each block's Reed-Solomon syndromes and parses the byte-mode segment.
+func readBack(t *testing.T, code *Code) []byte {
+	t.Helper()
+	ver, n := code.Version, code.Size
+	if n != 17+4*ver {
+		t.Fatalf("size %d does not match version %d", n, ver)
+	}
+	dark := func(row, col int) bool { return code.Modules[row][col] }
+
+	// Format information, both copies.
+	var first, second strings.Builder
+	for _, rc := range [][2]int{
+		{0, 8}, {1, 8}, {2, 8}, {3, 8}, {4, 8}, {5, 8}, {7, 8}, {8, 8},
+		{8, 7}, {8, 5}, {8, 4}, {8, 3}, {8, 2}, {8, 1}, {8, 0},
+	} {
+		first.WriteString(bitChar(dark(rc[0], rc[1])))
+	}
+	for i := range 15 {
+		if i < 8 {
+			second.WriteString(bitChar(dark(8, n-1-i)))
+		} else {
+			second.WriteString(bitChar(dark(n-15+i, 8)))
+		}
+	}
+	format := reverse(first.String())
+	if reverse(second.String()) != format {
+		t.Fatalf("format copies differ: %s and %s", reverse(first.String()), reverse(second.String()))
+	}
+	mask := -1
+	for m, f := range specFormatL {
+		if f == format {
+			mask = m
+		}
+	}
+	if mask < 0 {
+		t.Fatalf("format %s is not a level L format", format)
+	}
+	if !dark(n-8, 8) {
+		t.Error("dark module is light")
+	}
+
+	// Version information, both copies.
+	if ver >= 7 {
+		for i := range 18 {
+			want := specVersionInfo[ver]>>i&1 != 0
+			a, b := n-11+i%3, i/3
+			if dark(a, b) != want || dark(b, a) != want {
+				t.Fatalf("version information bit %d differs from the specification", i)
+			}
+		}
+	}
+
+	// Function modules: finders with separators and format areas, timing
+	// patterns, alignment patterns and version information.
+	reserved := make([][]bool, n)
+	for i := range reserved {
+		reserved[i] = make([]bool, n)
+	}
+	fill := func(row0, col0, rows, cols int) {
+		for r := row0; r < row0+rows; r++ {
+			for c := col0; c < col0+cols; c++ {
+				reserved[r][c] = true
+			}
+		}
+	}
+	fill(0, 0, 9, 9)
+	fill(0, n-8, 9, 8)
+	fill(n-8, 0, 8, 9)
+	centers := specAlignment[ver]
+	for _, r := range centers {
+		for _, c := range centers {
+			if !reserved[r][c] { // those overlapping a finder are left out
+				fill(r-2, c-2, 5, 5)
+			}
+		}
+	}
+	fill(6, 0, 1, n)
+	fill(0, 6, n, 1)
+	if ver >= 7 {
+		fill(0, n-11, 6, 3)
+		fill(n-11, 0, 3, 6)
+	}
+
+	// Data modules, two columns at a time from the right, alternately
+	// upwards and downwards, skipping the vertical timing pattern.
+	var bits []bool
+	upward := true
+	for col := n - 1; col > 0; col -= 2 {
+		if col == 6 {
+			col--
+		}
+		for k := range n {
+			row := k
+			if upward {
+				row = n - 1 - k
+			}
+			for _, c := range []int{col, col - 1} {
+				if reserved[row][c] {
+					continue
+				}
+				bits = append(bits, dark(row, c) != specMask(mask, row, c))
+			}
+		}
+		upward = !upward
+	}
+	raw := make([]byte, len(bits)/8)
+	for i := range raw {
+		for _, b := range bits[8*i : 8*i+8] {
+			raw[i] <<= 1
+			if b {
+				raw[i] |= 1
+			}
+		}
+	}
+
+	// De-interleave: data codewords column by column, then error
+	// correction codewords.
+	type block struct{ data, ec []byte }
+	var blocks []*block
+	ecLen, maxData, total := 0, 0, 0
+	for _, g := range specBlocksL[ver] {
+		for range g[0] {
+			blocks = append(blocks, &block{})
+			ecLen = g[1] - g[2]
+			maxData = max(maxData, g[2])
+			total += g[1]
+		}
+	}
+	if len(raw) < total {
+		t.Fatalf("read %d codewords, want %d", len(raw), total)
+	}
+	pos := 0
+	for k := range maxData {
+		for i, b := range blocks {
+			if k < dataLen(specBlocksL[ver], i) {
+				b.data = append(b.data, raw[pos])
+				pos++
+			}
+		}
+	}
+	for range ecLen {
+		for _, b := range blocks {
+			b.ec = append(b.ec, raw[pos])
+			pos++
+		}
+	}
+	var data []byte
+	for i, b := range blocks {
+		if !syndromesZero(append(slices.Clone(b.data), b.ec...), ecLen) {
+			t.Fatalf("block %d fails the Reed-Solomon check", i)
+		}
+		data = append(data, b.data...)
+	}
+
+	// Byte-mode segment.
+	off := 0
+	read := func(nbits int) int {
+		v := 0
+		for range nbits {
+			v = v<<1 | int(data[off/8]>>(7-off%8)&1)
+			off++
+		}
+		return v
+	}
+	if mode := read(4); mode != 0x4 {
+		t.Fatalf("mode = %x, want byte mode", mode)
+	}
+	countBits := 8
+	if ver >= 10 {
+		countBits = 16
+	}
+	out := make([]byte, read(countBits))
+	for k := range out {
+		out[k] = byte(read(8))
+	}
+	return out
+}
+
+func bitChar(dark bool) string {
+	if dark {
+		return "1"
+	}
+	return "0"
+}
+
+// reverse turns a least-significant-first bit string around.
+func reverse(s string) string {
+	b := []byte(s)
+	slices.Reverse(b)
+	return string(b)
+}
+
+// specMask reports whether mask pattern m inverts the module at row i,
+// column j.
+func specMask(m, i, j int) bool {
+	switch m {
+	case 0:
+		return (i+j)%2 == 0
+	case 1:
+		return i%2 == 0
+	case 2:
+		return j%3 == 0
+	case 3:
+		return (i+j)%3 == 0
+	case 4:
+		return (i/2+j/3)%2 == 0
+	case 5:
+		return (i*j)%2+(i*j)%3 == 0
+	case 6:
+		return ((i*j)%2+(i*j)%3)%2 == 0
+	default:
+		return ((i+j)%2+(i*j)%3)%2 == 0
+	}
+}
+
+// dataLen returns the data codeword count of block i.
+func dataLen(groups [][3]int, i int) int {
+	for _, g := range groups {
+		if i < g[0] {
+			return g[2]
+		}
+		i -= g[0]
+	}
+	return 0
+}
+
+// syndromesZero reports whether codeword, highest degree first, is a
+// multiple of the generator polynomial with ec roots α^0 … α^(ec-1).
+func syndromesZero(codeword []byte, ec int) bool {
+	mul := func(a, b byte) byte {
+		var p byte
+		for ; b != 0; b >>= 1 {
+			if b&1 != 0 {
+				p ^= a
+			}
+			carry := a&0x80 != 0
+			a <<= 1
+			if carry {
+				a ^= 0x1D // x^8 = x^4 + x^3 + x^2 + 1
+			}
+		}
+		return p
+	}
+	alpha := byte(1)
+	for range ec {
+		var s byte
+		for _, c := range codeword {
+			s = mul(s, alpha) ^ c
+		}
+		if s != 0 {
+			return false
+		}
+		alpha = mul(alpha, 2)
+	}
+	return true
+}